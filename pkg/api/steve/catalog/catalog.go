@@ -63,6 +63,9 @@ func addSchemas(server *steve.Server, ops *operation, index http.Handler) {
 	server.BaseSchemas.MustImportAndCustomize(types2.ChartInstallAction{}, nil)
 	server.BaseSchemas.MustImportAndCustomize(types2.ChartInstall{}, nil)
 	server.BaseSchemas.MustImportAndCustomize(types2.ChartActionOutput{}, nil)
+	server.BaseSchemas.MustImportAndCustomize(types2.ResourceChange{}, nil)
+	server.BaseSchemas.MustImportAndCustomize(types2.ChartDryRun{}, nil)
+	server.BaseSchemas.MustImportAndCustomize(types2.ChartDryRunOutput{}, nil)
 
 	operationTemplate := schema2.Template{
 		Group: catalog.GroupName,
@@ -1,6 +1,9 @@
 package catalog
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 
 	"github.com/rancher/apiserver/pkg/types"
@@ -11,6 +14,7 @@
 	"github.com/rancher/wrangler/pkg/schemas/validation"
 	"k8s.io/apimachinery/pkg/runtime"
 	schema2 "k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/apiserver/pkg/endpoints/request"
 )
 
@@ -47,7 +51,8 @@ func newOperation(
 // For example, if the api request is for installing a chart, then it will call the
 // install function of the Operation struct.
 //
-// All chart actions (install, upgrade, and uninstall) are served through this method.
+// All chart actions (install, upgrade, and uninstall) are served through this method. Install and upgrade
+// actions with dryRun set render the charts and respond with their manifests instead of creating an operation.
 func (o *operation) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	// Get the APIContext from the current request's context. This APIContext
 	// encapsulates the details of the API request, which will be used to
@@ -66,6 +71,20 @@ func (o *operation) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	)
 
 	ns, name := nsAndName(apiRequest)
+	switch apiRequest.Action {
+	case "install", "upgrade":
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			apiRequest.WriteError(err)
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if isDryRun(body) {
+			o.dryRun(apiRequest, user, ns, name, body)
+			return
+		}
+	}
+
 	switch apiRequest.Action {
 	case "install":
 		op, err = o.ops.Install(apiRequest.Context(), user, ns, name, req.Body, o.imageOverride)
@@ -99,6 +118,31 @@ func (o *operation) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	})
 }
 
+// isDryRun returns true if the body of an install or upgrade action requests a dry-run.
+func isDryRun(body []byte) bool {
+	action := struct {
+		DryRun bool `json:"dryRun"`
+	}{}
+	// a body that can not be decoded is rejected by the operation
+	_ = json.Unmarshal(body, &action)
+	return action.DryRun
+}
+
+// dryRun responds with the rendered manifests of the charts of an install or upgrade action and their changes to the
+// current releases. The user is checked the same way as for the action.
+func (o *operation) dryRun(apiRequest *types.APIRequest, user user.Info, ns, name string, body []byte) {
+	output, err := o.ops.DryRun(apiRequest.Context(), user, apiRequest.Action, ns, name, bytes.NewReader(body))
+	if err != nil {
+		apiRequest.WriteError(err)
+		return
+	}
+
+	apiRequest.WriteResponse(http.StatusOK, types.APIObject{
+		Type:   "chartDryRunOutput",
+		Object: output,
+	})
+}
+
 // OnAdd is registered as a callback of a Kubernetes Informer.
 // It is invoked when a new object is added to the Kubernetes cluster.
 // It purges old roles related to the object being added.
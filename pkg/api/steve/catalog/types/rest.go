@@ -13,6 +13,9 @@
   - ChartUpgradeAction: Describes the configuration for an upgrade action.
   - ChartUpgrade: Represents a Helm chart upgrade request.
   - ChartActionOutput: Represents the output after performing a Helm chart action.
+  - ChartDryRunOutput: Represents the output of a dry-run of an install or upgrade action.
+  - ChartDryRun: Contains the rendered manifests of a chart and their changes to its release.
+  - ResourceChange: Describes how a resource of a release changes.
 
 Each type includes fields that map directly to properties of Helm chart operations,
 allowing for a structured approach to managing Helm charts through the API.
@@ -40,6 +43,7 @@ type ChartInstallAction struct {
 	DisableOpenAPIValidation bool             `json:"disableOpenAPIValidation,omitempty"`
 	Namespace                string           `json:"namespace,omitempty"`
 	ProjectID                string           `json:"projectId,omitempty"`
+	DryRun                   bool             `json:"dryRun,omitempty"`
 
 	Charts []ChartInstall `json:"charts,omitempty"`
 }
@@ -71,6 +75,7 @@ type ChartUpgradeAction struct {
 	Install                  bool             `json:"install,omitempty"`
 	Namespace                string           `json:"namespace,omitempty"`
 	CleanupOnFail            bool             `json:"cleanupOnFail,omitempty"`
+	DryRun                   bool             `json:"dryRun,omitempty"`
 	Charts                   []ChartUpgrade   `json:"charts,omitempty"`
 }
 
@@ -89,3 +94,26 @@ type ChartActionOutput struct {
 	OperationName      string `json:"operationName,omitempty"`
 	OperationNamespace string `json:"operationNamespace,omitempty"`
 }
+
+type ChartDryRunOutput struct {
+	Charts []ChartDryRun `json:"charts,omitempty"`
+}
+
+type ChartDryRun struct {
+	ChartName        string           `json:"chartName,omitempty"`
+	Version          string           `json:"version,omitempty"`
+	ReleaseName      string           `json:"releaseName,omitempty"`
+	ReleaseNamespace string           `json:"releaseNamespace,omitempty"`
+	Manifest         string           `json:"manifest,omitempty"`
+	Notes            string           `json:"notes,omitempty"`
+	Changes          []ResourceChange `json:"changes,omitempty"`
+}
+
+type ResourceChange struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Change     string `json:"change,omitempty"`
+	Diff       string `json:"diff,omitempty"`
+}
@@ -15,6 +15,10 @@ func Register(server *steve.Server, clients *wrangler.Context) {
 		machines: clients.CAPI.Machine(),
 		secrets:  clients.Core.Secret(),
 	}
+	planHistory := &planHistory{
+		secrets:  clients.Core.Secret().Cache(),
+		machines: clients.CAPI.Machine().Cache(),
+	}
 
 	server.SchemaFactory.AddTemplate(schema2.Template{
 		Group: "cluster.x-k8s.io",
@@ -25,12 +29,16 @@ func Register(server *steve.Server, clients *wrangler.Context) {
 			}
 			schema.LinkHandlers["shell"] = sshClient
 			schema.LinkHandlers["sshkeys"] = sshClient
+			schema.LinkHandlers["planhistory"] = planHistory
 			schema.Formatter = func(request *types.APIRequest, resource *types.RawResource) {
-				if err := request.AccessControl.CanUpdate(request, types.APIObject{}, request.Schema); err != nil ||
-					resource.APIObject.Data().String("spec", "infrastructureRef", "apiVersion") != capr.RKEMachineAPIVersion {
+				canUpdate := request.AccessControl.CanUpdate(request, types.APIObject{}, request.Schema) == nil
+				if !canUpdate || resource.APIObject.Data().String("spec", "infrastructureRef", "apiVersion") != capr.RKEMachineAPIVersion {
 					delete(resource.Links, "shell")
 					delete(resource.Links, "sshkeys")
 				}
+				if !canUpdate || resource.APIObject.Data().String("spec", "bootstrap", "configRef", "kind") != "RKEBootstrap" {
+					delete(resource.Links, "planhistory")
+				}
 			}
 		},
 	})
@@ -0,0 +1,121 @@
+package machine
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/rancher/apiserver/pkg/apierror"
+	"github.com/rancher/apiserver/pkg/types"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/rancher/rancher/pkg/capr/planner"
+	capicontrollers "github.com/rancher/rancher/pkg/generated/controllers/cluster.x-k8s.io/v1beta1"
+	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/schemas/validation"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// planRevisionSummary is a revision of the plan history without the plan itself, as plans hold join tokens and other
+// secrets.
+type planRevisionSummary struct {
+	Revision  int               `json:"revision"`
+	Timestamp metav1.Time       `json:"timestamp"`
+	Checksum  string            `json:"checksum"`
+	Failed    bool              `json:"failed,omitempty"`
+	Output    map[string]string `json:"output,omitempty"`
+}
+
+type planHistory struct {
+	secrets  corecontrollers.SecretCache
+	machines capicontrollers.MachineCache
+}
+
+// ServeHTTP returns the plan history of a machine, or the difference between two of its revisions if the from and to
+// query parameters are set.
+func (p *planHistory) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	apiRequest := types.GetAPIContext(req.Context())
+	if err := apiRequest.AccessControl.CanUpdate(apiRequest, types.APIObject{}, apiRequest.Schema); err != nil {
+		apiRequest.WriteError(err)
+		return
+	}
+
+	result, err := p.history(apiRequest.Namespace, apiRequest.Name, req.URL.Query().Get("from"), req.URL.Query().Get("to"))
+	if err != nil {
+		apiRequest.WriteError(err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(rw).Encode(result)
+}
+
+func (p *planHistory) history(namespace, name, from, to string) (interface{}, error) {
+	machine, err := p.machines.Get(namespace, name)
+	if apierrors.IsNotFound(err) {
+		return nil, validation.NotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if machine.Spec.Bootstrap.ConfigRef == nil {
+		return nil, apierror.NewAPIError(validation.InvalidState, "machine has no bootstrap config")
+	}
+
+	var history []planner.PlanRevision
+	secret, err := p.secrets.Get(namespace, planner.PlanHistorySecretName(capr.PlanSecretFromBootstrapName(machine.Spec.Bootstrap.ConfigRef.Name)))
+	if err == nil {
+		if history, err = planner.DecodePlanHistory(secret); err != nil {
+			return nil, err
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if from == "" && to == "" {
+		summaries := make([]planRevisionSummary, 0, len(history))
+		for _, revision := range history {
+			summaries = append(summaries, summarizePlanRevision(revision))
+		}
+		return summaries, nil
+	}
+
+	fromRevision, err := findRevision(history, "from", from)
+	if err != nil {
+		return nil, err
+	}
+	toRevision, err := findRevision(history, "to", to)
+	if err != nil {
+		return nil, err
+	}
+	return planner.DiffPlanRevisions(fromRevision, toRevision), nil
+}
+
+func findRevision(history []planner.PlanRevision, param, value string) (planner.PlanRevision, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return planner.PlanRevision{}, apierror.NewAPIError(validation.InvalidFormat, fmt.Sprintf("invalid %s revision %q", param, value))
+	}
+	revision, ok := planner.FindPlanRevision(history, n)
+	if !ok {
+		return planner.PlanRevision{}, apierror.NewAPIError(validation.NotFound, fmt.Sprintf("revision %d is not in the plan history", n))
+	}
+	return revision, nil
+}
+
+func summarizePlanRevision(revision planner.PlanRevision) planRevisionSummary {
+	summary := planRevisionSummary{
+		Revision:  revision.Revision,
+		Timestamp: revision.Timestamp,
+		Checksum:  revision.Checksum,
+		Failed:    revision.Failed,
+	}
+	if len(revision.Output) > 0 {
+		summary.Output = map[string]string{}
+		for k, v := range revision.Output {
+			summary.Output[k] = string(v)
+		}
+	}
+	return summary
+}
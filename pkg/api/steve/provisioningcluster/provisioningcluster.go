@@ -0,0 +1,133 @@
+package provisioningcluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/rancher/apiserver/pkg/apierror"
+	"github.com/rancher/apiserver/pkg/types"
+	provv1 "github.com/rancher/rancher/pkg/apis/provisioning.cattle.io/v1"
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/capr/planner"
+	caprcontrollers "github.com/rancher/rancher/pkg/controllers/capr"
+	provcontrollers "github.com/rancher/rancher/pkg/generated/controllers/provisioning.cattle.io/v1"
+	rkecontrollers "github.com/rancher/rancher/pkg/generated/controllers/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/wrangler"
+	schema2 "github.com/rancher/steve/pkg/schema"
+	steve "github.com/rancher/steve/pkg/server"
+	"github.com/rancher/wrangler/pkg/schemas"
+	"github.com/rancher/wrangler/pkg/schemas/validation"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const previewPlanAction = "previewPlan"
+
+// Register adds the previewPlan action to provisioning clusters. The action renders the plans the planner would
+// deliver to the machines of a cluster if the cluster had the spec in the request body, or its current spec if the
+// body is empty, and returns how they differ from the current plans without delivering them.
+func Register(ctx context.Context, server *steve.Server, clients *wrangler.Context) {
+	preview := &planPreview{
+		clusters:      clients.Provisioning.Cluster().Cache(),
+		controlPlanes: clients.RKE.RKEControlPlane().Cache(),
+		planner:       planner.New(ctx, clients, caprcontrollers.PlannerInfoFunctions(clients)),
+	}
+
+	server.BaseSchemas.MustImportAndCustomize(planner.FileChange{}, nil)
+	server.BaseSchemas.MustImportAndCustomize(planner.InstructionChange{}, nil)
+	server.BaseSchemas.MustImportAndCustomize(planner.MachinePlanPreview{}, nil)
+	server.BaseSchemas.MustImportAndCustomize(PlanPreviewOutput{}, nil)
+	server.SchemaFactory.AddTemplate(schema2.Template{
+		Group: provv1.SchemeGroupVersion.Group,
+		Kind:  "Cluster",
+		Customize: func(schema *types.APISchema) {
+			if schema.ActionHandlers == nil {
+				schema.ActionHandlers = map[string]http.Handler{}
+			}
+			schema.ActionHandlers[previewPlanAction] = preview
+			if schema.ResourceActions == nil {
+				schema.ResourceActions = map[string]schemas.Action{}
+			}
+			schema.ResourceActions[previewPlanAction] = schemas.Action{
+				Output: "planPreviewOutput",
+			}
+		},
+	})
+}
+
+type planPreview struct {
+	clusters      provcontrollers.ClusterCache
+	controlPlanes rkecontrollers.RKEControlPlaneCache
+	planner       *planner.Planner
+}
+
+func (p *planPreview) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	apiRequest := types.GetAPIContext(req.Context())
+	// Previewing a spec is only allowed to the users who could apply it.
+	if err := apiRequest.AccessControl.CanDo(apiRequest, provv1.SchemeGroupVersion.Group+"/clusters", "update", apiRequest.Namespace, apiRequest.Name); err != nil {
+		apiRequest.WriteError(err)
+		return
+	}
+
+	machines, err := p.preview(apiRequest.Namespace, apiRequest.Name, req.Body)
+	if err != nil {
+		apiRequest.WriteError(err)
+		return
+	}
+	apiRequest.WriteResponse(http.StatusOK, types.APIObject{
+		Type: "planPreviewOutput",
+		Object: &PlanPreviewOutput{
+			Machines: machines,
+		},
+	})
+}
+
+func (p *planPreview) preview(namespace, name string, body io.Reader) ([]planner.MachinePlanPreview, error) {
+	cluster, err := p.clusters.Get(namespace, name)
+	if apierrors.IsNotFound(err) {
+		return nil, validation.NotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	spec := cluster.Spec.DeepCopy()
+	if body != nil {
+		var proposed provv1.ClusterSpec
+		if err := json.NewDecoder(body).Decode(&proposed); err == nil {
+			spec = &proposed
+		} else if !errors.Is(err, io.EOF) {
+			return nil, apierror.NewAPIError(validation.InvalidBodyContent, fmt.Sprintf("failed to parse cluster spec: %v", err))
+		}
+	}
+	if spec.RKEConfig == nil {
+		return nil, apierror.NewAPIError(validation.InvalidAction, "plans are only rendered for clusters with an RKE config")
+	}
+
+	controlPlane, err := p.controlPlanes.Get(namespace, name)
+	if apierrors.IsNotFound(err) {
+		return nil, apierror.NewAPIError(validation.InvalidState, "cluster has not been provisioned yet")
+	} else if err != nil {
+		return nil, err
+	}
+
+	machines, err := p.planner.Preview(proposedControlPlane(controlPlane, spec))
+	if err != nil {
+		return nil, apierror.NewAPIError(validation.ServerError, err.Error())
+	}
+	return machines, nil
+}
+
+// proposedControlPlane returns a copy of controlPlane with the fields the provisioning cluster controller sets from
+// the cluster spec replaced by the ones of spec.
+func proposedControlPlane(controlPlane *rkev1.RKEControlPlane, spec *provv1.ClusterSpec) *rkev1.RKEControlPlane {
+	controlPlane = controlPlane.DeepCopy()
+	rkeConfig := spec.RKEConfig.DeepCopy()
+	controlPlane.Spec.RKEClusterSpecCommon = rkeConfig.RKEClusterSpecCommon
+	controlPlane.Spec.LocalClusterAuthEndpoint = *spec.LocalClusterAuthEndpoint.DeepCopy()
+	controlPlane.Spec.KubernetesVersion = spec.KubernetesVersion
+	controlPlane.Spec.AgentEnvVars = spec.AgentEnvVars
+	return controlPlane
+}
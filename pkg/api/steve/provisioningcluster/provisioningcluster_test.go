@@ -0,0 +1,46 @@
+package provisioningcluster
+
+import (
+	"testing"
+
+	provv1 "github.com/rancher/rancher/pkg/apis/provisioning.cattle.io/v1"
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProposedControlPlane(t *testing.T) {
+	controlPlane := &rkev1.RKEControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "c-1", Namespace: "fleet-default"},
+		Spec: rkev1.RKEControlPlaneSpec{
+			RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
+				AdditionalManifest: "current",
+			},
+			KubernetesVersion:     "v1.26.8+rke2r1",
+			ManagementClusterName: "c-m-abc",
+			ClusterName:           "c-1",
+		},
+	}
+	spec := &provv1.ClusterSpec{
+		KubernetesVersion: "v1.27.5+rke2r1",
+		RKEConfig: &provv1.RKEConfig{
+			RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
+				AdditionalManifest: "proposed",
+				UpgradeStrategy: rkev1.ClusterUpgradeStrategy{
+					WorkerDrainOptions: rkev1.DrainOptions{Enabled: true},
+				},
+			},
+		},
+		LocalClusterAuthEndpoint: rkev1.LocalClusterAuthEndpoint{Enabled: true},
+		AgentEnvVars:             []rkev1.EnvVar{{Name: "HTTP_PROXY", Value: "proxy"}},
+	}
+
+	proposed := proposedControlPlane(controlPlane, spec)
+	assert.Equal(t, "proposed", proposed.Spec.AdditionalManifest)
+	assert.True(t, proposed.Spec.UpgradeStrategy.WorkerDrainOptions.Enabled)
+	assert.Equal(t, "v1.27.5+rke2r1", proposed.Spec.KubernetesVersion)
+	assert.True(t, proposed.Spec.LocalClusterAuthEndpoint.Enabled)
+	assert.Equal(t, spec.AgentEnvVars, proposed.Spec.AgentEnvVars)
+	assert.Equal(t, "c-m-abc", proposed.Spec.ManagementClusterName, "fields not set from the cluster spec are kept")
+	assert.Equal(t, "current", controlPlane.Spec.AdditionalManifest, "the control plane is not modified")
+}
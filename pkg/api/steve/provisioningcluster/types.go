@@ -0,0 +1,7 @@
+package provisioningcluster
+
+import "github.com/rancher/rancher/pkg/capr/planner"
+
+type PlanPreviewOutput struct {
+	Machines []planner.MachinePlanPreview `json:"machines,omitempty"`
+}
@@ -24,7 +24,8 @@ type SecretReference struct {
 }
 
 type RepoSpec struct {
-	// URL A http URL of the repo to connect to
+	// URL A http URL of the repo to connect to, or an oci:// URL of a chart repository in an OCI registry, for
+	// example oci://ghcr.io/org/charts/mychart. The semver tags of an OCI repository are the versions of its chart.
 	URL string `json:"url,omitempty"`
 
 	// GitRepo a git repo to clone and index as the helm repo
@@ -41,7 +42,7 @@ type RepoSpec struct {
 	InsecureSkipTLSverify bool `json:"insecureSkipTLSVerify,omitempty"`
 
 	// ClientSecretName is the client secret to be used to connect to the repo
-	// It is expected the secret be of type "kubernetes.io/basic-auth" or "kubernetes.io/tls" for Helm repos
+	// It is expected the secret be of type "kubernetes.io/basic-auth" or "kubernetes.io/tls" for Helm and OCI repos
 	// and "kubernetes.io/basic-auth" or "kubernetes.io/ssh-auth" for git repos.
 	// For a repo the Namespace file will be ignored
 	ClientSecret *SecretReference `json:"clientSecret,omitempty"`
@@ -53,6 +54,16 @@ type RepoSpec struct {
 	// If ForceUpdate is greater than time.Now() it will not trigger an update
 	ForceUpdate *metav1.Time `json:"forceUpdate,omitempty"`
 
+	// RefreshInterval is how long after the last download the repo index is downloaded again, for example "15m".
+	// Defaults to one hour. Intervals shorter than five minutes are raised to five minutes, which the RefreshScheduled
+	// condition then reports.
+	RefreshInterval string `json:"refreshInterval,omitempty"`
+
+	// RefreshSchedule is a cron schedule, in the standard five field format, on which the repo index is downloaded
+	// instead of the refresh interval, for example "0 */6 * * *". If the schedule or the interval is invalid, the
+	// RefreshScheduled condition is false and the repo index is downloaded again after an hour.
+	RefreshSchedule string `json:"refreshSchedule,omitempty"`
+
 	// ServiceAccount this service account will be used to deploy charts instead of the end users credentials
 	ServiceAccount string `json:"serviceAccount,omitempty"`
 
@@ -65,6 +76,20 @@ type RepoSpec struct {
 
 	// DisableSameOriginCheck attaches the Basic Auth Header to all helm client API calls, regardless of whether the destination of the API call matches the origin of the repository's URL
 	DisableSameOriginCheck bool `json:"disableSameOriginCheck,omitempty"`
+
+	// Verification verifies the provenance files of the charts of the repo against a keyring
+	Verification *ChartVerification `json:"verification,omitempty"`
+}
+
+// ChartVerification configures the verification of the provenance files signing the charts of a repo
+type ChartVerification struct {
+	// KeyringSecret is the secret holding the public keyring the charts are signed with, as exported by
+	// gpg --export, in its "keyring" key. For a Repo the Namespace field will be ignored
+	KeyringSecret *SecretReference `json:"keyringSecret,omitempty"`
+
+	// Required rejects installs and upgrades of chart versions that do not have a provenance file signed by a key of
+	// the keyring
+	Required bool `json:"required,omitempty"`
 }
 
 type RepoCondition string
@@ -72,6 +97,10 @@ type RepoSpec struct {
 const (
 	RepoDownloaded         RepoCondition = "Downloaded"
 	FollowerRepoDownloaded RepoCondition = "FollowerDownloaded"
+	// RepoRefreshScheduled is false if the RefreshSchedule or RefreshInterval of the repo is invalid, the index is then
+	// downloaded again after the default interval until it is fixed. Its message reports a RefreshInterval raised to the
+	// minimum interval.
+	RepoRefreshScheduled RepoCondition = "RefreshScheduled"
 )
 
 type RepoStatus struct {
@@ -94,9 +123,39 @@ type RepoStatus struct {
 	// The git commit used to generate the index
 	Commit string `json:"commit,omitempty"`
 
+	// IndexHistory the changes of the chart versions of the index by download, the most recent last
+	IndexHistory []IndexRevision `json:"indexHistory,omitempty"`
+
 	Conditions []genericcondition.GenericCondition `json:"conditions,omitempty"`
 }
 
+// IndexRevision the chart versions that changed when the index of a repo was downloaded
+type IndexRevision struct {
+	// Time the index was downloaded
+	Time metav1.Time `json:"time"`
+
+	// Commit the git commit the index was generated from
+	Commit string `json:"commit,omitempty"`
+
+	// Added the chart versions that were not in the previous index
+	Added []IndexChartVersion `json:"added,omitempty"`
+
+	// Removed the chart versions that are no longer in the index
+	Removed []IndexChartVersion `json:"removed,omitempty"`
+
+	// Changed the chart versions of the previous index whose digest or URLs changed
+	Changed []IndexChartVersion `json:"changed,omitempty"`
+
+	// Truncated is true if not all the chart versions that changed are listed
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// IndexChartVersion a version of a chart in the index of a repo
+type IndexChartVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
 // +genclient
 // +kubebuilder:skipversion
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
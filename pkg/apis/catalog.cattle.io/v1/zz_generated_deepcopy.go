@@ -109,6 +109,27 @@ func (in *Chart) DeepCopy() *Chart {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChartVerification) DeepCopyInto(out *ChartVerification) {
+	*out = *in
+	if in.KeyringSecret != nil {
+		in, out := &in.KeyringSecret, &out.KeyringSecret
+		*out = new(SecretReference)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChartVerification.
+func (in *ChartVerification) DeepCopy() *ChartVerification {
+	if in == nil {
+		return nil
+	}
+	out := new(ChartVerification)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterRepo) DeepCopyInto(out *ClusterRepo) {
 	*out = *in
@@ -170,6 +191,54 @@ func (in *ClusterRepoList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IndexChartVersion) DeepCopyInto(out *IndexChartVersion) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IndexChartVersion.
+func (in *IndexChartVersion) DeepCopy() *IndexChartVersion {
+	if in == nil {
+		return nil
+	}
+	out := new(IndexChartVersion)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IndexRevision) DeepCopyInto(out *IndexRevision) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.Added != nil {
+		in, out := &in.Added, &out.Added
+		*out = make([]IndexChartVersion, len(*in))
+		copy(*out, *in)
+	}
+	if in.Removed != nil {
+		in, out := &in.Removed, &out.Removed
+		*out = make([]IndexChartVersion, len(*in))
+		copy(*out, *in)
+	}
+	if in.Changed != nil {
+		in, out := &in.Changed, &out.Changed
+		*out = make([]IndexChartVersion, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IndexRevision.
+func (in *IndexRevision) DeepCopy() *IndexRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(IndexRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Info) DeepCopyInto(out *Info) {
 	*out = *in
@@ -425,6 +494,11 @@ func (in *RepoSpec) DeepCopyInto(out *RepoSpec) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.Verification != nil {
+		in, out := &in.Verification, &out.Verification
+		*out = new(ChartVerification)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -442,6 +516,13 @@ func (in *RepoSpec) DeepCopy() *RepoSpec {
 func (in *RepoStatus) DeepCopyInto(out *RepoStatus) {
 	*out = *in
 	in.DownloadTime.DeepCopyInto(&out.DownloadTime)
+	if in.IndexHistory != nil {
+		in, out := &in.IndexHistory, &out.IndexHistory
+		*out = make([]IndexRevision, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]genericcondition.GenericCondition, len(*in))
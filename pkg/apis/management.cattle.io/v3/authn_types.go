@@ -38,12 +38,29 @@ type Token struct {
 	Current         bool              `json:"current"`
 	ClusterName     string            `json:"clusterName,omitempty" norman:"noupdate,type=reference[cluster]"`
 	Enabled         *bool             `json:"enabled,omitempty" norman:"default=true"`
+	Scope           *TokenScope       `json:"scope,omitempty" norman:"noupdate"`
+	LastUsedAt      *metav1.Time      `json:"lastUsedAt,omitempty" norman:"nocreate,noupdate"`
+	LastUsedFrom    string            `json:"lastUsedFrom,omitempty" norman:"nocreate,noupdate"`
 }
 
 func (t *Token) ObjClusterName() string {
 	return t.ClusterName
 }
 
+// TokenScope restricts what a token can be used for on top of the RBAC of its user.
+// An empty list places no restriction on that attribute, "*" matches any value.
+type TokenScope struct {
+	// Clusters the token can be used for. Requests to the management API, which are not made to a cluster, count as
+	// requests to the local cluster.
+	Clusters []string `json:"clusters,omitempty" norman:"type=array[reference[cluster]]"`
+	// Verbs are Kubernetes verbs, e.g. get, list, watch, create, update, patch or delete.
+	Verbs []string `json:"verbs,omitempty"`
+	// APIGroups of the resources the token can be used for, "" being the core group.
+	APIGroups []string `json:"apiGroups,omitempty"`
+	// Resources are the plural resource names the token can be used for.
+	Resources []string `json:"resources,omitempty"`
+}
+
 // +genclient
 // +kubebuilder:skipversion
 // +genclient:nonNamespaced
@@ -53,16 +70,18 @@ type User struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	DisplayName        string     `json:"displayName,omitempty"`
-	Description        string     `json:"description"`
-	Username           string     `json:"username,omitempty"`
-	Password           string     `json:"password,omitempty" norman:"writeOnly,noupdate"`
-	MustChangePassword bool       `json:"mustChangePassword,omitempty"`
-	PrincipalIDs       []string   `json:"principalIds,omitempty" norman:"type=array[reference[principal]]"`
-	Me                 bool       `json:"me,omitempty" norman:"nocreate,noupdate"`
-	Enabled            *bool      `json:"enabled,omitempty" norman:"default=true"`
-	Spec               UserSpec   `json:"spec,omitempty"`
-	Status             UserStatus `json:"status"`
+	DisplayName        string       `json:"displayName,omitempty"`
+	Description        string       `json:"description"`
+	Username           string       `json:"username,omitempty"`
+	Password           string       `json:"password,omitempty" norman:"writeOnly,noupdate"`
+	MustChangePassword bool         `json:"mustChangePassword,omitempty"`
+	PasswordChangedAt  *metav1.Time `json:"passwordChangedAt,omitempty" norman:"nocreate,noupdate"`
+	PasswordHistory    []string     `json:"passwordHistory,omitempty" norman:"writeOnly,nocreate,noupdate"`
+	PrincipalIDs       []string     `json:"principalIds,omitempty" norman:"type=array[reference[principal]]"`
+	Me                 bool         `json:"me,omitempty" norman:"nocreate,noupdate"`
+	Enabled            *bool        `json:"enabled,omitempty" norman:"default=true"`
+	Spec               UserSpec     `json:"spec,omitempty"`
+	Status             UserStatus   `json:"status"`
 }
 
 // IsSystem returns true if the user is a system user.
@@ -185,6 +204,19 @@ type SetPasswordInput struct {
 	NewPassword string `json:"newPassword" norman:"type=string,required"`
 }
 
+// MFACodeInput holds a TOTP code or a recovery code of a user enrolled in multi-factor authentication.
+type MFACodeInput struct {
+	Code string `json:"code" norman:"type=string,required"`
+}
+
+// MFAEnrollment is returned when a user starts enrolling in TOTP multi-factor authentication. The enrollment is only
+// active once a code generated from the secret has been confirmed.
+type MFAEnrollment struct {
+	Secret          string   `json:"secret"`
+	ProvisioningURI string   `json:"provisioningUri"`
+	RecoveryCodes   []string `json:"recoveryCodes"`
+}
+
 // +genclient
 // +kubebuilder:skipversion
 // +genclient:nonNamespaced
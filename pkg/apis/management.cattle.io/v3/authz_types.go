@@ -103,6 +103,10 @@ type GlobalRoleBinding struct {
 	UserName           string `json:"userName,omitempty" norman:"noupdate,type=reference[user]"`
 	GroupPrincipalName string `json:"groupPrincipalName,omitempty" norman:"noupdate,type=reference[principal]"`
 	GlobalRoleName     string `json:"globalRoleName,omitempty" norman:"required,noupdate,type=reference[globalRole]"`
+	// ExpiresAt is the time after which the binding is removed, it never expires if unset. Immutable, an expiration
+	// can't be extended or removed once it is set.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty" norman:"noupdate"`
 }
 
 // +genclient
@@ -248,6 +252,11 @@ type ProjectRoleTemplateBinding struct {
 	// ServiceAccount is the name of the service account bound as a subject. Immutable.
 	// +optional
 	ServiceAccount string `json:"serviceAccount,omitempty" norman:"nocreate,noupdate"`
+
+	// ExpiresAt is the time after which the binding is removed, it never expires if unset. Immutable, an expiration
+	// can't be extended or removed once it is set.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty" norman:"noupdate"`
 }
 
 func (p *ProjectRoleTemplateBinding) ObjClusterName() string {
@@ -272,6 +281,10 @@ type ClusterRoleTemplateBinding struct {
 	GroupPrincipalName string `json:"groupPrincipalName,omitempty" norman:"noupdate,type=reference[principal]"`
 	ClusterName        string `json:"clusterName,omitempty" norman:"required,noupdate,type=reference[cluster]"`
 	RoleTemplateName   string `json:"roleTemplateName,omitempty" norman:"required,noupdate,type=reference[roleTemplate]"`
+	// ExpiresAt is the time after which the binding is removed, it never expires if unset. Immutable, an expiration
+	// can't be extended or removed once it is set.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty" norman:"noupdate"`
 }
 
 func (c *ClusterRoleTemplateBinding) ObjClusterName() string {
@@ -4,3 +4,30 @@ type RotateCertificates struct {
 	Generation int64    `json:"generation,omitempty"`
 	Services   []string `json:"services,omitempty"`
 }
+
+type CertificateAutoRotation struct {
+	// ExpiringInDays rotates the certificates of all the services when a certificate of a node expires within this
+	// number of days. Rotations only start while the maintenance window of the upgrade strategy is open. Defaults to
+	// 30.
+	// +optional
+	ExpiringInDays int `json:"expiringInDays,omitempty"`
+}
+
+// CertificateExpiration is the certificate of a machine that expires first.
+type CertificateExpiration struct {
+	MachineName string `json:"machineName"`
+	// Certificate is the path of the certificate relative to the data directory of the distribution.
+	Certificate string `json:"certificate,omitempty"`
+	// ExpirationDate is RFC3339 formatted.
+	ExpirationDate string `json:"expirationDate,omitempty"`
+}
+
+type CertificateAutoRotationStatus struct {
+	// Generation is incremented when an automatic rotation of the certificates is triggered.
+	Generation int64 `json:"generation,omitempty"`
+	// AppliedGeneration is the generation of the last completed automatic rotation.
+	AppliedGeneration int64 `json:"appliedGeneration,omitempty"`
+	// AppliedTime is when the last automatic rotation completed, RFC3339 formatted. Certificate expirations collected
+	// before it do not trigger another rotation.
+	AppliedTime string `json:"appliedTime,omitempty"`
+}
@@ -31,6 +31,15 @@ type RKEClusterSpecCommon struct {
 	AdditionalManifest    string                 `json:"additionalManifest,omitempty"`
 	Registries            *Registry              `json:"registries,omitempty"`
 	ETCD                  *ETCD                  `json:"etcd,omitempty"`
+	// CertificateAutoRotation collects the expiration of the certificates of the nodes and rotates them automatically
+	// before they expire. It requires openssl on the nodes.
+	// +optional
+	CertificateAutoRotation *CertificateAutoRotation `json:"certificateAutoRotation,omitempty"`
+	// EncryptionKeyRotationSchedule rotates the secrets encryption keys of the cluster periodically. It requires secrets
+	// encryption to be enabled. Once a scheduled rotation failed, rotations are no longer scheduled until the keys are
+	// rotated successfully with RotateEncryptionKeys.
+	// +optional
+	EncryptionKeyRotationSchedule *EncryptionKeyRotationSchedule `json:"encryptionKeyRotationSchedule,omitempty"`
 	// Increment to force all nodes to re-provision
 	ProvisionGeneration int `json:"provisionGeneration,omitempty"`
 }
@@ -65,6 +74,64 @@ type ClusterUpgradeStrategy struct {
 	// How many workers should be upgraded at a time
 	WorkerConcurrency  string       `json:"workerConcurrency,omitempty"`
 	WorkerDrainOptions DrainOptions `json:"workerDrainOptions,omitempty"`
+
+	// MaintenanceWindow restricts disruptive node plan changes, such as restarts, drains and version upgrades, to
+	// recurring windows. If unset, changes are rolled out as soon as they are made.
+	// +optional
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+
+	// WorkerCanary upgrades a subset of the worker nodes first and only continues with the other worker nodes once
+	// health gates pass on them. If unset, all worker nodes are upgraded in batches of WorkerConcurrency.
+	// +optional
+	WorkerCanary *CanaryStrategy `json:"workerCanary,omitempty"`
+}
+
+type CanaryStrategy struct {
+	// MachineSelector selects the worker machines that are upgraded first.
+	MachineSelector *metav1.LabelSelector `json:"machineSelector,omitempty"`
+	// PodsReady requires the pods running on the canary nodes to be ready, in addition to the nodes being ready and
+	// the probes of their plans being healthy.
+	// +optional
+	PodsReady bool `json:"podsReady,omitempty"`
+	// Probes are additional HTTP probes run by the system-agent on the canary nodes. They must be healthy for the
+	// health gates to pass.
+	// +optional
+	Probes map[string]CanaryProbe `json:"probes,omitempty"`
+	// HealthyDuration is how long the health gates must pass before the other worker nodes are upgraded, for example
+	// "5m". Defaults to 0.
+	// +optional
+	HealthyDuration string `json:"healthyDuration,omitempty"`
+	// Timeout is how long the health gates may fail after the canary nodes were upgraded before the rollout is halted,
+	// for example "30m". Defaults to 10m.
+	// +optional
+	Timeout string `json:"timeout,omitempty"`
+}
+
+type CanaryProbe struct {
+	// URL is the URL that is requested from the node, for example "http://127.0.0.1:8080/healthz".
+	URL string `json:"url"`
+	// Insecure skips the verification of the certificate of the server.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+	// CACert is the path on the node of the CA certificate used to verify the certificate of the server.
+	// +optional
+	CACert string `json:"caCert,omitempty"`
+	// +optional
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// +optional
+	SuccessThreshold int `json:"successThreshold,omitempty"`
+	// +optional
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+}
+
+type MaintenanceWindow struct {
+	// Schedules are standard cron expressions, for example "0 2 * * 6", at which a maintenance window opens.
+	Schedules []string `json:"schedules,omitempty"`
+	// Duration is how long a window stays open after it opens, for example "4h".
+	Duration string `json:"duration,omitempty"`
+	// TimeZone is the IANA time zone the schedules are evaluated in, defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
 }
 
 type DrainOptions struct {
@@ -52,4 +52,25 @@ type RKEControlPlaneStatus struct {
 	ConfigGeneration              int64                               `json:"configGeneration,omitempty"`
 	Initialized                   bool                                `json:"initialized,omitempty"`
 	AgentConnected                bool                                `json:"agentConnected,omitempty"`
+	WorkerCanary                  *WorkerCanaryStatus                 `json:"workerCanary,omitempty"`
+	// CertificateExpiration lists the certificate expiring first on each machine, if certificate auto rotation is
+	// enabled.
+	CertificateExpiration   []CertificateExpiration        `json:"certificateExpiration,omitempty"`
+	CertificateAutoRotation *CertificateAutoRotationStatus `json:"certificateAutoRotation,omitempty"`
+	// EncryptionKeyRotationScheduledGeneration is incremented when a scheduled encryption key rotation is triggered.
+	EncryptionKeyRotationScheduledGeneration int64 `json:"encryptionKeyRotationScheduledGeneration,omitempty"`
+	// EncryptionKeyRotationHistory lists the most recent encryption key rotations, oldest first.
+	EncryptionKeyRotationHistory []EncryptionKeyRotationRecord `json:"encryptionKeyRotationHistory,omitempty"`
+}
+
+// WorkerCanaryStatus is the state of the health gates of the canary worker nodes.
+type WorkerCanaryStatus struct {
+	// Revision identifies the plans of the canary machines the health gates are evaluated for.
+	Revision string `json:"revision,omitempty"`
+	// StartTime is when the plans of Revision were first seen applied on all canary machines.
+	StartTime string `json:"startTime,omitempty"`
+	// HealthyTime is when the health gates started passing, it is empty while they fail.
+	HealthyTime string `json:"healthyTime,omitempty"`
+	// Halted is true if the health gates failed for longer than the timeout of the canary strategy.
+	Halted bool `json:"halted,omitempty"`
 }
@@ -16,3 +16,24 @@
 type RotateEncryptionKeys struct {
 	Generation int64 `json:"generation,omitempty"`
 }
+
+type EncryptionKeyRotationSchedule struct {
+	// IntervalDays rotates the secrets encryption keys when this number of days passed since the last rotation
+	// started, or since the cluster was created if the keys were never rotated. Rotations only start while the
+	// maintenance window of the upgrade strategy is open. Defaults to 90.
+	// +optional
+	IntervalDays int `json:"intervalDays,omitempty"`
+}
+
+// EncryptionKeyRotationRecord is an encryption key rotation of the cluster.
+type EncryptionKeyRotationRecord struct {
+	Generation int64 `json:"generation,omitempty"`
+	// StartTime is RFC3339 formatted, it is empty if the rotation failed before it started.
+	StartTime string `json:"startTime,omitempty"`
+	// FinishTime is RFC3339 formatted, it is empty while the rotation is in progress.
+	FinishTime string `json:"finishTime,omitempty"`
+	// Leader is the machine the secrets-encrypt commands were run on.
+	Leader string `json:"leader,omitempty"`
+	// Phase is Done or Failed once the rotation finished, it is empty while the rotation is in progress.
+	Phase RotateEncryptionKeysPhase `json:"phase,omitempty"`
+}
@@ -11,9 +11,15 @@
 	ETCDSnapshotPhasePostRestorePodCleanup  ETCDSnapshotPhase = "PostRestorePodCleanup"
 	ETCDSnapshotPhaseInitialRestartCluster  ETCDSnapshotPhase = "InitialRestartCluster"
 	ETCDSnapshotPhasePostRestoreNodeCleanup ETCDSnapshotPhase = "PostRestoreNodeCleanup"
-	ETCDSnapshotPhaseRestartCluster         ETCDSnapshotPhase = "RestartCluster"
-	ETCDSnapshotPhaseFinished               ETCDSnapshotPhase = "Finished"
-	ETCDSnapshotPhaseFailed                 ETCDSnapshotPhase = "Failed"
+	// ETCDSnapshotPhasePostRestoreRotateCA replaces the certificate authorities and the service account signing key
+	// restored from the snapshot of another cluster.
+	ETCDSnapshotPhasePostRestoreRotateCA ETCDSnapshotPhase = "PostRestoreRotateCA"
+	// ETCDSnapshotPhasePostRestoreRotateServerToken replaces the server token of the cluster that produced a snapshot
+	// restored into another cluster.
+	ETCDSnapshotPhasePostRestoreRotateServerToken ETCDSnapshotPhase = "PostRestoreRotateServerToken"
+	ETCDSnapshotPhaseRestartCluster               ETCDSnapshotPhase = "RestartCluster"
+	ETCDSnapshotPhaseFinished                     ETCDSnapshotPhase = "Finished"
+	ETCDSnapshotPhaseFailed                       ETCDSnapshotPhase = "Failed"
 )
 
 type ETCDSnapshotS3 struct {
@@ -24,6 +30,63 @@ type ETCDSnapshotS3 struct {
 	Region              string `json:"region,omitempty"`
 	CloudCredentialName string `json:"cloudCredentialName,omitempty"`
 	Folder              string `json:"folder,omitempty"`
+
+	// Encryption encrypts snapshots on the etcd nodes before they are uploaded to S3. Encrypted snapshots are
+	// uploaded by the system-agent rather than by the distribution, which requires openssl and curl 7.75 or later on
+	// the etcd nodes.
+	// +optional
+	Encryption *ETCDSnapshotEncryption `json:"encryption,omitempty"`
+}
+
+type ETCDSnapshotEncryption struct {
+	// KeySecretName is the name of a secret in the namespace of the cluster holding the encryption keys, each key of
+	// the secret is a key version.
+	KeySecretName string `json:"keySecretName,omitempty"`
+	// KeyVersion is the key of the secret new snapshots are encrypted with. Keys are rotated by adding a new key to the
+	// secret and setting its version here, previous versions must be kept to restore the snapshots encrypted with
+	// them. On snapshots, it is the version the snapshot was encrypted with.
+	KeyVersion string `json:"keyVersion,omitempty"`
+}
+
+type ETCDSnapshotS3Target struct {
+	// Name identifies the target, it must be unique among the S3 targets of the cluster.
+	Name string `json:"name"`
+	// SnapshotRetention is the number of the newest snapshots kept in the target, counting the snapshots of all etcd
+	// nodes. Older objects in the folder of the target, including the snapshots of removed nodes, are deleted, so the
+	// folder must only be used by the cluster. Defaults to the snapshot retention of the cluster. It is ignored if the
+	// cluster has a snapshot retention policy, which applies to the target instead.
+	// +optional
+	SnapshotRetention int `json:"snapshotRetention,omitempty"`
+
+	ETCDSnapshotS3 `json:",inline"`
+}
+
+type ETCDSnapshotVerification struct {
+	// IntervalSeconds is the interval the local snapshots of the etcd nodes are verified at. Defaults to 3600.
+	// +optional
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+	// TestRestoreMachineName is the name of the etcd machine of the cluster the local snapshots are test restored on,
+	// by restoring them into a throwaway etcd process. RKE2 machines use the etcd image of their etcd static pod, other
+	// machines require the etcd and etcdutl binaries on the node, otherwise the verification is Unsupported. If empty,
+	// snapshots are only checksummed.
+	// +optional
+	TestRestoreMachineName string `json:"testRestoreMachineName,omitempty"`
+}
+
+type ETCDSnapshotRetentionPolicy struct {
+	// Hourly is the number of most recent hours the newest snapshot of is kept.
+	// +optional
+	Hourly int `json:"hourly,omitempty"`
+	// Daily is the number of most recent days the newest snapshot of is kept.
+	// +optional
+	Daily int `json:"daily,omitempty"`
+	// Weekly is the number of most recent weeks the newest snapshot of is kept.
+	// +optional
+	Weekly int `json:"weekly,omitempty"`
+	// MaxAgeHours is the age snapshots are deleted after, even if they are kept by a tier. If no tier is set, the
+	// snapshots younger than it are kept.
+	// +optional
+	MaxAgeHours int `json:"maxAgeHours,omitempty"`
 }
 
 type ETCDSnapshotCreate struct {
@@ -39,6 +102,18 @@ type ETCDSnapshotRestore struct {
 	Generation int `json:"generation,omitempty"`
 	// Set to either none (or empty string), all, or kubernetesVersion
 	RestoreRKEConfig string `json:"restoreRKEConfig,omitempty"`
+
+	// S3Target is the name of the S3 target of the cluster to download the snapshot from. If empty, the snapshot is
+	// restored from the node or the S3 bucket it was taken to.
+	S3Target string `json:"s3Target,omitempty"`
+
+	// ServerTokenSecretName is the name of a secret in the namespace of the cluster holding the server token of the
+	// cluster that produced the snapshot under the serverToken key. It is required to restore the snapshot of another
+	// cluster into a new cluster, and the user who created the cluster must be allowed to get the secret. The datastore
+	// of the snapshot is encrypted with the server token, so it must be known to restore the snapshot. Once restored,
+	// the certificate authorities, the service account signing key and the server token are replaced, so that the new
+	// cluster shares no credentials with the cluster that produced the snapshot.
+	ServerTokenSecretName string `json:"serverTokenSecretName,omitempty"`
 }
 
 // +genclient
@@ -71,6 +146,50 @@ type ETCDSnapshotFile struct {
 
 type ETCDSnapshotStatus struct {
 	Missing bool `json:"missing"`
+	// S3Targets lists the S3 targets of the cluster a local snapshot was uploaded to. The snapshot object is kept
+	// while the snapshot is in a target, even if it is missing on its node.
+	S3Targets []ETCDSnapshotS3TargetStatus `json:"s3Targets,omitempty"`
+	// Verification is the result of the last verification of a local snapshot.
+	Verification *ETCDSnapshotVerificationStatus `json:"verification,omitempty"`
+	// Retention is the result of the last evaluation of the retention policy of the cluster for the snapshot.
+	Retention *ETCDSnapshotRetentionStatus `json:"retention,omitempty"`
+}
+
+type ETCDSnapshotS3TargetStatus struct {
+	// Name is the name of the S3 target.
+	Name     string `json:"name"`
+	Location string `json:"location,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	// KeyVersion is the version of the key the snapshot was encrypted with, if the target is encrypted.
+	KeyVersion string `json:"keyVersion,omitempty"`
+}
+
+type ETCDSnapshotVerificationResult string
+
+const (
+	ETCDSnapshotVerified           ETCDSnapshotVerificationResult = "Verified"
+	ETCDSnapshotVerificationFailed ETCDSnapshotVerificationResult = "Failed"
+	// ETCDSnapshotVerificationUnsupported is the result of a snapshot whose checksum matches but that could not be test
+	// restored because the node lacks the tools to do so.
+	ETCDSnapshotVerificationUnsupported ETCDSnapshotVerificationResult = "Unsupported"
+)
+
+type ETCDSnapshotVerificationStatus struct {
+	Result ETCDSnapshotVerificationResult `json:"result,omitempty"`
+	// SHA256 is the checksum of the snapshot recorded by the first verification that did not fail, later verifications
+	// fail if the snapshot no longer matches it.
+	SHA256 string `json:"sha256,omitempty"`
+	// TestRestored is true if the snapshot was restored into a throwaway etcd process.
+	TestRestored bool         `json:"testRestored,omitempty"`
+	LastVerified *metav1.Time `json:"lastVerified,omitempty"`
+	Message      string       `json:"message,omitempty"`
+}
+
+type ETCDSnapshotRetentionStatus struct {
+	// Pinned is true if the snapshot is kept by the retention policy, otherwise it is eligible for deletion.
+	Pinned bool `json:"pinned"`
+	// Tiers lists the tiers of the retention policy the snapshot is kept by: hourly, daily, weekly or age.
+	Tiers []string `json:"tiers,omitempty"`
 }
 
 type ETCD struct {
@@ -78,4 +197,22 @@ type ETCD struct {
 	SnapshotScheduleCron string          `json:"snapshotScheduleCron,omitempty"`
 	SnapshotRetention    int             `json:"snapshotRetention,omitempty"`
 	S3                   *ETCDSnapshotS3 `json:"s3,omitempty"`
+
+	// S3Targets are S3 targets the snapshots are replicated to in addition to S3, each with its own credential and
+	// retention. Snapshots are uploaded to the targets by the system-agent from the etcd nodes, which requires openssl
+	// and curl 7.75 or later on the etcd nodes.
+	// +optional
+	S3Targets []ETCDSnapshotS3Target `json:"s3Targets,omitempty"`
+
+	// SnapshotVerification periodically verifies the local snapshots of the etcd nodes, the result is set on the
+	// status of the snapshots.
+	// +optional
+	SnapshotVerification *ETCDSnapshotVerification `json:"snapshotVerification,omitempty"`
+
+	// SnapshotRetentionPolicy replaces the snapshot retention with a grandfather-father-son retention of the local and
+	// S3 snapshots, with an optional age limit. It applies to every S3 destination: S3, encrypted or not, and the S3
+	// targets, whose own retention it replaces. Snapshots are pruned by the system-agent on the etcd nodes, the S3
+	// snapshots by the init node, the encrypted S3 snapshots and the snapshots in S3 targets by their uploads.
+	// +optional
+	SnapshotRetentionPolicy *ETCDSnapshotRetentionPolicy `json:"snapshotRetentionPolicy,omitempty"`
 }
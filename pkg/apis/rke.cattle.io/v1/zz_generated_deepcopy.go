@@ -45,11 +45,113 @@ func (in *AuthConfig) DeepCopy() *AuthConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryProbe) DeepCopyInto(out *CanaryProbe) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryProbe.
+func (in *CanaryProbe) DeepCopy() *CanaryProbe {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryProbe)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryStrategy) DeepCopyInto(out *CanaryStrategy) {
+	*out = *in
+	if in.MachineSelector != nil {
+		in, out := &in.MachineSelector, &out.MachineSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Probes != nil {
+		in, out := &in.Probes, &out.Probes
+		*out = make(map[string]CanaryProbe, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryStrategy.
+func (in *CanaryStrategy) DeepCopy() *CanaryStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateAutoRotation) DeepCopyInto(out *CertificateAutoRotation) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateAutoRotation.
+func (in *CertificateAutoRotation) DeepCopy() *CertificateAutoRotation {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateAutoRotation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateAutoRotationStatus) DeepCopyInto(out *CertificateAutoRotationStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateAutoRotationStatus.
+func (in *CertificateAutoRotationStatus) DeepCopy() *CertificateAutoRotationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateAutoRotationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateExpiration) DeepCopyInto(out *CertificateExpiration) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateExpiration.
+func (in *CertificateExpiration) DeepCopy() *CertificateExpiration {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateExpiration)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterUpgradeStrategy) DeepCopyInto(out *ClusterUpgradeStrategy) {
 	*out = *in
 	in.ControlPlaneDrainOptions.DeepCopyInto(&out.ControlPlaneDrainOptions)
 	in.WorkerDrainOptions.DeepCopyInto(&out.WorkerDrainOptions)
+	if in.MaintenanceWindow != nil {
+		in, out := &in.MaintenanceWindow, &out.MaintenanceWindow
+		*out = new(MaintenanceWindow)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.WorkerCanary != nil {
+		in, out := &in.WorkerCanary, &out.WorkerCanary
+		*out = new(CanaryStrategy)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -219,6 +321,23 @@ func (in *ETCD) DeepCopyInto(out *ETCD) {
 	if in.S3 != nil {
 		in, out := &in.S3, &out.S3
 		*out = new(ETCDSnapshotS3)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.S3Targets != nil {
+		in, out := &in.S3Targets, &out.S3Targets
+		*out = make([]ETCDSnapshotS3Target, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SnapshotVerification != nil {
+		in, out := &in.SnapshotVerification, &out.SnapshotVerification
+		*out = new(ETCDSnapshotVerification)
+		**out = **in
+	}
+	if in.SnapshotRetentionPolicy != nil {
+		in, out := &in.SnapshotRetentionPolicy, &out.SnapshotRetentionPolicy
+		*out = new(ETCDSnapshotRetentionPolicy)
 		**out = **in
 	}
 	return
@@ -241,7 +360,7 @@ func (in *ETCDSnapshot) DeepCopyInto(out *ETCDSnapshot) {
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	out.Spec = in.Spec
 	in.SnapshotFile.DeepCopyInto(&out.SnapshotFile)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -279,6 +398,22 @@ func (in *ETCDSnapshotCreate) DeepCopy() *ETCDSnapshotCreate {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotEncryption) DeepCopyInto(out *ETCDSnapshotEncryption) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotEncryption.
+func (in *ETCDSnapshotEncryption) DeepCopy() *ETCDSnapshotEncryption {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotEncryption)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ETCDSnapshotFile) DeepCopyInto(out *ETCDSnapshotFile) {
 	*out = *in
@@ -289,7 +424,7 @@ func (in *ETCDSnapshotFile) DeepCopyInto(out *ETCDSnapshotFile) {
 	if in.S3 != nil {
 		in, out := &in.S3, &out.S3
 		*out = new(ETCDSnapshotS3)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	return
 }
@@ -353,9 +488,51 @@ func (in *ETCDSnapshotRestore) DeepCopy() *ETCDSnapshotRestore {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotRetentionPolicy) DeepCopyInto(out *ETCDSnapshotRetentionPolicy) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotRetentionPolicy.
+func (in *ETCDSnapshotRetentionPolicy) DeepCopy() *ETCDSnapshotRetentionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotRetentionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotRetentionStatus) DeepCopyInto(out *ETCDSnapshotRetentionStatus) {
+	*out = *in
+	if in.Tiers != nil {
+		in, out := &in.Tiers, &out.Tiers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotRetentionStatus.
+func (in *ETCDSnapshotRetentionStatus) DeepCopy() *ETCDSnapshotRetentionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotRetentionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ETCDSnapshotS3) DeepCopyInto(out *ETCDSnapshotS3) {
 	*out = *in
+	if in.Encryption != nil {
+		in, out := &in.Encryption, &out.Encryption
+		*out = new(ETCDSnapshotEncryption)
+		**out = **in
+	}
 	return
 }
 
@@ -369,6 +546,39 @@ func (in *ETCDSnapshotS3) DeepCopy() *ETCDSnapshotS3 {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotS3Target) DeepCopyInto(out *ETCDSnapshotS3Target) {
+	*out = *in
+	in.ETCDSnapshotS3.DeepCopyInto(&out.ETCDSnapshotS3)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotS3Target.
+func (in *ETCDSnapshotS3Target) DeepCopy() *ETCDSnapshotS3Target {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotS3Target)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotS3TargetStatus) DeepCopyInto(out *ETCDSnapshotS3TargetStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotS3TargetStatus.
+func (in *ETCDSnapshotS3TargetStatus) DeepCopy() *ETCDSnapshotS3TargetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotS3TargetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ETCDSnapshotSpec) DeepCopyInto(out *ETCDSnapshotSpec) {
 	*out = *in
@@ -388,6 +598,21 @@ func (in *ETCDSnapshotSpec) DeepCopy() *ETCDSnapshotSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ETCDSnapshotStatus) DeepCopyInto(out *ETCDSnapshotStatus) {
 	*out = *in
+	if in.S3Targets != nil {
+		in, out := &in.S3Targets, &out.S3Targets
+		*out = make([]ETCDSnapshotS3TargetStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Verification != nil {
+		in, out := &in.Verification, &out.Verification
+		*out = new(ETCDSnapshotVerificationStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(ETCDSnapshotRetentionStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -401,6 +626,74 @@ func (in *ETCDSnapshotStatus) DeepCopy() *ETCDSnapshotStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotVerification) DeepCopyInto(out *ETCDSnapshotVerification) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotVerification.
+func (in *ETCDSnapshotVerification) DeepCopy() *ETCDSnapshotVerification {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotVerification)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ETCDSnapshotVerificationStatus) DeepCopyInto(out *ETCDSnapshotVerificationStatus) {
+	*out = *in
+	if in.LastVerified != nil {
+		in, out := &in.LastVerified, &out.LastVerified
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ETCDSnapshotVerificationStatus.
+func (in *ETCDSnapshotVerificationStatus) DeepCopy() *ETCDSnapshotVerificationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ETCDSnapshotVerificationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EncryptionKeyRotationRecord) DeepCopyInto(out *EncryptionKeyRotationRecord) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EncryptionKeyRotationRecord.
+func (in *EncryptionKeyRotationRecord) DeepCopy() *EncryptionKeyRotationRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(EncryptionKeyRotationRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EncryptionKeyRotationSchedule) DeepCopyInto(out *EncryptionKeyRotationSchedule) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EncryptionKeyRotationSchedule.
+func (in *EncryptionKeyRotationSchedule) DeepCopy() *EncryptionKeyRotationSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(EncryptionKeyRotationSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EnvVar) DeepCopyInto(out *EnvVar) {
 	*out = *in
@@ -480,6 +773,27 @@ func (in *LocalClusterAuthEndpoint) DeepCopy() *LocalClusterAuthEndpoint {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	if in.Schedules != nil {
+		in, out := &in.Schedules, &out.Schedules
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Mirror) DeepCopyInto(out *Mirror) {
 	*out = *in
@@ -813,6 +1127,16 @@ func (in *RKEClusterSpecCommon) DeepCopyInto(out *RKEClusterSpecCommon) {
 		*out = new(ETCD)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.CertificateAutoRotation != nil {
+		in, out := &in.CertificateAutoRotation, &out.CertificateAutoRotation
+		*out = new(CertificateAutoRotation)
+		**out = **in
+	}
+	if in.EncryptionKeyRotationSchedule != nil {
+		in, out := &in.EncryptionKeyRotationSchedule, &out.EncryptionKeyRotationSchedule
+		*out = new(EncryptionKeyRotationSchedule)
+		**out = **in
+	}
 	return
 }
 
@@ -1009,6 +1333,26 @@ func (in *RKEControlPlaneStatus) DeepCopyInto(out *RKEControlPlaneStatus) {
 		*out = new(ETCDSnapshotCreate)
 		**out = **in
 	}
+	if in.WorkerCanary != nil {
+		in, out := &in.WorkerCanary, &out.WorkerCanary
+		*out = new(WorkerCanaryStatus)
+		**out = **in
+	}
+	if in.CertificateExpiration != nil {
+		in, out := &in.CertificateExpiration, &out.CertificateExpiration
+		*out = make([]CertificateExpiration, len(*in))
+		copy(*out, *in)
+	}
+	if in.CertificateAutoRotation != nil {
+		in, out := &in.CertificateAutoRotation, &out.CertificateAutoRotation
+		*out = new(CertificateAutoRotationStatus)
+		**out = **in
+	}
+	if in.EncryptionKeyRotationHistory != nil {
+		in, out := &in.EncryptionKeyRotationHistory, &out.EncryptionKeyRotationHistory
+		*out = make([]EncryptionKeyRotationRecord, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -1185,3 +1529,19 @@ func (in *RotateEncryptionKeys) DeepCopy() *RotateEncryptionKeys {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkerCanaryStatus) DeepCopyInto(out *WorkerCanaryStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkerCanaryStatus.
+func (in *WorkerCanaryStatus) DeepCopy() *WorkerCanaryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkerCanaryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
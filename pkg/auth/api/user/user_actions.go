@@ -1,18 +1,22 @@
 package user
 
 import (
+	"encoding/json"
 	"net/http"
 	"strings"
-	"unicode/utf8"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rancher/norman/httperror"
 	"github.com/rancher/norman/parse"
 	"github.com/rancher/norman/types"
 	"github.com/rancher/rancher/pkg/auth/providerrefresh"
+	"github.com/rancher/rancher/pkg/auth/providers/local"
+	"github.com/rancher/rancher/pkg/auth/util"
 	client "github.com/rancher/rancher/pkg/client/generated/management/v3"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/settings"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -23,10 +27,23 @@ func (h *Handler) UserFormatter(apiContext *types.APIContext, resource *types.Ra
 	if canRefresh := h.userCanRefresh(apiContext); canRefresh {
 		resource.AddAction(apiContext, "refreshauthprovideraccess")
 	}
+
+	if annotations, ok := resource.Values[client.UserFieldAnnotations].(map[string]interface{}); ok {
+		if _, locked := annotations[local.LockedUntilAnnotation]; locked && h.userCanUpdate(apiContext) {
+			resource.AddAction(apiContext, "unlock")
+		}
+	}
+
+	if h.userCanUpdate(apiContext) {
+		resource.AddAction(apiContext, "resetmfa")
+	}
 }
 
 func (h *Handler) CollectionFormatter(apiContext *types.APIContext, collection *types.GenericCollection) {
 	collection.AddAction(apiContext, "changepassword")
+	collection.AddAction(apiContext, "enrollmfa")
+	collection.AddAction(apiContext, "confirmmfa")
+	collection.AddAction(apiContext, "disablemfa")
 	if canRefresh := h.userCanRefresh(apiContext); canRefresh {
 		collection.AddAction(apiContext, "refreshauthprovideraccess")
 	}
@@ -36,6 +53,7 @@ type Handler struct {
 	UserClient               v3.UserInterface
 	GlobalRoleBindingsClient v3.GlobalRoleBindingInterface
 	UserAuthRefresher        providerrefresh.UserAuthRefresher
+	MFA                      *local.MFAStore
 }
 
 func (h *Handler) Actions(actionName string, action *types.Action, apiContext *types.APIContext) error {
@@ -52,6 +70,26 @@ func (h *Handler) Actions(actionName string, action *types.Action, apiContext *t
 		if err := h.refreshAttributes(actionName, action, apiContext); err != nil {
 			return err
 		}
+	case "unlock":
+		if err := h.unlock(actionName, action, apiContext); err != nil {
+			return err
+		}
+	case "enrollmfa":
+		if err := h.enrollMFA(actionName, action, apiContext); err != nil {
+			return err
+		}
+	case "confirmmfa":
+		if err := h.confirmMFA(actionName, action, apiContext); err != nil {
+			return err
+		}
+	case "disablemfa":
+		if err := h.disableMFA(actionName, action, apiContext); err != nil {
+			return err
+		}
+	case "resetmfa":
+		if err := h.resetMFA(actionName, action, apiContext); err != nil {
+			return err
+		}
 	default:
 		return errors.Errorf("bad action %v", actionName)
 	}
@@ -95,7 +133,8 @@ func (h *Handler) changePassword(actionName string, action *types.Action, reques
 		return err
 	}
 
-	if err := validatePassword(user.Username, currentPass, newPass, settings.PasswordMinLength.GetInt()); err != nil {
+	policy := local.ReadPasswordPolicy()
+	if err := policy.Validate(user.Username, currentPass, newPass, user); err != nil {
 		return httperror.NewAPIError(httperror.InvalidBodyContent, err.Error())
 	}
 
@@ -108,7 +147,7 @@ func (h *Handler) changePassword(actionName string, action *types.Action, reques
 		return err
 	}
 
-	user.Password = newPassHash
+	policy.SetPassword(user, newPassHash, time.Now())
 	user.MustChangePassword = false
 	user, err = h.UserClient.Update(user)
 	if err != nil {
@@ -139,17 +178,27 @@ func (h *Handler) setPassword(actionName string, action *types.Action, request *
 		return errors.New("Invalid password")
 	}
 
-	username := userData[client.UserFieldUsername].(string)
+	user, err := h.UserClient.Get(request.ID, v1.GetOptions{})
+	if err != nil {
+		return err
+	}
 
 	// passing empty currentPass to validator since, this api call doesn't assume an existing password
-	if err := validatePassword(username, "", newPass, settings.PasswordMinLength.GetInt()); err != nil {
+	policy := local.ReadPasswordPolicy()
+	if err := policy.Validate(user.Username, "", newPass, user); err != nil {
 		return httperror.NewAPIError(httperror.InvalidBodyContent, err.Error())
 	}
 
-	userData[client.UserFieldPassword] = newPass
-	if err := hashPassword(userData); err != nil {
+	newPassHash, err := HashPasswordString(newPass)
+	if err != nil {
 		return err
 	}
+	user = user.DeepCopy()
+	policy.SetPassword(user, newPassHash, time.Now())
+
+	userData[client.UserFieldPassword] = user.Password
+	userData[client.UserFieldPasswordHistory] = user.PasswordHistory
+	userData[client.UserFieldPasswordChangedAt] = user.PasswordChangedAt
 	userData[client.UserFieldMustChangePassword] = false
 	delete(userData, "me")
 
@@ -179,23 +228,156 @@ func (h *Handler) refreshAttributes(actionName string, action *types.Action, req
 	return nil
 }
 
-func (h *Handler) userCanRefresh(request *types.APIContext) bool {
-	return request.AccessControl.CanDo(v3.UserGroupVersionKind.Group, v3.UserResource.Name, "create", request, nil, request.Schema) == nil
+// unlock ends the lockout of a user locked out by the local auth provider after too many failed logins.
+func (h *Handler) unlock(actionName string, action *types.Action, request *types.APIContext) error {
+	if !h.userCanUpdate(request) {
+		return httperror.NewAPIError(httperror.PermissionDenied, "Not Allowed")
+	}
+
+	user, err := h.UserClient.Get(request.ID, v1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if _, ok := user.Annotations[local.LockedUntilAnnotation]; ok {
+		user = user.DeepCopy()
+		delete(user.Annotations, local.LockedUntilAnnotation)
+		if _, err := h.UserClient.Update(user); err != nil {
+			return err
+		}
+		logrus.Infof("User [%s] was unlocked by [%s]", user.Name, request.Request.Header.Get("Impersonate-User"))
+	}
+
+	request.WriteResponse(http.StatusOK, nil)
+	return nil
+}
+
+// enrollMFA starts a TOTP enrollment of the current user. It has to be confirmed with a code before it is used.
+func (h *Handler) enrollMFA(actionName string, action *types.Action, request *types.APIContext) error {
+	user, err := h.currentLocalUser(request)
+	if err != nil {
+		return err
+	}
+
+	enrollment, err := h.MFA.Enroll(user)
+	if err == local.ErrMFAAlreadyEnrolled {
+		return httperror.NewAPIError(httperror.Conflict, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	res, err := json.Marshal(enrollment)
+	if err != nil {
+		return httperror.WrapAPIError(err, httperror.ServerError, "failed to marshal multi-factor authentication enrollment")
+	}
+	request.Response.Header().Set("Content-Type", "application/json")
+	request.Response.Write(res)
+	return nil
+}
+
+// confirmMFA activates the pending TOTP enrollment of the current user.
+func (h *Handler) confirmMFA(actionName string, action *types.Action, request *types.APIContext) error {
+	code, err := readMFACode(request)
+	if err != nil {
+		return err
+	}
+	user, err := h.currentLocalUser(request)
+	if err != nil {
+		return err
+	}
+
+	if err := h.MFA.Confirm(user.Name, code); err != nil {
+		return mfaError(err)
+	}
+	logrus.Infof("User [%s] enrolled in multi-factor authentication", user.Name)
+
+	request.WriteResponse(http.StatusOK, nil)
+	return nil
 }
 
-// validatePassword will ensure a password is at least the minimum required length in runes,
-// that the username and password do not match, and that the new password is not the same as the current password.
-func validatePassword(user string, currentPass string, pass string, minPassLen int) error {
-	if utf8.RuneCountInString(pass) < minPassLen {
-		return errors.Errorf("Password must be at least %v characters", minPassLen)
+// disableMFA removes the TOTP enrollment of the current user, which requires a valid code.
+func (h *Handler) disableMFA(actionName string, action *types.Action, request *types.APIContext) error {
+	code, err := readMFACode(request)
+	if err != nil {
+		return err
 	}
+	user, err := h.currentLocalUser(request)
+	if err != nil {
+		return err
+	}
+
+	if err := h.MFA.Verify(user.Name, code); err != nil {
+		return mfaError(err)
+	}
+	if err := h.MFA.Delete(user.Name); err != nil {
+		return err
+	}
+	logrus.Infof("User [%s] disabled multi-factor authentication", user.Name)
+
+	request.WriteResponse(http.StatusOK, nil)
+	return nil
+}
 
-	if user == pass {
-		return errors.New("Password cannot be the same as username")
+// resetMFA removes the TOTP enrollment of a user who lost access to their authenticator and recovery codes.
+func (h *Handler) resetMFA(actionName string, action *types.Action, request *types.APIContext) error {
+	if !h.userCanUpdate(request) {
+		return httperror.NewAPIError(httperror.PermissionDenied, "Not Allowed")
 	}
-	if pass == currentPass {
-		return errors.New("The new password must not be the same as the current password")
+
+	if err := h.MFA.Delete(request.ID); err != nil {
+		return err
 	}
+	logrus.Infof("Multi-factor authentication of User [%s] was reset by [%s]", request.ID, request.Request.Header.Get("Impersonate-User"))
 
+	request.WriteResponse(http.StatusOK, nil)
 	return nil
 }
+
+// currentLocalUser returns the user making the request, who must be able to log in with the local auth provider.
+func (h *Handler) currentLocalUser(request *types.APIContext) (*v3.User, error) {
+	userID := request.Request.Header.Get("Impersonate-User")
+	if userID == "" {
+		return nil, errors.New("can't find user")
+	}
+	user, err := h.UserClient.Get(userID, v1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if user.Username == "" || user.Password == "" {
+		return nil, httperror.NewAPIError(httperror.InvalidAction, "multi-factor authentication is only available to local users")
+	}
+	return user, nil
+}
+
+func readMFACode(request *types.APIContext) (string, error) {
+	actionInput, err := parse.ReadBody(request.Request)
+	if err != nil {
+		return "", err
+	}
+	code, ok := actionInput["code"].(string)
+	if !ok || len(code) == 0 {
+		return "", httperror.NewAPIError(httperror.InvalidBodyContent, "must specify code")
+	}
+	return code, nil
+}
+
+func mfaError(err error) error {
+	switch err {
+	case local.ErrInvalidMFACode:
+		return httperror.NewAPIError(httperror.InvalidBodyContent, err.Error())
+	case local.ErrMFANotEnrolled:
+		return httperror.NewAPIError(httperror.InvalidState, err.Error())
+	case local.ErrMFAAlreadyEnrolled:
+		return httperror.NewAPIError(httperror.Conflict, err.Error())
+	case local.ErrMFAThrottled:
+		return httperror.NewAPIErrorLong(http.StatusTooManyRequests, util.GetHTTPErrorCode(http.StatusTooManyRequests), err.Error())
+	}
+	return err
+}
+
+func (h *Handler) userCanUpdate(request *types.APIContext) bool {
+	return request.AccessControl.CanDo(v3.UserGroupVersionKind.Group, v3.UserResource.Name, "update", request, nil, request.Schema) == nil
+}
+
+func (h *Handler) userCanRefresh(request *types.APIContext) bool {
+	return request.AccessControl.CanDo(v3.UserGroupVersionKind.Group, v3.UserResource.Name, "create", request, nil, request.Schema) == nil
+}
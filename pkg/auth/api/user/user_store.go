@@ -9,9 +9,9 @@
 	"github.com/rancher/norman/httperror"
 	"github.com/rancher/norman/store/transform"
 	"github.com/rancher/norman/types"
+	"github.com/rancher/rancher/pkg/auth/providers/local"
 	client "github.com/rancher/rancher/pkg/client/generated/management/v3"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
-	"github.com/rancher/rancher/pkg/settings"
 	"github.com/rancher/rancher/pkg/types/config"
 	"github.com/rancher/rancher/pkg/user"
 	"github.com/sirupsen/logrus"
@@ -118,7 +118,7 @@ func (s *userStore) Create(apiContext *types.APIContext, schema *types.Schema, d
 		return nil, errors.New("invalid password")
 	}
 
-	if err := validatePassword(username, "", password, settings.PasswordMinLength.GetInt()); err != nil {
+	if err := local.ReadPasswordPolicy().Validate(username, "", password, nil); err != nil {
 		return nil, httperror.NewAPIError(httperror.InvalidBodyContent, err.Error())
 	}
 
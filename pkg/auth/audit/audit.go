@@ -44,6 +44,9 @@
 	LevelRequestResponse
 
 	generateKubeconfigURI = "action=generateKubeconfig"
+	enrollMFAURI          = "action=enrollmfa"
+	confirmMFAURI         = "action=confirmmfa"
+	disableMFAURI         = "action=disablemfa"
 )
 
 var (
@@ -62,6 +65,8 @@
 type auditLog struct {
 	log               *log
 	writer            *LogWriter
+	policy            *Policy
+	attributes        *requestAttributes
 	reqBody           []byte
 	keysToRedactRegex *regexp.Regexp
 }
@@ -80,6 +85,8 @@ type log struct {
 	RequestBody       []byte       `json:"requestBody,omitempty"`
 	ResponseBody      []byte       `json:"responseBody,omitempty"`
 	UserLoginName     string       `json:"userLoginName,omitempty"`
+	// Annotations are events of interest added by the handlers of the request, see util.AddAuditAnnotation.
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 var userKey struct{}
@@ -132,10 +139,15 @@ func newAuditLog(writer *LogWriter, req *http.Request, keysToRedactRegex *regexp
 		},
 		keysToRedactRegex: keysToRedactRegex,
 	}
+	if policy := writer.Policy(); policy != nil {
+		auditLog.policy = policy
+		auditLog.attributes = newRequestAttributes(req)
+	}
 
+	level := auditLog.level(0)
 	contentType := req.Header.Get("Content-Type")
 	loginReq := isLoginRequest(req.RequestURI)
-	if writer.Level >= LevelRequest || loginReq {
+	if level >= LevelRequest || loginReq {
 		if bodyMethods[req.Method] && strings.HasPrefix(contentType, contentTypeJSON) {
 			reqBody, err := readBodyWithoutLosingContent(req)
 			if err != nil {
@@ -147,7 +159,7 @@ func newAuditLog(writer *LogWriter, req *http.Request, keysToRedactRegex *regexp
 					auditLog.log.UserLoginName = loginName
 				}
 			}
-			if writer.Level >= LevelRequest {
+			if level >= LevelRequest {
 				auditLog.reqBody = reqBody
 			}
 		}
@@ -155,11 +167,28 @@ func newAuditLog(writer *LogWriter, req *http.Request, keysToRedactRegex *regexp
 	return auditLog, nil
 }
 
+// level returns the audit level for the request. The response code is 0 while the response is not yet known,
+// in which case the highest level the request could end up being logged at is returned.
+func (a *auditLog) level(resCode int) Level {
+	level, ok := a.policy.levelFor(a.attributes, resCode)
+	if ok {
+		return level
+	}
+	return maxLevel(level, a.writer.Level)
+}
+
 func (a *auditLog) write(userInfo *User, reqHeaders, resHeaders http.Header, resCode int, resBody []byte) error {
+	level := a.level(resCode)
+	if level == LevelNull {
+		return nil
+	}
+
 	a.log.User = userInfo
 	a.log.ResponseTimestamp = time.Now().Format(time.RFC3339)
 	a.log.RequestHeader = filterOutHeaders(reqHeaders, sensitiveRequestHeader)
 	a.log.ResponseHeader = filterOutHeaders(resHeaders, sensitiveResponseHeader)
+	a.policy.redaction().redactHeaders(a.log.RequestHeader)
+	a.policy.redaction().redactHeaders(a.log.ResponseHeader)
 	a.log.ResponseCode = resCode
 
 	if a.log.UserLoginName != "" {
@@ -178,9 +207,9 @@ func (a *auditLog) write(userInfo *User, reqHeaders, resHeaders http.Header, res
 	}
 
 	buffer.Write(bytes.TrimSuffix(alByte, []byte("}")))
-	a.writeRequest(&buffer)
+	a.writeRequest(&buffer, level)
 
-	if err = a.writeResponse(&buffer, resHeaders, resBody); err != nil {
+	if err = a.writeResponse(&buffer, level, resHeaders, resBody); err != nil {
 		return err
 	}
 
@@ -204,8 +233,8 @@ func (a *auditLog) write(userInfo *User, reqHeaders, resHeaders http.Header, res
 }
 
 // writeRequest attempts to write the API request to the log message.
-func (a *auditLog) writeRequest(buf *bytes.Buffer) {
-	if a.writer.Level < LevelRequest || len(a.reqBody) == 0 {
+func (a *auditLog) writeRequest(buf *bytes.Buffer, level Level) {
+	if level < LevelRequest || len(a.reqBody) == 0 {
 		return
 	}
 
@@ -214,8 +243,8 @@ func (a *auditLog) writeRequest(buf *bytes.Buffer) {
 }
 
 // writeResponse attempt to write the API response to the log message.
-func (a *auditLog) writeResponse(buf *bytes.Buffer, resHeaders http.Header, resBody []byte) (err error) {
-	if a.writer.Level < LevelRequestResponse || resHeaders.Get("Content-Type") != contentTypeJSON || len(resBody) == 0 {
+func (a *auditLog) writeResponse(buf *bytes.Buffer, level Level, resHeaders http.Header, resBody []byte) (err error) {
+	if level < LevelRequestResponse || resHeaders.Get("Content-Type") != contentTypeJSON || len(resBody) == 0 {
 		return nil
 	}
 
@@ -298,6 +327,20 @@ func (a *auditLog) redactSensitiveData(requestURI string, body []byte) []byte {
 		changed = redact(m, "config")
 	}
 
+	if strings.Contains(requestURI, enrollMFAURI) {
+		// The enrollment holds the TOTP secret and the recovery codes, a list the regex doesn't redact.
+		for _, key := range []string{"secret", "provisioningUri", "recoveryCodes"} {
+			changed = redact(m, key) || changed
+		}
+	}
+
+	if strings.Contains(requestURI, confirmMFAURI) || strings.Contains(requestURI, disableMFAURI) {
+		changed = redact(m, "code") || changed
+	}
+
+	// Redact values matching the rules configured in the audit policy.
+	changed = a.policy.redaction().redactBody(m) || changed
+
 	// Redact values for data considered sensitive: passwords, tokens, etc.
 	if !a.redactMap(m) && !changed {
 		return body
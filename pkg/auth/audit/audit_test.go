@@ -187,6 +187,30 @@ func (a *AuditTest) TestRedactSensitiveData() {
 			want:  []byte(fmt.Sprintf(`{"baseType":"generateKubeConfigOutput","config":"%s","type":"generateKubeConfigOutput"}`, redacted)),
 			uri:   `/v3/clusters/c-xxxxx?action=generateKubeconfig`,
 		},
+		{
+			name:  "With MFA enrollment from enrollmfa action",
+			input: []byte(`{"secret":"JBSWY3DPEHPK3PXP","provisioningUri":"otpauth://totp/Rancher:admin?issuer=Rancher&secret=JBSWY3DPEHPK3PXP","recoveryCodes":["abcd-efgh","ijkl-mnop"]}`),
+			want:  []byte(fmt.Sprintf(`{"secret":"%[1]s","provisioningUri":"%[1]s","recoveryCodes":"%[1]s"}`, redacted)),
+			uri:   `/v3/users?action=enrollmfa`,
+		},
+		{
+			name:  "With MFA code from login",
+			input: []byte(`{"type":"localProvider","username":"admin","password":"secret","mfaCode":"123456"}`),
+			want:  []byte(fmt.Sprintf(`{"type":"localProvider","username":"admin","password":"%[1]s","mfaCode":"%[1]s"}`, redacted)),
+			uri:   `/v3-public/localProviders/local?action=login`,
+		},
+		{
+			name:  "With MFA code from confirmmfa action",
+			input: []byte(`{"code":"123456"}`),
+			want:  []byte(fmt.Sprintf(`{"code":"%s"}`, redacted)),
+			uri:   `/v3/users?action=confirmmfa`,
+		},
+		{
+			name:  "With MFA code from disablemfa action",
+			input: []byte(`{"code":"abcd-efgh"}`),
+			want:  []byte(fmt.Sprintf(`{"code":"%s"}`, redacted)),
+			uri:   `/v3/users?action=disablemfa`,
+		},
 		{
 			name:  "With kubeconfig from connect agent",
 			input: []byte(`{"kubeConfig":"apiVersion: v1\nkind: Config\nclusters:\n- name: \"somecluster-rke\"\n  cluster:\n    server: \"https://rancherurl.com/k8s/clusters/c-xxxxx\"\n- name: \"somecluster-rke-somecluster-rke1\"\n  cluster:\n    server: \"https://34.211.205.110:6443\"\n    certificate-authority-data: \"somecadata\"\n\nusers:\n- name: \"somecluster-rke\"\n  user:\n    token: \"kubeconfig-user-12345:sometoken\"\n\n\ncontexts:\n- name: \"somecluster-rke\"\n  context:\n    user: \"somecluster-rke\"\n    cluster: \"somecluster-rke\"\n- name: \"somecluster-rke-somecluster-rke1\"\n  context:\n    user: \"somecluster-rke\"\n    cluster: \"somecluster-rke-somecluster-rke1\"\n\ncurrent-context: \"somecluster-rke\"\n","namespace":"testns","secretName":"secret-name"}`),
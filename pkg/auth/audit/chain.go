@@ -0,0 +1,212 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pborman/uuid"
+)
+
+const defaultCheckpointInterval = 1000
+
+// chainInfo is added to every audit record when hash chaining is enabled. Each replica starts a new chain, identified by
+// ID, every time it starts. PrevHash is the hex encoded SHA256 of the previous record of the chain as written, without
+// the trailing newline.
+type chainInfo struct {
+	ID       string `json:"id"`
+	Replica  string `json:"replica"`
+	Seq      uint64 `json:"seq"`
+	PrevHash string `json:"prevHash,omitempty"`
+}
+
+// checkpoint is a record signing the hash of the record preceding it. Final is set on the last checkpoint written
+// before the chain is closed, so a verifier can tell a cleanly closed chain from a truncated one.
+type checkpoint struct {
+	Seq       uint64 `json:"seq"`
+	Hash      string `json:"hash"`
+	Timestamp string `json:"timestamp"`
+	Final     bool   `json:"final,omitempty"`
+	Signature string `json:"signature"`
+}
+
+// chainSink adds a sequence number and the hash of the previous record to every audit record before passing it on.
+// If a signing key is set a signed checkpoint record is added every interval records and when the sink is closed.
+type chainSink struct {
+	next     Sink
+	id       string
+	replica  string
+	key      ed25519.PrivateKey
+	interval uint64
+	now      func() time.Time
+
+	lock            sync.Mutex
+	seq             uint64
+	prevHash        string
+	sinceCheckpoint uint64
+}
+
+func newChainSink(next Sink, key ed25519.PrivateKey, interval int) *chainSink {
+	replica, err := os.Hostname()
+	if err != nil || replica == "" {
+		replica = "unknown"
+	}
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	return &chainSink{
+		next:     next,
+		id:       uuid.NewRandom().String(),
+		replica:  replica,
+		key:      key,
+		interval: uint64(interval),
+		now:      time.Now,
+	}
+}
+
+func (c *chainSink) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.writeRecord(bytes.TrimSuffix(p, []byte("\n"))); err != nil {
+		return 0, err
+	}
+
+	c.sinceCheckpoint++
+	if c.key != nil && c.sinceCheckpoint >= c.interval {
+		if err := c.writeCheckpoint(false); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (c *chainSink) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var err error
+	if c.key != nil && c.seq > 0 {
+		err = c.writeCheckpoint(true)
+	}
+	if closeErr := c.next.Close(); closeErr != nil {
+		return closeErr
+	}
+	return err
+}
+
+// writeRecord appends the chain information to the JSON object in record and writes it. The chain advances even if the
+// write fails, as some of the underlying sinks may have received the record.
+func (c *chainSink) writeRecord(record []byte) error {
+	if len(record) < 2 || record[len(record)-1] != '}' {
+		return fmt.Errorf("audit record is not a JSON object")
+	}
+
+	c.seq++
+	info, err := json.Marshal(chainInfo{
+		ID:       c.id,
+		Replica:  c.replica,
+		Seq:      c.seq,
+		PrevHash: c.prevHash,
+	})
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(record[:len(record)-1])
+	if !bytes.Equal(bytes.TrimSpace(record), []byte("{}")) {
+		buf.WriteString(",")
+	}
+	buf.WriteString(`"chain":`)
+	buf.Write(info)
+	buf.WriteString("}")
+
+	c.prevHash = hashRecord(buf.Bytes())
+	buf.WriteString("\n")
+
+	if _, err := c.next.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write audit record %d: %w", c.seq, err)
+	}
+	return nil
+}
+
+func (c *chainSink) writeCheckpoint(final bool) error {
+	cp := checkpoint{
+		Seq:       c.seq,
+		Hash:      c.prevHash,
+		Timestamp: c.now().UTC().Format(time.RFC3339),
+		Final:     final,
+	}
+	cp.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(c.key, checkpointPayload(c.id, c.replica, cp)))
+
+	record, err := json.Marshal(struct {
+		Checkpoint checkpoint `json:"checkpoint"`
+	}{cp})
+	if err != nil {
+		return err
+	}
+	c.sinceCheckpoint = 0
+	return c.writeRecord(record)
+}
+
+// checkpointPayload is the data signed by a checkpoint.
+func checkpointPayload(id, replica string, cp checkpoint) []byte {
+	return []byte(fmt.Sprintf("%s:%s:%d:%s:%s:%t", id, replica, cp.Seq, cp.Hash, cp.Timestamp, cp.Final))
+}
+
+func hashRecord(record []byte) string {
+	sum := sha256.Sum256(record)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadCheckpointKey reads a PEM encoded PKCS8 ed25519 private key used to sign audit log checkpoints.
+func LoadCheckpointKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log checkpoint key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("audit log checkpoint key %s is not PEM encoded", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse audit log checkpoint key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("audit log checkpoint key must be an ed25519 key, got %T", key)
+	}
+	return edKey, nil
+}
+
+// LoadCheckpointPublicKey reads a PEM encoded PKIX ed25519 public key used to verify audit log checkpoints.
+func LoadCheckpointPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log checkpoint public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("audit log checkpoint public key %s is not PEM encoded", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse audit log checkpoint public key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("audit log checkpoint public key must be an ed25519 key, got %T", key)
+	}
+	return edKey, nil
+}
@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeChain writes count records through a chainSink and returns the lines as written.
+func writeChain(t *testing.T, key ed25519.PrivateKey, interval, count int) []string {
+	t.Helper()
+	var out bytes.Buffer
+	sink := newChainSink(&stdoutSink{out: &out}, key, interval)
+	for i := 0; i < count; i++ {
+		_, err := sink.Write([]byte(fmt.Sprintf(`{"auditID":"%d"}`+"\n", i)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, sink.Close())
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
+func writeFile(t *testing.T, dir, name string, lines []string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600))
+	return path
+}
+
+func TestChainSink(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	lines := writeChain(t, key, 2, 3)
+	// 3 records, a checkpoint after the second and a final checkpoint.
+	require.Len(t, lines, 5)
+
+	var prevHash string
+	for i, line := range lines {
+		var record struct {
+			AuditID    string      `json:"auditID"`
+			Chain      chainInfo   `json:"chain"`
+			Checkpoint *checkpoint `json:"checkpoint"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		assert.Equal(t, uint64(i+1), record.Chain.Seq)
+		assert.Equal(t, prevHash, record.Chain.PrevHash)
+		prevHash = hashRecord([]byte(line))
+
+		switch i {
+		case 2:
+			require.NotNil(t, record.Checkpoint)
+			assert.Equal(t, uint64(2), record.Checkpoint.Seq)
+			assert.False(t, record.Checkpoint.Final)
+		case 4:
+			require.NotNil(t, record.Checkpoint)
+			assert.True(t, record.Checkpoint.Final)
+		default:
+			assert.Nil(t, record.Checkpoint)
+			assert.NotEmpty(t, record.AuditID)
+		}
+	}
+}
+
+func TestVerifyFiles(t *testing.T) {
+	public, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		modify       func(lines []string) [][]string
+		publicKey    ed25519.PublicKey
+		wantProblems []string
+		wantWarnings []string
+	}{
+		{
+			name: "intact rotated set in any order",
+			modify: func(lines []string) [][]string {
+				return [][]string{lines[4:], lines[:4]}
+			},
+			publicKey: public,
+		},
+		{
+			name: "modified record",
+			modify: func(lines []string) [][]string {
+				lines[1] = strings.Replace(lines[1], `"auditID":"1"`, `"auditID":"x"`, 1)
+				return [][]string{lines}
+			},
+			wantProblems: []string{"record 2 at"},
+		},
+		{
+			name: "removed record",
+			modify: func(lines []string) [][]string {
+				return [][]string{append(append([]string{}, lines[:3]...), lines[4:]...)}
+			},
+			wantProblems: []string{"records 4-4 are missing"},
+		},
+		{
+			name: "rotated out start",
+			modify: func(lines []string) [][]string {
+				return [][]string{lines[2:]}
+			},
+			wantWarnings: []string{"records 1-2 are missing"},
+		},
+		{
+			name: "truncated end",
+			modify: func(lines []string) [][]string {
+				return [][]string{lines[:5]}
+			},
+			wantWarnings: []string{"no final checkpoint"},
+		},
+		{
+			name: "wrong signing key",
+			modify: func(lines []string) [][]string {
+				return [][]string{lines}
+			},
+			publicKey:    otherPublic,
+			wantProblems: []string{"invalid signature", "invalid signature", "invalid signature"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var paths []string
+			for i, file := range tt.modify(writeChain(t, key, 2, 5)) {
+				paths = append(paths, writeFile(t, dir, fmt.Sprintf("audit-%d.log", i), file))
+			}
+
+			report, err := VerifyFiles(paths, tt.publicKey)
+			require.NoError(t, err)
+			require.Len(t, report.Problems, len(tt.wantProblems), report.Problems)
+			for i, want := range tt.wantProblems {
+				assert.Contains(t, report.Problems[i], want)
+			}
+			require.Len(t, report.Warnings, len(tt.wantWarnings), report.Warnings)
+			for i, want := range tt.wantWarnings {
+				assert.Contains(t, report.Warnings[i], want)
+			}
+		})
+	}
+}
+
+func TestVerifyFilesUnchained(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "audit.log", []string{`{"auditID":"1"}`, `{"auditID":"2"}`})
+	report, err := VerifyFiles([]string{path}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Unchained)
+	assert.Empty(t, report.Chains)
+	assert.Empty(t, report.Problems)
+}
@@ -35,7 +35,8 @@ func NewAuditLogMiddleware(auditWriter *LogWriter) (func(http.Handler) http.Hand
 	}, err
 }
 
-// constructKeyRedactRegex builds a regex for matching non-public fields from management.DriverData as well as fields that end with [pP]assword or [tT]oken.
+// constructKeyRedactRegex builds a regex for matching non-public fields from management.DriverData as well as fields that end with [pP]assword or [tT]oken
+// and the multi-factor authentication code and provisioning URI.
 func constructKeyRedactRegex() (*regexp.Regexp, error) {
 	s := strings.Builder{}
 	s.WriteRune('(')
@@ -49,7 +50,7 @@ func constructKeyRedactRegex() (*regexp.Regexp, error) {
 			}
 		}
 	}
-	s.WriteString(`[pP]assword|[tT]oken|[kK]ube[cC]onfig)`)
+	s.WriteString(`[pP]assword|[tT]oken|[kK]ube[cC]onfig|[mM]fa[cC]ode|[pP]rovisioning[uU]ri)`)
 
 	return regexp.Compile(s.String())
 }
@@ -71,17 +72,23 @@ func (h auditHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	user := getUserInfo(req)
 
 	context := context.WithValue(req.Context(), userKey, user)
-	req = req.WithContext(context)
+	req = req.WithContext(util.WithAuditAnnotations(context))
 
 	auditLog, err := newAuditLog(h.auditWriter, req, h.sanitizingRegex)
 	if err != nil {
 		util.ReturnHTTPError(rw, req, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if auditLog.level(0) == LevelNull {
+		// The policy excludes this request regardless of its response.
+		h.next.ServeHTTP(rw, req)
+		return
+	}
 
 	wr := &wrapWriter{ResponseWriter: rw, auditWriter: h.auditWriter, statusCode: http.StatusOK}
 	h.next.ServeHTTP(wr, req)
 
+	auditLog.log.Annotations = util.AuditAnnotations(req.Context())
 	err = auditLog.write(user, req.Header, wr.Header(), wr.statusCode, wr.buf.Bytes())
 	if err == nil {
 		return
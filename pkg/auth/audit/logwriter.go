@@ -2,13 +2,57 @@
 
 import (
 	"context"
+	"crypto/ed25519"
+	"fmt"
+	"sync/atomic"
+	"time"
 
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
 )
 
+const (
+	// SinkFile writes audit events to a local rotating log file.
+	SinkFile = "file"
+	// SinkStdout writes audit events to stdout as JSON lines.
+	SinkStdout = "stdout"
+	// SinkWebhook sends batches of audit events to an HTTP endpoint.
+	SinkWebhook = "webhook"
+	// SinkSyslog sends audit events to an RFC5424 syslog receiver over TCP or TLS.
+	SinkSyslog = "syslog"
+)
+
 type LogWriter struct {
 	Level  Level
-	Output *lumberjack.Logger
+	Output Sink
+
+	policy atomic.Pointer[Policy]
+}
+
+// WriterOptions configures which sinks a LogWriter sends audit events to.
+type WriterOptions struct {
+	Level Level
+	// Sinks is the list of sink names to enable. When empty only the file sink is used.
+	Sinks []string
+
+	Path      string
+	MaxAge    int
+	MaxBackup int
+	MaxSize   int
+
+	WebhookURL           string
+	WebhookBatchSize     int
+	WebhookFlushInterval time.Duration
+
+	SyslogAddress  string
+	SyslogTLS      bool
+	SyslogInsecure bool
+
+	// HashChain adds a sequence number and the hash of the previous record to every record.
+	HashChain bool
+	// CheckpointKeyPath is a PEM encoded ed25519 private key. When set, signed checkpoints are added to the hash chain.
+	CheckpointKeyPath string
+	// CheckpointInterval is the number of records between checkpoints.
+	CheckpointInterval int
 }
 
 func (l *LogWriter) Start(ctx context.Context) {
@@ -21,18 +65,100 @@ func (l *LogWriter) Start(ctx context.Context) {
 	}()
 }
 
+// SetPolicy replaces the policy used to pick the audit level per request. A nil policy logs every request at Level.
+func (l *LogWriter) SetPolicy(policy *Policy) {
+	l.policy.Store(policy)
+}
+
+// Policy returns the current audit policy, or nil if none is set.
+func (l *LogWriter) Policy() *Policy {
+	return l.policy.Load()
+}
+
 func NewLogWriter(path string, level Level, maxAge, maxBackup, maxSize int) *LogWriter {
 	if path == "" || level == LevelNull {
 		return nil
 	}
 
 	return &LogWriter{
-		Level: level,
-		Output: &lumberjack.Logger{
-			Filename:   path,
-			MaxAge:     maxAge,
-			MaxBackups: maxBackup,
-			MaxSize:    maxSize,
-		},
+		Level:  level,
+		Output: newFileSink(path, maxAge, maxBackup, maxSize),
+	}
+}
+
+// NewLogWriterFromOptions returns a LogWriter writing to every sink named in opts.
+// A nil LogWriter is returned if auditing is disabled or no sink is usable.
+func NewLogWriterFromOptions(opts WriterOptions) (*LogWriter, error) {
+	if opts.Level == LevelNull {
+		return nil, nil
+	}
+
+	names := opts.Sinks
+	if len(names) == 0 {
+		names = []string{SinkFile}
+	}
+
+	var sinks []Sink
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		switch name {
+		case SinkFile:
+			// Keep the historical behavior of an empty path disabling the file output.
+			if opts.Path == "" {
+				continue
+			}
+			sinks = append(sinks, newFileSink(opts.Path, opts.MaxAge, opts.MaxBackup, opts.MaxSize))
+		case SinkStdout:
+			sinks = append(sinks, newStdoutSink())
+		case SinkWebhook:
+			if opts.WebhookURL == "" {
+				return nil, fmt.Errorf("audit log sink %s requires a webhook URL", name)
+			}
+			sinks = append(sinks, newWebhookSink(opts.WebhookURL, opts.WebhookBatchSize, opts.WebhookFlushInterval))
+		case SinkSyslog:
+			if opts.SyslogAddress == "" {
+				return nil, fmt.Errorf("audit log sink %s requires a syslog address", name)
+			}
+			sinks = append(sinks, newSyslogSink(opts.SyslogAddress, opts.SyslogTLS, opts.SyslogInsecure))
+		default:
+			return nil, fmt.Errorf("unknown audit log sink %q", name)
+		}
+	}
+
+	var output Sink
+	switch len(sinks) {
+	case 0:
+		return nil, nil
+	case 1:
+		output = sinks[0]
+	default:
+		output = multiSink(sinks)
+	}
+
+	if opts.HashChain {
+		var key ed25519.PrivateKey
+		if opts.CheckpointKeyPath != "" {
+			var err error
+			if key, err = LoadCheckpointKey(opts.CheckpointKeyPath); err != nil {
+				return nil, err
+			}
+		}
+		output = newChainSink(output, key, opts.CheckpointInterval)
+	}
+
+	return &LogWriter{Level: opts.Level, Output: output}, nil
+}
+
+func newFileSink(path string, maxAge, maxBackup, maxSize int) Sink {
+	return &lumberjack.Logger{
+		Filename:   path,
+		MaxAge:     maxAge,
+		MaxBackups: maxBackup,
+		MaxSize:    maxSize,
 	}
 }
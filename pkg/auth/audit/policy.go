@@ -0,0 +1,249 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"k8s.io/utils/strings/slices"
+	"sigs.k8s.io/yaml"
+)
+
+var levelNames = map[string]Level{
+	"None":            LevelNull,
+	"Metadata":        LevelMetadata,
+	"Request":         LevelRequest,
+	"RequestResponse": LevelRequestResponse,
+}
+
+// UnmarshalJSON accepts either the name of a level (None, Metadata, Request, RequestResponse) or its numeric value.
+func (l *Level) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var value int
+		if err := json.Unmarshal(data, &value); err != nil {
+			return fmt.Errorf("audit level must be a string or an integer: %w", err)
+		}
+		name = strconv.Itoa(value)
+	}
+
+	if level, ok := levelNames[name]; ok {
+		*l = level
+		return nil
+	}
+	if value, err := strconv.Atoi(name); err == nil && Level(value) >= LevelNull && Level(value) <= LevelRequestResponse {
+		*l = Level(value)
+		return nil
+	}
+	return fmt.Errorf("unknown audit level %q", name)
+}
+
+// Policy selects the audit Level per request, similar to a Kubernetes audit policy.
+// Rules are evaluated in order and the first matching rule decides the level.
+// Requests that match no rule are logged at the LogWriter's Level.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+	// Redaction adds to the fields and headers that are always redacted from the log.
+	Redaction *Redaction `json:"redaction,omitempty"`
+}
+
+// PolicyRule matches a request when every non-empty criteria matches. Within a criteria any entry may match.
+type PolicyRule struct {
+	Level Level `json:"level"`
+	// Users are matched against the authenticated user name.
+	Users []string `json:"users,omitempty"`
+	// Groups are matched against the groups of the authenticated user.
+	Groups []string `json:"groups,omitempty"`
+	// Verbs are HTTP methods, compared case-insensitively.
+	Verbs []string `json:"verbs,omitempty"`
+	// URIPrefixes are compared against the request URI, including the query string.
+	URIPrefixes []string `json:"uriPrefixes,omitempty"`
+	// ResourceTypes are compared against the type derived from the request path, e.g. globalrolebindings for
+	// /v3/globalrolebindings or management.cattle.io.settings for /v1/management.cattle.io.settings.
+	ResourceTypes []string `json:"resourceTypes,omitempty"`
+	// ResponseCodes are compared against the HTTP status code of the response.
+	ResponseCodes []int `json:"responseCodes,omitempty"`
+}
+
+// ParsePolicy parses a YAML or JSON encoded audit policy.
+func ParsePolicy(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse audit policy: %w", err)
+	}
+	if policy.Redaction != nil {
+		if err := policy.Redaction.compile(); err != nil {
+			return nil, fmt.Errorf("failed to parse audit policy: %w", err)
+		}
+	}
+	return policy, nil
+}
+
+// requestAttributes are the properties of a request that policy rules match on.
+type requestAttributes struct {
+	user         *User
+	method       string
+	uri          string
+	resourceType string
+}
+
+func newRequestAttributes(req *http.Request) *requestAttributes {
+	user, _ := FromContext(req.Context())
+	return &requestAttributes{
+		user:         user,
+		method:       req.Method,
+		uri:          req.RequestURI,
+		resourceType: resourceType(req.URL.Path),
+	}
+}
+
+// redaction returns the configured redaction rules, or nil if there are none.
+func (p *Policy) redaction() *Redaction {
+	if p == nil {
+		return nil
+	}
+	return p.Redaction
+}
+
+// levelFor returns the level of the first rule matching attrs and whether a rule matched.
+// A code of 0 means the response is not known yet. Rules with ResponseCodes could then still match, so the
+// highest level they could select is folded into the result. This lets the caller capture enough of the request
+// to decide the final level once the response code is known. If no rule definitely matches, the returned level is
+// the highest level of those undecided rules and the caller should not lower its default below it.
+func (p *Policy) levelFor(attrs *requestAttributes, code int) (Level, bool) {
+	level := LevelNull
+	if p == nil {
+		return level, false
+	}
+
+	for _, rule := range p.Rules {
+		if !rule.matchesRequest(attrs) {
+			continue
+		}
+		if len(rule.ResponseCodes) > 0 {
+			if code == 0 {
+				level = maxLevel(level, rule.Level)
+				continue
+			}
+			if !containsInt(rule.ResponseCodes, code) {
+				continue
+			}
+		}
+		return maxLevel(level, rule.Level), true
+	}
+	return level, false
+}
+
+func (r *PolicyRule) matchesRequest(attrs *requestAttributes) bool {
+	if len(r.Users) > 0 && (attrs.user == nil || !slices.Contains(r.Users, attrs.user.Name)) {
+		return false
+	}
+	if len(r.Groups) > 0 && (attrs.user == nil || !containsAny(r.Groups, attrs.user.Group)) {
+		return false
+	}
+	if len(r.Verbs) > 0 && !containsFold(r.Verbs, attrs.method) {
+		return false
+	}
+	if len(r.URIPrefixes) > 0 && !hasAnyPrefix(attrs.uri, r.URIPrefixes) {
+		return false
+	}
+	if len(r.ResourceTypes) > 0 && !slices.Contains(r.ResourceTypes, attrs.resourceType) {
+		return false
+	}
+	return true
+}
+
+// resourceType derives the resource type from a norman (/v3), steve (/v1) or kubernetes API path.
+func resourceType(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+
+	switch parts[0] {
+	case "v3":
+		if (parts[1] == "cluster" || parts[1] == "project") && len(parts) > 3 {
+			return parts[3]
+		}
+		return parts[1]
+	case "v1":
+		return parts[1]
+	case "k8s":
+		// /k8s/clusters/<cluster>/api/...
+		if len(parts) > 3 && parts[1] == "clusters" {
+			return k8sResourceType(parts[3:])
+		}
+	case "api", "apis":
+		return k8sResourceType(parts)
+	}
+	return ""
+}
+
+// k8sResourceType returns the resource from a path of the form api/<version>/... or apis/<group>/<version>/...
+func k8sResourceType(parts []string) string {
+	switch {
+	case len(parts) > 0 && parts[0] == "api":
+		parts = parts[1:]
+	case len(parts) > 1 && parts[0] == "apis":
+		parts = parts[2:]
+	default:
+		return ""
+	}
+	// skip the version
+	if len(parts) < 2 {
+		return ""
+	}
+	parts = parts[1:]
+	if len(parts) > 2 && parts[0] == "namespaces" {
+		parts = parts[2:]
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return parts[0]
+}
+
+func maxLevel(a, b Level) Level {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values, candidates []string) bool {
+	for _, candidate := range candidates {
+		if slices.Contains(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(value string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package audit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rancher/rancher/pkg/auth/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+const testPolicy = `
+rules:
+- level: RequestResponse
+  resourceTypes: ["globalrolebindings"]
+- level: None
+  users: ["system:serviceaccount:cattle-system:rancher"]
+- level: Request
+  verbs: ["post"]
+  responseCodes: [401, 403]
+- level: Metadata
+  uriPrefixes: ["/v1/"]
+`
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+	require.Len(t, policy.Rules, 4)
+	assert.Equal(t, LevelRequestResponse, policy.Rules[0].Level)
+	assert.Equal(t, LevelNull, policy.Rules[1].Level)
+	assert.Equal(t, []int{401, 403}, policy.Rules[2].ResponseCodes)
+
+	policy, err = ParsePolicy([]byte("rules:\n- level: 2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, LevelRequest, policy.Rules[0].Level)
+
+	_, err = ParsePolicy([]byte("rules:\n- level: Everything\n"))
+	assert.Error(t, err)
+
+	_, err = ParsePolicy([]byte("rules:\n- level: None\n  verb: [get]\n"))
+	assert.Error(t, err, "unknown fields should be rejected")
+}
+
+func TestPolicyLevelFor(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		attrs     requestAttributes
+		code      int
+		wantLevel Level
+		wantMatch bool
+	}{
+		{
+			name:      "resource type",
+			attrs:     requestAttributes{method: http.MethodGet, uri: "/v3/globalrolebindings", resourceType: "globalrolebindings"},
+			code:      http.StatusOK,
+			wantLevel: LevelRequestResponse,
+			wantMatch: true,
+		},
+		{
+			name:      "excluded user",
+			attrs:     requestAttributes{user: &User{Name: "system:serviceaccount:cattle-system:rancher"}, method: http.MethodGet, uri: "/v1/pods"},
+			code:      http.StatusOK,
+			wantLevel: LevelNull,
+			wantMatch: true,
+		},
+		{
+			name:      "response code matches",
+			attrs:     requestAttributes{method: http.MethodPost, uri: "/v3/tokens"},
+			code:      http.StatusForbidden,
+			wantLevel: LevelRequest,
+			wantMatch: true,
+		},
+		{
+			name:      "response code does not match",
+			attrs:     requestAttributes{method: http.MethodPost, uri: "/v3/tokens"},
+			code:      http.StatusCreated,
+			wantLevel: LevelNull,
+			wantMatch: false,
+		},
+		{
+			name:      "response unknown folds in response code rules",
+			attrs:     requestAttributes{method: http.MethodPost, uri: "/v1/secrets"},
+			code:      0,
+			wantLevel: LevelRequest,
+			wantMatch: true,
+		},
+		{
+			name:      "response unknown without definite match",
+			attrs:     requestAttributes{method: http.MethodPost, uri: "/v3/tokens"},
+			code:      0,
+			wantLevel: LevelRequest,
+			wantMatch: false,
+		},
+		{
+			name:      "uri prefix",
+			attrs:     requestAttributes{method: http.MethodGet, uri: "/v1/management.cattle.io.settings"},
+			code:      http.StatusOK,
+			wantLevel: LevelMetadata,
+			wantMatch: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, matched := policy.levelFor(&tt.attrs, tt.code)
+			assert.Equal(t, tt.wantLevel, level)
+			assert.Equal(t, tt.wantMatch, matched)
+		})
+	}
+}
+
+func TestResourceType(t *testing.T) {
+	tests := map[string]string{
+		"/v3/globalrolebindings":                                   "globalrolebindings",
+		"/v3/globalrolebindings/grb-abc":                           "globalrolebindings",
+		"/v3/project/c-abc:p-xyz/workloads":                        "workloads",
+		"/v3/cluster/c-abc/namespaces/ns":                          "namespaces",
+		"/v1/management.cattle.io.settings":                        "management.cattle.io.settings",
+		"/k8s/clusters/c-abc/api/v1/namespaces/default/secrets/s1": "secrets",
+		"/k8s/clusters/c-abc/apis/apps/v1/deployments":             "deployments",
+		"/api/v1/namespaces":                                       "namespaces",
+		"/api/v1/namespaces/default":                               "namespaces",
+		"/apis":                                                    "",
+		"/v3":                                                      "",
+		"/healthz":                                                 "",
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, resourceType(path), path)
+	}
+}
+
+func TestAuditHandlerPolicy(t *testing.T) {
+	sink := &recordingSink{}
+	writer := &LogWriter{Level: LevelMetadata, Output: sink}
+	policy, err := ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+	writer.SetPolicy(policy)
+
+	middleware, err := NewAuditLogMiddleware(writer)
+	require.NoError(t, err)
+	handler := middleware(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = rw.Write([]byte(`{"name":"grb"}`))
+	}))
+
+	admin := &user.DefaultInfo{Name: "u-admin"}
+	req := httptest.NewRequest(http.MethodGet, "/v3/globalrolebindings", nil)
+	req = req.WithContext(request.WithUser(req.Context(), admin))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.Len(t, sink.events, 1)
+	assert.Contains(t, sink.events[0], `"responseBody":{"name":"grb"}`)
+
+	req = httptest.NewRequest(http.MethodGet, "/v3/settings", nil)
+	req = req.WithContext(request.WithUser(req.Context(), admin))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.Len(t, sink.events, 2)
+	assert.NotContains(t, sink.events[1], "responseBody", "requests matching no rule use the default level")
+
+	excluded := &user.DefaultInfo{Name: "system:serviceaccount:cattle-system:rancher"}
+	req = httptest.NewRequest(http.MethodGet, "/v3/settings", nil)
+	req = req.WithContext(request.WithUser(req.Context(), excluded))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Len(t, sink.events, 2, "requests at level None should not be logged")
+}
+
+func TestAuditHandlerAnnotations(t *testing.T) {
+	sink := &recordingSink{}
+	middleware, err := NewAuditLogMiddleware(&LogWriter{Level: LevelMetadata, Output: sink})
+	require.NoError(t, err)
+	handler := middleware(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		util.AddAuditAnnotation(req.Context(), "auth.cattle.io/lockout", "user locked out")
+		rw.WriteHeader(http.StatusTooManyRequests)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v3-public/localProviders/local?action=login", nil)
+	req = req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: "system:cattle:error"}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.Len(t, sink.events, 1)
+	assert.Contains(t, sink.events[0], `"annotations":{"auth.cattle.io/lockout":"user locked out"}`)
+}
+
+func TestPolicyHandler(t *testing.T) {
+	writer := &LogWriter{Level: LevelMetadata}
+	h := &policyHandler{key: "cattle-system/" + PolicyConfigMapName, writer: writer}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: PolicyConfigMapName, Namespace: "cattle-system"},
+		Data:       map[string]string{PolicyConfigMapKey: testPolicy},
+	}
+
+	_, err := h.OnConfigMap("other/"+PolicyConfigMapName, cm)
+	require.NoError(t, err)
+	assert.Nil(t, writer.Policy())
+
+	_, err = h.OnConfigMap(h.key, cm)
+	require.NoError(t, err)
+	require.NotNil(t, writer.Policy())
+	assert.Len(t, writer.Policy().Rules, 4)
+
+	invalid := cm.DeepCopy()
+	invalid.Data[PolicyConfigMapKey] = "rules: {"
+	_, err = h.OnConfigMap(h.key, invalid)
+	require.NoError(t, err)
+	assert.Len(t, writer.Policy().Rules, 4, "invalid policies should not replace the current one")
+
+	_, err = h.OnConfigMap(h.key, nil)
+	require.NoError(t, err)
+	assert.Nil(t, writer.Policy())
+}
+
+type recordingSink struct {
+	events []string
+}
+
+func (r *recordingSink) Write(p []byte) (int, error) {
+	r.events = append(r.events, string(p))
+	return len(p), nil
+}
+
+func (r *recordingSink) Close() error {
+	return nil
+}
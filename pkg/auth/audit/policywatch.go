@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"context"
+
+	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// PolicyConfigMapName is the name of the ConfigMap holding the audit policy.
+	PolicyConfigMapName = "rancher-audit-policy"
+	// PolicyConfigMapKey is the key in the ConfigMap data holding the YAML encoded Policy.
+	PolicyConfigMapKey = "policy.yaml"
+)
+
+// WatchPolicy keeps the policy of writer in sync with the audit policy ConfigMap in namespace.
+// Removing the ConfigMap reverts to logging every request at the writer's Level.
+func WatchPolicy(ctx context.Context, configMaps corecontrollers.ConfigMapController, namespace string, writer *LogWriter) {
+	if writer == nil {
+		return
+	}
+	h := &policyHandler{
+		key:    namespace + "/" + PolicyConfigMapName,
+		writer: writer,
+	}
+	configMaps.OnChange(ctx, "audit-policy", h.OnConfigMap)
+}
+
+type policyHandler struct {
+	key    string
+	writer *LogWriter
+}
+
+func (h *policyHandler) OnConfigMap(key string, cm *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	if key != h.key {
+		return cm, nil
+	}
+
+	if cm == nil || !cm.DeletionTimestamp.IsZero() || cm.Data[PolicyConfigMapKey] == "" {
+		if h.writer.Policy() != nil {
+			logrus.Infof("auditLog: audit policy %s removed, logging all requests at level %d", h.key, h.writer.Level)
+			h.writer.SetPolicy(nil)
+		}
+		return cm, nil
+	}
+
+	policy, err := ParsePolicy([]byte(cm.Data[PolicyConfigMapKey]))
+	if err != nil {
+		// Keep the last valid policy rather than silently changing what gets audited.
+		logrus.Errorf("auditLog: ignoring invalid audit policy %s: %v", h.key, err)
+		return cm, nil
+	}
+
+	logrus.Infof("auditLog: loaded audit policy %s with %d rules", h.key, len(policy.Rules))
+	h.writer.SetPolicy(policy)
+	return cm, nil
+}
@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Redaction holds admin configured redaction rules, applied in addition to the built-in ones.
+type Redaction struct {
+	// Headers are request or response header names whose values are removed from the log.
+	Headers []string `json:"headers,omitempty"`
+	// Paths are dot separated JSON paths whose values are redacted in request and response bodies.
+	// A "*" segment matches any key of an object or any element of a list, e.g. "spec.values.*.password".
+	Paths []string `json:"paths,omitempty"`
+	// KeyPatterns are regular expressions. Values of any JSON key matching one of them are redacted.
+	KeyPatterns []string `json:"keyPatterns,omitempty"`
+
+	headers    []string
+	paths      [][]string
+	keyPattern *regexp.Regexp
+}
+
+// compile validates the redaction rules and prepares them for use.
+func (r *Redaction) compile() error {
+	r.headers = nil
+	for _, header := range r.Headers {
+		r.headers = append(r.headers, http.CanonicalHeaderKey(header))
+	}
+
+	r.paths = nil
+	for _, path := range r.Paths {
+		segments := strings.Split(path, ".")
+		for _, segment := range segments {
+			if segment == "" {
+				return fmt.Errorf("invalid redaction path %q: empty segment", path)
+			}
+		}
+		r.paths = append(r.paths, segments)
+	}
+
+	r.keyPattern = nil
+	if len(r.KeyPatterns) > 0 {
+		for _, pattern := range r.KeyPatterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("invalid redaction key pattern %q: %w", pattern, err)
+			}
+		}
+		r.keyPattern = regexp.MustCompile("(" + strings.Join(r.KeyPatterns, ")|(") + ")")
+	}
+	return nil
+}
+
+// redactHeaders removes the configured headers from headers.
+func (r *Redaction) redactHeaders(headers map[string][]string) {
+	if r == nil {
+		return
+	}
+	for _, header := range r.headers {
+		delete(headers, header)
+	}
+}
+
+// redactBody applies the configured paths and key patterns to body and returns whether anything was redacted.
+func (r *Redaction) redactBody(body map[string]interface{}) bool {
+	if r == nil {
+		return false
+	}
+
+	var changed bool
+	for _, path := range r.paths {
+		changed = redactPath(body, path) || changed
+	}
+	if r.keyPattern != nil {
+		changed = redactKeys(body, r.keyPattern) || changed
+	}
+	return changed
+}
+
+func redactPath(node interface{}, path []string) bool {
+	segment, last := path[0], len(path) == 1
+
+	var changed bool
+	switch val := node.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			if segment != "*" && segment != key {
+				continue
+			}
+			if last {
+				val[key] = redacted
+				changed = true
+				continue
+			}
+			changed = redactPath(child, path[1:]) || changed
+		}
+	case []interface{}:
+		for i, child := range val {
+			if segment != "*" && segment != strconv.Itoa(i) {
+				continue
+			}
+			if last {
+				val[i] = redacted
+				changed = true
+				continue
+			}
+			changed = redactPath(child, path[1:]) || changed
+		}
+	}
+	return changed
+}
+
+// redactKeys redacts the value of every key matching pattern, whatever the type of the value.
+func redactKeys(node interface{}, pattern *regexp.Regexp) bool {
+	var changed bool
+	switch val := node.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			if pattern.MatchString(key) {
+				val[key] = redacted
+				changed = true
+				continue
+			}
+			changed = redactKeys(child, pattern) || changed
+		}
+	case []interface{}:
+		for _, child := range val {
+			changed = redactKeys(child, pattern) || changed
+		}
+	}
+	return changed
+}
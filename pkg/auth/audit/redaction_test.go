@@ -0,0 +1,141 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testRedactionPolicy = `
+rules: []
+redaction:
+  headers: ["x-custom-secret"]
+  paths:
+  - spec.values.*.password
+  - answers.0
+  keyPatterns:
+  - "^[sS]ecret[kK]ey$"
+`
+
+func TestRedactionCompile(t *testing.T) {
+	_, err := ParsePolicy([]byte("redaction:\n  keyPatterns: ['(']\n"))
+	assert.Error(t, err)
+
+	_, err = ParsePolicy([]byte("redaction:\n  paths: ['spec..values']\n"))
+	assert.Error(t, err)
+}
+
+func TestRedactionRedactBody(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testRedactionPolicy))
+	require.NoError(t, err)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"spec": {"values": {"db": {"password": "p1", "user": "u1"}, "cache": {"password": {"nested": true}}}},
+		"answers": ["first", "second"],
+		"config": {"secretKey": "s1", "accessKey": "a1", "list": [{"SecretKey": "s2"}]}
+	}`), &body))
+
+	assert.True(t, policy.redaction().redactBody(body))
+
+	want := fmt.Sprintf(`{
+		"spec": {"values": {"db": {"password": "%[1]s", "user": "u1"}, "cache": {"password": "%[1]s"}}},
+		"answers": ["%[1]s", "second"],
+		"config": {"secretKey": "%[1]s", "accessKey": "a1", "list": [{"SecretKey": "%[1]s"}]}
+	}`, redacted)
+	got, err := json.Marshal(body)
+	require.NoError(t, err)
+	assert.JSONEq(t, want, string(got))
+
+	var nilPolicy *Policy
+	assert.False(t, nilPolicy.redaction().redactBody(body))
+}
+
+func TestAuditLogConfiguredRedaction(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testRedactionPolicy))
+	require.NoError(t, err)
+	sink := &recordingSink{}
+	writer := &LogWriter{Level: LevelRequestResponse, Output: sink}
+	writer.SetPolicy(policy)
+
+	middleware, err := NewAuditLogMiddleware(writer)
+	require.NoError(t, err)
+	handler := middleware(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", contentTypeJSON)
+		rw.Header().Set("X-Custom-Secret", "abc")
+		_, _ = rw.Write([]byte(`{"config":{"secretKey":"s1"}}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v3/nodetemplates", bytes.NewBufferString(`{"spec":{"values":{"db":{"password":"p1"}}}}`))
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set("X-Custom-Secret", "abc")
+	req = req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: "u-admin"}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Len(t, sink.events, 1)
+	event := sink.events[0]
+	assert.NotContains(t, event, "p1")
+	assert.NotContains(t, event, "s1")
+	assert.NotContains(t, event, "X-Custom-Secret")
+}
+
+func TestRedactionPreview(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testRedactionPolicy))
+	require.NoError(t, err)
+	writer := &LogWriter{Level: LevelMetadata}
+	writer.SetPolicy(policy)
+
+	allowed := true
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		sar := action.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		assert.Equal(t, PolicyConfigMapName, sar.Spec.ResourceAttributes.Name)
+		sar.Status.Allowed = allowed
+		return true, sar, nil
+	})
+
+	middleware, err := NewRedactionPreviewMiddleware(writer, clientset.AuthorizationV1().SubjectAccessReviews(), "cattle-system")
+	require.NoError(t, err)
+	handler := middleware(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	}))
+
+	preview := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, RedactionPreviewEndpoint, bytes.NewBufferString(body))
+		req = req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: "u-admin"}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := preview(`{"requestURI":"/v3/nodetemplates","headers":{"Authorization":["Bearer abc"],"X-Custom-Secret":["abc"],"Accept":["*/*"]},"body":{"password":"p1","config":{"secretKey":"s1","region":"us"}}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var output RedactionPreviewOutput
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &output))
+	assert.Equal(t, map[string][]string{"Accept": {"*/*"}}, output.Headers)
+	assert.JSONEq(t, fmt.Sprintf(`{"password":"%[1]s","config":{"secretKey":"%[1]s","region":"us"}}`, redacted), string(output.Body))
+
+	rec = preview(`{"body":["not","an","object"]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	allowed = false
+	rec = preview(`{"body":{}}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/settings", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusTeapot, rec.Code, "other paths should be passed through")
+}
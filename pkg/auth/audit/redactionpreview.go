@@ -0,0 +1,157 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/rancher/rancher/pkg/auth/util"
+	"github.com/sirupsen/logrus"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	authv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+const (
+	// RedactionPreviewEndpoint accepts a sample payload and returns it as it would be written to the audit log.
+	RedactionPreviewEndpoint = "/v1/auditRedactionPreview"
+	maxPreviewBodySize       = 1 << 20
+)
+
+// RedactionPreviewInput is a sample request or response to redact.
+type RedactionPreviewInput struct {
+	// RequestURI is used for the URI dependent redaction rules, e.g. for secrets.
+	RequestURI string          `json:"requestURI,omitempty"`
+	Headers    http.Header     `json:"headers,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+}
+
+// RedactionPreviewOutput is the redacted version of a RedactionPreviewInput.
+type RedactionPreviewOutput struct {
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    json.RawMessage     `json:"body,omitempty"`
+}
+
+// NewRedactionPreviewMiddleware serves RedactionPreviewEndpoint using the built-in redaction rules and those of the current
+// audit policy of writer. Only users allowed to get the audit policy ConfigMap in namespace may use it.
+func NewRedactionPreviewMiddleware(writer *LogWriter, sars authv1.SubjectAccessReviewInterface, namespace string) (func(http.Handler) http.Handler, error) {
+	sensitiveRegex, err := constructKeyRedactRegex()
+	if err != nil {
+		return nil, err
+	}
+	h := &redactionPreviewHandler{
+		writer:          writer,
+		sars:            sars,
+		namespace:       namespace,
+		sanitizingRegex: sensitiveRegex,
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != RedactionPreviewEndpoint {
+				next.ServeHTTP(rw, req)
+				return
+			}
+			h.ServeHTTP(rw, req)
+		})
+	}, nil
+}
+
+type redactionPreviewHandler struct {
+	writer          *LogWriter
+	sars            authv1.SubjectAccessReviewInterface
+	namespace       string
+	sanitizingRegex *regexp.Regexp
+}
+
+func (h *redactionPreviewHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		util.ReturnHTTPError(rw, req, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	authorized, err := h.authorize(req)
+	if err != nil {
+		logrus.Errorf("auditLog: failed to authorize redaction preview: %v", err)
+	}
+	if !authorized {
+		util.ReturnHTTPError(rw, req, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+		return
+	}
+
+	var input RedactionPreviewInput
+	if err := json.NewDecoder(io.LimitReader(req.Body, maxPreviewBodySize)).Decode(&input); err != nil {
+		util.ReturnHTTPError(rw, req, http.StatusBadRequest, fmt.Sprintf("invalid redaction preview input: %v", err))
+		return
+	}
+
+	output, err := h.preview(&input)
+	if err != nil {
+		util.ReturnHTTPError(rw, req, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rw.Header().Set("Content-Type", contentTypeJSON)
+	if err := json.NewEncoder(rw).Encode(output); err != nil {
+		logrus.Errorf("auditLog: failed to write redaction preview: %v", err)
+	}
+}
+
+func (h *redactionPreviewHandler) preview(input *RedactionPreviewInput) (*RedactionPreviewOutput, error) {
+	var policy *Policy
+	if h.writer != nil {
+		policy = h.writer.Policy()
+	}
+	a := &auditLog{
+		policy:            policy,
+		keysToRedactRegex: h.sanitizingRegex,
+	}
+
+	// Headers are previewed against both the request and response header rules.
+	sensitiveHeaders := append(append([]string{}, sensitiveRequestHeader...), sensitiveResponseHeader...)
+	headers := filterOutHeaders(input.Headers, sensitiveHeaders)
+	policy.redaction().redactHeaders(headers)
+
+	output := &RedactionPreviewOutput{Headers: headers}
+	if len(input.Body) > 0 {
+		body := a.redactSensitiveData(input.RequestURI, input.Body)
+		if len(body) == 0 {
+			return nil, fmt.Errorf("body must be a JSON object")
+		}
+		output.Body = body
+	}
+	return output, nil
+}
+
+// authorize checks the user can read the audit policy, which describes the same redaction rules.
+func (h *redactionPreviewHandler) authorize(req *http.Request) (bool, error) {
+	userInfo, ok := request.UserFrom(req.Context())
+	if !ok {
+		return false, fmt.Errorf("unable to extract user info from context")
+	}
+
+	extra := map[string]authzv1.ExtraValue{}
+	for k, v := range userInfo.GetExtra() {
+		extra[k] = authzv1.ExtraValue(v)
+	}
+	response, err := h.sars.Create(req.Context(), &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authzv1.ResourceAttributes{
+				Resource:  "configmaps",
+				Verb:      "get",
+				Name:      PolicyConfigMapName,
+				Namespace: h.namespace,
+			},
+			User:   userInfo.GetName(),
+			Groups: userInfo.GetGroups(),
+			Extra:  extra,
+			UID:    userInfo.GetUID(),
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to create a SubjectAccessReview: %w", err)
+	}
+	return response.Status.Allowed, nil
+}
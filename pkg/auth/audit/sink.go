@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var errSinkClosed = fmt.Errorf("audit log sink is closed")
+
+// Sink is a destination for serialized audit events. Each call to Write receives exactly one
+// newline terminated JSON event.
+type Sink interface {
+	io.Writer
+	io.Closer
+}
+
+// multiSink fans every audit event out to all of its sinks.
+type multiSink []Sink
+
+func (m multiSink) Write(p []byte) (int, error) {
+	var errs []error
+	for _, sink := range m {
+		if _, err := sink.Write(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return 0, errors.Join(errs...)
+	}
+	return len(p), nil
+}
+
+func (m multiSink) Close() error {
+	var errs []error
+	for _, sink := range m {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// stdoutSink writes audit events as JSON lines to stdout so they can be picked up by the container runtime.
+type stdoutSink struct {
+	out io.Writer
+}
+
+func newStdoutSink() Sink {
+	return &stdoutSink{out: os.Stdout}
+}
+
+func (s *stdoutSink) Write(p []byte) (int, error) {
+	return s.out.Write(p)
+}
+
+func (s *stdoutSink) Close() error {
+	return nil
+}
@@ -0,0 +1,223 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogWriterFromOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      WriterOptions
+		wantNil   bool
+		wantErr   bool
+		wantMulti bool
+	}{
+		{
+			name:    "audit disabled",
+			opts:    WriterOptions{Level: LevelNull, Path: "/tmp/audit.log"},
+			wantNil: true,
+		},
+		{
+			name:    "default file sink without a path",
+			opts:    WriterOptions{Level: LevelMetadata},
+			wantNil: true,
+		},
+		{
+			name: "default file sink",
+			opts: WriterOptions{Level: LevelMetadata, Path: "/tmp/audit.log"},
+		},
+		{
+			name:      "file and stdout",
+			opts:      WriterOptions{Level: LevelMetadata, Path: "/tmp/audit.log", Sinks: []string{SinkFile, SinkStdout}},
+			wantMulti: true,
+		},
+		{
+			name:    "webhook without url",
+			opts:    WriterOptions{Level: LevelMetadata, Sinks: []string{SinkWebhook}},
+			wantErr: true,
+		},
+		{
+			name:    "syslog without address",
+			opts:    WriterOptions{Level: LevelMetadata, Sinks: []string{SinkSyslog}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown sink",
+			opts:    WriterOptions{Level: LevelMetadata, Sinks: []string{"kafka"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer, err := NewLogWriterFromOptions(tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantNil {
+				assert.Nil(t, writer)
+				return
+			}
+			require.NotNil(t, writer)
+			_, isMulti := writer.Output.(multiSink)
+			assert.Equal(t, tt.wantMulti, isMulti)
+		})
+	}
+}
+
+func TestMultiSink(t *testing.T) {
+	var first, second bytes.Buffer
+	sink := multiSink{&stdoutSink{out: &first}, &stdoutSink{out: &second}}
+
+	n, err := sink.Write([]byte("{\"a\":1}\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 8, n)
+	assert.Equal(t, "{\"a\":1}\n", first.String())
+	assert.Equal(t, "{\"a\":1}\n", second.String())
+}
+
+func TestWebhookSinkBatchesAndFlushesOnClose(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		batches []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		assert.Equal(t, contentTypeNDJSON, req.Header.Get("Content-Type"))
+		lock.Lock()
+		batches = append(batches, string(body))
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	sink := newWebhookSink(server.URL, 2, time.Hour)
+	for _, event := range []string{"{\"a\":1}\n", "{\"a\":2}\n", "{\"a\":3}\n"} {
+		_, err := sink.Write([]byte(event))
+		require.NoError(t, err)
+	}
+	require.NoError(t, sink.Close())
+
+	assert.Equal(t, []string{"{\"a\":1}\n{\"a\":2}\n", "{\"a\":3}\n"}, batches)
+
+	_, err := sink.Write([]byte("{}\n"))
+	assert.ErrorIs(t, err, errSinkClosed)
+}
+
+func TestWebhookSinkRetries(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		attempts int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		attempts++
+		if attempts < 3 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	sink := newWebhookSink(server.URL, 1, time.Hour)
+	var sleeps []time.Duration
+	sink.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	_, err := sink.Write([]byte("{}\n"))
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []time.Duration{webhookInitialBackoff, 2 * webhookInitialBackoff}, sleeps)
+}
+
+func TestWebhookSinkDoesNotRetryClientErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		rw.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink := newWebhookSink(server.URL, 1, time.Hour)
+	sink.sleep = func(time.Duration) {}
+
+	_, err := sink.Write([]byte("{}\n"))
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+
+	assert.Equal(t, 1, attempts)
+}
+
+func TestSyslogSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		prefix, err := reader.ReadString(' ')
+		if err != nil {
+			return
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(prefix))
+		if err != nil {
+			return
+		}
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			return
+		}
+		received <- string(msg)
+	}()
+
+	sink := newSyslogSink(listener.Addr().String(), false, false)
+	sink.hostname = "rancher-0"
+	sink.now = func() time.Time { return time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	_, err = sink.Write([]byte("{\"auditID\":\"1\"}\n"))
+	require.NoError(t, err)
+	defer sink.Close()
+
+	select {
+	case msg := <-received:
+		assert.Regexp(t, `^<110>1 2023-01-02T03:04:05.000000Z rancher-0 rancher \d+ audit - \{"auditID":"1"\}$`, msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for syslog message")
+	}
+}
+
+func TestSyslogSinkQueueFull(t *testing.T) {
+	// Nothing drains the queue, as if the receiver was unreachable.
+	sink := &syslogSink{
+		hostname: "rancher-0",
+		now:      time.Now,
+		messages: make(chan []byte, 1),
+	}
+
+	_, err := sink.Write([]byte("{\"auditID\":\"1\"}\n"))
+	require.NoError(t, err)
+	_, err = sink.Write([]byte("{\"auditID\":\"2\"}\n"))
+	assert.ErrorIs(t, err, errSyslogQueueFull, "the event is dropped instead of blocking the request")
+	assert.Equal(t, uint64(1), sink.dropped.Load())
+}
@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// syslogPriority is facility "log audit" (13) with severity informational (6).
+	syslogPriority     = 13*8 + 6
+	syslogAppName      = "rancher"
+	syslogMsgID        = "audit"
+	syslogTimeFormat   = "2006-01-02T15:04:05.000000Z07:00"
+	syslogDialTimeout  = 10 * time.Second
+	syslogWriteTimeout = 10 * time.Second
+	syslogQueueSize    = 10000
+)
+
+var errSyslogQueueFull = fmt.Errorf("audit log syslog queue is full")
+
+// syslogSink sends audit events as RFC5424 messages over TCP, optionally wrapped in TLS (RFC5425).
+// Messages are framed using octet counting. Events are queued and sent in the background so that a slow
+// or unreachable receiver does not hold up requests. Events are dropped when the queue is full or they
+// can not be sent, and the number of dropped events is logged once the receiver accepts events again.
+// The connection is re-established lazily after a failure.
+type syslogSink struct {
+	address  string
+	useTLS   bool
+	insecure bool
+	hostname string
+	now      func() time.Time
+
+	lock     sync.RWMutex
+	closed   bool
+	messages chan []byte
+	done     chan struct{}
+	dropped  atomic.Uint64
+
+	// conn is only used by the goroutine sending the queued messages.
+	conn net.Conn
+}
+
+func newSyslogSink(address string, useTLS, insecure bool) *syslogSink {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	s := &syslogSink{
+		address:  address,
+		useTLS:   useTLS,
+		insecure: insecure,
+		hostname: hostname,
+		now:      time.Now,
+		messages: make(chan []byte, syslogQueueSize),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *syslogSink) Write(p []byte) (int, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.closed {
+		return 0, errSinkClosed
+	}
+
+	// The message is formatted now so that it carries the time of the event, not of the send.
+	select {
+	case s.messages <- s.format(p):
+		return len(p), nil
+	default:
+		s.dropped.Add(1)
+		return 0, errSyslogQueueFull
+	}
+}
+
+// Close sends the queued messages and closes the connection.
+func (s *syslogSink) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.messages)
+	s.lock.Unlock()
+
+	<-s.done
+	return nil
+}
+
+func (s *syslogSink) run() {
+	defer close(s.done)
+	defer func() {
+		if s.conn != nil {
+			s.conn.Close()
+		}
+	}()
+
+	for msg := range s.messages {
+		if err := s.send(msg); err != nil {
+			s.dropped.Add(1)
+			logrus.Debugf("auditLog: dropping audit event: %v", err)
+			continue
+		}
+		if dropped := s.dropped.Swap(0); dropped > 0 {
+			logrus.Errorf("auditLog: dropped %d audit events for syslog receiver %s", dropped, s.address)
+		}
+	}
+}
+
+// send writes msg to the receiver, retrying once on a fresh connection in case the receiver dropped the previous one.
+func (s *syslogSink) send(msg []byte) error {
+	var err error
+	for i := 0; i < 2; i++ {
+		if s.conn == nil {
+			if s.conn, err = s.dial(); err != nil {
+				return fmt.Errorf("failed to connect to syslog receiver %s: %w", s.address, err)
+			}
+		}
+		if err = s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout)); err == nil {
+			if _, err = s.conn.Write(msg); err == nil {
+				return nil
+			}
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return fmt.Errorf("failed to write to syslog receiver %s: %w", s.address, err)
+}
+
+func (s *syslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+	if !s.useTLS {
+		return dialer.Dial("tcp", s.address)
+	}
+	return tls.DialWithDialer(dialer, "tcp", s.address, &tls.Config{
+		InsecureSkipVerify: s.insecure,
+	})
+}
+
+// format renders p as an octet counted RFC5424 message.
+func (s *syslogSink) format(p []byte) []byte {
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		syslogPriority,
+		s.now().UTC().Format(syslogTimeFormat),
+		s.hostname,
+		syslogAppName,
+		os.Getpid(),
+		syslogMsgID,
+		bytes.TrimSuffix(p, []byte("\n")),
+	)
+	return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+}
@@ -0,0 +1,265 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/pkg/reexec"
+	"github.com/urfave/cli"
+)
+
+// RegisterVerifyCommand registers the verify-audit-log command, which checks the hash chains of a set of audit logs.
+func RegisterVerifyCommand() {
+	reexec.Register("/usr/bin/verify-audit-log", verifyAuditLog)
+	reexec.Register("verify-audit-log", verifyAuditLog)
+}
+
+func verifyAuditLog() {
+	app := cli.NewApp()
+	app.Description = "Verify the hash chains of audit log files, including rotated backups, and report gaps or modifications"
+	app.ArgsUsage = "FILE..."
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "public-key",
+			Usage: "PEM encoded ed25519 public key used to verify checkpoint signatures",
+		},
+	}
+
+	app.Action = func(c *cli.Context) error {
+		if c.NArg() == 0 {
+			return fmt.Errorf("at least one audit log file is required")
+		}
+
+		var publicKey ed25519.PublicKey
+		if path := c.String("public-key"); path != "" {
+			var err error
+			if publicKey, err = LoadCheckpointPublicKey(path); err != nil {
+				return err
+			}
+		}
+
+		report, err := VerifyFiles(c.Args(), publicKey)
+		if err != nil {
+			return err
+		}
+		report.Print(os.Stdout)
+		if len(report.Problems) > 0 {
+			return fmt.Errorf("audit log verification failed with %d problems", len(report.Problems))
+		}
+		return nil
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// VerifyReport is the outcome of verifying a set of audit logs.
+type VerifyReport struct {
+	Chains []ChainReport
+	// Problems are evidence of missing or modified records.
+	Problems []string
+	// Warnings are conditions that are expected in normal operation, such as records removed by log rotation,
+	// but still limit what could be verified.
+	Warnings []string
+	// Unchained is the number of records without chain information.
+	Unchained int
+}
+
+// ChainReport summarizes one chain, that is the records written by one replica between a start and a stop.
+type ChainReport struct {
+	ID             string
+	Replica        string
+	FirstSeq       uint64
+	LastSeq        uint64
+	Records        int
+	Checkpoints    int
+	LastCheckpoint uint64
+	Closed         bool
+}
+
+// Print writes a human readable version of the report to w.
+func (r *VerifyReport) Print(w io.Writer) {
+	for _, chain := range r.Chains {
+		state := "open"
+		if chain.Closed {
+			state = "closed"
+		}
+		fmt.Fprintf(w, "chain %s (replica %s): records %d-%d, %d records, %d checkpoints, last checkpoint at %d, %s\n",
+			chain.ID, chain.Replica, chain.FirstSeq, chain.LastSeq, chain.Records, chain.Checkpoints, chain.LastCheckpoint, state)
+	}
+	if r.Unchained > 0 {
+		fmt.Fprintf(w, "%d records without chain information\n", r.Unchained)
+	}
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(w, "WARNING: %s\n", warning)
+	}
+	for _, problem := range r.Problems {
+		fmt.Fprintf(w, "PROBLEM: %s\n", problem)
+	}
+	if len(r.Problems) == 0 {
+		fmt.Fprintln(w, "OK: no gaps or modifications found")
+	}
+}
+
+type chainedRecord struct {
+	info       chainInfo
+	checkpoint *checkpoint
+	hash       string
+	location   string
+}
+
+// VerifyFiles verifies the audit records in paths. Files may be given in any order and may be gzip compressed.
+// If publicKey is nil checkpoint signatures are not checked.
+func VerifyFiles(paths []string, publicKey ed25519.PublicKey) (*VerifyReport, error) {
+	report := &VerifyReport{}
+	chains := map[string]map[uint64]*chainedRecord{}
+
+	for _, path := range paths {
+		if err := readRecords(path, report, chains); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]string, 0, len(chains))
+	for id := range chains {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		report.Chains = append(report.Chains, verifyChain(chains[id], publicKey, report))
+	}
+	return report, nil
+}
+
+func readRecords(path string, report *VerifyReport, chains map[string]map[uint64]*chainedRecord) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var reader io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	buf := bufio.NewReader(reader)
+	for lineNum := 1; ; lineNum++ {
+		line, err := buf.ReadBytes('\n')
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if len(line) > 0 {
+			location := fmt.Sprintf("%s:%d", path, lineNum)
+			var record struct {
+				Chain      *chainInfo  `json:"chain"`
+				Checkpoint *checkpoint `json:"checkpoint"`
+			}
+			if jsonErr := json.Unmarshal(line, &record); jsonErr != nil {
+				report.Problems = append(report.Problems, fmt.Sprintf("%s: record is not valid JSON: %v", location, jsonErr))
+			} else if record.Chain == nil {
+				report.Unchained++
+			} else {
+				if chains[record.Chain.ID] == nil {
+					chains[record.Chain.ID] = map[uint64]*chainedRecord{}
+				}
+				entry := &chainedRecord{
+					info:       *record.Chain,
+					checkpoint: record.Checkpoint,
+					hash:       hashRecord(line),
+					location:   location,
+				}
+				if existing, ok := chains[record.Chain.ID][record.Chain.Seq]; ok {
+					if existing.hash != entry.hash {
+						report.Problems = append(report.Problems, fmt.Sprintf("%s: record %d of chain %s differs from the copy at %s",
+							location, record.Chain.Seq, record.Chain.ID, existing.location))
+					}
+				} else {
+					chains[record.Chain.ID][record.Chain.Seq] = entry
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+}
+
+func verifyChain(records map[uint64]*chainedRecord, publicKey ed25519.PublicKey, report *VerifyReport) ChainReport {
+	seqs := make([]uint64, 0, len(records))
+	for seq := range records {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	first := records[seqs[0]]
+	result := ChainReport{
+		ID:       first.info.ID,
+		Replica:  first.info.Replica,
+		FirstSeq: seqs[0],
+		LastSeq:  seqs[len(seqs)-1],
+		Records:  len(seqs),
+	}
+
+	if result.FirstSeq > 1 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("chain %s: records 1-%d are missing, they may have been removed by log rotation",
+			result.ID, result.FirstSeq-1))
+	}
+
+	for i, seq := range seqs {
+		record := records[seq]
+		if i > 0 {
+			prevSeq := seqs[i-1]
+			if seq != prevSeq+1 {
+				report.Problems = append(report.Problems, fmt.Sprintf("chain %s: records %d-%d are missing before %s",
+					result.ID, prevSeq+1, seq-1, record.location))
+			} else if record.info.PrevHash != records[prevSeq].hash {
+				report.Problems = append(report.Problems, fmt.Sprintf("chain %s: record %d at %s was modified, its hash does not match the next record at %s",
+					result.ID, prevSeq, records[prevSeq].location, record.location))
+			}
+		} else if seq == 1 && record.info.PrevHash != "" {
+			report.Problems = append(report.Problems, fmt.Sprintf("chain %s: first record at %s references a previous record", result.ID, record.location))
+		}
+
+		if record.checkpoint == nil {
+			continue
+		}
+		result.Checkpoints++
+		result.LastCheckpoint = seq
+		result.Closed = record.checkpoint.Final
+		if record.checkpoint.Seq != seq-1 || record.checkpoint.Hash != record.info.PrevHash {
+			report.Problems = append(report.Problems, fmt.Sprintf("chain %s: checkpoint at %s does not cover the record preceding it", result.ID, record.location))
+			continue
+		}
+		if publicKey != nil {
+			signature, err := base64.StdEncoding.DecodeString(record.checkpoint.Signature)
+			if err != nil || !ed25519.Verify(publicKey, checkpointPayload(record.info.ID, record.info.Replica, *record.checkpoint), signature) {
+				report.Problems = append(report.Problems, fmt.Sprintf("chain %s: checkpoint at %s has an invalid signature", result.ID, record.location))
+			}
+		}
+	}
+
+	if !result.Closed && result.Checkpoints > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("chain %s: no final checkpoint, records after %d could have been truncated or the replica is still running",
+			result.ID, result.LastCheckpoint))
+	}
+	return result
+}
@@ -0,0 +1,168 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWebhookBatchSize     = 100
+	defaultWebhookFlushInterval = 5 * time.Second
+	webhookQueueSize            = 10000
+	webhookMaxAttempts          = 5
+	webhookInitialBackoff       = 500 * time.Millisecond
+	webhookMaxBackoff           = 30 * time.Second
+	contentTypeNDJSON           = "application/x-ndjson"
+)
+
+var errWebhookQueueFull = fmt.Errorf("audit log webhook queue is full")
+
+// webhookSink buffers audit events and POSTs them in batches as newline delimited JSON.
+// Failed batches are retried with exponential backoff. Any events still queued when the
+// sink is closed are flushed before Close returns.
+type webhookSink struct {
+	url           string
+	client        *http.Client
+	batchSize     int
+	flushInterval time.Duration
+	sleep         func(time.Duration)
+
+	lock   sync.RWMutex
+	closed bool
+	events chan []byte
+	done   chan struct{}
+}
+
+func newWebhookSink(url string, batchSize int, flushInterval time.Duration) *webhookSink {
+	if batchSize <= 0 {
+		batchSize = defaultWebhookBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = defaultWebhookFlushInterval
+	}
+
+	w := &webhookSink{
+		url:           url,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		sleep:         time.Sleep,
+		events:        make(chan []byte, webhookQueueSize),
+		done:          make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *webhookSink) Write(p []byte) (int, error) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	if w.closed {
+		return 0, errSinkClosed
+	}
+
+	// The caller may reuse p once Write returns.
+	event := make([]byte, len(p))
+	copy(event, p)
+
+	select {
+	case w.events <- event:
+		return len(p), nil
+	default:
+		return 0, errWebhookQueueFull
+	}
+}
+
+func (w *webhookSink) Close() error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.events)
+	w.lock.Unlock()
+
+	<-w.done
+	return nil
+}
+
+func (w *webhookSink) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	var batch [][]byte
+	for {
+		select {
+		case event, ok := <-w.events:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= w.batchSize {
+				w.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			w.flush(batch)
+			batch = nil
+		}
+	}
+}
+
+func (w *webhookSink) flush(batch [][]byte) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body := bytes.Join(batch, nil)
+	backoff := webhookInitialBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := w.post(body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= webhookMaxAttempts {
+			logrus.Errorf("auditLog: dropping %d audit events after %d attempts to send to webhook: %v", len(batch), attempt, err)
+			return
+		}
+		logrus.Debugf("auditLog: failed to send audit events to webhook, retrying in %s: %v", backoff, err)
+		w.sleep(backoff)
+		backoff *= 2
+		if backoff > webhookMaxBackoff {
+			backoff = webhookMaxBackoff
+		}
+	}
+}
+
+// post sends body to the webhook and reports whether a failure is worth retrying.
+func (w *webhookSink) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", contentTypeNDJSON)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+}
@@ -3,19 +3,26 @@
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
+	"time"
 
 	v32 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
 
 	"github.com/pkg/errors"
 	"github.com/rancher/norman/httperror"
 	"github.com/rancher/norman/types"
+	"github.com/rancher/norman/types/slice"
 	"github.com/rancher/rancher/pkg/auth/providers/common"
 	"github.com/rancher/rancher/pkg/auth/tokens"
+	"github.com/rancher/rancher/pkg/auth/util"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/rbac"
+	"github.com/rancher/rancher/pkg/settings"
 	"github.com/rancher/rancher/pkg/types/config"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/tools/cache"
@@ -27,17 +34,26 @@
 	gmPrincipalIndex      = "authn.management.cattle.io/groupmember-principalid-index"
 	userSearchIndex       = "authn.management.cattle.io/user-search-index"
 	groupSearchIndex      = "authn.management.cattle.io/group-search-index"
+	grbByUserIndex        = "authn.management.cattle.io/local-grb-by-user-index"
 	searchIndexDefaultLen = 6
+
+	auditAnnotationLockout = "auth.cattle.io/lockout"
+	auditAnnotationMFA     = "auth.cattle.io/mfa"
 )
 
 type Provider struct {
 	userLister   v3.UserLister
+	users        v3.UserInterface
 	groupLister  v3.GroupLister
 	userIndexer  cache.Indexer
 	gmIndexer    cache.Indexer
 	groupIndexer cache.Indexer
 	tokenMGR     *tokens.Manager
 	invalidHash  []byte
+	throttle     *loginThrottle
+	mfa          *MFAStore
+	grbIndexer   cache.Indexer
+	grLister     v3.GlobalRoleLister
 }
 
 func Configure(ctx context.Context, mgmtCtx *config.ScaledContext, tokenMGR *tokens.Manager) common.AuthProvider {
@@ -53,6 +69,10 @@ func Configure(ctx context.Context, mgmtCtx *config.ScaledContext, tokenMGR *tok
 	gIndexers := map[string]cache.IndexFunc{groupSearchIndex: groupSearchIndexer}
 	gInformer.AddIndexers(gIndexers)
 
+	grbInformer := mgmtCtx.Management.GlobalRoleBindings("").Controller().Informer()
+	grbIndexers := map[string]cache.IndexFunc{grbByUserIndex: grbByUserIndexer}
+	grbInformer.AddIndexers(grbIndexers)
+
 	invalidHash, _ := bcrypt.GenerateFromPassword([]byte("invalid"), bcrypt.DefaultCost)
 
 	l := &Provider{
@@ -61,8 +81,13 @@ func Configure(ctx context.Context, mgmtCtx *config.ScaledContext, tokenMGR *tok
 		groupLister:  mgmtCtx.Management.Groups("").Controller().Lister(),
 		groupIndexer: gInformer.GetIndexer(),
 		userLister:   mgmtCtx.Management.Users("").Controller().Lister(),
+		users:        mgmtCtx.Management.Users(""),
 		tokenMGR:     tokenMGR,
 		invalidHash:  invalidHash,
+		throttle:     newLoginThrottle(),
+		mfa:          NewMFAStore(mgmtCtx.Core.Secrets(""), mgmtCtx.Core.Secrets("").Controller().Lister()),
+		grbIndexer:   grbInformer.GetIndexer(),
+		grLister:     mgmtCtx.Management.GlobalRoles("").Controller().Lister(),
 	}
 	return l
 }
@@ -110,20 +135,63 @@ func (l *Provider) AuthenticateUser(ctx context.Context, input interface{}) (v3.
 	pwd := localInput.Password
 
 	authFailedError := httperror.NewAPIError(httperror.Unauthorized, "authentication failed")
+	// The same error is returned for locked out users and source IPs, whether the user exists or not.
+	lockedOutError := httperror.NewAPIErrorLong(http.StatusTooManyRequests, util.GetHTTPErrorCode(http.StatusTooManyRequests),
+		"too many failed login attempts, try again later")
+
+	clientIP := requestClientIP(ctx)
+	if l.throttle.ipBlocked(clientIP) {
+		logrus.Debugf("Rejecting login for User [%s] from throttled source IP %s", username, clientIP)
+		return v3.Principal{}, nil, "", lockedOutError
+	}
+
 	user, err := l.getUser(username)
 	if err != nil {
 		// If the user don't exist the password is evaluated
 		// to avoid user enumeration via timing attack (time based side-channel).
 		bcrypt.CompareHashAndPassword(l.invalidHash, []byte(pwd))
 		logrus.Debugf("Get User [%s] failed during Authentication: %v", username, err)
+		if l.throttle.unknownLocked(username) || l.loginFailed(ctx, nil, username, clientIP) {
+			return v3.Principal{}, nil, "", lockedOutError
+		}
 		return v3.Principal{}, nil, "", authFailedError
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(pwd)); err != nil {
+	// The password is evaluated before the lockout is checked, as for unknown users, so that locked out users can't be
+	// told apart by the time of the response.
+	passwordErr := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(pwd))
+	if lockedOut(user.Annotations, time.Now()) {
+		logrus.Debugf("Rejecting login for locked out User [%s]", username)
+		util.AddAuditAnnotation(ctx, auditAnnotationLockout, "user locked out")
+		return v3.Principal{}, nil, "", lockedOutError
+	}
+
+	if err := passwordErr; err != nil {
 		logrus.Debugf("Authentication failed for User [%s]: %v", username, err)
+		if l.loginFailed(ctx, user, username, clientIP) {
+			return v3.Principal{}, nil, "", lockedOutError
+		}
 		return v3.Principal{}, nil, "", authFailedError
 	}
 
+	if err := l.checkMFA(ctx, user, localInput.MFACode, clientIP); err != nil {
+		return v3.Principal{}, nil, "", err
+	}
+	l.throttle.succeeded(username)
+
+	if policy := ReadPasswordPolicy(); !user.MustChangePassword && policy.Expired(user, time.Now()) {
+		logrus.Infof("Password of User [%s] expired, it must be changed", username)
+		user = user.DeepCopy()
+		user.MustChangePassword = true
+		if _, err := l.users.Update(user); err != nil {
+			logrus.Errorf("Failed to require User [%s] to change their expired password: %v", username, err)
+		}
+	} else if updated := user.DeepCopy(); policy.StartMaxAge(updated, time.Now()) {
+		if _, err := l.users.Update(updated); err != nil {
+			logrus.Errorf("Failed to record the password change time of User [%s]: %v", username, err)
+		}
+	}
+
 	principalID := getLocalPrincipalID(user)
 	userPrincipal := l.toPrincipal("user", user.DisplayName, user.Username, principalID, nil)
 	userPrincipal.Me = true
@@ -136,6 +204,136 @@ func (l *Provider) AuthenticateUser(ctx context.Context, input interface{}) (v3.
 	return userPrincipal, groupPrincipals, "", nil
 }
 
+// loginFailed records a failed login and locks out the user or source IP once they reach their limit. It returns true
+// if the login caused a lockout.
+func (l *Provider) loginFailed(ctx context.Context, user *v3.User, username, clientIP string) bool {
+	s := readLockoutSettings()
+	lockUser, blockIP := l.throttle.failed(username, clientIP, s)
+
+	if blockIP {
+		logrus.Warnf("Too many failed logins from source IP %s, rejecting its logins for %v", clientIP, s.duration)
+		util.AddAuditAnnotation(ctx, auditAnnotationLockout, "source IP "+clientIP+" locked out")
+	}
+	if !lockUser {
+		return blockIP
+	}
+
+	logrus.Warnf("Too many failed logins for User [%s], locking it out for %v", username, s.duration)
+	util.AddAuditAnnotation(ctx, auditAnnotationLockout, "user locked out")
+	if user == nil {
+		// Unknown usernames are locked out in memory only, so they can't be told apart from existing users.
+		l.throttle.lockUnknown(username, s.duration)
+		return true
+	}
+
+	user = user.DeepCopy()
+	if user.Annotations == nil {
+		user.Annotations = map[string]string{}
+	}
+	user.Annotations[LockedUntilAnnotation] = time.Now().Add(s.duration).UTC().Format(time.RFC3339)
+	if _, err := l.users.Update(user); err != nil {
+		logrus.Errorf("Failed to lock out User [%s]: %v", username, err)
+	}
+	return true
+}
+
+// checkMFA is the second login step of users enrolled in multi-factor authentication. A missing code is not counted as
+// a failed login, as clients only learn that a code is required from the first attempt.
+func (l *Provider) checkMFA(ctx context.Context, user *v3.User, code, clientIP string) error {
+	enrolled, err := l.mfa.Enrolled(user.Name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get multi-factor authentication of %v", user.Name)
+	}
+
+	if !enrolled {
+		if settings.AuthLocalMFARequiredForAdmins.Get() != "true" {
+			return nil
+		}
+		admin, err := l.isAdmin(user)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get global roles of %v", user.Name)
+		}
+		if admin {
+			logrus.Debugf("Rejecting login for User [%s] not enrolled in multi-factor authentication", user.Username)
+			util.AddAuditAnnotation(ctx, auditAnnotationMFA, "enrollment required")
+			return httperror.NewAPIErrorLong(http.StatusUnauthorized, "MFAEnrollmentRequired",
+				"multi-factor authentication is required, enroll before logging in")
+		}
+		return nil
+	}
+
+	if code == "" {
+		return httperror.NewAPIErrorLong(http.StatusUnauthorized, "MFARequired", "multi-factor authentication code required")
+	}
+	if err := l.mfa.Verify(user.Name, code); err != nil {
+		if err == ErrMFAThrottled {
+			util.AddAuditAnnotation(ctx, auditAnnotationMFA, "throttled")
+			return httperror.NewAPIErrorLong(http.StatusTooManyRequests, util.GetHTTPErrorCode(http.StatusTooManyRequests), err.Error())
+		}
+		if err != ErrInvalidMFACode {
+			logrus.Debugf("Failed to verify multi-factor authentication code of User [%s]: %v", user.Username, err)
+		}
+		util.AddAuditAnnotation(ctx, auditAnnotationMFA, "invalid code")
+		if l.loginFailed(ctx, user, user.Username, clientIP) {
+			return httperror.NewAPIErrorLong(http.StatusTooManyRequests, util.GetHTTPErrorCode(http.StatusTooManyRequests),
+				"too many failed login attempts, try again later")
+		}
+		return httperror.NewAPIError(httperror.Unauthorized, "authentication failed")
+	}
+	return nil
+}
+
+// isAdmin returns true if user is bound to a GlobalRole granting full access.
+func (l *Provider) isAdmin(user *v3.User) (bool, error) {
+	grbs, err := l.grbIndexer.ByIndex(grbByUserIndex, user.Name)
+	if err != nil {
+		return false, err
+	}
+	for _, obj := range grbs {
+		grb, ok := obj.(*v3.GlobalRoleBinding)
+		if !ok {
+			continue
+		}
+		gr, err := l.grLister.Get("", grb.GlobalRoleName)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		if isAdminRole(gr) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isAdminRole returns true for the builtin admin role and roles with admin resource and nonResourceURLs rules.
+func isAdminRole(gr *v3.GlobalRole) bool {
+	if gr.Builtin && gr.Name == rbac.GlobalAdmin {
+		return true
+	}
+
+	var hasResourceRule, hasNonResourceRule bool
+	for _, rule := range gr.Rules {
+		if slice.ContainsString(rule.Resources, "*") && slice.ContainsString(rule.APIGroups, "*") && slice.ContainsString(rule.Verbs, "*") {
+			hasResourceRule = true
+		}
+		if slice.ContainsString(rule.NonResourceURLs, "*") && slice.ContainsString(rule.Verbs, "*") {
+			hasNonResourceRule = true
+		}
+	}
+	return hasResourceRule && hasNonResourceRule
+}
+
+// requestClientIP returns the client IP of the request stored in ctx by the login handler.
+func requestClientIP(ctx context.Context) string {
+	req, ok := ctx.Value(util.RequestKey).(*http.Request)
+	if !ok {
+		return ""
+	}
+	return util.RequestClientIP(req)
+}
+
 func getLocalPrincipalID(user *v3.User) string {
 	// TODO error condition handling: no principal, more than one that would match
 	var principalID string
@@ -378,6 +576,14 @@ func userNameIndexer(obj interface{}) ([]string, error) {
 	return []string{user.Username}, nil
 }
 
+func grbByUserIndexer(obj interface{}) ([]string, error) {
+	grb, ok := obj.(*v3.GlobalRoleBinding)
+	if !ok || grb.UserName == "" {
+		return []string{}, nil
+	}
+	return []string{grb.UserName}, nil
+}
+
 func gmPIdIndexer(obj interface{}) ([]string, error) {
 	gm, ok := obj.(*v3.GroupMember)
 	if !ok {
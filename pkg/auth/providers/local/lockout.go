@@ -0,0 +1,235 @@
+package local
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// LockedUntilAnnotation is set on a user locked out after too many failed logins. The value is an RFC3339 time.
+	// Removing it, e.g. with the unlock action of the user, unlocks the user.
+	LockedUntilAnnotation = "cattle.io/locked-until"
+
+	defaultLockoutDuration = 15 * time.Minute
+	// mfaCodeAttempts is the number of invalid multi-factor authentication codes of a user after which their codes are
+	// rejected for the lockout duration.
+	mfaCodeAttempts = 5
+)
+
+// loginThrottle counts failed logins per username and per source IP. The counts and the source IP throttling are kept
+// in memory of each replica, so with several replicas an attacker gets up to the limits per replica. A user lockout is
+// persisted on the user so it applies to all replicas.
+type loginThrottle struct {
+	now func() time.Time
+
+	lock     sync.Mutex
+	users    map[string][]time.Time
+	ips      map[string][]time.Time
+	ipsUntil map[string]time.Time
+	// unknownUntil holds the lockouts of usernames that do not exist, which can't be persisted.
+	unknownUntil map[string]time.Time
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{
+		now:          time.Now,
+		users:        map[string][]time.Time{},
+		ips:          map[string][]time.Time{},
+		ipsUntil:     map[string]time.Time{},
+		unknownUntil: map[string]time.Time{},
+	}
+}
+
+type lockoutSettings struct {
+	userAttempts int
+	ipAttempts   int
+	duration     time.Duration
+}
+
+func readLockoutSettings() lockoutSettings {
+	duration, err := time.ParseDuration(settings.AuthLocalLockoutDuration.Get())
+	if err != nil || duration <= 0 {
+		logrus.Warnf("Invalid %s setting %q, using %v", settings.AuthLocalLockoutDuration.Name, settings.AuthLocalLockoutDuration.Get(), defaultLockoutDuration)
+		duration = defaultLockoutDuration
+	}
+	return lockoutSettings{
+		userAttempts: settings.AuthLocalLockoutAttempts.GetInt(),
+		ipAttempts:   settings.AuthLocalLockoutAttemptsPerIP.GetInt(),
+		duration:     duration,
+	}
+}
+
+// ipBlocked returns true if logins from ip are rejected.
+func (t *loginThrottle) ipBlocked(ip string) bool {
+	return t.blocked(t.ipsUntil, ip)
+}
+
+// unknownLocked returns true if the username, which does not exist, is locked out.
+func (t *loginThrottle) unknownLocked(username string) bool {
+	return t.blocked(t.unknownUntil, username)
+}
+
+// lockUnknown locks out a username that does not exist for duration.
+func (t *loginThrottle) lockUnknown(username string, duration time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.unknownUntil[username] = t.now().Add(duration)
+}
+
+func (t *loginThrottle) blocked(until map[string]time.Time, key string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	end, ok := until[key]
+	if !ok {
+		return false
+	}
+	if t.now().Before(end) {
+		return true
+	}
+	delete(until, key)
+	return false
+}
+
+// failed records a failed login for username from ip and returns whether the user and the ip reached their limits.
+func (t *loginThrottle) failed(username, ip string, s lockoutSettings) (lockUser bool, blockIP bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	t.prune(now, s.duration)
+
+	if s.userAttempts > 0 {
+		t.users[username] = append(t.users[username], now)
+		if len(t.users[username]) >= s.userAttempts {
+			// The lockout is persisted on the user, counting starts over once it ends or the user is unlocked.
+			delete(t.users, username)
+			lockUser = true
+		}
+	}
+	if s.ipAttempts > 0 && ip != "" {
+		t.ips[ip] = append(t.ips[ip], now)
+		if len(t.ips[ip]) >= s.ipAttempts {
+			delete(t.ips, ip)
+			t.ipsUntil[ip] = now.Add(s.duration)
+			blockIP = true
+		}
+	}
+	return lockUser, blockIP
+}
+
+// succeeded resets the failed logins of username.
+func (t *loginThrottle) succeeded(username string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.users, username)
+}
+
+// prune drops the failures older than window, so the maps do not grow with every username ever tried.
+func (t *loginThrottle) prune(now time.Time, window time.Duration) {
+	for _, failures := range []map[string][]time.Time{t.users, t.ips} {
+		for key, times := range failures {
+			i := 0
+			for i < len(times) && now.Sub(times[i]) >= window {
+				i++
+			}
+			if i == len(times) {
+				delete(failures, key)
+			} else {
+				failures[key] = times[i:]
+			}
+		}
+	}
+	for _, until := range []map[string]time.Time{t.ipsUntil, t.unknownUntil} {
+		for key, end := range until {
+			if !now.Before(end) {
+				delete(until, key)
+			}
+		}
+	}
+}
+
+// mfaThrottle counts invalid multi-factor authentication codes per user, for logins as well as for confirming and
+// disabling an enrollment. Unlike the login lockout it is always enabled, a code is only checked once the password or
+// a session of the user was verified, so it can't be used to lock out other users. The counts are kept in memory of
+// each replica.
+type mfaThrottle struct {
+	now func() time.Time
+
+	lock     sync.Mutex
+	failures map[string][]time.Time
+	until    map[string]time.Time
+}
+
+func newMFAThrottle() *mfaThrottle {
+	return &mfaThrottle{
+		now:      time.Now,
+		failures: map[string][]time.Time{},
+		until:    map[string]time.Time{},
+	}
+}
+
+// blocked returns true if codes of userID are rejected.
+func (t *mfaThrottle) blocked(userID string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	end, ok := t.until[userID]
+	if !ok {
+		return false
+	}
+	if t.now().Before(end) {
+		return true
+	}
+	delete(t.until, userID)
+	return false
+}
+
+// failed records an invalid code of userID and blocks its codes for duration once it reaches mfaCodeAttempts.
+func (t *mfaThrottle) failed(userID string, duration time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	for key, times := range t.failures {
+		i := 0
+		for i < len(times) && now.Sub(times[i]) >= duration {
+			i++
+		}
+		if i == len(times) {
+			delete(t.failures, key)
+		} else {
+			t.failures[key] = times[i:]
+		}
+	}
+
+	t.failures[userID] = append(t.failures[userID], now)
+	if len(t.failures[userID]) >= mfaCodeAttempts {
+		delete(t.failures, userID)
+		t.until[userID] = now.Add(duration)
+	}
+}
+
+// succeeded resets the invalid codes of userID.
+func (t *mfaThrottle) succeeded(userID string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.failures, userID)
+}
+
+// lockedOut returns true if a user with annotations is locked out at now.
+func lockedOut(annotations map[string]string, now time.Time) bool {
+	value, ok := annotations[LockedUntilAnnotation]
+	if !ok {
+		return false
+	}
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		logrus.Warnf("Invalid %s annotation %q, ignoring it", LockedUntilAnnotation, value)
+		return false
+	}
+	return now.Before(until)
+}
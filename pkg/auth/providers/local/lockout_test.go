@@ -0,0 +1,87 @@
+package local
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	throttle := newLoginThrottle()
+	throttle.now = func() time.Time { return now }
+	s := lockoutSettings{userAttempts: 3, ipAttempts: 5, duration: 10 * time.Minute}
+
+	lockUser, blockIP := throttle.failed("admin", "10.0.0.1", s)
+	assert.False(t, lockUser)
+	assert.False(t, blockIP)
+
+	// failures outside of the window are forgotten
+	now = now.Add(11 * time.Minute)
+	for i := 0; i < 2; i++ {
+		lockUser, _ = throttle.failed("admin", "10.0.0.2", s)
+		assert.False(t, lockUser)
+	}
+	throttle.succeeded("admin")
+	lockUser, _ = throttle.failed("admin", "10.0.0.2", s)
+	assert.False(t, lockUser, "a successful login resets the count")
+
+	lockUser, _ = throttle.failed("admin", "10.0.0.2", s)
+	assert.False(t, lockUser)
+	lockUser, blockIP = throttle.failed("admin", "10.0.0.2", s)
+	assert.True(t, lockUser)
+	assert.True(t, blockIP)
+	assert.True(t, throttle.ipBlocked("10.0.0.2"))
+	assert.False(t, throttle.ipBlocked("10.0.0.1"))
+
+	now = now.Add(10 * time.Minute)
+	assert.False(t, throttle.ipBlocked("10.0.0.2"))
+
+	// limits of zero disable the lockouts
+	for i := 0; i < 10; i++ {
+		lockUser, blockIP = throttle.failed("admin", "10.0.0.3", lockoutSettings{duration: time.Minute})
+		assert.False(t, lockUser)
+		assert.False(t, blockIP)
+	}
+
+	throttle.lockUnknown("nobody", time.Minute)
+	assert.True(t, throttle.unknownLocked("nobody"))
+	now = now.Add(time.Minute)
+	assert.False(t, throttle.unknownLocked("nobody"))
+}
+
+func TestMFAThrottle(t *testing.T) {
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	throttle := newMFAThrottle()
+	throttle.now = func() time.Time { return now }
+
+	for i := 0; i < mfaCodeAttempts-1; i++ {
+		throttle.failed("u-abc", 10*time.Minute)
+	}
+	throttle.succeeded("u-abc")
+	throttle.failed("u-abc", 10*time.Minute)
+	assert.False(t, throttle.blocked("u-abc"), "a valid code resets the count")
+
+	// failures outside of the window are forgotten
+	now = now.Add(11 * time.Minute)
+	for i := 0; i < mfaCodeAttempts-1; i++ {
+		throttle.failed("u-abc", 10*time.Minute)
+	}
+	assert.False(t, throttle.blocked("u-abc"))
+	throttle.failed("u-abc", 10*time.Minute)
+	assert.True(t, throttle.blocked("u-abc"))
+	assert.False(t, throttle.blocked("u-def"))
+
+	now = now.Add(10 * time.Minute)
+	assert.False(t, throttle.blocked("u-abc"))
+}
+
+func TestLockedOut(t *testing.T) {
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.False(t, lockedOut(nil, now))
+	assert.True(t, lockedOut(map[string]string{LockedUntilAnnotation: "2023-09-01T12:05:00Z"}, now))
+	assert.False(t, lockedOut(map[string]string{LockedUntilAnnotation: "2023-09-01T11:55:00Z"}, now))
+	assert.False(t, lockedOut(map[string]string{LockedUntilAnnotation: "soon"}, now))
+}
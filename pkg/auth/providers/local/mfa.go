@@ -0,0 +1,347 @@
+package local
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	v32 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/auth/tokens"
+	"github.com/rancher/rancher/pkg/auth/tokens/hashers"
+	v1 "github.com/rancher/rancher/pkg/generated/norman/core/v1"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	mfaSecretNameEnding = "-mfa"
+	mfaIssuer           = "Rancher"
+
+	mfaKeyTOTPSecret    = "totpSecret"
+	mfaKeyRecoveryCodes = "recoveryCodes"
+	mfaKeyConfirmed     = "confirmed"
+	mfaKeyLastStep      = "lastStep"
+
+	totpPeriod  = 30
+	totpDigits  = 6
+	totpSkew    = 1
+	totpKeySize = 20
+
+	recoveryCodeCount = 10
+)
+
+var (
+	// ErrInvalidMFACode is returned if a code is neither a valid TOTP code nor an unused recovery code.
+	ErrInvalidMFACode = errors.New("invalid multi-factor authentication code")
+	// ErrMFANotEnrolled is returned if the user has no confirmed or pending enrollment.
+	ErrMFANotEnrolled = errors.New("multi-factor authentication is not enrolled")
+	// ErrMFAAlreadyEnrolled is returned when enrolling a user with a confirmed enrollment.
+	ErrMFAAlreadyEnrolled = errors.New("multi-factor authentication is already enrolled")
+	// ErrMFAThrottled is returned if codes of the user are rejected after too many invalid codes.
+	ErrMFAThrottled = errors.New("too many invalid multi-factor authentication codes, try again later")
+
+	// codeThrottle is shared by all stores, so the login and the user actions count the same invalid codes.
+	codeThrottle = newMFAThrottle()
+
+	totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// MFAStore keeps the TOTP multi-factor authentication enrollments of local users. An enrollment is stored in a secret
+// per user owned by the user, recovery codes are stored hashed.
+type MFAStore struct {
+	secrets      v1.SecretInterface
+	secretLister v1.SecretLister
+	throttle     *mfaThrottle
+	now          func() time.Time
+}
+
+func NewMFAStore(secrets v1.SecretInterface, secretLister v1.SecretLister) *MFAStore {
+	return &MFAStore{
+		secrets:      secrets,
+		secretLister: secretLister,
+		throttle:     codeThrottle,
+		now:          time.Now,
+	}
+}
+
+func mfaSecretName(userID string) string {
+	return userID + mfaSecretNameEnding
+}
+
+// Enrolled returns true if the user has confirmed a TOTP enrollment.
+func (s *MFAStore) Enrolled(userID string) (bool, error) {
+	secret, err := s.secretLister.Get(tokens.SecretNamespace, mfaSecretName(userID))
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return string(secret.Data[mfaKeyConfirmed]) == "true", nil
+}
+
+// Enroll generates a new TOTP secret and recovery codes for user. The enrollment replaces a pending one and is only
+// used for logins once it is confirmed.
+func (s *MFAStore) Enroll(user *v3.User) (*v32.MFAEnrollment, error) {
+	key := make([]byte, totpKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	encodedKey := totpEncoding.EncodeToString(key)
+
+	var codes, hashes []string
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := hashers.GetHasher().CreateHash(normalizeRecoveryCode(code))
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash recovery code: %w", err)
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hash)
+	}
+
+	data := map[string][]byte{
+		mfaKeyTOTPSecret:    []byte(encodedKey),
+		mfaKeyRecoveryCodes: []byte(strings.Join(hashes, "\n")),
+	}
+
+	existing, err := s.secrets.GetNamespaced(tokens.SecretNamespace, mfaSecretName(user.Name), metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		_, err = s.secrets.Create(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      mfaSecretName(user.Name),
+				Namespace: tokens.SecretNamespace,
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: v3.UserGroupVersionKind.GroupVersion().String(),
+					Kind:       v3.UserGroupVersionKind.Kind,
+					Name:       user.Name,
+					UID:        user.UID,
+				}},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: data,
+		})
+	case err != nil:
+	case string(existing.Data[mfaKeyConfirmed]) == "true":
+		return nil, ErrMFAAlreadyEnrolled
+	default:
+		existing = existing.DeepCopy()
+		existing.Data = data
+		_, err = s.secrets.Update(existing)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &v32.MFAEnrollment{
+		Secret:          encodedKey,
+		ProvisioningURI: provisioningURI(user.Username, encodedKey),
+		RecoveryCodes:   codes,
+	}, nil
+}
+
+// Confirm activates the pending enrollment of userID if code is a valid TOTP code for it.
+func (s *MFAStore) Confirm(userID, code string) error {
+	return s.throttled(userID, func() error { return s.confirm(userID, code) })
+}
+
+func (s *MFAStore) confirm(userID, code string) error {
+	secret, err := s.secrets.GetNamespaced(tokens.SecretNamespace, mfaSecretName(userID), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return ErrMFANotEnrolled
+	} else if err != nil {
+		return err
+	}
+	if string(secret.Data[mfaKeyConfirmed]) == "true" {
+		return ErrMFAAlreadyEnrolled
+	}
+
+	key, err := totpEncoding.DecodeString(string(secret.Data[mfaKeyTOTPSecret]))
+	if err != nil {
+		return fmt.Errorf("invalid TOTP secret of user %s: %w", userID, err)
+	}
+	step, ok := matchTOTP(key, code, s.now(), -1)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data[mfaKeyConfirmed] = []byte("true")
+	secret.Data[mfaKeyLastStep] = []byte(strconv.FormatInt(step, 10))
+	_, err = s.secrets.Update(secret)
+	return err
+}
+
+// Verify checks code against the confirmed enrollment of userID. code is either a TOTP code, which can't be reused, or
+// a recovery code, which is consumed.
+func (s *MFAStore) Verify(userID, code string) error {
+	return s.throttled(userID, func() error { return s.verify(userID, code) })
+}
+
+func (s *MFAStore) verify(userID, code string) error {
+	secret, err := s.secrets.GetNamespaced(tokens.SecretNamespace, mfaSecretName(userID), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return ErrMFANotEnrolled
+	} else if err != nil {
+		return err
+	}
+	if string(secret.Data[mfaKeyConfirmed]) != "true" {
+		return ErrMFANotEnrolled
+	}
+	secret = secret.DeepCopy()
+
+	if isTOTPCode(code) {
+		key, err := totpEncoding.DecodeString(string(secret.Data[mfaKeyTOTPSecret]))
+		if err != nil {
+			return fmt.Errorf("invalid TOTP secret of user %s: %w", userID, err)
+		}
+		lastStep, _ := strconv.ParseInt(string(secret.Data[mfaKeyLastStep]), 10, 64)
+		step, ok := matchTOTP(key, code, s.now(), lastStep)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		// The update fails on a conflict, so a code can't be used by two concurrent logins.
+		secret.Data[mfaKeyLastStep] = []byte(strconv.FormatInt(step, 10))
+		_, err = s.secrets.Update(secret)
+		return err
+	}
+
+	remaining, ok := consumeRecoveryCode(string(secret.Data[mfaKeyRecoveryCodes]), code)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	secret.Data[mfaKeyRecoveryCodes] = []byte(remaining)
+	_, err = s.secrets.Update(secret)
+	return err
+}
+
+// throttled rejects codes of userID after too many invalid ones, otherwise it runs check and counts its result.
+func (s *MFAStore) throttled(userID string, check func() error) error {
+	if s.throttle.blocked(userID) {
+		return ErrMFAThrottled
+	}
+	err := check()
+	switch err {
+	case nil:
+		s.throttle.succeeded(userID)
+	case ErrInvalidMFACode:
+		s.throttle.failed(userID, readLockoutSettings().duration)
+	}
+	return err
+}
+
+// Delete removes the enrollment of userID, confirmed or not.
+func (s *MFAStore) Delete(userID string) error {
+	err := s.secrets.DeleteNamespaced(tokens.SecretNamespace, mfaSecretName(userID), &metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// provisioningURI returns the otpauth URI authenticator apps import, usually from a QR code.
+func provisioningURI(username, encodedKey string) string {
+	params := url.Values{}
+	params.Set("secret", encodedKey)
+	params.Set("issuer", mfaIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", strconv.Itoa(totpDigits))
+	params.Set("period", strconv.Itoa(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(mfaIssuer+":"+username) + "?" + params.Encode()
+}
+
+// totpCode computes the RFC 6238 code of key for a time step.
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// matchTOTP returns the time step code is valid for at now, allowing for totpSkew steps of clock drift. Steps up to
+// lastStep were already used and are rejected.
+func matchTOTP(key []byte, code string, now time.Time, lastStep int64) (int64, bool) {
+	if !isTOTPCode(code) {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRecoveryCode returns a random code formatted as xxxx-xxxx.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(totpEncoding.EncodeToString(b))
+	return code[:4] + "-" + code[4:], nil
+}
+
+// normalizeRecoveryCode makes recovery codes case insensitive and ignores separators.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// consumeRecoveryCode returns the newline separated hashes without the one matching code.
+func consumeRecoveryCode(hashes, code string) (string, bool) {
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return hashes, false
+	}
+	remaining := strings.Split(hashes, "\n")
+	for i, hash := range remaining {
+		if hash == "" {
+			continue
+		}
+		hasher, err := hashers.GetHasherForHash(hash)
+		if err != nil {
+			continue
+		}
+		if hasher.VerifyHash(hash, code) == nil {
+			remaining = append(remaining[:i], remaining[i+1:]...)
+			return strings.Join(remaining, "\n"), true
+		}
+	}
+	return hashes, false
+}
@@ -0,0 +1,185 @@
+package local
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancher/rancher/pkg/auth/tokens"
+	"github.com/rancher/rancher/pkg/generated/norman/core/v1/fakes"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 SHA1 test vectors, truncated to 6 digits.
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, totpCode(key, tt.unix/totpPeriod))
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / totpPeriod
+
+	got, ok := matchTOTP(key, totpCode(key, step), now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, step, got)
+
+	_, ok = matchTOTP(key, totpCode(key, step-1), now, 0)
+	assert.True(t, ok, "the previous step is accepted for clock drift")
+	_, ok = matchTOTP(key, totpCode(key, step-2), now, 0)
+	assert.False(t, ok)
+	_, ok = matchTOTP(key, totpCode(key, step), now, step)
+	assert.False(t, ok, "a used code can't be replayed")
+	_, ok = matchTOTP(key, "12345a", now, 0)
+	assert.False(t, ok)
+}
+
+func TestConsumeRecoveryCode(t *testing.T) {
+	store, _ := newTestMFAStore()
+	user := &v3.User{ObjectMeta: metav1.ObjectMeta{Name: "u-abc"}, Username: "alice"}
+	enrollment, err := store.Enroll(user)
+	require.NoError(t, err)
+	require.Len(t, enrollment.RecoveryCodes, recoveryCodeCount)
+
+	secret, err := store.secrets.GetNamespaced(tokens.SecretNamespace, mfaSecretName(user.Name), metav1.GetOptions{})
+	require.NoError(t, err)
+	hashes := string(secret.Data[mfaKeyRecoveryCodes])
+	assert.NotContains(t, hashes, enrollment.RecoveryCodes[0], "recovery codes are stored hashed")
+
+	remaining, ok := consumeRecoveryCode(hashes, strings.ToUpper(enrollment.RecoveryCodes[3]))
+	assert.True(t, ok)
+	assert.Len(t, strings.Split(remaining, "\n"), recoveryCodeCount-1)
+
+	_, ok = consumeRecoveryCode(remaining, enrollment.RecoveryCodes[3])
+	assert.False(t, ok, "a recovery code can only be used once")
+	_, ok = consumeRecoveryCode(remaining, "")
+	assert.False(t, ok)
+}
+
+func TestMFAStore(t *testing.T) {
+	store, secrets := newTestMFAStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	user := &v3.User{ObjectMeta: metav1.ObjectMeta{Name: "u-abc", UID: "uid"}, Username: "alice"}
+
+	enrollment, err := store.Enroll(user)
+	require.NoError(t, err)
+	uri, err := url.Parse(enrollment.ProvisioningURI)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "/Rancher:alice", uri.Path)
+	assert.Equal(t, enrollment.Secret, uri.Query().Get("secret"))
+	assert.Equal(t, "u-abc", secrets[mfaSecretName(user.Name)].OwnerReferences[0].Name)
+
+	key, err := totpEncoding.DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+	code := totpCode(key, now.Unix()/totpPeriod)
+
+	assert.Equal(t, ErrMFANotEnrolled, store.Verify(user.Name, code), "a pending enrollment is not used")
+	assert.Equal(t, ErrInvalidMFACode, store.Confirm(user.Name, "000000"))
+	require.NoError(t, store.Confirm(user.Name, code))
+	enrolled, err := store.Enrolled(user.Name)
+	require.NoError(t, err)
+	assert.True(t, enrolled)
+
+	assert.Equal(t, ErrInvalidMFACode, store.Verify(user.Name, code), "the code used to confirm can't be reused")
+	now = now.Add(totpPeriod * time.Second)
+	assert.NoError(t, store.Verify(user.Name, totpCode(key, now.Unix()/totpPeriod)))
+	assert.NoError(t, store.Verify(user.Name, enrollment.RecoveryCodes[0]))
+	assert.Equal(t, ErrInvalidMFACode, store.Verify(user.Name, enrollment.RecoveryCodes[0]))
+
+	_, err = store.Enroll(user)
+	assert.Equal(t, ErrMFAAlreadyEnrolled, err)
+
+	require.NoError(t, store.Delete(user.Name))
+	enrolled, err = store.Enrolled(user.Name)
+	require.NoError(t, err)
+	assert.False(t, enrolled)
+	assert.NoError(t, store.Delete(user.Name))
+}
+
+func TestMFAStoreThrottle(t *testing.T) {
+	store, _ := newTestMFAStore()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	store.throttle.now = func() time.Time { return now }
+	user := &v3.User{ObjectMeta: metav1.ObjectMeta{Name: "u-abc", UID: "uid"}, Username: "alice"}
+
+	enrollment, err := store.Enroll(user)
+	require.NoError(t, err)
+	key, err := totpEncoding.DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+
+	for i := 0; i < mfaCodeAttempts; i++ {
+		assert.Equal(t, ErrInvalidMFACode, store.Confirm(user.Name, "000000"))
+	}
+	assert.Equal(t, ErrMFAThrottled, store.Confirm(user.Name, totpCode(key, now.Unix()/totpPeriod)), "a valid code is rejected once throttled")
+
+	now = now.Add(defaultLockoutDuration)
+	require.NoError(t, store.Confirm(user.Name, totpCode(key, now.Unix()/totpPeriod)))
+
+	for i := 0; i < mfaCodeAttempts; i++ {
+		assert.Equal(t, ErrInvalidMFACode, store.Verify(user.Name, "not-a-recovery-code"))
+	}
+	assert.Equal(t, ErrMFAThrottled, store.Verify(user.Name, enrollment.RecoveryCodes[0]))
+}
+
+// newTestMFAStore returns a store backed by an in-memory map of secrets.
+func newTestMFAStore() (*MFAStore, map[string]*corev1.Secret) {
+	secrets := map[string]*corev1.Secret{}
+	notFound := func(name string) error {
+		return apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+	}
+	get := func(namespace, name string) (*corev1.Secret, error) {
+		secret, ok := secrets[name]
+		if !ok {
+			return nil, notFound(name)
+		}
+		return secret.DeepCopy(), nil
+	}
+	client := &fakes.SecretInterfaceMock{
+		GetNamespacedFunc: func(namespace, name string, opts metav1.GetOptions) (*corev1.Secret, error) {
+			return get(namespace, name)
+		},
+		CreateFunc: func(secret *corev1.Secret) (*corev1.Secret, error) {
+			secrets[secret.Name] = secret.DeepCopy()
+			return secret, nil
+		},
+		UpdateFunc: func(secret *corev1.Secret) (*corev1.Secret, error) {
+			secrets[secret.Name] = secret.DeepCopy()
+			return secret, nil
+		},
+		DeleteNamespacedFunc: func(namespace, name string, options *metav1.DeleteOptions) error {
+			if _, ok := secrets[name]; !ok {
+				return notFound(name)
+			}
+			delete(secrets, name)
+			return nil
+		},
+	}
+	lister := &fakes.SecretListerMock{
+		GetFunc: get,
+	}
+	store := NewMFAStore(client, lister)
+	store.throttle = newMFAThrottle()
+	return store, secrets
+}
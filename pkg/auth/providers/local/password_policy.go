@@ -0,0 +1,143 @@
+package local
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PasswordPolicy holds the rules passwords of local users must satisfy.
+type PasswordPolicy struct {
+	MinLength int
+	// MinCharacterClasses is the number of character classes, out of lowercase and uppercase letters, digits and other
+	// characters, a password must contain.
+	MinCharacterClasses int
+	// DisallowUsername rejects passwords containing the username, ignoring case. Passwords equal to the username are
+	// always rejected.
+	DisallowUsername bool
+	// HistorySize is the number of most recent passwords, including the current one, a new password must differ from.
+	HistorySize int
+	// MaxAge is the time after which users must change their password, zero means passwords don't expire.
+	MaxAge time.Duration
+}
+
+// ReadPasswordPolicy returns the password policy configured by the password settings.
+func ReadPasswordPolicy() PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength:           settings.PasswordMinLength.GetInt(),
+		MinCharacterClasses: settings.PasswordMinCharacterClasses.GetInt(),
+		DisallowUsername:    settings.PasswordDisallowUsername.Get() == "true",
+		HistorySize:         settings.PasswordHistorySize.GetInt(),
+	}
+	if value := settings.PasswordMaxAge.Get(); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge < 0 {
+			logrus.Warnf("Invalid %s setting %q, passwords won't expire", settings.PasswordMaxAge.Name, value)
+		} else {
+			policy.MaxAge = maxAge
+		}
+	}
+	return policy
+}
+
+// Validate returns an error if password breaks the policy. currentPassword is the plain text current password if the
+// user provided it, user is the existing user and nil for new users.
+func (p PasswordPolicy) Validate(username, currentPassword, password string, user *v3.User) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return errors.Errorf("Password must be at least %v characters", p.MinLength)
+	}
+
+	if username == password {
+		return errors.New("Password cannot be the same as username")
+	}
+	if p.DisallowUsername && username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return errors.New("Password cannot contain the username")
+	}
+	if password == currentPassword {
+		return errors.New("The new password must not be the same as the current password")
+	}
+
+	if classes := characterClasses(password); classes < p.MinCharacterClasses {
+		return errors.Errorf("Password must contain at least %v of lowercase letters, uppercase letters, digits and other characters", p.MinCharacterClasses)
+	}
+
+	if user != nil && p.HistorySize > 0 {
+		for _, hash := range recentPasswords(user, p.HistorySize) {
+			if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+				return errors.Errorf("The new password must not be the same as any of the last %v passwords", p.HistorySize)
+			}
+		}
+	}
+	return nil
+}
+
+// Expired returns true if the password of user is older than the policy's maximum age at now. A password without a
+// change time was set before the maximum age was enabled and is treated as changed now, see StartMaxAge.
+func (p PasswordPolicy) Expired(user *v3.User, now time.Time) bool {
+	if p.MaxAge <= 0 || user.PasswordChangedAt == nil {
+		return false
+	}
+	return now.Sub(user.PasswordChangedAt.Time) > p.MaxAge
+}
+
+// StartMaxAge sets the change time of a password that has none to now and returns true if it did, so the maximum age
+// of passwords set before it was enabled counts from then instead of expiring them at once.
+func (p PasswordPolicy) StartMaxAge(user *v3.User, now time.Time) bool {
+	if p.MaxAge <= 0 || user.PasswordChangedAt != nil {
+		return false
+	}
+	user.PasswordChangedAt = &metav1.Time{Time: now}
+	return true
+}
+
+// SetPassword changes the password hash of user, keeping the previous hash in the history as the policy requires.
+func (p PasswordPolicy) SetPassword(user *v3.User, hash string, now time.Time) {
+	var history []string
+	if p.HistorySize > 1 && user.Password != "" {
+		history = append([]string{user.Password}, user.PasswordHistory...)
+		if len(history) > p.HistorySize-1 {
+			history = history[:p.HistorySize-1]
+		}
+	}
+	user.Password = hash
+	user.PasswordHistory = history
+	user.PasswordChangedAt = &metav1.Time{Time: now}
+}
+
+// recentPasswords returns the hashes of the current and previous passwords of user, at most size of them.
+func recentPasswords(user *v3.User, size int) []string {
+	var hashes []string
+	if user.Password != "" {
+		hashes = append(hashes, user.Password)
+	}
+	hashes = append(hashes, user.PasswordHistory...)
+	if len(hashes) > size {
+		hashes = hashes[:size]
+	}
+	return hashes
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
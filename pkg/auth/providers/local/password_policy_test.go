@@ -0,0 +1,174 @@
+package local
+
+import (
+	"testing"
+	"time"
+
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     PasswordPolicy
+		username   string
+		password   string
+		expectsErr bool
+	}{
+		{
+			name:     "length only",
+			policy:   PasswordPolicy{MinLength: 12},
+			username: "admin",
+			password: "aaaaaaaaaaaa",
+		},
+		{
+			name:       "too few character classes",
+			policy:     PasswordPolicy{MinLength: 12, MinCharacterClasses: 3},
+			username:   "admin",
+			password:   "aaaaaaaa1234",
+			expectsErr: true,
+		},
+		{
+			name:     "enough character classes",
+			policy:   PasswordPolicy{MinLength: 12, MinCharacterClasses: 3},
+			username: "admin",
+			password: "aaaaaaaA1234",
+		},
+		{
+			name:     "contains username allowed",
+			policy:   PasswordPolicy{MinLength: 12},
+			username: "administrator",
+			password: "administrator1",
+		},
+		{
+			name:       "contains username disallowed",
+			policy:     PasswordPolicy{MinLength: 12, DisallowUsername: true},
+			username:   "administrator",
+			password:   "myADMINISTRATOR1",
+			expectsErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.username, "", tt.password, nil)
+			if tt.expectsErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name        string
+		username    string
+		currentpass string
+		password    string
+		expectsErr  bool
+	}{
+		{
+			name:        "password too short",
+			username:    "admin",
+			currentpass: "currentpassword",
+			password:    "tooshort",
+			expectsErr:  true,
+		},
+		{
+			name:        "username equals password min length",
+			username:    "passwordpass",
+			currentpass: "currentpassword",
+			password:    "passwordpass",
+			expectsErr:  true,
+		},
+		{
+			name:        "username and password almost match",
+			username:    "administrator",
+			currentpass: "currentpassword",
+			password:    "administrator1",
+			expectsErr:  false,
+		},
+		{
+			name:        "12 byte password, 6 runes",
+			username:    "admin",
+			currentpass: "currentpassword",
+			password:    "пароль",
+			expectsErr:  true,
+		},
+		{
+			name:        "23 byte password, 12 runes",
+			username:    "admin",
+			currentpass: "currentpassword",
+			password:    "абвгдеёжзий1",
+			expectsErr:  false,
+		},
+		{
+			name:        "username equals password min length unicode",
+			username:    "абвгдеёжзий1",
+			currentpass: "currentpassword",
+			password:    "абвгдеёжзий1",
+			expectsErr:  true,
+		},
+		{
+			name:        "new password matches current password",
+			username:    "admin",
+			currentpass: "myfavoritepassword",
+			password:    "myfavoritepassword",
+			expectsErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PasswordPolicy{MinLength: 12}.Validate(tt.username, tt.currentpass, tt.password, nil)
+			if err != nil && !tt.expectsErr {
+				t.Errorf("Received unexpected error: %v", err)
+			} else if err == nil && tt.expectsErr {
+				t.Error("Expected error when non received")
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyHistory(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 1, HistorySize: 3}
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	user := &v3.User{Username: "admin"}
+
+	for _, password := range []string{"first", "second", "third", "fourth"} {
+		require.NoError(t, policy.Validate(user.Username, "", password, user))
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		require.NoError(t, err)
+		policy.SetPassword(user, string(hash), now)
+	}
+	assert.Len(t, user.PasswordHistory, 2)
+	assert.Equal(t, now, user.PasswordChangedAt.Time)
+
+	assert.Error(t, policy.Validate(user.Username, "", "fourth", user), "the current password")
+	assert.Error(t, policy.Validate(user.Username, "", "second", user))
+	assert.NoError(t, policy.Validate(user.Username, "", "first", user), "older than the history")
+}
+
+func TestPasswordPolicyExpired(t *testing.T) {
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	user := &v3.User{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-48 * time.Hour))}}
+
+	assert.False(t, PasswordPolicy{}.Expired(user, now))
+	policy := PasswordPolicy{MaxAge: 24 * time.Hour}
+	assert.False(t, policy.Expired(user, now), "a password without a change time is treated as changed now")
+
+	assert.False(t, PasswordPolicy{}.StartMaxAge(user, now))
+	assert.Nil(t, user.PasswordChangedAt)
+	assert.True(t, policy.StartMaxAge(user, now.Add(-25*time.Hour)))
+	assert.True(t, policy.Expired(user, now))
+	assert.False(t, policy.StartMaxAge(user, now), "an existing change time is kept")
+
+	user.PasswordChangedAt = &metav1.Time{Time: now.Add(-time.Hour)}
+	assert.False(t, policy.Expired(user, now))
+}
@@ -69,6 +69,7 @@ func NewAuthenticator(ctx context.Context, clusterRouter ClusterRouter, mgmtCtx
 		userLister:          mgmtCtx.Management.Users("").Controller().Lister(),
 		clusterRouter:       clusterRouter,
 		userAuthRefresher:   providerrefresh.NewUserAuthRefresher(ctx, mgmtCtx),
+		lastUsed:            newLastUsedRecorder(mgmtCtx.Management.Tokens("")),
 	}
 }
 
@@ -81,6 +82,7 @@ type tokenAuthenticator struct {
 	userLister          v3.UserLister
 	clusterRouter       ClusterRouter
 	userAuthRefresher   providerrefresh.UserAuthRefresher
+	lastUsed            *lastUsedRecorder
 }
 
 const (
@@ -108,9 +110,13 @@ func (a *tokenAuthenticator) Authenticate(req *http.Request) (*AuthenticatorResp
 	if token.Enabled != nil && !*token.Enabled {
 		return nil, errors.Wrapf(ErrMustAuthenticate, "user's token is not enabled")
 	}
-	if token.ClusterName != "" && token.ClusterName != a.clusterRouter(req) {
+	clusterID := a.clusterRouter(req)
+	if token.ClusterName != "" && token.ClusterName != clusterID {
 		return nil, errors.Wrapf(ErrMustAuthenticate, "clusterID does not match")
 	}
+	if err := tokens.ScopeAllows(token.Scope, req, clusterID); err != nil {
+		return nil, errors.Wrapf(ErrMustAuthenticate, "%v", err)
+	}
 
 	attribs, err := a.userAttributeLister.Get("", token.UserID)
 	if err != nil && !apierrors.IsNotFound(err) {
@@ -152,6 +158,7 @@ func (a *tokenAuthenticator) Authenticate(req *http.Request) (*AuthenticatorResp
 	if !strings.HasPrefix(token.UserID, "system:") {
 		go a.userAuthRefresher.TriggerUserRefresh(token.UserID, false)
 	}
+	a.lastUsed.record(token, req)
 
 	authResp.IsAuthed = true
 	authResp.User = token.UserID
@@ -0,0 +1,65 @@
+package requests
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rancher/rancher/pkg/auth/util"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// lastUsedUpdateInterval is the minimum time between two updates of the last used time of a token.
+const lastUsedUpdateInterval = time.Minute
+
+// lastUsedRecorder records when and from where a token was last used. To avoid writing the token on every request
+// the record is only updated if it is older than lastUsedUpdateInterval.
+type lastUsedRecorder struct {
+	tokenClient v3.TokenInterface
+	now         func() time.Time
+
+	lock sync.Mutex
+	// updated holds the tokens updated in the last interval, which may not be in the cache yet.
+	updated map[string]time.Time
+}
+
+func newLastUsedRecorder(tokenClient v3.TokenInterface) *lastUsedRecorder {
+	return &lastUsedRecorder{
+		tokenClient: tokenClient,
+		now:         time.Now,
+		updated:     map[string]time.Time{},
+	}
+}
+
+// record updates the last used time and client IP of token in the background if they are due for an update.
+func (r *lastUsedRecorder) record(token *v3.Token, req *http.Request) {
+	now := r.now()
+	if token.LastUsedAt != nil && now.Sub(token.LastUsedAt.Time) < lastUsedUpdateInterval {
+		return
+	}
+
+	r.lock.Lock()
+	if updated, ok := r.updated[token.Name]; ok && now.Sub(updated) < lastUsedUpdateInterval {
+		r.lock.Unlock()
+		return
+	}
+	for name, updated := range r.updated {
+		if now.Sub(updated) >= lastUsedUpdateInterval {
+			delete(r.updated, name)
+		}
+	}
+	r.updated[token.Name] = now
+	r.lock.Unlock()
+
+	token = token.DeepCopy()
+	token.LastUsedAt = &metav1.Time{Time: now}
+	token.LastUsedFrom = util.RequestClientIP(req)
+	go func() {
+		// Conflicts are ignored, the next use of the token after the interval will try again.
+		if _, err := r.tokenClient.Update(token); err != nil {
+			logrus.Debugf("Failed to record last use of token %s: %v", token.Name, err)
+		}
+	}()
+}
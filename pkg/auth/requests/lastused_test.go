@@ -0,0 +1,74 @@
+package requests
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	mgmtFakes "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3/fakes"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLastUsedRecorder(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		updates []*v3.Token
+		wg      sync.WaitGroup
+	)
+	recorder := newLastUsedRecorder(&mgmtFakes.TokenInterfaceMock{
+		UpdateFunc: func(token *v3.Token) (*v3.Token, error) {
+			defer wg.Done()
+			lock.Lock()
+			defer lock.Unlock()
+			updates = append(updates, token)
+			return token, nil
+		},
+	})
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	recorder.now = func() time.Time { return now }
+
+	req := httptest.NewRequest("GET", "/v3/clusters", nil)
+	req.RemoteAddr = "10.0.0.1:52100"
+	// forwarded headers can be set by any client
+	req.Header.Set("X-Forwarded-For", "192.168.0.1")
+	token := &v3.Token{ObjectMeta: metav1.ObjectMeta{Name: "token-abc"}}
+
+	wg.Add(1)
+	recorder.record(token, req)
+	// the cache has not seen the update yet
+	recorder.record(token, req)
+	wg.Wait()
+
+	require.Len(t, updates, 1)
+	assert.Equal(t, now, updates[0].LastUsedAt.Time)
+	assert.Equal(t, "10.0.0.1", updates[0].LastUsedFrom)
+	assert.Nil(t, token.LastUsedAt, "the cached token must not be modified")
+
+	// recently used according to the cache
+	now = now.Add(2 * lastUsedUpdateInterval)
+	recorder.record(&v3.Token{
+		ObjectMeta: metav1.ObjectMeta{Name: "token-def"},
+		LastUsedAt: &metav1.Time{Time: now.Add(-time.Second)},
+	}, req)
+
+	wg.Add(1)
+	recorder.record(token, req)
+	wg.Wait()
+	assert.Len(t, updates, 2)
+
+	// the forwarded header of a trusted proxy is honored as for the lockout of local logins
+	proxies := settings.AuthLocalLockoutTrustedProxies.Get()
+	require.NoError(t, settings.AuthLocalLockoutTrustedProxies.Set("10.0.0.0/8"))
+	defer settings.AuthLocalLockoutTrustedProxies.Set(proxies)
+	now = now.Add(2 * lastUsedUpdateInterval)
+	wg.Add(1)
+	recorder.record(token, req)
+	wg.Wait()
+	require.Len(t, updates, 3)
+	assert.Equal(t, "192.168.0.1", updates[2].LastUsedFrom)
+}
@@ -105,6 +105,23 @@ func (m *Manager) createDerivedToken(jsonInput clientv3.Token, tokenAuthValue st
 		return v3.Token{}, "", 500, fmt.Errorf("error validating max-ttl %v", err)
 	}
 
+	// A token derived from a scoped token inherits its scope and can not be given a wider one.
+	scope := token.Scope.DeepCopy()
+	if jsonInput.Scope != nil {
+		scope = &v32.TokenScope{
+			Clusters:  jsonInput.Scope.Clusters,
+			Verbs:     jsonInput.Scope.Verbs,
+			APIGroups: jsonInput.Scope.APIGroups,
+			Resources: jsonInput.Scope.Resources,
+		}
+		if err := ScopeIsSubset(scope, token.Scope); err != nil {
+			return v3.Token{}, "", 403, err
+		}
+	}
+	if scope != nil && jsonInput.ClusterID != "" && len(scope.Clusters) > 0 && !scopeContains(scope.Clusters, jsonInput.ClusterID) {
+		return v3.Token{}, "", 403, fmt.Errorf("token scope does not allow cluster %s", jsonInput.ClusterID)
+	}
+
 	var unhashedTokenKey string
 	derivedToken := v3.Token{
 		UserPrincipal: token.UserPrincipal,
@@ -115,6 +132,7 @@ func (m *Manager) createDerivedToken(jsonInput clientv3.Token, tokenAuthValue st
 		ProviderInfo:  token.ProviderInfo,
 		Description:   jsonInput.Description,
 		ClusterName:   jsonInput.ClusterID,
+		Scope:         scope,
 	}
 	derivedToken, unhashedTokenKey, err = m.createToken(&derivedToken)
 
@@ -7,11 +7,14 @@
 	"github.com/rancher/norman/clientbase"
 	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
 	"github.com/rancher/rancher/pkg/namespace"
+	"github.com/rancher/rancher/pkg/settings"
 	"github.com/rancher/rancher/pkg/types/config"
 	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/pointer"
 )
 
 const intervalSeconds int64 = 3600
@@ -20,6 +23,7 @@ func StartPurgeDaemon(ctx context.Context, mgmt *config.ManagementContext) {
 	p := &purger{
 		tokenLister:      mgmt.Management.Tokens("").Controller().Lister(),
 		tokens:           mgmt.Management.Tokens(""),
+		clusterLister:    mgmt.Management.Clusters("").Controller().Lister(),
 		samlTokensLister: mgmt.Management.SamlTokens("").Controller().Lister(),
 		samlTokens:       mgmt.Management.SamlTokens(""),
 	}
@@ -29,6 +33,7 @@ func StartPurgeDaemon(ctx context.Context, mgmt *config.ManagementContext) {
 type purger struct {
 	tokenLister      v3.TokenLister
 	tokens           v3.TokenInterface
+	clusterLister    v3.ClusterLister
 	samlTokens       v3.SamlTokenInterface
 	samlTokensLister v3.SamlTokenLister
 }
@@ -54,6 +59,8 @@ func (p *purger) purge() {
 		logrus.Infof("Purged %v expired tokens", count)
 	}
 
+	p.disableUnused(allTokens)
+
 	// saml tokens store encrypted token for login request from rancher cli
 	samlTokens, err := p.samlTokensLister.List(namespace.GlobalNamespace, labels.Everything())
 	if err != nil {
@@ -76,3 +83,62 @@ func (p *purger) purge() {
 		logrus.Infof("Purged %v saml tokens", count)
 	}
 }
+
+// disableUnused disables the tokens that have not been used for longer than the DisableUnusedTokensAfter setting.
+func (p *purger) disableUnused(allTokens []*v3.Token) {
+	value := settings.DisableUnusedTokensAfter.Get()
+	if value == "" {
+		return
+	}
+	disableAfter, err := time.ParseDuration(value)
+	if err != nil {
+		logrus.Errorf("Error parsing %s setting: %v", settings.DisableUnusedTokensAfter.Name, err)
+		return
+	}
+	if disableAfter <= 0 {
+		return
+	}
+
+	var count int
+	now := time.Now()
+	for _, token := range allTokens {
+		if !pointer.BoolDeref(token.Enabled, true) {
+			continue
+		}
+		lastUsed := token.CreationTimestamp.Time
+		if token.LastUsedAt != nil {
+			lastUsed = token.LastUsedAt.Time
+		}
+		if now.Sub(lastUsed) < disableAfter || IsExpired(*token) || p.usableThroughACE(token) {
+			continue
+		}
+
+		token = token.DeepCopy()
+		token.Enabled = pointer.Bool(false)
+		if _, err := p.tokens.Update(token); err != nil {
+			if !clientbase.IsNotFound(err) {
+				logrus.Errorf("Error: while disabling unused token %v: %v", token.ObjectMeta.Name, err)
+			}
+			continue
+		}
+		count++
+	}
+	if count > 0 {
+		logrus.Infof("Disabled %v tokens unused for %v", count, disableAfter)
+	}
+}
+
+// usableThroughACE returns true if the token can be used through the authorized cluster endpoint of its cluster. These
+// uses are authenticated by the downstream cluster and do not update the last used time of the token, so it may be in
+// use even if it was not used through Rancher.
+func (p *purger) usableThroughACE(token *v3.Token) bool {
+	if token.ClusterName == "" {
+		return false
+	}
+	cluster, err := p.clusterLister.Get("", token.ClusterName)
+	if err != nil {
+		// keep the token if it is unknown whether the cluster has the endpoint enabled
+		return !apierrors.IsNotFound(err)
+	}
+	return cluster.Spec.LocalClusterAuthEndpoint.Enabled
+}
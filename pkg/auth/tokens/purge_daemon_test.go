@@ -0,0 +1,101 @@
+package tokens
+
+import (
+	"testing"
+	"time"
+
+	apimgmtv3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	mgmtFakes "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3/fakes"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/pointer"
+)
+
+func TestPurgerDisableUnused(t *testing.T) {
+	now := time.Now()
+	newToken := func(name string, created time.Time, lastUsed *time.Time, enabled *bool) *v3.Token {
+		token := &v3.Token{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(created),
+			},
+			Enabled: enabled,
+		}
+		if lastUsed != nil {
+			token.LastUsedAt = &metav1.Time{Time: *lastUsed}
+		}
+		return token
+	}
+	recent := now.Add(-time.Hour)
+	old := now.Add(-48 * time.Hour)
+
+	allTokens := []*v3.Token{
+		newToken("used-recently", old, &recent, nil),
+		newToken("created-recently", recent, nil, nil),
+		newToken("unused", old, &old, pointer.Bool(true)),
+		newToken("never-used", old, nil, nil),
+		newToken("already-disabled", old, &old, pointer.Bool(false)),
+		newToken("ace", old, &old, nil),
+		newToken("no-ace", old, &old, nil),
+		newToken("deleted-cluster", old, &old, nil),
+	}
+	allTokens[5].ClusterName = "c-ace"
+	allTokens[6].ClusterName = "c-no-ace"
+	allTokens[7].ClusterName = "c-deleted"
+	clusters := map[string]*v3.Cluster{
+		"c-ace":    {Spec: apimgmtv3.ClusterSpec{ClusterSpecBase: apimgmtv3.ClusterSpecBase{LocalClusterAuthEndpoint: apimgmtv3.LocalClusterAuthEndpoint{Enabled: true}}}},
+		"c-no-ace": {},
+	}
+
+	tests := []struct {
+		name         string
+		setting      string
+		wantDisabled []string
+	}{
+		{
+			name: "disabled by default",
+		},
+		{
+			name:    "invalid setting",
+			setting: "a day",
+		},
+		{
+			name:         "disable unused",
+			setting:      "24h",
+			wantDisabled: []string{"unused", "never-used", "no-ace", "deleted-cluster"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, settings.DisableUnusedTokensAfter.Set(tt.setting))
+			defer settings.DisableUnusedTokensAfter.Set("")
+
+			var disabled []string
+			p := &purger{
+				tokens: &mgmtFakes.TokenInterfaceMock{
+					UpdateFunc: func(token *v3.Token) (*v3.Token, error) {
+						assert.False(t, *token.Enabled)
+						disabled = append(disabled, token.Name)
+						return token, nil
+					},
+				},
+				clusterLister: &mgmtFakes.ClusterListerMock{
+					GetFunc: func(namespace, name string) (*v3.Cluster, error) {
+						if cluster, ok := clusters[name]; ok {
+							return cluster, nil
+						}
+						return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "clusters"}, name)
+					},
+				},
+			}
+			p.disableUnused(allTokens)
+			assert.Equal(t, tt.wantDisabled, disabled)
+		})
+	}
+}
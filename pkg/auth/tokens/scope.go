@@ -0,0 +1,240 @@
+package tokens
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+)
+
+const (
+	localCluster  = "local"
+	scopeWildcard = "*"
+)
+
+// namespaceSubresources are the subresources of namespaces, which the Kubernetes API does not confuse with resources in
+// a namespace.
+var namespaceSubresources = map[string]bool{"status": true, "finalize": true}
+
+// ScopedRequest describes a request in the terms of a TokenScope.
+type ScopedRequest struct {
+	Cluster string
+	// Verb is the Kubernetes verb of the request. A request that could stand for several verbs, e.g. a GET of
+	// /v1/pods/default is either a list of the pods in the default namespace or a get of a pod named default, is
+	// described by the broadest of them.
+	Verb     string
+	APIGroup string
+	// Resource is the resource of the request, followed by its subresource as in pods/exec if any.
+	Resource string
+	// NonResource is set for discovery requests, which do not act on a resource.
+	NonResource bool
+}
+
+// ParseScopedRequest describes req for scope checks. clusterID is the cluster the request is routed to, it is empty for
+// requests to the local cluster and the management API.
+func ParseScopedRequest(req *http.Request, clusterID string) (*ScopedRequest, bool) {
+	result := &ScopedRequest{Cluster: clusterID}
+	if result.Cluster == "" {
+		result.Cluster = localCluster
+	}
+
+	path := strings.Trim(req.URL.Path, "/")
+	if parts := strings.SplitN(path, "/", 4); len(parts) >= 3 && parts[0] == "k8s" && parts[1] == "clusters" {
+		path = ""
+		if len(parts) == 4 {
+			path = parts[3]
+		}
+	}
+	parts := strings.Split(path, "/")
+
+	var named, ok bool
+	switch parts[0] {
+	case "api":
+		// /api/v1/[namespaces/<namespace>/]<resource>[/<name>[/<subresource>]]
+		if len(parts) < 3 {
+			result.NonResource = true
+			break
+		}
+		result.Resource, named, ok = k8sResource(parts[2:])
+	case "apis":
+		// /apis/<group>/<version>/[namespaces/<namespace>/]<resource>[/<name>[/<subresource>]]
+		if len(parts) < 4 {
+			result.NonResource = true
+			break
+		}
+		result.APIGroup = parts[1]
+		result.Resource, named, ok = k8sResource(parts[3:])
+	case "version", "openapi":
+		result.NonResource = true
+	case "v1":
+		// /v1/<group>.<resource>[/<namespace>][/<name>], core resources have no group.
+		if len(parts) < 2 || parts[1] == "" {
+			return nil, false
+		}
+		if i := strings.LastIndex(parts[1], "."); i >= 0 {
+			result.APIGroup, result.Resource = parts[1][:i], parts[1][i+1:]
+		} else {
+			result.Resource = parts[1]
+		}
+		// With two segments after the type the request is for a single object, with one it is ambiguous and treated as a
+		// list, which is never allowed by a scope that does not allow a get of the same resource too.
+		named = len(parts) > 3
+		if len(parts) > 4 && parts[4] != "" {
+			result.Resource += "/" + parts[4]
+		}
+		ok = true
+	case "v3":
+		// /v3/<type>[/<id>], /v3/cluster/<id>/<type>[/<id>] or /v3/project/<id>/<type>[/<id>]
+		if len(parts) < 2 || parts[1] == "" {
+			result.NonResource = true
+			break
+		}
+		result.APIGroup = "management.cattle.io"
+		rest := parts[1:]
+		if (rest[0] == "cluster" || rest[0] == "project") && len(rest) > 2 {
+			if rest[0] == "project" && clusterID == "" {
+				// Project IDs are <cluster>:<project>.
+				if cluster, _, found := strings.Cut(rest[1], ":"); found {
+					result.Cluster = cluster
+				}
+			}
+			rest = rest[2:]
+		}
+		result.Resource = strings.ToLower(rest[0])
+		named = len(rest) > 1
+		ok = true
+	default:
+		return nil, false
+	}
+
+	if result.NonResource {
+		result.Verb = "get"
+		return result, req.Method == http.MethodGet || req.Method == http.MethodHead
+	}
+	if !ok {
+		return nil, false
+	}
+	result.Verb = requestVerb(req, named)
+	return result, result.Verb != ""
+}
+
+// k8sResource returns the resource of a Kubernetes API path after the version, followed by its subresource if any, and
+// whether it names an object.
+func k8sResource(parts []string) (string, bool, bool) {
+	if parts[0] == "namespaces" && len(parts) > 2 && !namespaceSubresources[parts[2]] {
+		parts = parts[2:]
+	}
+	if parts[0] == "" {
+		return "", false, false
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		return parts[0] + "/" + parts[2], true, true
+	}
+	return parts[0], len(parts) > 1 && parts[1] != "", true
+}
+
+// requestVerb maps the method of req to a Kubernetes verb, a GET is a get if it names an object and a list otherwise.
+func requestVerb(req *http.Request, named bool) string {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		if req.URL.Query().Get("watch") == "true" {
+			return "watch"
+		}
+		if named {
+			return "get"
+		}
+		return "list"
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		if named {
+			return "delete"
+		}
+		return "deletecollection"
+	}
+	return ""
+}
+
+// ScopeAllows returns an error if scope does not allow req. A nil scope allows every request.
+func ScopeAllows(scope *v3.TokenScope, req *http.Request, clusterID string) error {
+	if scope == nil {
+		return nil
+	}
+
+	scoped, ok := ParseScopedRequest(req, clusterID)
+	if !ok {
+		if len(scope.Verbs) == 0 && len(scope.APIGroups) == 0 && len(scope.Resources) == 0 &&
+			(len(scope.Clusters) == 0 || scopeContains(scope.Clusters, localCluster)) {
+			return nil
+		}
+		return fmt.Errorf("token scope does not allow %s %s", req.Method, req.URL.Path)
+	}
+
+	if len(scope.Clusters) > 0 && !scopeContains(scope.Clusters, scoped.Cluster) {
+		return fmt.Errorf("token scope does not allow cluster %s", scoped.Cluster)
+	}
+	if len(scope.Verbs) > 0 && !scopeContains(scope.Verbs, scoped.Verb) {
+		return fmt.Errorf("token scope does not allow %s", scoped.Verb)
+	}
+	if scoped.NonResource {
+		return nil
+	}
+	if len(scope.APIGroups) > 0 && !scopeContains(scope.APIGroups, scoped.APIGroup) {
+		return fmt.Errorf("token scope does not allow API group %q", scoped.APIGroup)
+	}
+	if len(scope.Resources) > 0 && !scopeContains(scope.Resources, scoped.Resource) {
+		return fmt.Errorf("token scope does not allow resource %s", scoped.Resource)
+	}
+	return nil
+}
+
+// ScopeIsSubset returns an error if child allows something parent does not. A nil scope is unrestricted.
+func ScopeIsSubset(child, parent *v3.TokenScope) error {
+	if parent == nil {
+		return nil
+	}
+	if child == nil {
+		return fmt.Errorf("an unrestricted token can not be derived from a scoped token")
+	}
+	for _, attr := range []struct {
+		name          string
+		child, parent []string
+	}{
+		{"clusters", child.Clusters, parent.Clusters},
+		{"verbs", child.Verbs, parent.Verbs},
+		{"apiGroups", child.APIGroups, parent.APIGroups},
+		{"resources", child.Resources, parent.Resources},
+	} {
+		if len(attr.parent) == 0 || scopeContains(attr.parent, scopeWildcard) {
+			continue
+		}
+		if len(attr.child) == 0 {
+			return fmt.Errorf("token scope %s must be a subset of %v", attr.name, attr.parent)
+		}
+		for _, value := range attr.child {
+			if value == scopeWildcard || !scopeContains(attr.parent, value) {
+				return fmt.Errorf("token scope %s must be a subset of %v", attr.name, attr.parent)
+			}
+		}
+	}
+	return nil
+}
+
+// IsRestrictedScope returns true if scope restricts what a token can be used for, including the clusters.
+func IsRestrictedScope(scope *v3.TokenScope) bool {
+	return scope != nil && (len(scope.Clusters) > 0 || len(scope.Verbs) > 0 || len(scope.APIGroups) > 0 || len(scope.Resources) > 0)
+}
+
+func scopeContains(values []string, value string) bool {
+	for _, v := range values {
+		if v == scopeWildcard || v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,342 @@
+package tokens
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	clientv3 "github.com/rancher/rancher/pkg/client/generated/management/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestParseScopedRequest(t *testing.T) {
+	tests := []struct {
+		method    string
+		path      string
+		clusterID string
+		want      *ScopedRequest
+	}{
+		{
+			method:    http.MethodGet,
+			path:      "/k8s/clusters/c-abc/api/v1/namespaces/default/pods/web",
+			clusterID: "c-abc",
+			want:      &ScopedRequest{Cluster: "c-abc", Verb: "get", Resource: "pods"},
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/k8s/clusters/c-abc/apis/apps/v1/deployments?watch=true",
+			clusterID: "c-abc",
+			want:      &ScopedRequest{Cluster: "c-abc", Verb: "watch", APIGroup: "apps", Resource: "deployments"},
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/k8s/clusters/c-abc/apis",
+			clusterID: "c-abc",
+			want:      &ScopedRequest{Cluster: "c-abc", Verb: "get", NonResource: true},
+		},
+		{
+			method: http.MethodDelete,
+			path:   "/api/v1/namespaces/default",
+			want:   &ScopedRequest{Cluster: "local", Verb: "delete", Resource: "namespaces"},
+		},
+		{
+			method: http.MethodPost,
+			path:   "/v1/catalog.cattle.io.apps/default",
+			want:   &ScopedRequest{Cluster: "local", Verb: "create", APIGroup: "catalog.cattle.io", Resource: "apps"},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/v1/secrets/default",
+			want:   &ScopedRequest{Cluster: "local", Verb: "list", Resource: "secrets"},
+		},
+		{
+			method: http.MethodPut,
+			path:   "/v1/management.cattle.io.settings/server-url",
+			want:   &ScopedRequest{Cluster: "local", Verb: "update", APIGroup: "management.cattle.io", Resource: "settings"},
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/v3/clusters/c-abc",
+			clusterID: "c-abc",
+			want:      &ScopedRequest{Cluster: "c-abc", Verb: "get", APIGroup: "management.cattle.io", Resource: "clusters"},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/v3/project/c-abc:p-xyz/apps",
+			want:   &ScopedRequest{Cluster: "c-abc", Verb: "list", APIGroup: "management.cattle.io", Resource: "apps"},
+		},
+		{
+			method:    http.MethodPost,
+			path:      "/k8s/clusters/c-abc/api/v1/namespaces/default/pods/web/exec",
+			clusterID: "c-abc",
+			want:      &ScopedRequest{Cluster: "c-abc", Verb: "create", Resource: "pods/exec"},
+		},
+		{
+			method: http.MethodGet,
+			path:   "/api/v1/namespaces/default/pods/web/log",
+			want:   &ScopedRequest{Cluster: "local", Verb: "get", Resource: "pods/log"},
+		},
+		{
+			method: http.MethodPut,
+			path:   "/api/v1/namespaces/default/finalize",
+			want:   &ScopedRequest{Cluster: "local", Verb: "update", Resource: "namespaces/finalize"},
+		},
+		{
+			method: http.MethodDelete,
+			path:   "/api/v1/namespaces/default/secrets",
+			want:   &ScopedRequest{Cluster: "local", Verb: "deletecollection", Resource: "secrets"},
+		},
+		{
+			method: http.MethodPost,
+			path:   "/apis",
+		},
+		{
+			method: http.MethodGet,
+			path:   "/dashboard/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			got, ok := ParseScopedRequest(req, tt.clusterID)
+			if tt.want == nil {
+				assert.False(t, ok)
+				return
+			}
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	readOnly := &v3.TokenScope{
+		Clusters: []string{"c-abc", "c-def"},
+		Verbs:    []string{"get", "list", "watch"},
+	}
+	catalog := &v3.TokenScope{
+		APIGroups: []string{"catalog.cattle.io"},
+	}
+
+	tests := []struct {
+		name      string
+		scope     *v3.TokenScope
+		method    string
+		path      string
+		clusterID string
+		wantErr   bool
+	}{
+		{
+			name:   "nil scope",
+			method: http.MethodDelete,
+			path:   "/v3/clusters/c-abc",
+		},
+		{
+			name:      "read in allowed cluster",
+			scope:     readOnly,
+			method:    http.MethodGet,
+			path:      "/k8s/clusters/c-def/api/v1/pods",
+			clusterID: "c-def",
+		},
+		{
+			name:      "ambiguous read",
+			scope:     &v3.TokenScope{Verbs: []string{"list"}},
+			method:    http.MethodGet,
+			path:      "/v1/pods/default",
+			clusterID: "",
+		},
+		{
+			name:      "ambiguous read requires list",
+			scope:     &v3.TokenScope{Verbs: []string{"get"}},
+			method:    http.MethodGet,
+			path:      "/v1/pods/default",
+			clusterID: "",
+			wantErr:   true,
+		},
+		{
+			name:      "get does not allow list",
+			scope:     &v3.TokenScope{Verbs: []string{"get"}},
+			method:    http.MethodGet,
+			path:      "/k8s/clusters/c-abc/api/v1/namespaces/default/secrets",
+			clusterID: "c-abc",
+			wantErr:   true,
+		},
+		{
+			name:      "resource does not allow its subresources",
+			scope:     &v3.TokenScope{Resources: []string{"pods"}},
+			method:    http.MethodPost,
+			path:      "/k8s/clusters/c-abc/api/v1/namespaces/default/pods/web/exec",
+			clusterID: "c-abc",
+			wantErr:   true,
+		},
+		{
+			name:      "subresource allowed explicitly",
+			scope:     &v3.TokenScope{Resources: []string{"pods", "pods/log"}},
+			method:    http.MethodGet,
+			path:      "/k8s/clusters/c-abc/api/v1/namespaces/default/pods/web/log",
+			clusterID: "c-abc",
+		},
+		{
+			name:      "write in allowed cluster",
+			scope:     readOnly,
+			method:    http.MethodPatch,
+			path:      "/k8s/clusters/c-abc/api/v1/namespaces/default/pods/web",
+			clusterID: "c-abc",
+			wantErr:   true,
+		},
+		{
+			name:      "read in other cluster",
+			scope:     readOnly,
+			method:    http.MethodGet,
+			path:      "/k8s/clusters/c-xyz/api/v1/pods",
+			clusterID: "c-xyz",
+			wantErr:   true,
+		},
+		{
+			name:    "management API counts as local",
+			scope:   readOnly,
+			method:  http.MethodGet,
+			path:    "/v3/settings",
+			wantErr: true,
+		},
+		{
+			name:   "catalog operation",
+			scope:  catalog,
+			method: http.MethodPost,
+			path:   "/v1/catalog.cattle.io.clusterrepos/rancher-charts",
+		},
+		{
+			name:   "discovery with group restriction",
+			scope:  catalog,
+			method: http.MethodGet,
+			path:   "/apis",
+		},
+		{
+			name:    "other group",
+			scope:   catalog,
+			method:  http.MethodGet,
+			path:    "/v1/secrets",
+			wantErr: true,
+		},
+		{
+			name:    "unknown path with group restriction",
+			scope:   catalog,
+			method:  http.MethodGet,
+			path:    "/dashboard/",
+			wantErr: true,
+		},
+		{
+			name:   "unknown path with cluster restriction including local",
+			scope:  &v3.TokenScope{Clusters: []string{"local"}},
+			method: http.MethodGet,
+			path:   "/dashboard/",
+		},
+		{
+			name:   "wildcard",
+			scope:  &v3.TokenScope{Verbs: []string{"*"}, Resources: []string{"*"}},
+			method: http.MethodDelete,
+			path:   "/v1/secrets/default/creds",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ScopeAllows(tt.scope, httptest.NewRequest(tt.method, tt.path, nil), tt.clusterID)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestScopeIsSubset(t *testing.T) {
+	parent := &v3.TokenScope{
+		Clusters: []string{"c-abc", "c-def"},
+		Verbs:    []string{"get", "list"},
+	}
+
+	tests := []struct {
+		name    string
+		child   *v3.TokenScope
+		parent  *v3.TokenScope
+		wantErr bool
+	}{
+		{
+			name:  "unscoped parent",
+			child: nil,
+		},
+		{
+			name:   "narrower",
+			child:  &v3.TokenScope{Clusters: []string{"c-abc"}, Verbs: []string{"get"}, Resources: []string{"pods"}},
+			parent: parent,
+		},
+		{
+			name:    "unscoped child",
+			parent:  parent,
+			wantErr: true,
+		},
+		{
+			name:    "drops a restriction",
+			child:   &v3.TokenScope{Clusters: []string{"c-abc"}},
+			parent:  parent,
+			wantErr: true,
+		},
+		{
+			name:    "extra verb",
+			child:   &v3.TokenScope{Clusters: []string{"c-abc"}, Verbs: []string{"get", "delete"}},
+			parent:  parent,
+			wantErr: true,
+		},
+		{
+			name:    "wildcard",
+			child:   &v3.TokenScope{Clusters: []string{"*"}, Verbs: []string{"get"}},
+			parent:  parent,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ScopeIsSubset(tt.child, tt.parent)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestIsRestrictedScope(t *testing.T) {
+	assert.False(t, IsRestrictedScope(nil))
+	assert.False(t, IsRestrictedScope(&v3.TokenScope{}))
+	assert.True(t, IsRestrictedScope(&v3.TokenScope{Clusters: []string{"c-abc"}}))
+	assert.True(t, IsRestrictedScope(&v3.TokenScope{Verbs: []string{"get"}}))
+	assert.True(t, IsRestrictedScope(&v3.TokenScope{Resources: []string{"pods"}}))
+}
+
+func TestCreateDerivedTokenOutsideScopeClusters(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		tokenKeyIndex: func(obj interface{}) ([]string, error) {
+			return []string{obj.(*v3.Token).Token}, nil
+		},
+	})
+	require.NoError(t, indexer.Add(&v3.Token{
+		ObjectMeta: metav1.ObjectMeta{Name: "token-abc"},
+		Token:      "key",
+		UserID:     "u-abc",
+		Scope:      &v3.TokenScope{Clusters: []string{"c-abc"}},
+	}))
+	m := Manager{tokenIndexer: indexer}
+
+	_, _, status, err := m.createDerivedToken(clientv3.Token{ClusterID: "c-xyz"}, "token-abc:key")
+	assert.Error(t, err)
+	assert.Equal(t, 403, status)
+}
@@ -0,0 +1,48 @@
+package util
+
+import (
+	"context"
+	"sync"
+)
+
+type auditAnnotationsKey struct{}
+
+type auditAnnotations struct {
+	lock   sync.Mutex
+	values map[string]string
+}
+
+// WithAuditAnnotations returns a context handlers can add audit annotations to with AddAuditAnnotation.
+func WithAuditAnnotations(ctx context.Context) context.Context {
+	return context.WithValue(ctx, auditAnnotationsKey{}, &auditAnnotations{values: map[string]string{}})
+}
+
+// AddAuditAnnotation records an event of interest, e.g. an account lockout, in the audit record of the request of ctx.
+// It does nothing if the request is not audited.
+func AddAuditAnnotation(ctx context.Context, key, value string) {
+	annotations, ok := ctx.Value(auditAnnotationsKey{}).(*auditAnnotations)
+	if !ok {
+		return
+	}
+	annotations.lock.Lock()
+	defer annotations.lock.Unlock()
+	annotations.values[key] = value
+}
+
+// AuditAnnotations returns a copy of the audit annotations added to ctx.
+func AuditAnnotations(ctx context.Context) map[string]string {
+	annotations, ok := ctx.Value(auditAnnotationsKey{}).(*auditAnnotations)
+	if !ok {
+		return nil
+	}
+	annotations.lock.Lock()
+	defer annotations.lock.Unlock()
+	if len(annotations.values) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(annotations.values))
+	for k, v := range annotations.values {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package util
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestClientIP returns the IP address of the client of req, honoring the X-Forwarded-For header of the proxies
+// trusted by the auth-local-lockout-trusted-proxies setting.
+func RequestClientIP(req *http.Request) string {
+	return ClientIP(req, ParseTrustedProxies(settings.AuthLocalLockoutTrustedProxies.Get()))
+}
+
+// ParseTrustedProxies parses the comma separated IP addresses and CIDRs of trusted proxies.
+func ParseTrustedProxies(value string) []*net.IPNet {
+	var proxies []*net.IPNet
+	for _, proxy := range strings.Split(value, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+		_, cidr, err := net.ParseCIDR(proxy)
+		if err != nil {
+			logrus.Warnf("Ignoring invalid trusted proxy %q: %v", proxy, err)
+			continue
+		}
+		proxies = append(proxies, cidr)
+	}
+	return proxies
+}
+
+// ClientIP returns the IP address of the client of req. The X-Forwarded-For header can be set by any client, so it is
+// only honored for connections from trusted proxies: the client is the last address of the header that is not a
+// trusted proxy.
+func ClientIP(req *http.Request, trustedProxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+
+	trusted := func(ip net.IP) bool {
+		for _, proxy := range trustedProxies {
+			if proxy.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	if !trusted(ip) {
+		return ip.String()
+	}
+
+	forwarded := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0 && trusted(ip); i-- {
+		forwardedIP := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if forwardedIP == nil {
+			break
+		}
+		ip = forwardedIP
+	}
+	return ip.String()
+}
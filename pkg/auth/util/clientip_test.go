@@ -0,0 +1,60 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	trustedProxies := ParseTrustedProxies("10.42.0.0/16, 192.168.0.1, invalid")
+	assert.Len(t, trustedProxies, 2)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{
+			name:       "direct connection",
+			remoteAddr: "203.0.113.5:41000",
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "forwarded header of an untrusted client is ignored",
+			remoteAddr: "203.0.113.5:41000",
+			forwarded:  []string{"198.51.100.7"},
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.42.1.10:41000",
+			forwarded:  []string{"198.51.100.7"},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "addresses prepended by the client are ignored",
+			remoteAddr: "10.42.1.10:41000",
+			forwarded:  []string{"198.51.100.7, 203.0.113.9", "192.168.0.1"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "trusted proxy without forwarded header",
+			remoteAddr: "192.168.0.1:41000",
+			want:       "192.168.0.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v3-public/localProviders/local?action=login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			assert.Equal(t, tt.want, ClientIP(req, trustedProxies))
+		})
+	}
+}
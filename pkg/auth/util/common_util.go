@@ -35,6 +35,8 @@ func GetHTTPErrorCode(httpStatus int) string {
 		return "NotFound"
 	case 403:
 		return "PermissionDenied"
+	case 429:
+		return "TooManyRequests"
 	case 500:
 		return "ServerError"
 	}
@@ -79,8 +79,9 @@
 
 	JoinServerImplausible = "implausible"
 
-	SecretTypeMachinePlan  = "rke.cattle.io/machine-plan"
-	SecretTypeClusterState = "rke.cattle.io/cluster-state"
+	SecretTypeMachinePlan        = "rke.cattle.io/machine-plan"
+	SecretTypeMachinePlanHistory = "rke.cattle.io/machine-plan-history"
+	SecretTypeClusterState       = "rke.cattle.io/cluster-state"
 
 	MachineTemplateClonedFromGroupVersionAnn = "rke.cattle.io/cloned-from-group-version"
 	MachineTemplateClonedFromKindAnn         = "rke.cattle.io/cloned-from-kind"
@@ -106,6 +107,7 @@
 	InfrastructureReady          = condition.Cond(capi.InfrastructureReadyCondition)
 	SystemUpgradeControllerReady = condition.Cond("SystemUpgradeControllerReady")
 	Bootstrapped                 = condition.Cond("Bootstrapped")
+	WorkerCanaryHealthy          = condition.Cond("WorkerCanaryHealthy")
 
 	RuntimeK3S  = "k3s"
 	RuntimeRKE2 = "rke2"
@@ -0,0 +1,316 @@
+package planner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/rancher/wrangler/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+)
+
+const (
+	workerCanaryTier = "worker canary"
+
+	canaryProbePrefix         = "canary-"
+	defaultCanaryTimeout      = 10 * time.Minute
+	canaryRecheckInterval     = 30 * time.Second
+	canaryPodListTimeout      = 10 * time.Second
+	canaryHaltedReason        = "Halted"
+	canaryWaitingReason       = "Waiting"
+	waitingCanaryPlansMessage = "waiting for canary worker nodes to be upgraded"
+	noCanaryMachinesMessage   = "waiting for worker machines matching the canary machine selector"
+	canaryGatesFailingMessage = "waiting for canary health gates to pass"
+	canaryGatesHealthyMessage = "waiting for canary health gates to pass for %s"
+	canaryHaltedMessage       = "rollout halted, canary health gates failed for more than %s"
+)
+
+// canaryFilter returns a filter for the worker machines selected by the machine selector of canary.
+func canaryFilter(canary *rkev1.CanaryStrategy) (roleFilter, error) {
+	if canary.MachineSelector == nil {
+		return nil, fmt.Errorf("worker canary machine selector is not set")
+	}
+	sel, err := metav1.LabelSelectorAsSelector(canary.MachineSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid worker canary machine selector: %w", err)
+	}
+	return func(entry *planEntry) bool {
+		return isOnlyWorker(entry) && sel.Matches(labels.Set(entry.Machine.Labels))
+	}, nil
+}
+
+// canaryDurations parses the healthy duration and timeout of canary.
+func canaryDurations(canary *rkev1.CanaryStrategy) (time.Duration, time.Duration, error) {
+	var (
+		healthyDuration time.Duration
+		timeout         = defaultCanaryTimeout
+		err             error
+	)
+	if canary.HealthyDuration != "" {
+		if healthyDuration, err = time.ParseDuration(canary.HealthyDuration); err != nil {
+			return 0, 0, fmt.Errorf("invalid worker canary healthy duration %s: %w", canary.HealthyDuration, err)
+		}
+	}
+	if canary.Timeout != "" {
+		if timeout, err = time.ParseDuration(canary.Timeout); err != nil {
+			return 0, 0, fmt.Errorf("invalid worker canary timeout %s: %w", canary.Timeout, err)
+		}
+	}
+	return healthyDuration, timeout, nil
+}
+
+// addCanaryProbes adds the probes of the worker canary strategy to the probes of canary machines, the system-agent
+// reports their health along with the other probes of the plan.
+func addCanaryProbes(controlPlane *rkev1.RKEControlPlane, entry *planEntry, probes map[string]plan.Probe) (map[string]plan.Probe, error) {
+	canary := controlPlane.Spec.UpgradeStrategy.WorkerCanary
+	if canary == nil || len(canary.Probes) == 0 {
+		return probes, nil
+	}
+	isCanary, err := canaryFilter(canary)
+	if err != nil {
+		return probes, err
+	}
+	if !isCanary(entry) {
+		return probes, nil
+	}
+
+	if probes == nil {
+		probes = map[string]plan.Probe{}
+	}
+	for probeName, probe := range canary.Probes {
+		probes[canaryProbePrefix+probeName] = plan.Probe{
+			TimeoutSeconds:   probe.TimeoutSeconds,
+			SuccessThreshold: probe.SuccessThreshold,
+			FailureThreshold: probe.FailureThreshold,
+			HTTPGetAction: plan.HTTPGetAction{
+				URL:      probe.URL,
+				Insecure: probe.Insecure,
+				CACert:   probe.CACert,
+			},
+		}
+	}
+	return probes, nil
+}
+
+// canaryRevision identifies the current plans of the canary machines.
+func canaryRevision(entries []*planEntry) (string, error) {
+	plans := map[string]string{}
+	for _, entry := range entries {
+		if entry.Plan == nil {
+			continue
+		}
+		data, err := json.Marshal(entry.Plan.Plan)
+		if err != nil {
+			return "", err
+		}
+		plans[entry.Machine.Name] = PlanHash(data)
+	}
+	data, err := json.Marshal(plans)
+	if err != nil {
+		return "", err
+	}
+	return PlanHash(data), nil
+}
+
+// canaryGateFailures returns why the health gates fail on the canary machines. The nodes of the machines must be
+// ready, their plans applied and their probes healthy. If podsNotReady is set, the pods running on the nodes must be
+// ready too.
+func canaryGateFailures(entries []*planEntry, podsNotReady func(*capi.Machine) ([]string, error)) []string {
+	var failures []string
+	for _, entry := range entries {
+		switch {
+		case entry.Plan == nil || !entry.Plan.InSync:
+			failures = append(failures, fmt.Sprintf("plan of machine %s is not applied", entry.Machine.Name))
+		case !entry.Plan.Healthy:
+			failures = append(failures, fmt.Sprintf("probes of machine %s are not healthy", entry.Machine.Name))
+		case entry.Machine.Status.NodeRef == nil || !conditions.IsTrue(entry.Machine, capi.MachineNodeHealthyCondition):
+			failures = append(failures, fmt.Sprintf("node of machine %s is not ready", entry.Machine.Name))
+		case podsNotReady != nil:
+			pods, err := podsNotReady(entry.Machine)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("failed to list pods of machine %s: %v", entry.Machine.Name, err))
+			} else if len(pods) > 0 {
+				failures = append(failures, fmt.Sprintf("pods %s on machine %s are not ready", atMostThree(pods), entry.Machine.Name))
+			}
+		}
+	}
+	return failures
+}
+
+// workerCanaryGates evaluates the health gates of the canary worker machines and records their state in the status.
+// It returns the message major plan changes of the other worker machines are held with, or an empty message if the
+// gates passed for the healthy duration of the canary strategy.
+func (p *Planner) workerCanaryGates(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus, clusterPlan *plan.Plan,
+	canary *rkev1.CanaryStrategy, isCanary roleFilter, canaryPending bool, now time.Time) (rkev1.RKEControlPlaneStatus, string, error) {
+	healthyDuration, timeout, err := canaryDurations(canary)
+	if err != nil {
+		return status, "", err
+	}
+
+	entries := collect(clusterPlan, roleAnd(isCanary, isNotDeleting))
+	if len(entries) == 0 {
+		status.WorkerCanary = nil
+		markCanary(&status, capr.WorkerCanaryHealthy.Unknown, canaryWaitingReason, noCanaryMachinesMessage)
+		return status, noCanaryMachinesMessage, nil
+	}
+	if canaryPending {
+		markCanary(&status, capr.WorkerCanaryHealthy.Unknown, canaryWaitingReason, waitingCanaryPlansMessage)
+		return status, waitingCanaryPlansMessage, nil
+	}
+
+	revision, err := canaryRevision(entries)
+	if err != nil {
+		return status, "", err
+	}
+	if status.WorkerCanary == nil || status.WorkerCanary.Revision != revision {
+		status.WorkerCanary = &rkev1.WorkerCanaryStatus{
+			Revision:  revision,
+			StartTime: now.UTC().Format(time.RFC3339),
+		}
+	}
+
+	var podsNotReady func(*capi.Machine) ([]string, error)
+	if canary.PodsReady {
+		podsNotReady = func(machine *capi.Machine) ([]string, error) {
+			return p.podsNotReady(cp, machine)
+		}
+	}
+
+	if failures := canaryGateFailures(entries, podsNotReady); len(failures) > 0 {
+		status.WorkerCanary.HealthyTime = ""
+		startTime, err := time.Parse(time.RFC3339, status.WorkerCanary.StartTime)
+		if err != nil {
+			startTime = now
+		}
+		// The gates are not only evaluated from watched objects, so they are re-evaluated periodically.
+		p.rkeControlPlanes.EnqueueAfter(cp.Namespace, cp.Name, canaryRecheckInterval)
+		if now.Sub(startTime) < timeout {
+			message := canaryGatesFailingMessage + ": " + strings.Join(failures, ", ")
+			markCanary(&status, capr.WorkerCanaryHealthy.Unknown, canaryWaitingReason, message)
+			return status, message, nil
+		}
+		status.WorkerCanary.Halted = true
+		message := fmt.Sprintf(canaryHaltedMessage, timeout) + ": " + strings.Join(failures, ", ")
+		markCanary(&status, capr.WorkerCanaryHealthy.False, canaryHaltedReason, message)
+		return status, message, nil
+	}
+
+	status.WorkerCanary.Halted = false
+	if status.WorkerCanary.HealthyTime == "" {
+		status.WorkerCanary.HealthyTime = now.UTC().Format(time.RFC3339)
+	}
+	healthyTime, err := time.Parse(time.RFC3339, status.WorkerCanary.HealthyTime)
+	if err != nil {
+		healthyTime = now
+	}
+	if remaining := healthyDuration - now.Sub(healthyTime); remaining > 0 {
+		message := fmt.Sprintf(canaryGatesHealthyMessage, healthyDuration)
+		markCanary(&status, capr.WorkerCanaryHealthy.Unknown, canaryWaitingReason, message)
+		p.rkeControlPlanes.EnqueueAfter(cp.Namespace, cp.Name, remaining)
+		return status, message, nil
+	}
+
+	markCanary(&status, capr.WorkerCanaryHealthy.True, "", "")
+	return status, "", nil
+}
+
+func markCanary(status *rkev1.RKEControlPlaneStatus, set func(interface{}), reason, message string) {
+	set(status)
+	capr.WorkerCanaryHealthy.Reason(status, reason)
+	capr.WorkerCanaryHealthy.Message(status, message)
+}
+
+// downstreamClients caches the clients of the downstream clusters the pods of canary machines are listed in, so that a
+// client is only built again when the kubeconfig secret of its cluster changes.
+type downstreamClients struct {
+	sync.Mutex
+	clients map[string]downstreamClient
+}
+
+type downstreamClient struct {
+	resourceVersion string
+	client          kubernetes.Interface
+}
+
+// get returns the client of the downstream cluster of the given kubeconfig secret.
+func (d *downstreamClients) get(secret *corev1.Secret) (kubernetes.Interface, error) {
+	key := secret.Namespace + "/" + secret.Name
+	d.Lock()
+	defer d.Unlock()
+	if c, ok := d.clients[key]; ok && c.resourceVersion == secret.ResourceVersion {
+		return c.client, nil
+	}
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(secret.Data["value"])
+	if err != nil {
+		return nil, err
+	}
+	restConfig.Timeout = canaryPodListTimeout
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	if d.clients == nil {
+		d.clients = map[string]downstreamClient{}
+	}
+	d.clients[key] = downstreamClient{resourceVersion: secret.ResourceVersion, client: client}
+	return client, nil
+}
+
+// podsNotReady returns the pods running on the node of machine that are not ready. Pods that completed are ignored.
+func (p *Planner) podsNotReady(cp *rkev1.RKEControlPlane, machine *capi.Machine) ([]string, error) {
+	if machine.Status.NodeRef == nil {
+		return nil, fmt.Errorf("machine %s has no node", machine.Name)
+	}
+	secret, err := p.secretCache.Get(cp.Namespace, name.SafeConcatName(machine.Spec.ClusterName, "kubeconfig"))
+	if err != nil {
+		return nil, err
+	}
+	client, err := p.downstreamClients.get(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(p.ctx, canaryPodListTimeout)
+	defer cancel()
+	pods, err := client.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", machine.Status.NodeRef.Name).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var notReady []string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if !podReady(&pod) {
+			notReady = append(notReady, pod.Namespace+"/"+pod.Name)
+		}
+	}
+	sort.Strings(notReady)
+	return notReady, nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package planner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+func createTestCanaryPlan(canaryHealthy bool) *plan.Plan {
+	clusterPlan := &plan.Plan{
+		Nodes:    map[string]*plan.Node{},
+		Machines: map[string]*capi.Machine{},
+		Metadata: map[string]*plan.Metadata{},
+	}
+	for _, name := range []string{"canary", "worker"} {
+		entry := createTestPlanEntry("linux")
+		entry.Machine.Name = name
+		entry.Machine.Labels["canary"] = map[string]string{"canary": "true", "worker": "false"}[name]
+		entry.Machine.Status.NodeRef = &v1.ObjectReference{Name: name}
+		entry.Machine.Status.Conditions = capi.Conditions{{Type: capi.MachineNodeHealthyCondition, Status: v1.ConditionTrue}}
+		clusterPlan.Machines[name] = entry.Machine
+		clusterPlan.Metadata[name] = entry.Metadata
+		clusterPlan.Nodes[name] = &plan.Node{InSync: true, Healthy: name != "canary" || canaryHealthy}
+	}
+	return clusterPlan
+}
+
+func TestCanaryFilter(t *testing.T) {
+	_, err := canaryFilter(&rkev1.CanaryStrategy{})
+	assert.Error(t, err, "a machine selector is required")
+
+	isCanary, err := canaryFilter(&rkev1.CanaryStrategy{
+		MachineSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"canary": "true"}},
+	})
+	assert.NoError(t, err)
+
+	clusterPlan := createTestCanaryPlan(true)
+	entries := collect(clusterPlan, isCanary)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "canary", entries[0].Machine.Name)
+	}
+
+	clusterPlan.Metadata["canary"].Labels[capr.ControlPlaneRoleLabel] = "true"
+	assert.Empty(t, collect(clusterPlan, isCanary), "only worker machines are canaries")
+}
+
+func TestAddCanaryProbes(t *testing.T) {
+	cp := &rkev1.RKEControlPlane{}
+	cp.Spec.UpgradeStrategy.WorkerCanary = &rkev1.CanaryStrategy{
+		MachineSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"canary": "true"}},
+		Probes: map[string]rkev1.CanaryProbe{
+			"app": {URL: "http://127.0.0.1:8080/healthz", FailureThreshold: 3},
+		},
+	}
+	clusterPlan := createTestCanaryPlan(true)
+
+	probes, err := addCanaryProbes(cp, &planEntry{Machine: clusterPlan.Machines["canary"], Metadata: clusterPlan.Metadata["canary"]}, map[string]plan.Probe{"kubelet": {}})
+	assert.NoError(t, err)
+	assert.Len(t, probes, 2)
+	assert.Equal(t, plan.Probe{
+		FailureThreshold: 3,
+		HTTPGetAction:    plan.HTTPGetAction{URL: "http://127.0.0.1:8080/healthz"},
+	}, probes["canary-app"])
+
+	probes, err = addCanaryProbes(cp, &planEntry{Machine: clusterPlan.Machines["worker"], Metadata: clusterPlan.Metadata["worker"]}, map[string]plan.Probe{"kubelet": {}})
+	assert.NoError(t, err)
+	assert.Len(t, probes, 1, "probes are only added to canary machines")
+}
+
+func TestCanaryGateFailures(t *testing.T) {
+	clusterPlan := createTestCanaryPlan(true)
+	entries := collect(clusterPlan, isOnlyWorker)
+	assert.Empty(t, canaryGateFailures(entries, nil))
+
+	clusterPlan.Nodes["canary"].Healthy = false
+	clusterPlan.Machines["worker"].Status.Conditions = nil
+	assert.Equal(t, []string{
+		"probes of machine canary are not healthy",
+		"node of machine worker is not ready",
+	}, canaryGateFailures(collect(clusterPlan, isOnlyWorker), nil))
+
+	clusterPlan = createTestCanaryPlan(true)
+	clusterPlan.Nodes["worker"].InSync = false
+	podsNotReady := func(machine *capi.Machine) ([]string, error) {
+		return []string{"default/" + machine.Name}, nil
+	}
+	assert.Equal(t, []string{
+		"pods default/canary on machine canary are not ready",
+		"plan of machine worker is not applied",
+	}, canaryGateFailures(collect(clusterPlan, isOnlyWorker), podsNotReady))
+}
+
+func TestWorkerCanaryGates(t *testing.T) {
+	now := time.Date(2023, 9, 2, 0, 0, 0, 0, time.UTC)
+	cp := &rkev1.RKEControlPlane{ObjectMeta: metav1.ObjectMeta{Namespace: "fleet-default", Name: "test"}}
+	canary := &rkev1.CanaryStrategy{
+		MachineSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"canary": "true"}},
+		HealthyDuration: "5m",
+		Timeout:         "15m",
+	}
+	isCanary, err := canaryFilter(canary)
+	assert.NoError(t, err)
+
+	mp := newMockPlanner(t, InfoFunctions{})
+	mp.rkeControlPlanes.EXPECT().EnqueueAfter(cp.Namespace, cp.Name, gomock.Any()).AnyTimes()
+
+	// The canary machines are still being upgraded.
+	status, message, err := mp.planner.workerCanaryGates(cp, rkev1.RKEControlPlaneStatus{}, createTestCanaryPlan(true), canary, isCanary, true, now)
+	assert.NoError(t, err)
+	assert.Equal(t, waitingCanaryPlansMessage, message)
+	assert.Nil(t, status.WorkerCanary)
+
+	// The gates pass but not for long enough yet.
+	status, message, err = mp.planner.workerCanaryGates(cp, status, createTestCanaryPlan(true), canary, isCanary, false, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "waiting for canary health gates to pass for 5m0s", message)
+	assert.Equal(t, now.Format(time.RFC3339), status.WorkerCanary.HealthyTime)
+	assert.True(t, capr.WorkerCanaryHealthy.IsUnknown(&status))
+
+	// The gates passed for the healthy duration.
+	status, message, err = mp.planner.workerCanaryGates(cp, status, createTestCanaryPlan(true), canary, isCanary, false, now.Add(5*time.Minute))
+	assert.NoError(t, err)
+	assert.Empty(t, message)
+	assert.True(t, capr.WorkerCanaryHealthy.IsTrue(&status))
+
+	// The gates fail, the rollout waits until the timeout.
+	status, message, err = mp.planner.workerCanaryGates(cp, status, createTestCanaryPlan(false), canary, isCanary, false, now.Add(10*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "waiting for canary health gates to pass: probes of machine canary are not healthy", message)
+	assert.Empty(t, status.WorkerCanary.HealthyTime)
+	assert.False(t, status.WorkerCanary.Halted)
+
+	// The gates failed for longer than the timeout, the rollout is halted.
+	status, message, err = mp.planner.workerCanaryGates(cp, status, createTestCanaryPlan(false), canary, isCanary, false, now.Add(16*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "rollout halted, canary health gates failed for more than 15m0s: probes of machine canary are not healthy", message)
+	assert.True(t, status.WorkerCanary.Halted)
+	assert.True(t, capr.WorkerCanaryHealthy.IsFalse(&status))
+	assert.Equal(t, canaryHaltedReason, capr.WorkerCanaryHealthy.GetReason(&status))
+
+	// New plans on the canary machines start a new evaluation.
+	newPlan := createTestCanaryPlan(false)
+	newPlan.Nodes["canary"].Plan.Files = []plan.File{{Path: "/etc/new"}}
+	status, _, err = mp.planner.workerCanaryGates(cp, status, newPlan, canary, isCanary, false, now.Add(17*time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, status.WorkerCanary.Halted)
+	assert.Equal(t, now.Add(17*time.Minute).Format(time.RFC3339), status.WorkerCanary.StartTime)
+}
+
+func TestPodsNotReady(t *testing.T) {
+	mp := newMockPlanner(t, InfoFunctions{})
+	cp := &rkev1.RKEControlPlane{ObjectMeta: metav1.ObjectMeta{Namespace: "fleet-default", Name: "test"}}
+	machine := &capi.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "canary"},
+		Spec:       capi.MachineSpec{ClusterName: "test"},
+		Status:     capi.MachineStatus{NodeRef: &v1.ObjectReference{Name: "canary"}},
+	}
+	secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: cp.Namespace, Name: "test-kubeconfig", ResourceVersion: "1"}}
+	mp.secretCache.EXPECT().Get(cp.Namespace, "test-kubeconfig").Return(secret, nil).AnyTimes()
+
+	ready := v1.PodStatus{Phase: v1.PodRunning, Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}}
+	client := k8sfake.NewSimpleClientset(
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ready"}, Status: ready},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "starting"}, Status: v1.PodStatus{Phase: v1.PodPending}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "completed"}, Status: v1.PodStatus{Phase: v1.PodSucceeded}},
+	)
+	var fieldSelector string
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		fieldSelector = action.(k8stesting.ListAction).GetListRestrictions().Fields.String()
+		return false, nil, nil
+	})
+	mp.planner.downstreamClients.clients = map[string]downstreamClient{
+		"fleet-default/test-kubeconfig": {resourceVersion: "1", client: client},
+	}
+
+	pods, err := mp.planner.podsNotReady(cp, machine)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"default/starting"}, pods)
+	assert.Equal(t, "spec.nodeName=canary", fieldSelector, "only the pods of the node are listed")
+
+	secret.ResourceVersion = "2"
+	_, err = mp.planner.podsNotReady(cp, machine)
+	assert.Error(t, err, "the client is built again from the changed kubeconfig")
+}
@@ -0,0 +1,164 @@
+package planner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/sirupsen/logrus"
+)
+
+// certificateExpirationScript lists the expiration of the server and agent certificates of the node, the CA
+// certificates are not rotated by a certificate rotation and are skipped.
+const certificateExpirationScript = `#!/bin/sh
+set -e
+
+{
+	if [ -d "${DATA_DIR}/server/tls" ]; then
+		find "${DATA_DIR}/server/tls" -name '*.crt'
+	fi
+	if [ -d "${DATA_DIR}/agent" ]; then
+		find "${DATA_DIR}/agent" -maxdepth 1 -name '*.crt'
+	fi
+} | grep -v 'ca\.crt$' | while read -r cert; do
+	if enddate=$(openssl x509 -noout -enddate -in "${cert}" 2> /dev/null); then
+		echo "${cert#"${DATA_DIR}/"} $(date -u -d "${enddate#notAfter=}" +%Y-%m-%dT%H:%M:%SZ)"
+	fi
+done
+`
+
+const (
+	// CertificateExpirationInstructionName is the name of the periodic instruction that lists the expiration of the
+	// certificates of a node. Its output lists the certificates, one per line, as: path expiration.
+	CertificateExpirationInstructionName = "certificate-expiration"
+
+	certificateExpirationScriptPath = "/var/lib/rancher/capr/certificate-expiration/expiration.sh"
+
+	defaultCertificateExpiringInDays = 30
+)
+
+// addCertificateExpirationPeriodicInstruction adds the periodic instruction that lists the expiration of the
+// certificates of the node.
+func (p *Planner) addCertificateExpirationPeriodicInstruction(nodePlan plan.NodePlan, controlPlane *rkev1.RKEControlPlane) (plan.NodePlan, error) {
+	nodePlan.Files = append(nodePlan.Files, plan.File{
+		Content: base64.StdEncoding.EncodeToString([]byte(certificateExpirationScript)),
+		Path:    certificateExpirationScriptPath,
+		Dynamic: true,
+		Minor:   true,
+	})
+	nodePlan.PeriodicInstructions = append(nodePlan.PeriodicInstructions, plan.PeriodicInstruction{
+		Name:          CertificateExpirationInstructionName,
+		Command:       "sh",
+		Args:          []string{certificateExpirationScriptPath},
+		Env:           []string{fmt.Sprintf("DATA_DIR=/var/lib/rancher/%s", capr.GetRuntime(controlPlane.Spec.KubernetesVersion))},
+		PeriodSeconds: 3600,
+	})
+	return nodePlan, nil
+}
+
+// earliestCertificateExpiration parses the output of the certificate expiration instruction and returns the
+// certificate that expires first.
+func earliestCertificateExpiration(output []byte) (string, time.Time, bool) {
+	var (
+		certificate string
+		expiration  time.Time
+	)
+	scanner := bufio.NewScanner(bytes.NewBuffer(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			continue
+		}
+		if certificate == "" || t.Before(expiration) {
+			certificate, expiration = fields[0], t
+		}
+	}
+	return certificate, expiration, certificate != ""
+}
+
+// certificateAutoRotationPending returns true if an automatic rotation of the certificates was triggered and did not
+// complete yet.
+func certificateAutoRotationPending(status rkev1.RKEControlPlaneStatus) bool {
+	return status.CertificateAutoRotation != nil && status.CertificateAutoRotation.Generation != status.CertificateAutoRotation.AppliedGeneration
+}
+
+// autoRotateCertificates sets the certificate expiring first on each machine on the status, and triggers an automatic
+// rotation of the certificates if one of them expires within the threshold of the cluster and the maintenance window
+// is open. Expirations collected before the last automatic rotation completed are not considered, as they may list
+// the certificates that were rotated.
+func (p *Planner) autoRotateCertificates(controlPlane *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus, clusterPlan *plan.Plan, now time.Time) (rkev1.RKEControlPlaneStatus, error) {
+	autoRotation := controlPlane.Spec.CertificateAutoRotation
+	if autoRotation == nil {
+		status.CertificateExpiration = nil
+		return status, nil
+	}
+
+	var appliedTime time.Time
+	if status.CertificateAutoRotation != nil && status.CertificateAutoRotation.AppliedTime != "" {
+		appliedTime, _ = time.Parse(time.RFC3339, status.CertificateAutoRotation.AppliedTime)
+	}
+	days := autoRotation.ExpiringInDays
+	if days <= 0 {
+		days = defaultCertificateExpiringInDays
+	}
+	threshold := now.AddDate(0, 0, days)
+
+	var (
+		expirations []rkev1.CertificateExpiration
+		expiring    string
+	)
+	for machineName, node := range clusterPlan.Nodes {
+		output, ok := node.PeriodicOutput[CertificateExpirationInstructionName]
+		if !ok || output.ExitCode != 0 {
+			continue
+		}
+		certificate, expiration, ok := earliestCertificateExpiration(output.Stdout)
+		if !ok {
+			continue
+		}
+		expirations = append(expirations, rkev1.CertificateExpiration{
+			MachineName:    machineName,
+			Certificate:    certificate,
+			ExpirationDate: expiration.UTC().Format(time.RFC3339),
+		})
+		if lastRun, err := time.Parse(time.UnixDate, output.LastSuccessfulRunTime); err == nil && lastRun.After(appliedTime) && expiration.Before(threshold) {
+			expiring = fmt.Sprintf("certificate %s of machine %s expires at %s", certificate, machineName, expiration.UTC().Format(time.RFC3339))
+		}
+	}
+	sort.Slice(expirations, func(i, j int) bool {
+		return expirations[i].MachineName < expirations[j].MachineName
+	})
+	status.CertificateExpiration = expirations
+
+	if expiring == "" || !status.Initialized || shouldRotate(controlPlane) {
+		return status, nil
+	}
+	open, next, err := maintenanceWindowOpen(controlPlane.Spec.UpgradeStrategy.MaintenanceWindow, now)
+	if err != nil {
+		return status, err
+	}
+	if !open {
+		logrus.Debugf("[planner] rkecluster %s/%s: %s, automatic certificate rotation is %s", controlPlane.Namespace, controlPlane.Name, expiring, maintenanceWindowMessage(next))
+		return status, nil
+	}
+
+	logrus.Infof("[planner] rkecluster %s/%s: %s, triggering automatic certificate rotation", controlPlane.Namespace, controlPlane.Name, expiring)
+	autoRotationStatus := &rkev1.CertificateAutoRotationStatus{}
+	if status.CertificateAutoRotation != nil {
+		autoRotationStatus = status.CertificateAutoRotation.DeepCopy()
+	}
+	autoRotationStatus.Generation++
+	status.CertificateAutoRotation = autoRotationStatus
+	return status, errWaiting("triggering automatic certificate rotation")
+}
@@ -0,0 +1,140 @@
+package planner
+
+import (
+	"testing"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEarliestCertificateExpiration(t *testing.T) {
+	certificate, expiration, ok := earliestCertificateExpiration([]byte(`server/tls/serving-kube-apiserver.crt 2024-09-01T00:00:00Z
+agent/client-kubelet.crt 2024-08-01T00:00:00Z
+invalid
+server/tls/etcd/server-client.crt invalid
+`))
+	assert.True(t, ok)
+	assert.Equal(t, "agent/client-kubelet.crt", certificate)
+	assert.Equal(t, time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC), expiration)
+
+	_, _, ok = earliestCertificateExpiration(nil)
+	assert.False(t, ok)
+}
+
+func TestAutoRotateCertificates(t *testing.T) {
+	now := time.Date(2024, 7, 15, 12, 0, 0, 0, time.UTC)
+	lastRun := now.Add(-time.Hour).Format(time.UnixDate)
+	clusterPlan := &plan.Plan{
+		Nodes: map[string]*plan.Node{
+			"worker": {PeriodicOutput: map[string]plan.PeriodicInstructionOutput{
+				CertificateExpirationInstructionName: {
+					Stdout:                []byte("agent/client-kubelet.crt 2024-08-01T00:00:00Z\n"),
+					LastSuccessfulRunTime: lastRun,
+				},
+			}},
+			"server": {PeriodicOutput: map[string]plan.PeriodicInstructionOutput{
+				CertificateExpirationInstructionName: {
+					Stdout:                []byte("server/tls/serving-kube-apiserver.crt 2025-07-01T00:00:00Z\n"),
+					LastSuccessfulRunTime: lastRun,
+				},
+			}},
+			"failed": {PeriodicOutput: map[string]plan.PeriodicInstructionOutput{
+				CertificateExpirationInstructionName: {ExitCode: 1},
+			}},
+		},
+	}
+	newControlPlane := func() *rkev1.RKEControlPlane {
+		return &rkev1.RKEControlPlane{
+			Spec: rkev1.RKEControlPlaneSpec{
+				RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
+					CertificateAutoRotation: &rkev1.CertificateAutoRotation{},
+				},
+			},
+			Status: rkev1.RKEControlPlaneStatus{Initialized: true},
+		}
+	}
+	expirations := []rkev1.CertificateExpiration{
+		{MachineName: "server", Certificate: "server/tls/serving-kube-apiserver.crt", ExpirationDate: "2025-07-01T00:00:00Z"},
+		{MachineName: "worker", Certificate: "agent/client-kubelet.crt", ExpirationDate: "2024-08-01T00:00:00Z"},
+	}
+	mp := newMockPlanner(t, InfoFunctions{})
+
+	t.Run("triggers a rotation", func(t *testing.T) {
+		cp := newControlPlane()
+		status, err := mp.planner.autoRotateCertificates(cp, cp.Status, clusterPlan, now)
+		assert.Error(t, err)
+		assert.Equal(t, expirations, status.CertificateExpiration)
+		assert.Equal(t, &rkev1.CertificateAutoRotationStatus{Generation: 1}, status.CertificateAutoRotation)
+
+		cp.Status = status
+		assert.True(t, shouldRotate(cp))
+		assert.Equal(t, &rkev1.RotateCertificates{Generation: 1}, certificateRotation(cp))
+	})
+
+	t.Run("no certificate expiring within the threshold", func(t *testing.T) {
+		cp := newControlPlane()
+		cp.Spec.CertificateAutoRotation.ExpiringInDays = 7
+		status, err := mp.planner.autoRotateCertificates(cp, cp.Status, clusterPlan, now)
+		assert.NoError(t, err)
+		assert.Equal(t, expirations, status.CertificateExpiration)
+		assert.Nil(t, status.CertificateAutoRotation)
+	})
+
+	t.Run("expirations collected before the last rotation", func(t *testing.T) {
+		cp := newControlPlane()
+		cp.Status.CertificateAutoRotation = &rkev1.CertificateAutoRotationStatus{Generation: 1, AppliedGeneration: 1, AppliedTime: now.Add(-time.Minute).Format(time.RFC3339)}
+		status, err := mp.planner.autoRotateCertificates(cp, cp.Status, clusterPlan, now)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), status.CertificateAutoRotation.Generation)
+	})
+
+	t.Run("maintenance window closed", func(t *testing.T) {
+		cp := newControlPlane()
+		cp.Spec.UpgradeStrategy.MaintenanceWindow = &rkev1.MaintenanceWindow{Schedules: []string{"0 2 * * *"}, Duration: "1h"}
+		status, err := mp.planner.autoRotateCertificates(cp, cp.Status, clusterPlan, now)
+		assert.NoError(t, err)
+		assert.Nil(t, status.CertificateAutoRotation)
+	})
+
+	t.Run("manual rotation in progress", func(t *testing.T) {
+		cp := newControlPlane()
+		cp.Spec.RotateCertificates = &rkev1.RotateCertificates{Generation: 2, Services: []string{"etcd"}}
+		status, err := mp.planner.autoRotateCertificates(cp, cp.Status, clusterPlan, now)
+		assert.NoError(t, err)
+		assert.Nil(t, status.CertificateAutoRotation)
+	})
+
+	t.Run("auto rotation disabled", func(t *testing.T) {
+		cp := newControlPlane()
+		cp.Spec.CertificateAutoRotation = nil
+		cp.Status.CertificateExpiration = expirations
+		status, err := mp.planner.autoRotateCertificates(cp, cp.Status, clusterPlan, now)
+		assert.NoError(t, err)
+		assert.Nil(t, status.CertificateExpiration)
+	})
+}
+
+func TestCertificateRotation(t *testing.T) {
+	cp := &rkev1.RKEControlPlane{
+		Spec: rkev1.RKEControlPlaneSpec{
+			RotateCertificates: &rkev1.RotateCertificates{Generation: 2, Services: []string{"etcd"}},
+		},
+		Status: rkev1.RKEControlPlaneStatus{
+			Initialized:                   true,
+			CertificateRotationGeneration: 2,
+		},
+	}
+	assert.False(t, shouldRotate(cp))
+	assert.Equal(t, &rkev1.RotateCertificates{Generation: 2, Services: []string{"etcd"}}, certificateRotation(cp))
+
+	cp.Status.CertificateAutoRotation = &rkev1.CertificateAutoRotationStatus{Generation: 1}
+	assert.True(t, shouldRotate(cp))
+	assert.Equal(t, &rkev1.RotateCertificates{Generation: 3}, certificateRotation(cp), "an automatic rotation rotates all the services")
+
+	cp.Status.CertificateAutoRotation.AppliedGeneration = 1
+	cp.Spec.RotateCertificates.Generation = 3
+	assert.True(t, shouldRotate(cp))
+	assert.Equal(t, &rkev1.RotateCertificates{Generation: 4, Services: []string{"etcd"}}, certificateRotation(cp), "the generation keeps increasing")
+}
@@ -4,6 +4,7 @@
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
@@ -16,6 +17,7 @@ func (p *Planner) rotateCertificates(controlPlane *rkev1.RKEControlPlane, status
 	if !shouldRotate(controlPlane) {
 		return status, nil
 	}
+	rotation := certificateRotation(controlPlane)
 
 	found, joinServer, _, err := p.findInitNode(controlPlane, clusterPlan)
 	if err != nil {
@@ -28,11 +30,11 @@ func (p *Planner) rotateCertificates(controlPlane *rkev1.RKEControlPlane, status
 	}
 
 	for _, node := range collect(clusterPlan, anyRole) {
-		if !shouldRotateEntry(controlPlane.Spec.RotateCertificates, node) {
+		if !shouldRotateEntry(rotation, node) {
 			continue
 		}
 
-		rotatePlan, joinedServer, err := p.rotateCertificatesPlan(controlPlane, tokensSecret, controlPlane.Spec.RotateCertificates, node, joinServer)
+		rotatePlan, joinedServer, err := p.rotateCertificatesPlan(controlPlane, tokensSecret, rotation, node, joinServer)
 		if err != nil {
 			return status, err
 		}
@@ -51,14 +53,38 @@ func (p *Planner) rotateCertificates(controlPlane *rkev1.RKEControlPlane, status
 		return status, errWaiting("unpausing CAPI cluster")
 	}
 
-	status.CertificateRotationGeneration = controlPlane.Spec.RotateCertificates.Generation
+	if controlPlane.Spec.RotateCertificates != nil {
+		status.CertificateRotationGeneration = controlPlane.Spec.RotateCertificates.Generation
+	}
+	if certificateAutoRotationPending(status) {
+		status.CertificateAutoRotation = status.CertificateAutoRotation.DeepCopy()
+		status.CertificateAutoRotation.AppliedGeneration = status.CertificateAutoRotation.Generation
+		status.CertificateAutoRotation.AppliedTime = time.Now().UTC().Format(time.RFC3339)
+	}
 	return status, errWaiting("certificate rotation done")
 }
 
-// shouldRotate `true` if the cluster is ready and the generation is stale
+// certificateRotation returns the certificate rotation of the cluster. Its generation is the sum of the generation of
+// the spec and of the automatic rotations, so that the idempotent instructions of the rotation run again when either
+// is incremented. An automatic rotation rotates the certificates of all the services.
+func certificateRotation(cp *rkev1.RKEControlPlane) *rkev1.RotateCertificates {
+	rotation := &rkev1.RotateCertificates{}
+	if cp.Spec.RotateCertificates != nil {
+		rotation = cp.Spec.RotateCertificates.DeepCopy()
+	}
+	if cp.Status.CertificateAutoRotation != nil {
+		rotation.Generation += cp.Status.CertificateAutoRotation.Generation
+		if certificateAutoRotationPending(cp.Status) {
+			rotation.Services = nil
+		}
+	}
+	return rotation
+}
+
+// shouldRotate `true` if the cluster is ready and the generation is stale, or an automatic rotation was triggered
 func shouldRotate(cp *rkev1.RKEControlPlane) bool {
-	// if a spec is not defined there is nothing to do
-	if cp.Spec.RotateCertificates == nil {
+	// if a spec is not defined and no automatic rotation was triggered there is nothing to do
+	if cp.Spec.RotateCertificates == nil && !certificateAutoRotationPending(cp.Status) {
 		return false
 	}
 
@@ -69,7 +95,7 @@ func shouldRotate(cp *rkev1.RKEControlPlane) bool {
 	}
 
 	// if this generation has already been applied there is no work
-	return cp.Status.CertificateRotationGeneration != cp.Spec.RotateCertificates.Generation
+	return certificateAutoRotationPending(cp.Status) || cp.Status.CertificateRotationGeneration != cp.Spec.RotateCertificates.Generation
 }
 
 // rotateCertificatesPlan rotates the certificates for the services specified, if any, and restarts the service.  If no services are specified
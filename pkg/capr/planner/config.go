@@ -40,14 +40,17 @@ func (p *Planner) addETCD(config map[string]interface{}, controlPlane *rkev1.RKE
 	if controlPlane.Spec.ETCD.DisableSnapshots {
 		config["etcd-disable-snapshots"] = true
 	}
-	if controlPlane.Spec.ETCD.SnapshotRetention > 0 {
+	if controlPlane.Spec.ETCD.SnapshotRetentionPolicy != nil {
+		config["etcd-snapshot-retention"] = policySnapshotRetention
+	} else if controlPlane.Spec.ETCD.SnapshotRetention > 0 {
 		config["etcd-snapshot-retention"] = controlPlane.Spec.ETCD.SnapshotRetention
 	}
 	if controlPlane.Spec.ETCD.SnapshotScheduleCron != "" {
 		config["etcd-snapshot-schedule-cron"] = controlPlane.Spec.ETCD.SnapshotScheduleCron
 	}
 
-	if renderS3 {
+	// Encrypted snapshots are uploaded by the system-agent, so the distribution only takes local snapshots.
+	if renderS3 && !S3EncryptionEnabled(controlPlane.Spec.ETCD.S3) {
 		args, _, files, err := p.etcdS3Args.ToArgs(controlPlane.Spec.ETCD.S3, controlPlane, "etcd-", false)
 		if err != nil {
 			return nil, err
@@ -5,6 +5,7 @@
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/blang/semver"
 	"github.com/pkg/errors"
@@ -120,6 +121,11 @@ func (p *Planner) rotateEncryptionKeys(cp *rkev1.RKEControlPlane, status rkev1.R
 		return status, fmt.Errorf("cannot pass nil parameters to rotateEncryptionKeys")
 	}
 
+	// scheduled rotations are folded into the spec of a copy of the control plane, so that the phases and their
+	// instructions follow the generation of the requested rotation
+	cp = cp.DeepCopy()
+	cp.Spec.RotateEncryptionKeys = encryptionKeyRotation(cp)
+
 	if cp.Spec.RotateEncryptionKeys == nil {
 		return p.resetEncryptionKeyRotateState(status)
 	}
@@ -128,6 +134,7 @@ func (p *Planner) rotateEncryptionKeys(cp *rkev1.RKEControlPlane, status rkev1.R
 		return status, err
 	} else if !supported {
 		logrus.Debugf("rkecluster %s/%s: marking encryption key rotation phase as failed as it was not supported by version: %s", cp.Namespace, cp.Name, cp.Spec.KubernetesVersion)
+		status = finishEncryptionKeyRotationRecord(status, cp.Spec.RotateEncryptionKeys.Generation, rkev1.RotateEncryptionKeysPhaseFailed, time.Now())
 		return p.setEncryptionKeyRotateState(status, cp.Spec.RotateEncryptionKeys, rkev1.RotateEncryptionKeysPhaseFailed)
 	}
 
@@ -153,6 +160,7 @@ func (p *Planner) rotateEncryptionKeys(cp *rkev1.RKEControlPlane, status rkev1.R
 
 	if shouldRestartEncryptionKeyRotation(cp) {
 		logrus.Debugf("[planner] rkecluster %s/%s: starting/restarting encryption key rotation", cp.Namespace, cp.Name)
+		status = startEncryptionKeyRotationRecord(status, cp.Spec.RotateEncryptionKeys.Generation, time.Now())
 		return p.setEncryptionKeyRotateState(status, cp.Spec.RotateEncryptionKeys, rkev1.RotateEncryptionKeysPhasePrepare)
 	}
 
@@ -210,6 +218,7 @@ func (p *Planner) rotateEncryptionKeys(cp *rkev1.RKEControlPlane, status rkev1.R
 		if err = p.pauseCAPICluster(cp, false); err != nil {
 			return status, errWaiting("unpausing CAPI cluster")
 		}
+		status = finishEncryptionKeyRotationRecord(status, cp.Spec.RotateEncryptionKeys.Generation, rkev1.RotateEncryptionKeysPhaseDone, time.Now())
 		status.RotateEncryptionKeysLeader = ""
 		return p.setEncryptionKeyRotateState(status, cp.Spec.RotateEncryptionKeys, rkev1.RotateEncryptionKeysPhaseDone)
 	}
@@ -743,6 +752,9 @@ func encryptionKeyRotationIsCurrentStageAllowed(leaderStage string, currentPhase
 // encryptionKeyRotationFailed updates the various status objects on the control plane, allowing the cluster to
 // continue the reconciliation loop. Encryption key rotation will not be restarted again until requested.
 func (p *Planner) encryptionKeyRotationFailed(status rkev1.RKEControlPlaneStatus, err error) (rkev1.RKEControlPlaneStatus, error) {
+	if status.RotateEncryptionKeys != nil {
+		status = finishEncryptionKeyRotationRecord(status, status.RotateEncryptionKeys.Generation, rkev1.RotateEncryptionKeysPhaseFailed, time.Now())
+	}
 	status.RotateEncryptionKeysPhase = rkev1.RotateEncryptionKeysPhaseFailed
 	return status, errors.Wrap(err, "encryption key rotation failed, please perform an etcd restore")
 }
@@ -0,0 +1,171 @@
+package planner
+
+import (
+	"time"
+
+	"github.com/rancher/channelserver/pkg/model"
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/rancher/wrangler/pkg/data/convert"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultEncryptionKeyRotationIntervalDays = 90
+	// encryptionKeyRotationHistoryLimit is the number of encryption key rotations kept in the history on the status.
+	encryptionKeyRotationHistoryLimit = 10
+)
+
+// encryptionKeyRotation returns the encryption key rotation requested for the control plane, its generation is the sum
+// of the generation of the spec and the number of scheduled rotations, so that it increases with both. It returns nil
+// if no rotation was ever requested.
+func encryptionKeyRotation(cp *rkev1.RKEControlPlane) *rkev1.RotateEncryptionKeys {
+	if cp.Spec.RotateEncryptionKeys == nil && cp.Status.EncryptionKeyRotationScheduledGeneration == 0 {
+		return nil
+	}
+	rotation := &rkev1.RotateEncryptionKeys{}
+	if cp.Spec.RotateEncryptionKeys != nil {
+		rotation = cp.Spec.RotateEncryptionKeys.DeepCopy()
+	}
+	rotation.Generation += cp.Status.EncryptionKeyRotationScheduledGeneration
+	return rotation
+}
+
+// lastEncryptionKeyRotationTime returns when the last encryption key rotation in the history started, or when the
+// control plane was created if there is none.
+func lastEncryptionKeyRotationTime(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus) time.Time {
+	if n := len(status.EncryptionKeyRotationHistory); n > 0 {
+		last := status.EncryptionKeyRotationHistory[n-1]
+		for _, value := range []string{last.StartTime, last.FinishTime} {
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				return t
+			}
+		}
+	}
+	return cp.CreationTimestamp.Time
+}
+
+// secretsEncryptionEnabled returns true if the secrets of the cluster are encrypted, which RKE2 always does and K3s only
+// does if secrets-encryption is set.
+func secretsEncryptionEnabled(cp *rkev1.RKEControlPlane) bool {
+	if capr.GetRuntime(cp.Spec.KubernetesVersion) == capr.RuntimeRKE2 {
+		return true
+	}
+	return convert.ToBool(cp.Spec.MachineGlobalConfig.Data["secrets-encryption"])
+}
+
+// lastEncryptionKeyRotationFailed returns true if the last encryption key rotation in the history failed.
+func lastEncryptionKeyRotationFailed(status rkev1.RKEControlPlaneStatus) bool {
+	n := len(status.EncryptionKeyRotationHistory)
+	return n > 0 && status.EncryptionKeyRotationHistory[n-1].Phase == rkev1.RotateEncryptionKeysPhaseFailed
+}
+
+// encryptionKeyRotationBlocked returns why an encryption key rotation requested now would not start, or an empty string
+// if it would. These are the preconditions of a rotation requested with the spec.
+func (p *Planner) encryptionKeyRotationBlocked(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus, clusterPlan *plan.Plan, releaseData *model.Release) (string, error) {
+	if supported, err := encryptionKeyRotationSupported(releaseData); err != nil {
+		return "", err
+	} else if !supported {
+		return "encryption key rotation is not supported by the Kubernetes version", nil
+	}
+	if !status.Initialized || !capr.Ready.IsTrue(cp) {
+		return "the cluster is not ready", nil
+	}
+	if clusterPlan == nil {
+		return "the cluster has no plan", nil
+	}
+	if found, joinServer, _, err := p.findInitNode(cp, clusterPlan); err != nil || !found || joinServer == "" {
+		return "the cluster does not have an init node", nil
+	}
+	return "", nil
+}
+
+// scheduleEncryptionKeyRotation triggers an encryption key rotation if the interval of the schedule of the cluster
+// passed since the last rotation and the maintenance window is open. Rotations are not triggered while another one is
+// requested or in progress, nor if the secrets of the cluster are not encrypted or a rotation requested with the spec
+// would not start. Once a rotation failed, rotations are no longer triggered until the keys are rotated successfully
+// with the spec.
+func (p *Planner) scheduleEncryptionKeyRotation(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPlaneStatus, clusterPlan *plan.Plan, releaseData *model.Release, now time.Time) (rkev1.RKEControlPlaneStatus, error) {
+	schedule := cp.Spec.EncryptionKeyRotationSchedule
+	if schedule == nil || !status.Initialized || rotateEncryptionKeyInProgress(cp) || !secretsEncryptionEnabled(cp) {
+		return status, nil
+	}
+	if rotation := encryptionKeyRotation(cp); rotation != nil && rotation.Generation > 0 && (status.RotateEncryptionKeys == nil || status.RotateEncryptionKeys.Generation != rotation.Generation) {
+		return status, nil
+	}
+
+	days := schedule.IntervalDays
+	if days <= 0 {
+		days = defaultEncryptionKeyRotationIntervalDays
+	}
+	due := lastEncryptionKeyRotationTime(cp, status).AddDate(0, 0, days)
+	if now.Before(due) {
+		return status, nil
+	}
+	if lastEncryptionKeyRotationFailed(status) {
+		logrus.Warnf("[planner] rkecluster %s/%s: scheduled encryption key rotation was due at %s, it is suspended as the last rotation failed until the keys are rotated successfully with the spec", cp.Namespace, cp.Name, due.UTC().Format(time.RFC3339))
+		return status, nil
+	}
+	open, next, err := maintenanceWindowOpen(cp.Spec.UpgradeStrategy.MaintenanceWindow, now)
+	if err != nil {
+		return status, err
+	}
+	if !open {
+		logrus.Debugf("[planner] rkecluster %s/%s: scheduled encryption key rotation was due at %s, it is %s", cp.Namespace, cp.Name, due.UTC().Format(time.RFC3339), maintenanceWindowMessage(next))
+		return status, nil
+	}
+	if reason, err := p.encryptionKeyRotationBlocked(cp, status, clusterPlan, releaseData); err != nil || reason != "" {
+		if reason != "" {
+			logrus.Debugf("[planner] rkecluster %s/%s: scheduled encryption key rotation was due at %s, it is waiting as %s", cp.Namespace, cp.Name, due.UTC().Format(time.RFC3339), reason)
+		}
+		return status, err
+	}
+
+	logrus.Infof("[planner] rkecluster %s/%s: triggering scheduled encryption key rotation, due at %s", cp.Namespace, cp.Name, due.UTC().Format(time.RFC3339))
+	status.EncryptionKeyRotationScheduledGeneration++
+	return status, errWaiting("triggering scheduled encryption key rotation")
+}
+
+// startEncryptionKeyRotationRecord adds the encryption key rotation of the generation to the history on the status,
+// unless it is already in progress.
+func startEncryptionKeyRotationRecord(status rkev1.RKEControlPlaneStatus, generation int64, now time.Time) rkev1.RKEControlPlaneStatus {
+	if n := len(status.EncryptionKeyRotationHistory); n > 0 {
+		last := status.EncryptionKeyRotationHistory[n-1]
+		if last.Generation == generation && last.Phase == "" {
+			return status
+		}
+	}
+	return appendEncryptionKeyRotationRecord(status, rkev1.EncryptionKeyRotationRecord{
+		Generation: generation,
+		StartTime:  now.UTC().Format(time.RFC3339),
+	})
+}
+
+// finishEncryptionKeyRotationRecord records the outcome of the encryption key rotation of the generation and its leader
+// in the history on the status. A record is added if the rotation failed before it started.
+func finishEncryptionKeyRotationRecord(status rkev1.RKEControlPlaneStatus, generation int64, phase rkev1.RotateEncryptionKeysPhase, now time.Time) rkev1.RKEControlPlaneStatus {
+	record := rkev1.EncryptionKeyRotationRecord{Generation: generation}
+	if n := len(status.EncryptionKeyRotationHistory); n > 0 && status.EncryptionKeyRotationHistory[n-1].Generation == generation {
+		record = status.EncryptionKeyRotationHistory[n-1]
+		if record.Phase != "" {
+			return status
+		}
+		status.EncryptionKeyRotationHistory = append([]rkev1.EncryptionKeyRotationRecord{}, status.EncryptionKeyRotationHistory[:n-1]...)
+	}
+	record.FinishTime = now.UTC().Format(time.RFC3339)
+	record.Leader = status.RotateEncryptionKeysLeader
+	record.Phase = phase
+	return appendEncryptionKeyRotationRecord(status, record)
+}
+
+// appendEncryptionKeyRotationRecord appends a record to a copy of the history on the status, dropping the oldest
+// records over the limit.
+func appendEncryptionKeyRotationRecord(status rkev1.RKEControlPlaneStatus, record rkev1.EncryptionKeyRotationRecord) rkev1.RKEControlPlaneStatus {
+	history := append(append([]rkev1.EncryptionKeyRotationRecord{}, status.EncryptionKeyRotationHistory...), record)
+	if len(history) > encryptionKeyRotationHistoryLimit {
+		history = history[len(history)-encryptionKeyRotationHistoryLimit:]
+	}
+	status.EncryptionKeyRotationHistory = history
+	return status
+}
@@ -0,0 +1,201 @@
+package planner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rancher/channelserver/pkg/model"
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	cp := &rkev1.RKEControlPlane{}
+	assert.Nil(t, encryptionKeyRotation(cp))
+
+	cp.Status.EncryptionKeyRotationScheduledGeneration = 2
+	assert.Equal(t, &rkev1.RotateEncryptionKeys{Generation: 2}, encryptionKeyRotation(cp))
+
+	cp.Spec.RotateEncryptionKeys = &rkev1.RotateEncryptionKeys{Generation: 3}
+	assert.Equal(t, &rkev1.RotateEncryptionKeys{Generation: 5}, encryptionKeyRotation(cp))
+	assert.Equal(t, int64(3), cp.Spec.RotateEncryptionKeys.Generation)
+}
+
+func TestScheduleEncryptionKeyRotation(t *testing.T) {
+	now := time.Date(2024, 7, 15, 12, 0, 0, 0, time.UTC)
+	newControlPlane := func() *rkev1.RKEControlPlane {
+		cp := &rkev1.RKEControlPlane{
+			ObjectMeta: metav1.ObjectMeta{
+				CreationTimestamp: metav1.NewTime(now.AddDate(0, 0, -100)),
+			},
+			Spec: rkev1.RKEControlPlaneSpec{
+				KubernetesVersion: "v1.28.5+rke2r1",
+				RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
+					EncryptionKeyRotationSchedule: &rkev1.EncryptionKeyRotationSchedule{},
+				},
+			},
+			Status: rkev1.RKEControlPlaneStatus{Initialized: true},
+		}
+		capr.Ready.True(cp)
+		return cp
+	}
+	releaseData := &model.Release{FeatureVersions: map[string]string{"encryption-key-rotation": "2.0.0"}}
+	initNode := createTestPlanEntry("linux")
+	initNode.Machine.Name = "init"
+	initNode.Metadata.Labels[capr.EtcdRoleLabel] = "true"
+	initNode.Metadata.Labels[capr.InitNodeLabel] = "true"
+	initNode.Metadata.Annotations = map[string]string{capr.JoinURLAnnotation: "https://10.0.0.1:9345"}
+	initNode.Machine.Status.Conditions = capi.Conditions{{Type: capi.InfrastructureReadyCondition, Status: v1.ConditionTrue}}
+	clusterPlan := &plan.Plan{
+		Machines: map[string]*capi.Machine{"init": initNode.Machine},
+		Metadata: map[string]*plan.Metadata{"init": initNode.Metadata},
+		Nodes:    map[string]*plan.Node{},
+	}
+	mp := newMockPlanner(t, InfoFunctions{})
+
+	t.Run("triggers a rotation after the interval since creation", func(t *testing.T) {
+		cp := newControlPlane()
+		status, err := mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, clusterPlan, releaseData, now)
+		assert.Error(t, err)
+		assert.Equal(t, int64(1), status.EncryptionKeyRotationScheduledGeneration)
+
+		cp.Status = status
+		assert.Equal(t, &rkev1.RotateEncryptionKeys{Generation: 1}, encryptionKeyRotation(cp))
+	})
+
+	t.Run("triggers a rotation after the interval since the last rotation", func(t *testing.T) {
+		cp := newControlPlane()
+		cp.Spec.EncryptionKeyRotationSchedule.IntervalDays = 30
+		cp.Status.RotateEncryptionKeys = &rkev1.RotateEncryptionKeys{Generation: 1}
+		cp.Status.RotateEncryptionKeysPhase = rkev1.RotateEncryptionKeysPhaseDone
+		cp.Status.EncryptionKeyRotationScheduledGeneration = 1
+		cp.Status.EncryptionKeyRotationHistory = []rkev1.EncryptionKeyRotationRecord{
+			{Generation: 1, StartTime: now.AddDate(0, 0, -20).Format(time.RFC3339), Phase: rkev1.RotateEncryptionKeysPhaseDone},
+		}
+		status, err := mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, clusterPlan, releaseData, now)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), status.EncryptionKeyRotationScheduledGeneration)
+
+		status, err = mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, clusterPlan, releaseData, now.AddDate(0, 0, 10))
+		assert.Error(t, err)
+		assert.Equal(t, int64(2), status.EncryptionKeyRotationScheduledGeneration)
+	})
+
+	t.Run("no rotation while another one is requested", func(t *testing.T) {
+		cp := newControlPlane()
+		cp.Spec.RotateEncryptionKeys = &rkev1.RotateEncryptionKeys{Generation: 1}
+		status, err := mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, clusterPlan, releaseData, now)
+		assert.NoError(t, err)
+		assert.Zero(t, status.EncryptionKeyRotationScheduledGeneration)
+	})
+
+	t.Run("no rotation while another one is in progress", func(t *testing.T) {
+		cp := newControlPlane()
+		cp.Status.RotateEncryptionKeysPhase = rkev1.RotateEncryptionKeysPhaseRotate
+		status, err := mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, clusterPlan, releaseData, now)
+		assert.NoError(t, err)
+		assert.Zero(t, status.EncryptionKeyRotationScheduledGeneration)
+	})
+
+	t.Run("no rotation outside of the maintenance window", func(t *testing.T) {
+		cp := newControlPlane()
+		cp.Spec.UpgradeStrategy.MaintenanceWindow = &rkev1.MaintenanceWindow{
+			Schedules: []string{"0 2 * * *"},
+			Duration:  "1h",
+		}
+		status, err := mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, clusterPlan, releaseData, now)
+		assert.NoError(t, err)
+		assert.Zero(t, status.EncryptionKeyRotationScheduledGeneration)
+	})
+
+	t.Run("no rotation without secrets encryption", func(t *testing.T) {
+		cp := newControlPlane()
+		cp.Spec.KubernetesVersion = "v1.28.5+k3s1"
+		status, err := mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, clusterPlan, releaseData, now)
+		assert.NoError(t, err)
+		assert.Zero(t, status.EncryptionKeyRotationScheduledGeneration)
+
+		cp.Spec.MachineGlobalConfig.Data = map[string]interface{}{"secrets-encryption": true}
+		status, err = mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, clusterPlan, releaseData, now)
+		assert.Error(t, err)
+		assert.Equal(t, int64(1), status.EncryptionKeyRotationScheduledGeneration)
+	})
+
+	t.Run("no rotation unless a requested rotation would start", func(t *testing.T) {
+		cp := newControlPlane()
+		status, err := mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, clusterPlan, &model.Release{}, now)
+		assert.NoError(t, err)
+		assert.Zero(t, status.EncryptionKeyRotationScheduledGeneration, "the version does not support encryption key rotation")
+
+		capr.Ready.False(cp)
+		status, err = mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, clusterPlan, releaseData, now)
+		assert.NoError(t, err)
+		assert.Zero(t, status.EncryptionKeyRotationScheduledGeneration, "the cluster is not ready")
+
+		cp = newControlPlane()
+		status, err = mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, &plan.Plan{}, releaseData, now)
+		assert.NoError(t, err)
+		assert.Zero(t, status.EncryptionKeyRotationScheduledGeneration, "the cluster has no init node")
+	})
+
+	t.Run("no rotation after a failed rotation until the keys are rotated", func(t *testing.T) {
+		cp := newControlPlane()
+		cp.Status.RotateEncryptionKeys = &rkev1.RotateEncryptionKeys{Generation: 1}
+		cp.Status.RotateEncryptionKeysPhase = rkev1.RotateEncryptionKeysPhaseFailed
+		cp.Status.EncryptionKeyRotationScheduledGeneration = 1
+		cp.Status.EncryptionKeyRotationHistory = []rkev1.EncryptionKeyRotationRecord{
+			{Generation: 1, StartTime: now.AddDate(0, 0, -91).Format(time.RFC3339), Phase: rkev1.RotateEncryptionKeysPhaseFailed},
+		}
+		status, err := mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, clusterPlan, releaseData, now)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), status.EncryptionKeyRotationScheduledGeneration)
+
+		// the operator rotates the keys with the spec
+		cp.Spec.RotateEncryptionKeys = &rkev1.RotateEncryptionKeys{Generation: 1}
+		cp.Status.RotateEncryptionKeys = &rkev1.RotateEncryptionKeys{Generation: 2}
+		cp.Status.RotateEncryptionKeysPhase = rkev1.RotateEncryptionKeysPhaseDone
+		cp.Status.EncryptionKeyRotationHistory = append(cp.Status.EncryptionKeyRotationHistory, rkev1.EncryptionKeyRotationRecord{
+			Generation: 2, StartTime: now.AddDate(0, 0, -90).Format(time.RFC3339), Phase: rkev1.RotateEncryptionKeysPhaseDone,
+		})
+		status, err = mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, clusterPlan, releaseData, now)
+		assert.Error(t, err)
+		assert.Equal(t, int64(2), status.EncryptionKeyRotationScheduledGeneration)
+	})
+
+	t.Run("no rotation without a schedule", func(t *testing.T) {
+		cp := newControlPlane()
+		cp.Spec.EncryptionKeyRotationSchedule = nil
+		status, err := mp.planner.scheduleEncryptionKeyRotation(cp, cp.Status, clusterPlan, releaseData, now)
+		assert.NoError(t, err)
+		assert.Zero(t, status.EncryptionKeyRotationScheduledGeneration)
+	})
+}
+
+func TestEncryptionKeyRotationRecord(t *testing.T) {
+	start := time.Date(2024, 7, 15, 12, 0, 0, 0, time.UTC)
+	finish := start.Add(time.Hour)
+
+	status := startEncryptionKeyRotationRecord(rkev1.RKEControlPlaneStatus{}, 1, start)
+	status = startEncryptionKeyRotationRecord(status, 1, finish)
+	status.RotateEncryptionKeysLeader = "cp-0"
+	status = finishEncryptionKeyRotationRecord(status, 1, rkev1.RotateEncryptionKeysPhaseDone, finish)
+	status = finishEncryptionKeyRotationRecord(status, 1, rkev1.RotateEncryptionKeysPhaseFailed, finish)
+	assert.Equal(t, []rkev1.EncryptionKeyRotationRecord{
+		{Generation: 1, StartTime: "2024-07-15T12:00:00Z", FinishTime: "2024-07-15T13:00:00Z", Leader: "cp-0", Phase: rkev1.RotateEncryptionKeysPhaseDone},
+	}, status.EncryptionKeyRotationHistory)
+
+	status.RotateEncryptionKeysLeader = ""
+	status = finishEncryptionKeyRotationRecord(status, 2, rkev1.RotateEncryptionKeysPhaseFailed, finish)
+	assert.Equal(t, rkev1.EncryptionKeyRotationRecord{Generation: 2, FinishTime: "2024-07-15T13:00:00Z", Phase: rkev1.RotateEncryptionKeysPhaseFailed}, status.EncryptionKeyRotationHistory[1])
+
+	for i := int64(3); i < 20; i++ {
+		status = startEncryptionKeyRotationRecord(status, i, start)
+	}
+	assert.Len(t, status.EncryptionKeyRotationHistory, encryptionKeyRotationHistoryLimit)
+	assert.Equal(t, int64(19), status.EncryptionKeyRotationHistory[encryptionKeyRotationHistoryLimit-1].Generation)
+}
@@ -0,0 +1,305 @@
+package planner
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/rancher/wrangler/pkg/name"
+	"github.com/rancher/wrangler/pkg/randomtoken"
+	authzv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// creatorIDAnnotation holds the user who created a cluster.
+const creatorIDAnnotation = "field.cattle.io/creatorId"
+
+// isEtcdSnapshotClone returns true if the snapshot was produced by another cluster than the cluster of controlPlane,
+// i.e. the snapshot is restored to clone a cluster.
+func isEtcdSnapshotClone(controlPlane *rkev1.RKEControlPlane, snapshot *rkev1.ETCDSnapshot) bool {
+	return snapshot != nil && snapshot.Spec.ClusterName != "" && snapshot.Spec.ClusterName != controlPlane.Spec.ClusterName
+}
+
+// etcdSnapshotCloneServerToken returns the server token of the cluster that produced the snapshot restored into the
+// cluster of controlPlane, or an empty string if the cluster does not restore the snapshot of another cluster. The
+// datastore is encrypted with the server token, so a new cluster restoring the snapshot of another cluster is created
+// with the server token of that cluster, the agent token is regenerated. The token is read from the secret named by
+// the restore, which the creator of the cluster must be allowed to get, the state secret of the other cluster is never
+// read on its own.
+func (p *Planner) etcdSnapshotCloneServerToken(controlPlane *rkev1.RKEControlPlane) (string, error) {
+	if controlPlane.Spec.ETCDSnapshotRestore == nil || controlPlane.Spec.ETCDSnapshotRestore.Name == "" {
+		return "", nil
+	}
+	snapshot, err := p.retrieveEtcdSnapshot(controlPlane)
+	if err != nil || !isEtcdSnapshotClone(controlPlane, snapshot) {
+		return "", err
+	}
+
+	secretName := controlPlane.Spec.ETCDSnapshotRestore.ServerTokenSecretName
+	if secretName == "" {
+		return "", fmt.Errorf("etcd snapshot %s/%s of cluster %s can only be restored with serverTokenSecretName set to a secret holding the server token of that cluster", snapshot.Namespace, snapshot.Name, snapshot.Spec.ClusterName)
+	}
+	if err := p.authorizeEtcdSnapshotClone(controlPlane, secretName); err != nil {
+		return "", err
+	}
+
+	secret, err := p.secretCache.Get(controlPlane.Namespace, secretName)
+	if apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("secret %s/%s holding the server token of cluster %s was not found, it is required to restore etcd snapshot %s/%s", controlPlane.Namespace, secretName, snapshot.Spec.ClusterName, snapshot.Namespace, snapshot.Name)
+	} else if err != nil {
+		return "", err
+	}
+	serverToken := string(secret.Data["serverToken"])
+	if serverToken == "" {
+		return "", fmt.Errorf("secret %s/%s does not have a serverToken", secret.Namespace, secret.Name)
+	}
+	return serverToken, nil
+}
+
+// authorizeEtcdSnapshotClone returns an error unless the creator of the cluster of controlPlane is allowed to get the
+// secret holding the server token of the cluster whose snapshot is restored. Otherwise anyone able to create a cluster
+// could obtain the datastore and the server token of any other cluster by naming its snapshot.
+func (p *Planner) authorizeEtcdSnapshotClone(controlPlane *rkev1.RKEControlPlane, secretName string) error {
+	cluster, err := p.rancherClusterCache.Get(controlPlane.Namespace, controlPlane.Spec.ClusterName)
+	if err != nil {
+		return err
+	}
+	creator := cluster.Annotations[creatorIDAnnotation]
+	if creator == "" {
+		return fmt.Errorf("cluster %s/%s has no creator, which must be allowed to get secret %s/%s to restore the etcd snapshot of another cluster", cluster.Namespace, cluster.Name, controlPlane.Namespace, secretName)
+	}
+
+	review, err := p.subjectAccessReviews.Create(p.ctx, &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User: creator,
+			ResourceAttributes: &authzv1.ResourceAttributes{
+				Verb:      "get",
+				Resource:  "secrets",
+				Namespace: controlPlane.Namespace,
+				Name:      secretName,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to review access of %s to secret %s/%s: %w", creator, controlPlane.Namespace, secretName, err)
+	}
+	if !review.Status.Allowed {
+		return fmt.Errorf("%s, the creator of cluster %s/%s, is not allowed to get secret %s/%s holding the server token of the cluster whose etcd snapshot is restored", creator, cluster.Namespace, cluster.Name, controlPlane.Namespace, secretName)
+	}
+	return nil
+}
+
+// validateEtcdSnapshotClone validates that the snapshot of another cluster can be restored into the cluster of
+// controlPlane. The snapshot must be restored from S3 as the local snapshots of the other cluster are on its machines,
+// and the cluster must have been created with the server token of the other cluster.
+func (p *Planner) validateEtcdSnapshotClone(controlPlane *rkev1.RKEControlPlane, snapshot *rkev1.ETCDSnapshot, tokensSecret plan.Secret) error {
+	if !isEtcdSnapshotClone(controlPlane, snapshot) {
+		return nil
+	}
+	if snapshot.SnapshotFile.S3 == nil && controlPlane.Spec.ETCDSnapshotRestore.S3Target == "" {
+		return fmt.Errorf("etcd snapshot %s/%s of cluster %s is stored locally on its machines, only snapshots in S3 can be restored into another cluster", snapshot.Namespace, snapshot.Name, snapshot.Spec.ClusterName)
+	}
+	serverToken, err := p.etcdSnapshotCloneServerToken(controlPlane)
+	if err != nil {
+		return err
+	}
+	if tokensSecret.ServerToken != serverToken {
+		return fmt.Errorf("etcd snapshot %s/%s of cluster %s can only be restored into a new cluster", snapshot.Namespace, snapshot.Name, snapshot.Spec.ClusterName)
+	}
+	return nil
+}
+
+// generateEtcdSnapshotCloneCleanupInstructions returns the instructions that remove the state restored from the
+// snapshot of another cluster which identifies that cluster: the list of its etcd snapshots, which is repopulated with
+// the snapshots of the cluster, and its cluster agent pods, which are replaced by the cluster agent of the cluster.
+// The nodes of the other cluster are removed by the post restore node cleanup.
+func generateEtcdSnapshotCloneCleanupInstructions(controlPlane *rkev1.RKEControlPlane, snapshot *rkev1.ETCDSnapshot) []plan.OneTimeInstruction {
+	if !isEtcdSnapshotClone(controlPlane, snapshot) {
+		return nil
+	}
+	kubectl, kubeconfig := capr.GetKubectlAndKubeconfigPaths(controlPlane.Spec.KubernetesVersion)
+	if kubectl == "" || kubeconfig == "" {
+		return nil
+	}
+	return []plan.OneTimeInstruction{
+		idempotentInstruction(
+			"etcd-restore/clone-cleanup-snapshots",
+			fmt.Sprintf("%v", controlPlane.Status.ETCDSnapshotRestore),
+			kubectl,
+			[]string{
+				"--kubeconfig",
+				kubeconfig,
+				"delete",
+				"configmap",
+				"-n",
+				"kube-system",
+				capr.GetRuntime(controlPlane.Spec.KubernetesVersion) + "-etcd-snapshots",
+				"--ignore-not-found",
+			},
+			[]string{}),
+		idempotentInstruction(
+			"etcd-restore/clone-cleanup-cluster-agent",
+			fmt.Sprintf("%v", controlPlane.Status.ETCDSnapshotRestore),
+			kubectl,
+			[]string{
+				"--kubeconfig",
+				kubeconfig,
+				"delete",
+				"pods",
+				"-n",
+				"cattle-system",
+				"-l",
+				"app=cattle-cluster-agent",
+				"--wait=false",
+			},
+			[]string{}),
+	}
+}
+
+// etcdSnapshotCloneRotateCAScript replaces the certificate authorities and the service account signing key of the
+// cluster, restored from the snapshot of another cluster, with new self-signed ones. The distribution stores them in the
+// datastore, the servers and agents use them once restarted. The replacement is forced as the new certificate
+// authorities are not cross-signed by the ones they replace.
+const etcdSnapshotCloneRotateCAScript = `#!/bin/sh
+set -e
+umask 077
+
+dir="${DATA_DIR}/server/clone-rotate-ca"
+rm -rf "${dir}"
+mkdir -p "${dir}/etcd"
+
+# ca generates the self-signed certificate authority $1 with the common name $2
+ca() {
+	openssl ecparam -name prime256v1 -genkey -noout -out "${dir}/$1.key"
+	openssl req -x509 -new -sha256 -days 3650 -key "${dir}/$1.key" -out "${dir}/$1.crt" -subj "/CN=$2@$(date +%s)" \
+		-addext "basicConstraints=critical,CA:TRUE" -addext "keyUsage=critical,digitalSignature,keyEncipherment,keyCertSign"
+}
+
+ca server-ca "${RUNTIME}-server-ca"
+ca client-ca "${RUNTIME}-client-ca"
+ca request-header-ca "${RUNTIME}-request-header-ca"
+ca etcd/peer-ca etcd-peer-ca
+ca etcd/server-ca etcd-server-ca
+openssl genrsa -out "${dir}/service.key" 2048 2> /dev/null
+
+"${RUNTIME}" certificate rotate-ca --data-dir "${DATA_DIR}" --path "${dir}" --force
+rm -rf "${dir}"
+`
+
+const (
+	etcdSnapshotCloneRotateCAScriptPath = "/var/lib/rancher/capr/etcd-clone/rotate-ca.sh"
+
+	// cloneServerTokenKey holds the server token a cloned cluster is being rotated to in its state secret, until the
+	// rotation is done and it replaces the server token.
+	cloneServerTokenKey = "rotatedServerToken"
+)
+
+// etcdSnapshotCloneTokenEnv returns the environment variables passing the server token to the distribution, and the
+// new server token if set, so that they are not in the arguments of its command.
+func etcdSnapshotCloneTokenEnv(controlPlane *rkev1.RKEControlPlane, serverToken, newServerToken string) []string {
+	prefix := strings.ToUpper(capr.GetRuntime(controlPlane.Spec.KubernetesVersion))
+	env := []string{fmt.Sprintf("%s_TOKEN=%s", prefix, serverToken)}
+	if newServerToken != "" {
+		env = append(env, fmt.Sprintf("%s_NEW_TOKEN=%s", prefix, newServerToken))
+	}
+	return env
+}
+
+// generateEtcdSnapshotCloneRotateCAFilesAndInstruction returns the script and the instruction that replace the
+// certificate authorities and the service account signing key restored from the snapshot of another cluster.
+func generateEtcdSnapshotCloneRotateCAFilesAndInstruction(controlPlane *rkev1.RKEControlPlane, tokensSecret plan.Secret) ([]plan.File, plan.OneTimeInstruction) {
+	runtime := capr.GetRuntimeCommand(controlPlane.Spec.KubernetesVersion)
+	return []plan.File{{
+		Content: base64.StdEncoding.EncodeToString([]byte(etcdSnapshotCloneRotateCAScript)),
+		Path:    etcdSnapshotCloneRotateCAScriptPath,
+		Dynamic: true,
+		Minor:   true,
+	}}, idempotentInstruction(
+		"etcd-restore/clone-rotate-ca",
+		fmt.Sprintf("%v", controlPlane.Status.ETCDSnapshotRestore),
+		"sh",
+		[]string{etcdSnapshotCloneRotateCAScriptPath},
+		append([]string{
+			fmt.Sprintf("RUNTIME=%s", runtime),
+			fmt.Sprintf("DATA_DIR=/var/lib/rancher/%s", runtime),
+		}, etcdSnapshotCloneTokenEnv(controlPlane, tokensSecret.ServerToken, "")...))
+}
+
+// generateEtcdSnapshotCloneRotateServerTokenInstruction returns the instruction that replaces the server token of the
+// cluster, which is the one of the cluster whose snapshot was restored, with newServerToken.
+func generateEtcdSnapshotCloneRotateServerTokenInstruction(controlPlane *rkev1.RKEControlPlane, serverToken, newServerToken string) plan.OneTimeInstruction {
+	return idempotentInstruction(
+		"etcd-restore/clone-rotate-server-token",
+		fmt.Sprintf("%v-%s", controlPlane.Status.ETCDSnapshotRestore, newServerToken),
+		capr.GetRuntimeCommand(controlPlane.Spec.KubernetesVersion),
+		[]string{"token", "rotate"},
+		etcdSnapshotCloneTokenEnv(controlPlane, serverToken, newServerToken))
+}
+
+// runEtcdSnapshotCloneRotateCAPlan replaces the certificate authorities and the service account signing key restored
+// from the snapshot of another cluster on the init node, from where the distribution distributes them to the other
+// nodes when they are restarted.
+func (p *Planner) runEtcdSnapshotCloneRotateCAPlan(controlPlane *rkev1.RKEControlPlane, tokensSecret plan.Secret, clusterPlan *plan.Plan) error {
+	initNodes := collect(clusterPlan, isInitNode)
+	if len(initNodes) != 1 {
+		return fmt.Errorf("multiple init nodes found")
+	}
+	initNode := initNodes[0]
+
+	initNodePlan, _, err := p.desiredPlan(controlPlane, tokensSecret, initNode, "")
+	if err != nil {
+		return err
+	}
+	files, instruction := generateEtcdSnapshotCloneRotateCAFilesAndInstruction(controlPlane, tokensSecret)
+	initNodePlan.Files = append(initNodePlan.Files, files...)
+	initNodePlan.Instructions = append(initNodePlan.Instructions, instruction)
+	return assignAndCheckPlan(p.store, ETCDRestoreMessage, initNode, initNodePlan, "", 5, 5)
+}
+
+// rotateEtcdSnapshotCloneServerToken replaces the server token of the cluster of controlPlane, which is the one of the
+// cluster whose snapshot was restored. The new server token is recorded in the state secret before the distribution
+// rotates to it, and replaces the server token in the state secret once the rotation is done. The nodes use the new
+// server token once their plans are regenerated with it.
+func (p *Planner) rotateEtcdSnapshotCloneServerToken(controlPlane *rkev1.RKEControlPlane, tokensSecret plan.Secret, clusterPlan *plan.Plan) error {
+	initNodes := collect(clusterPlan, isInitNode)
+	if len(initNodes) != 1 {
+		return fmt.Errorf("multiple init nodes found")
+	}
+	initNode := initNodes[0]
+
+	secret, err := p.secretCache.Get(controlPlane.Namespace, name.SafeConcatName(controlPlane.Name, "rke", "state"))
+	if err != nil {
+		return err
+	}
+	newServerToken := string(secret.Data[cloneServerTokenKey])
+	if newServerToken == "" {
+		if newServerToken, err = randomtoken.Generate(); err != nil {
+			return err
+		}
+		secret = secret.DeepCopy()
+		secret.Data[cloneServerTokenKey] = []byte(newServerToken)
+		if _, err := p.secretClient.Update(secret); err != nil {
+			return err
+		}
+		return errWaiting("generated new server token for the cloned cluster")
+	}
+
+	initNodePlan, _, err := p.desiredPlan(controlPlane, tokensSecret, initNode, "")
+	if err != nil {
+		return err
+	}
+	initNodePlan.Instructions = append(initNodePlan.Instructions, generateEtcdSnapshotCloneRotateServerTokenInstruction(controlPlane, tokensSecret.ServerToken, newServerToken))
+	if err := assignAndCheckPlan(p.store, ETCDRestoreMessage, initNode, initNodePlan, "", 5, 5); err != nil {
+		return err
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data["serverToken"] = []byte(newServerToken)
+	delete(secret.Data, cloneServerTokenKey)
+	_, err = p.secretClient.Update(secret)
+	return err
+}
@@ -0,0 +1,304 @@
+package planner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	apisv1 "github.com/rancher/rancher/pkg/apis/provisioning.cattle.io/v1"
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authzv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+func createTestCloneControlPlane() *rkev1.RKEControlPlane {
+	return &rkev1.RKEControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fleet-default", Name: "clone"},
+		Spec: rkev1.RKEControlPlaneSpec{
+			ClusterName:         "clone",
+			KubernetesVersion:   "v1.27.5+rke2r1",
+			ETCDSnapshotRestore: &rkev1.ETCDSnapshotRestore{Name: "source-etcd-snapshot-1-s3", Generation: 1, ServerTokenSecretName: "source-token"},
+		},
+	}
+}
+
+func createTestCloneSnapshot() *rkev1.ETCDSnapshot {
+	return &rkev1.ETCDSnapshot{
+		ObjectMeta:   metav1.ObjectMeta{Namespace: "fleet-default", Name: "source-etcd-snapshot-1-s3"},
+		Spec:         rkev1.ETCDSnapshotSpec{ClusterName: "source"},
+		SnapshotFile: rkev1.ETCDSnapshotFile{Name: "etcd-snapshot-1", S3: &rkev1.ETCDSnapshotS3{Bucket: "bucket"}},
+	}
+}
+
+func TestIsEtcdSnapshotClone(t *testing.T) {
+	cp := createTestCloneControlPlane()
+	assert.False(t, isEtcdSnapshotClone(cp, nil))
+	assert.True(t, isEtcdSnapshotClone(cp, createTestCloneSnapshot()))
+
+	snapshot := createTestCloneSnapshot()
+	snapshot.Spec.ClusterName = "clone"
+	assert.False(t, isEtcdSnapshotClone(cp, snapshot))
+}
+
+// expectCloneCreator sets up the cluster of cp to be created by user, and the reviews of the access of user to secrets
+// to return allowed.
+func expectCloneCreator(mp *mockPlanner, cp *rkev1.RKEControlPlane, user string, allowed bool) {
+	mp.rancherClusterCache.EXPECT().Get(cp.Namespace, cp.Spec.ClusterName).Return(&apisv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   cp.Namespace,
+			Name:        cp.Spec.ClusterName,
+			Annotations: map[string]string{creatorIDAnnotation: user},
+		},
+	}, nil).AnyTimes()
+	mp.clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		review.Status.Allowed = allowed && review.Spec.User == user && review.Spec.ResourceAttributes.Resource == "secrets" &&
+			review.Spec.ResourceAttributes.Verb == "get"
+		return true, review, nil
+	})
+}
+
+func TestEtcdSnapshotCloneServerToken(t *testing.T) {
+	tests := []struct {
+		name            string
+		modify          func(cp *rkev1.RKEControlPlane)
+		snapshotCluster string
+		denied          bool
+		secret          *v1.Secret
+		expected        string
+		expectedErr     bool
+	}{
+		{
+			name:   "no restore",
+			modify: func(cp *rkev1.RKEControlPlane) { cp.Spec.ETCDSnapshotRestore = nil },
+		},
+		{
+			name:            "snapshot of the same cluster",
+			snapshotCluster: "clone",
+		},
+		{
+			name:            "state secret of the source cluster is not used by default",
+			snapshotCluster: "source",
+			modify: func(cp *rkev1.RKEControlPlane) {
+				cp.Spec.ETCDSnapshotRestore.ServerTokenSecretName = ""
+			},
+			expectedErr: true,
+		},
+		{
+			name:            "server token secret",
+			snapshotCluster: "source",
+			secret:          &v1.Secret{Data: map[string][]byte{"serverToken": []byte("saved")}},
+			expected:        "saved",
+		},
+		{
+			name:            "creator not allowed to get the server token secret",
+			snapshotCluster: "source",
+			denied:          true,
+			expectedErr:     true,
+		},
+		{
+			name:            "server token secret not found",
+			snapshotCluster: "source",
+			expectedErr:     true,
+		},
+		{
+			name:            "secret without server token",
+			snapshotCluster: "source",
+			secret:          &v1.Secret{Data: map[string][]byte{"agentToken": []byte("agent")}},
+			expectedErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mp := newMockPlanner(t, InfoFunctions{})
+			cp := createTestCloneControlPlane()
+			if tt.modify != nil {
+				tt.modify(cp)
+			}
+			snapshot := createTestCloneSnapshot()
+			snapshot.Spec.ClusterName = tt.snapshotCluster
+			mp.etcdSnapshotCache.EXPECT().Get(cp.Namespace, snapshot.Name).Return(snapshot, nil).AnyTimes()
+			expectCloneCreator(mp, cp, "u-creator", !tt.denied)
+			if tt.secret != nil {
+				mp.secretCache.EXPECT().Get(cp.Namespace, "source-token").Return(tt.secret, nil)
+			} else {
+				mp.secretCache.EXPECT().Get(cp.Namespace, "source-token").Return(nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "source-token")).AnyTimes()
+			}
+
+			token, err := mp.planner.etcdSnapshotCloneServerToken(cp)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, token)
+		})
+	}
+}
+
+func TestValidateEtcdSnapshotClone(t *testing.T) {
+	mp := newMockPlanner(t, InfoFunctions{})
+	cp := createTestCloneControlPlane()
+	snapshot := createTestCloneSnapshot()
+	mp.etcdSnapshotCache.EXPECT().Get(cp.Namespace, snapshot.Name).Return(snapshot, nil).AnyTimes()
+	expectCloneCreator(mp, cp, "u-creator", true)
+	mp.secretCache.EXPECT().Get(cp.Namespace, "source-token").Return(&v1.Secret{
+		Data: map[string][]byte{"serverToken": []byte("source-token")},
+	}, nil).AnyTimes()
+
+	assert.NoError(t, mp.planner.validateEtcdSnapshotClone(cp, snapshot, plan.Secret{ServerToken: "source-token", AgentToken: "new"}))
+	assert.Error(t, mp.planner.validateEtcdSnapshotClone(cp, snapshot, plan.Secret{ServerToken: "clone-token"}), "existing clusters can not restore snapshots of other clusters")
+
+	local := createTestCloneSnapshot()
+	local.SnapshotFile.S3 = nil
+	assert.Error(t, mp.planner.validateEtcdSnapshotClone(cp, local, plan.Secret{ServerToken: "source-token"}), "local snapshots are on the machines of the source cluster")
+}
+
+func TestEnsureRKEStateSecretClone(t *testing.T) {
+	mp := newMockPlanner(t, InfoFunctions{})
+	cp := createTestCloneControlPlane()
+	snapshot := createTestCloneSnapshot()
+	mp.etcdSnapshotCache.EXPECT().Get(cp.Namespace, snapshot.Name).Return(snapshot, nil)
+	expectCloneCreator(mp, cp, "u-creator", true)
+	mp.secretCache.EXPECT().Get(cp.Namespace, "clone-rke-state").Return(nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "clone-rke-state"))
+	mp.secretCache.EXPECT().Get(cp.Namespace, "source-token").Return(&v1.Secret{
+		Data: map[string][]byte{"serverToken": []byte("source-token"), "agentToken": []byte("source-agent")},
+	}, nil)
+	mp.secretClient.EXPECT().Create(gomock.Any()).DoAndReturn(func(secret *v1.Secret) (*v1.Secret, error) {
+		return secret, nil
+	})
+
+	_, tokens, err := mp.planner.ensureRKEStateSecret(cp, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "source-token", tokens.ServerToken)
+	assert.NotEmpty(t, tokens.AgentToken)
+	assert.NotEqual(t, "source-agent", tokens.AgentToken, "the agent token is regenerated")
+}
+
+func TestEnsureRKEStateSecretCloneDenied(t *testing.T) {
+	mp := newMockPlanner(t, InfoFunctions{})
+	cp := createTestCloneControlPlane()
+	cp.Spec.ETCDSnapshotRestore.ServerTokenSecretName = "source-rke-state"
+	snapshot := createTestCloneSnapshot()
+	mp.etcdSnapshotCache.EXPECT().Get(cp.Namespace, snapshot.Name).Return(snapshot, nil)
+	expectCloneCreator(mp, cp, "u-creator", false)
+	mp.secretCache.EXPECT().Get(cp.Namespace, "clone-rke-state").Return(nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "clone-rke-state"))
+
+	_, _, err := mp.planner.ensureRKEStateSecret(cp, true)
+	assert.Error(t, err, "the state secret of another cluster is not read for a creator without access to it")
+}
+
+func TestGenerateEtcdSnapshotCloneCleanupInstructions(t *testing.T) {
+	cp := createTestCloneControlPlane()
+	snapshot := createTestCloneSnapshot()
+	assert.Empty(t, generateEtcdSnapshotCloneCleanupInstructions(cp, nil))
+
+	instructions := generateEtcdSnapshotCloneCleanupInstructions(cp, snapshot)
+	if assert.Len(t, instructions, 2) {
+		assert.Contains(t, instructions[0].Args, "rke2-etcd-snapshots")
+		assert.Contains(t, instructions[1].Args, "app=cattle-cluster-agent")
+	}
+}
+
+func TestGenerateEtcdSnapshotCloneRotateInstructions(t *testing.T) {
+	cp := createTestCloneControlPlane()
+	cp.Status.ETCDSnapshotRestore = cp.Spec.ETCDSnapshotRestore
+
+	files, instruction := generateEtcdSnapshotCloneRotateCAFilesAndInstruction(cp, plan.Secret{ServerToken: "source-token"})
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, etcdSnapshotCloneRotateCAScriptPath, files[0].Path)
+		assert.Contains(t, instruction.Args, etcdSnapshotCloneRotateCAScriptPath)
+	}
+	assert.Subset(t, instruction.Env, []string{"RUNTIME=rke2", "DATA_DIR=/var/lib/rancher/rke2", "RKE2_TOKEN=source-token"})
+	assert.NotContains(t, strings.Join(instruction.Args, " "), "source-token")
+
+	instruction = generateEtcdSnapshotCloneRotateServerTokenInstruction(cp, "source-token", "clone-token")
+	assert.Subset(t, instruction.Args, []string{"rke2", "token", "rotate"})
+	assert.Subset(t, instruction.Env, []string{"RKE2_TOKEN=source-token", "RKE2_NEW_TOKEN=clone-token"})
+	assert.NotContains(t, strings.Join(instruction.Args, " "), "clone-token")
+	assert.NotEqual(t, instruction.Name, generateEtcdSnapshotCloneRotateServerTokenInstruction(cp, "source-token", "other-token").Name, "every new token is rotated to")
+}
+
+func TestEtcdSnapshotCloneRotateCAScript(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl is not installed")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "bin"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bin", "rke2"), []byte(`#!/bin/sh
+echo "$@" > "${FAKE_DIR}/args"
+cd "${6}" && find . -type f | sort > "${FAKE_DIR}/files"
+`), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rotate-ca.sh"), []byte(etcdSnapshotCloneRotateCAScript), 0600))
+
+	cmd := exec.Command("sh", "rotate-ca.sh")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"PATH="+filepath.Join(dir, "bin")+":"+os.Getenv("PATH"),
+		"FAKE_DIR="+dir,
+		"RUNTIME=rke2",
+		"DATA_DIR="+filepath.Join(dir, "data"),
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("certificate rotate-ca --data-dir %[1]s --path %[1]s/server/clone-rotate-ca --force\n", filepath.Join(dir, "data")), string(args))
+	files, err := os.ReadFile(filepath.Join(dir, "files"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"./client-ca.crt", "./client-ca.key",
+		"./etcd/peer-ca.crt", "./etcd/peer-ca.key",
+		"./etcd/server-ca.crt", "./etcd/server-ca.key",
+		"./request-header-ca.crt", "./request-header-ca.key",
+		"./server-ca.crt", "./server-ca.key",
+		"./service.key",
+	}, strings.Fields(string(files)))
+	assert.NoDirExists(t, filepath.Join(dir, "data", "server", "clone-rotate-ca"), "the new keys are removed once rotated to")
+}
+
+func TestRotateEtcdSnapshotCloneServerToken(t *testing.T) {
+	mp := newMockPlanner(t, InfoFunctions{})
+	cp := createTestCloneControlPlane()
+	initNode := createTestPlanEntry("linux")
+	initNode.Metadata.Labels[capr.InitNodeLabel] = "true"
+	clusterPlan := &plan.Plan{
+		Machines: map[string]*capi.Machine{"init": initNode.Machine},
+		Metadata: map[string]*plan.Metadata{"init": initNode.Metadata},
+		Nodes:    map[string]*plan.Node{},
+	}
+
+	mp.secretCache.EXPECT().Get(cp.Namespace, "clone-rke-state").Return(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: cp.Namespace, Name: "clone-rke-state"},
+		Data:       map[string][]byte{"serverToken": []byte("source-token"), "agentToken": []byte("agent-token")},
+	}, nil)
+	var updated *v1.Secret
+	mp.secretClient.EXPECT().Update(gomock.Any()).DoAndReturn(func(secret *v1.Secret) (*v1.Secret, error) {
+		updated = secret
+		return secret, nil
+	})
+
+	err := mp.planner.rotateEtcdSnapshotCloneServerToken(cp, plan.Secret{ServerToken: "source-token"}, clusterPlan)
+	assert.True(t, IsErrWaiting(err), "the new server token is recorded before it is rotated to")
+	if assert.NotNil(t, updated) {
+		assert.Equal(t, "source-token", string(updated.Data["serverToken"]))
+		assert.NotEmpty(t, updated.Data[cloneServerTokenKey])
+		assert.NotEqual(t, "source-token", string(updated.Data[cloneServerTokenKey]))
+	}
+}
@@ -0,0 +1,402 @@
+package planner
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"path"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+)
+
+// etcdSnapshotEncryptionScript uploads the local etcd snapshots that were not uploaded yet to S3, encrypting them if a
+// key file is set, or downloads and decrypts a snapshot. Uploaded snapshots are recorded in the state directory with the
+// key version they were encrypted with, so that a snapshot is uploaded once and keeps the key version it was encrypted
+// with when keys are rotated. Partial snapshots and snapshots modified within the last two minutes, which may still be
+// written, are left for the next run. If a retention is set, the snapshots in the bucket folder beyond the newest ones
+// it keeps, or not kept by the retention policy if POLICY is set, are deleted, whichever node uploaded them, and the
+// state of snapshots no longer in the bucket is dropped,
+// otherwise the state of snapshots removed locally is dropped. If LIST_BUCKET is set, the encrypted snapshots in the
+// bucket folder uploaded by other nodes are listed too.
+//
+// The key file holds the hex encoded key, from which an encryption and an authentication key are derived. A snapshot
+// is encrypted with AES-256-CBC, with a key derived from the encryption key with PBKDF2, and authenticated with
+// HMAC-SHA256 over the IV and the ciphertext. The encrypted object is the hex IV, the ciphertext and the hex HMAC, which
+// is verified before a snapshot is decrypted. The keys are only handled by shell builtins and passed to openssl in files
+// or on stdin, so that they never show in the process list.
+const etcdSnapshotEncryptionScript = `#!/bin/sh
+set -e
+umask 077
+
+url="${S3_ENDPOINT}/${S3_BUCKET}"
+if [ -n "${S3_FOLDER}" ]; then
+	url="${url}/${S3_FOLDER}"
+fi
+
+s3() {
+	set -- --fail --silent --show-error --aws-sigv4 "aws:amz:${S3_REGION}:s3" "$@"
+	if [ "${S3_SKIP_SSL_VERIFY}" = "true" ]; then
+		set -- --insecure "$@"
+	fi
+	if [ -n "${S3_ENDPOINT_CA}" ]; then
+		set -- --cacert "${S3_ENDPOINT_CA}" "$@"
+	fi
+	# the credentials are passed on stdin to keep them out of the process list
+	printf 'user = "%s:%s"\n' "${AWS_ACCESS_KEY_ID}" "${AWS_SECRET_ACCESS_KEY}" | curl --config - "$@"
+}
+
+# object returns the name of the object of a snapshot uploaded with the given key version, - if it is not encrypted
+object() {
+	if [ "$2" = "-" ]; then
+		echo "$1"
+	else
+		echo "$1.enc"
+	fi
+}
+
+# objects lists the objects in the bucket folder, excluding subfolders, as: last-modified name
+objects() {
+	prefix=""
+	if [ -n "${S3_FOLDER}" ]; then
+		prefix="${S3_FOLDER}/"
+	fi
+	token=""
+	while :; do
+		set -- --get --data-urlencode "list-type=2" --data-urlencode "prefix=${prefix}"
+		if [ -n "${token}" ]; then
+			set -- "$@" --data-urlencode "continuation-token=${token}"
+		fi
+		page=$(s3 "$@" "${S3_ENDPOINT}/${S3_BUCKET}")
+		echo "${page}" | grep -o '<Key>[^<]*</Key><LastModified>[^<]*</LastModified>' |
+			sed 's#<Key>\([^<]*\)</Key><LastModified>\([^<]*\)</LastModified>#\2 \1#' |
+			while read -r modified key; do
+				name="${key#"${prefix}"}"
+				case "${name}" in */*) continue ;; esac
+				echo "${modified} ${name}"
+			done
+		token=$(echo "${page}" | grep -o '<NextContinuationToken>[^<]*' | sed 's#<NextContinuationToken>##')
+		if [ -z "${token}" ]; then
+			break
+		fi
+	done
+}
+
+` + etcdSnapshotRetainFunction + `
+# pad prints the 64 byte HMAC block of the hex key $1 xored with $2
+pad() {
+	hex="$1"
+	i=0
+	while [ "${i}" -lt 64 ]; do
+		byte=0
+		if [ -n "${hex}" ]; then
+			byte=$((0x${hex%"${hex#??}"}))
+			hex="${hex#??}"
+		fi
+		printf "\\$(printf '%o' $((byte ^ $2)))"
+		i=$((i + 1))
+	done
+}
+
+# unhex prints the bytes of the hex string $1
+unhex() {
+	hex="$1"
+	while [ -n "${hex}" ]; do
+		printf "\\$(printf '%o' $((0x${hex%"${hex#??}"})))"
+		hex="${hex#??}"
+	done
+}
+
+# hmac prints the hex HMAC-SHA256 of stdin with the hex key in the file $1
+hmac() {
+	key=$(cat "$1")
+	if [ "${#key}" -gt 128 ]; then
+		key=$(unhex "${key}" | openssl dgst -sha256 | sed 's/^.*= //')
+	fi
+	pad "${key}" 54 > "${key_dir}/ipad"
+	pad "${key}" 92 > "${key_dir}/opad"
+	cat "${key_dir}/ipad" - | openssl dgst -sha256 -binary > "${key_dir}/inner"
+	cat "${key_dir}/opad" "${key_dir}/inner" | openssl dgst -sha256 | sed 's/^.*= //'
+}
+
+# keys derives the encryption and authentication keys from the hex key in KEY_FILE into files in key_dir
+keys() {
+	if [ -n "${key_dir}" ]; then
+		return
+	fi
+	key_dir=$(mktemp -d)
+	trap 'rm -rf "${key_dir}"' EXIT
+	printf 'encryption' | hmac "${KEY_FILE}" > "${key_dir}/encryption"
+	printf 'authentication' | hmac "${KEY_FILE}" > "${key_dir}/authentication"
+}
+
+# encrypt encrypts the file $1 into $2
+encrypt() {
+	keys
+	iv=$(openssl rand -hex 16)
+	printf '%s' "${iv}" > "$2"
+	openssl enc -aes-256-cbc -pbkdf2 -nosalt -pass "file:${key_dir}/encryption" -iv "${iv}" -in "$1" >> "$2"
+	mac=$(hmac "${key_dir}/authentication" < "$2")
+	printf '%s' "${mac}" >> "$2"
+}
+
+# decrypt verifies and decrypts the file $1 into $2
+decrypt() {
+	keys
+	size=$(wc -c < "$1")
+	head -c $((size - 64)) "$1" > "$1.body"
+	if [ "$(hmac "${key_dir}/authentication" < "$1.body")" != "$(tail -c 64 "$1")" ]; then
+		rm -f "$1.body"
+		echo "authentication of $1 failed" >&2
+		exit 1
+	fi
+	iv=$(head -c 32 "$1.body")
+	tail -c +33 "$1.body" | openssl enc -d -aes-256-cbc -pbkdf2 -nosalt -pass "file:${key_dir}/encryption" -iv "${iv}" -out "$2"
+	rm -f "$1.body"
+}
+
+case "$1" in
+upload)
+	mkdir -p "${STATE_DIR}"
+	# encrypted snapshots left by an interrupted run
+	rm -f "${STATE_DIR}"/*.enc
+	version="-"
+	if [ -n "${KEY_FILE}" ]; then
+		version="${KEY_VERSION}"
+	fi
+	for snapshot in "${SNAPSHOT_DIR}"/*; do
+		name=$(basename "${snapshot}")
+		case "${name}" in *.enc|*.part|*.tmp) continue ;; esac
+		if [ ! -f "${snapshot}" ] || [ -f "${STATE_DIR}/${name}" ] || [ -n "$(find "${snapshot}" -mmin -2)" ]; then
+			continue
+		fi
+		upload="${snapshot}"
+		if [ -n "${KEY_FILE}" ]; then
+			upload="${STATE_DIR}/${name}.enc"
+			encrypt "${snapshot}" "${upload}"
+		fi
+		s3 --upload-file "${upload}" "${url}/$(object "${name}" "${version}")"
+		echo "${version} $(wc -c < "${upload}") $(date -u -r "${snapshot}" +%Y-%m-%dT%H:%M:%SZ)" > "${STATE_DIR}/${name}"
+		rm -f "${STATE_DIR}/${name}.enc"
+	done
+	# the bucket is listed as the state only has the snapshots of this node, not those of replaced nodes
+	if [ "${POLICY}" = "true" ]; then
+		objects | while read -r modified name; do
+			echo "$(date -u -d "${modified}" +%s) ${name}"
+		done | sort -rn | retain | while read -r name tiers; do
+			if [ "${tiers}" = "-" ]; then
+				s3 --request DELETE "${url}/${name}"
+				rm -f "${STATE_DIR}/${name%.enc}"
+			fi
+		done
+	elif [ "${RETENTION:-0}" -gt 0 ]; then
+		objects | sort -r | tail -n +$((RETENTION + 1)) | while read -r modified name; do
+			s3 --request DELETE "${url}/${name}"
+			rm -f "${STATE_DIR}/${name%.enc}"
+		done
+	fi
+	if [ "${RETENTION:-0}" -gt 0 ] || [ "${POLICY}" = "true" ] || [ "${LIST_BUCKET}" = "true" ]; then
+		# the state of the snapshots deleted from the bucket, e.g. by the retention of another node, is dropped
+		listing=$(objects)
+		for state in "${STATE_DIR}"/*; do
+			name=$(basename "${state}")
+			case "${name}" in *.enc) continue ;; esac
+			if [ ! -f "${state}" ]; then
+				continue
+			fi
+			uploaded=$(object "${name}" "$(cut -d ' ' -f 1 "${state}")")
+			if ! echo "${listing}" | awk -v uploaded="${uploaded}" '$2 == uploaded { found = 1 } END { exit !found }'; then
+				rm -f "${state}"
+			fi
+		done
+	else
+		for state in "${STATE_DIR}"/*; do
+			name=$(basename "${state}")
+			if [ -f "${state}" ] && [ ! -e "${SNAPSHOT_DIR}/${name}" ]; then
+				rm -f "${state}"
+			fi
+		done
+	fi
+	for state in "${STATE_DIR}"/*; do
+		name=$(basename "${state}")
+		case "${name}" in *.enc) continue ;; esac
+		if [ -f "${state}" ]; then
+			echo "${name} $(cat "${state}")"
+		fi
+	done
+	if [ "${LIST_BUCKET}" = "true" ]; then
+		echo "${listing}" | while read -r modified name; do
+			case "${name}" in *.enc) ;; *) continue ;; esac
+			if [ ! -f "${STATE_DIR}/${name%.enc}" ]; then
+				echo "${name%.enc} ? 0 ${modified}"
+			fi
+		done
+	fi
+	;;
+download)
+	mkdir -p "${SNAPSHOT_DIR}"
+	if [ -z "${KEY_FILE}" ]; then
+		s3 --output "${SNAPSHOT_DIR}/$2" "${url}/$2"
+		exit 0
+	fi
+	s3 --output "${SNAPSHOT_DIR}/$2.enc" "${url}/$2.enc"
+	decrypt "${SNAPSHOT_DIR}/$2.enc" "${SNAPSHOT_DIR}/$2"
+	rm -f "${SNAPSHOT_DIR}/$2.enc"
+	;;
+*)
+	echo "usage: $0 upload|download <snapshot>" >&2
+	exit 1
+	;;
+esac
+`
+
+const (
+	// ETCDSnapshotUploadEncryptedInstructionName is the name of the periodic instruction that encrypts and uploads etcd
+	// snapshots. Its output lists the uploaded snapshots, one per line, as: name key-version size created. It is followed
+	// by the encrypted snapshots in the bucket uploaded by other nodes, whose key version and size are ? and 0.
+	ETCDSnapshotUploadEncryptedInstructionName = "etcd-snapshot-upload-encrypted"
+
+	etcdSnapshotEncryptionDir        = "/var/lib/rancher/capr/etcd-snapshot-encryption"
+	etcdSnapshotEncryptionScriptPath = etcdSnapshotEncryptionDir + "/snapshot.sh"
+	etcdSnapshotEncryptionStateDir   = etcdSnapshotEncryptionDir + "/uploaded"
+	etcdSnapshotEncryptionKeyDir     = etcdSnapshotEncryptionDir + "/keys"
+
+	defaultS3Endpoint = "s3.amazonaws.com"
+	defaultS3Region   = "us-east-1"
+)
+
+var etcdSnapshotEncryptionScriptFile = plan.File{
+	Content: base64.StdEncoding.EncodeToString([]byte(etcdSnapshotEncryptionScript)),
+	Path:    etcdSnapshotEncryptionScriptPath,
+	Dynamic: true,
+	Minor:   true,
+}
+
+// S3EncryptionEnabled returns a boolean indicating whether snapshots stored in S3 are encrypted for the passed in
+// ETCDSnapshotS3 struct.
+func S3EncryptionEnabled(s3 *rkev1.ETCDSnapshotS3) bool {
+	return S3Enabled(s3) && s3.Encryption != nil && s3.Encryption.KeySecretName != ""
+}
+
+// ToEnv renders the environment variables and files used by the etcd snapshot encryption script to access S3.
+func (s *s3Args) ToEnv(s3 *rkev1.ETCDSnapshotS3, controlPlane *rkev1.RKEControlPlane) (env []string, files []plan.File, err error) {
+	credName := s3.CloudCredentialName
+	if credName == "" && controlPlane.Spec.ETCD != nil && controlPlane.Spec.ETCD.S3 != nil {
+		credName = controlPlane.Spec.ETCD.S3.CloudCredentialName
+	}
+
+	s3Cred, err := getS3Credential(s.secretCache, controlPlane.Namespace, credName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env = []string{
+		fmt.Sprintf("S3_ENDPOINT=https://%s", first(first(s3.Endpoint, s3Cred.Endpoint), defaultS3Endpoint)),
+		fmt.Sprintf("S3_BUCKET=%s", first(s3.Bucket, s3Cred.Bucket)),
+		fmt.Sprintf("S3_FOLDER=%s", first(s3.Folder, s3Cred.Folder)),
+		fmt.Sprintf("S3_REGION=%s", first(first(s3.Region, s3Cred.Region), defaultS3Region)),
+		fmt.Sprintf("S3_SKIP_SSL_VERIFY=%t", s3.SkipSSLVerify || s3Cred.SkipSSLVerify),
+		fmt.Sprintf("AWS_ACCESS_KEY_ID=%s", s3Cred.AccessKey),
+		fmt.Sprintf("AWS_SECRET_ACCESS_KEY=%s", s3Cred.SecretKey),
+	}
+	if v := first(s3.EndpointCA, s3Cred.EndpointCA); v != "" {
+		caFile := endpointCAFile(controlPlane, v)
+		files = append(files, caFile)
+		env = append(env, fmt.Sprintf("S3_ENDPOINT_CA=%s", caFile.Path))
+	}
+	return env, files, nil
+}
+
+// encryptionKeyFile renders the file holding the etcd snapshot encryption key of the given version. The key is hex
+// encoded, as it is passed to openssl as a hex key and may hold any bytes, including newlines.
+func (s *s3Args) encryptionKeyFile(controlPlane *rkev1.RKEControlPlane, encryption *rkev1.ETCDSnapshotEncryption) (plan.File, error) {
+	if encryption.KeyVersion == "" {
+		return plan.File{}, fmt.Errorf("etcd snapshot encryption key version is not set")
+	}
+	secret, err := s.secretCache.Get(controlPlane.Namespace, encryption.KeySecretName)
+	if err != nil {
+		return plan.File{}, fmt.Errorf("failed to lookup etcd snapshot encryption key secret %s/%s: %w", controlPlane.Namespace, encryption.KeySecretName, err)
+	}
+	key := secret.Data[encryption.KeyVersion]
+	if len(key) == 0 {
+		return plan.File{}, fmt.Errorf("etcd snapshot encryption key secret %s/%s does not have key version %s", controlPlane.Namespace, encryption.KeySecretName, encryption.KeyVersion)
+	}
+	return plan.File{
+		Content:     base64.StdEncoding.EncodeToString([]byte(hex.EncodeToString(key))),
+		Path:        path.Join(etcdSnapshotEncryptionKeyDir, encryption.KeySecretName, encryption.KeyVersion),
+		Permissions: "0600",
+		Minor:       true,
+	}, nil
+}
+
+// etcdSnapshotUploadEnv renders the environment variables and files shared by the upload and download of etcd
+// snapshots by the system-agent, the key file is only rendered if the snapshots are encrypted.
+func (s *s3Args) etcdSnapshotUploadEnv(controlPlane *rkev1.RKEControlPlane, s3 *rkev1.ETCDSnapshotS3, stateDir string) ([]string, []plan.File, error) {
+	env, files, err := s.ToEnv(s3, controlPlane)
+	if err != nil {
+		return nil, nil, err
+	}
+	env = append(env,
+		fmt.Sprintf("SNAPSHOT_DIR=/var/lib/rancher/%s/server/db/snapshots", capr.GetRuntime(controlPlane.Spec.KubernetesVersion)),
+		fmt.Sprintf("STATE_DIR=%s", stateDir),
+	)
+	if S3EncryptionEnabled(s3) {
+		keyFile, err := s.encryptionKeyFile(controlPlane, s3.Encryption)
+		if err != nil {
+			return nil, nil, err
+		}
+		env = append(env,
+			fmt.Sprintf("KEY_VERSION=%s", s3.Encryption.KeyVersion),
+			fmt.Sprintf("KEY_FILE=%s", keyFile.Path),
+		)
+		files = append(files, keyFile)
+	}
+	return env, append(files, etcdSnapshotEncryptionScriptFile), nil
+}
+
+// addEtcdSnapshotUploadEncryptedPeriodicInstruction adds the periodic instruction that encrypts the etcd snapshots of
+// the node and uploads them to S3, and deletes the snapshots in S3 beyond the snapshot retention or not kept by the
+// retention policy of the cluster. When
+// snapshots are encrypted, the distribution is not configured with S3 and keeps its snapshots local.
+func (p *Planner) addEtcdSnapshotUploadEncryptedPeriodicInstruction(nodePlan plan.NodePlan, controlPlane *rkev1.RKEControlPlane) (plan.NodePlan, error) {
+	env, files, err := p.etcdS3Args.etcdSnapshotUploadEnv(controlPlane, controlPlane.Spec.ETCD.S3, etcdSnapshotEncryptionStateDir)
+	if err != nil {
+		return nodePlan, err
+	}
+	retentionEnv, err := etcdSnapshotS3RetentionEnv(controlPlane, 0)
+	if err != nil {
+		return nodePlan, err
+	}
+	nodePlan.Files = append(nodePlan.Files, files...)
+	nodePlan.PeriodicInstructions = append(nodePlan.PeriodicInstructions, plan.PeriodicInstruction{
+		Name:          ETCDSnapshotUploadEncryptedInstructionName,
+		Command:       "sh",
+		Args:          []string{etcdSnapshotEncryptionScriptPath, "upload"},
+		Env:           append(append(env, retentionEnv...), "LIST_BUCKET=true"),
+		PeriodSeconds: 300,
+	})
+	return nodePlan, nil
+}
+
+// generateEtcdSnapshotDecryptInstruction returns the files and the instruction that download an encrypted etcd
+// snapshot from S3 and decrypt it into the local snapshot directory, using the key version the snapshot was encrypted
+// with.
+func (p *Planner) generateEtcdSnapshotDecryptInstruction(controlPlane *rkev1.RKEControlPlane, snapshot *rkev1.ETCDSnapshot) ([]plan.File, plan.OneTimeInstruction, error) {
+	return p.generateEtcdSnapshotDownloadInstruction(controlPlane, snapshot.SnapshotFile.S3, snapshot.SnapshotFile.Name)
+}
+
+// generateEtcdSnapshotDownloadInstruction returns the files and the instruction that download the etcd snapshot with the
+// given name from S3 into the local snapshot directory, decrypting it if s3 is encrypted.
+func (p *Planner) generateEtcdSnapshotDownloadInstruction(controlPlane *rkev1.RKEControlPlane, s3 *rkev1.ETCDSnapshotS3, snapshotName string) ([]plan.File, plan.OneTimeInstruction, error) {
+	env, files, err := p.etcdS3Args.etcdSnapshotUploadEnv(controlPlane, s3, etcdSnapshotEncryptionStateDir)
+	if err != nil {
+		return nil, plan.OneTimeInstruction{}, err
+	}
+	return files, plan.OneTimeInstruction{
+		Name:    "download-etcd-snapshot",
+		Command: "sh",
+		Args:    []string{etcdSnapshotEncryptionScriptPath, "download", snapshotName},
+		Env:     env,
+	}, nil
+}
@@ -0,0 +1,220 @@
+package planner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestS3EncryptionEnabled(t *testing.T) {
+	assert.False(t, S3EncryptionEnabled(nil))
+	assert.False(t, S3EncryptionEnabled(&rkev1.ETCDSnapshotS3{Bucket: "bucket"}))
+	assert.False(t, S3EncryptionEnabled(&rkev1.ETCDSnapshotS3{Encryption: &rkev1.ETCDSnapshotEncryption{KeySecretName: "keys"}}), "S3 must be enabled")
+	assert.True(t, S3EncryptionEnabled(&rkev1.ETCDSnapshotS3{Bucket: "bucket", Encryption: &rkev1.ETCDSnapshotEncryption{KeySecretName: "keys"}}))
+}
+
+func TestAddEtcdSnapshotUploadEncryptedPeriodicInstruction(t *testing.T) {
+	mp := newMockPlanner(t, InfoFunctions{})
+	cp := &rkev1.RKEControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fleet-default", Name: "test"},
+		Spec: rkev1.RKEControlPlaneSpec{
+			KubernetesVersion: "v1.27.5+rke2r1",
+			RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
+				ETCD: &rkev1.ETCD{
+					S3: &rkev1.ETCDSnapshotS3{
+						Bucket:              "bucket",
+						Folder:              "snapshots",
+						CloudCredentialName: "cattle-global-data:cc-s3",
+						Encryption: &rkev1.ETCDSnapshotEncryption{
+							KeySecretName: "snapshot-keys",
+							KeyVersion:    "v2",
+						},
+					},
+				},
+			},
+		},
+	}
+	mp.secretCache.EXPECT().Get("fleet-default", "snapshot-keys").Return(&v1.Secret{
+		Data: map[string][]byte{"v1": []byte("old"), "v2": []byte("new")},
+	}, nil).AnyTimes()
+	mp.secretCache.EXPECT().Get("cattle-global-data", "cc-s3").Return(&v1.Secret{
+		Data: map[string][]byte{
+			"s3credentialConfig-accessKey": []byte("access"),
+			"s3credentialConfig-secretKey": []byte("secret"),
+		},
+	}, nil).AnyTimes()
+
+	nodePlan, err := mp.planner.addEtcdSnapshotUploadEncryptedPeriodicInstruction(plan.NodePlan{}, cp)
+	assert.NoError(t, err)
+	if assert.Len(t, nodePlan.PeriodicInstructions, 1) {
+		instruction := nodePlan.PeriodicInstructions[0]
+		assert.Equal(t, ETCDSnapshotUploadEncryptedInstructionName, instruction.Name)
+		assert.Equal(t, []string{etcdSnapshotEncryptionScriptPath, "upload"}, instruction.Args)
+		assert.Contains(t, instruction.Env, "S3_ENDPOINT=https://s3.amazonaws.com")
+		assert.Contains(t, instruction.Env, "S3_BUCKET=bucket")
+		assert.Contains(t, instruction.Env, "S3_FOLDER=snapshots")
+		assert.Contains(t, instruction.Env, "AWS_SECRET_ACCESS_KEY=secret")
+		assert.Contains(t, instruction.Env, "KEY_VERSION=v2")
+		assert.Contains(t, instruction.Env, "SNAPSHOT_DIR=/var/lib/rancher/rke2/server/db/snapshots")
+		assert.Contains(t, instruction.Env, "RETENTION=5", "the encrypted snapshots are pruned with the default retention")
+		assert.Contains(t, instruction.Env, "LIST_BUCKET=true")
+	}
+
+	cp.Spec.ETCD.SnapshotRetentionPolicy = &rkev1.ETCDSnapshotRetentionPolicy{Weekly: 4}
+	policyPlan, err := mp.planner.addEtcdSnapshotUploadEncryptedPeriodicInstruction(plan.NodePlan{}, cp)
+	assert.NoError(t, err)
+	if assert.Len(t, policyPlan.PeriodicInstructions, 1) {
+		assert.Subset(t, policyPlan.PeriodicInstructions[0].Env, []string{"POLICY=true", "WEEKLY=4", "LIST_BUCKET=true"}, "the encrypted snapshots are pruned with the retention policy")
+	}
+	cp.Spec.ETCD.SnapshotRetentionPolicy = nil
+
+	var keyFound bool
+	for _, file := range nodePlan.Files {
+		if file.Path == etcdSnapshotEncryptionKeyDir+"/snapshot-keys/v2" {
+			keyFound = true
+			assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("6e6577")), file.Content, "the key is hex encoded")
+			assert.Equal(t, "0600", file.Permissions)
+		}
+	}
+	assert.True(t, keyFound, "the key of the active version is delivered")
+
+	cp.Spec.ETCD.S3.Encryption.KeyVersion = "v3"
+	_, err = mp.planner.addEtcdSnapshotUploadEncryptedPeriodicInstruction(plan.NodePlan{}, cp)
+	assert.Error(t, err, "the key version must exist in the secret")
+}
+
+func TestGenerateEtcdSnapshotDecryptInstruction(t *testing.T) {
+	mp := newMockPlanner(t, InfoFunctions{})
+	cp := &rkev1.RKEControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fleet-default", Name: "test"},
+		Spec:       rkev1.RKEControlPlaneSpec{KubernetesVersion: "v1.27.5+k3s1"},
+	}
+	snapshot := &rkev1.ETCDSnapshot{
+		SnapshotFile: rkev1.ETCDSnapshotFile{
+			Name: "etcd-snapshot-1",
+			S3: &rkev1.ETCDSnapshotS3{
+				Bucket:   "bucket",
+				Endpoint: "minio.example.com",
+				Encryption: &rkev1.ETCDSnapshotEncryption{
+					KeySecretName: "snapshot-keys",
+					KeyVersion:    "v1",
+				},
+			},
+		},
+	}
+
+	mp.secretCache.EXPECT().Get("fleet-default", "snapshot-keys").Return(nil, apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "snapshot-keys"))
+	_, _, err := mp.planner.generateEtcdSnapshotDecryptInstruction(cp, snapshot)
+	assert.Error(t, err)
+
+	mp.secretCache.EXPECT().Get("fleet-default", "snapshot-keys").Return(&v1.Secret{
+		Data: map[string][]byte{"v1": []byte("old"), "v2": []byte("new")},
+	}, nil)
+	files, instruction, err := mp.planner.generateEtcdSnapshotDecryptInstruction(cp, snapshot)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{etcdSnapshotEncryptionScriptPath, "download", "etcd-snapshot-1"}, instruction.Args)
+	assert.Contains(t, instruction.Env, "S3_ENDPOINT=https://minio.example.com")
+	assert.Contains(t, instruction.Env, "KEY_VERSION=v1", "snapshots are decrypted with the key version they were encrypted with")
+	assert.Contains(t, instruction.Env, "SNAPSHOT_DIR=/var/lib/rancher/k3s/server/db/snapshots")
+	assert.Len(t, files, 2)
+}
+
+func TestEtcdSnapshotEncryptionScript(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl is not installed")
+	}
+	dir := t.TempDir()
+	// the functions of the script, without running it
+	functions := etcdSnapshotEncryptionScript[:strings.Index(etcdSnapshotEncryptionScript, `case "$1" in`)]
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "functions.sh"), []byte(functions), 0600))
+	// a key with a newline, which must not truncate it
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "key"), []byte(hex.EncodeToString([]byte("key\nwith newline"))), 0600))
+	snapshot := bytes.Repeat([]byte("etcd snapshot data\n"), 1000)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "snapshot"), snapshot, 0600))
+
+	run := func(script string) ([]byte, error) {
+		cmd := exec.Command("sh", "-c", ". ./functions.sh; "+script)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "KEY_FILE=key")
+		return cmd.CombinedOutput()
+	}
+
+	// the HMAC computed by the shell is the HMAC-SHA256 of openssl, including for keys longer than the block size
+	for _, key := range []string{hex.EncodeToString([]byte("key\nwith newline")), strings.Repeat("ab", 100)} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "mac-key"), []byte(key), 0600))
+		out, err := run("key_dir=. && printf message | hmac mac-key")
+		require.NoError(t, err, string(out))
+		expected, err := exec.Command("sh", "-c", "printf message | openssl dgst -sha256 -mac HMAC -macopt hexkey:"+key+" | sed 's/^.*= //'").Output()
+		require.NoError(t, err)
+		assert.Equal(t, string(expected), string(out))
+	}
+
+	out, err := run("encrypt snapshot snapshot.enc && decrypt snapshot.enc decrypted")
+	require.NoError(t, err, string(out))
+	decrypted, err := os.ReadFile(filepath.Join(dir, "decrypted"))
+	require.NoError(t, err)
+	assert.Equal(t, snapshot, decrypted)
+
+	encrypted, err := os.ReadFile(filepath.Join(dir, "snapshot.enc"))
+	require.NoError(t, err)
+	encrypted[100] ^= 1
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tampered.enc"), encrypted, 0600))
+	out, err = run("decrypt tampered.enc tampered")
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "authentication of tampered.enc failed")
+	assert.NoFileExists(t, filepath.Join(dir, "tampered"))
+}
+
+func TestEtcdSnapshotEncryptionScriptListBucket(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"bin", "snapshots", "state"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, d), 0700))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bin", "curl"), []byte(fakeCurl), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "snapshot.sh"), []byte(etcdSnapshotEncryptionScript), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "page1.xml"), []byte(`<ListBucketResult>`+
+		`<Contents><Key>cluster/etcd-snapshot-a-100.enc</Key><LastModified>2023-09-01T10:00:00.000Z</LastModified></Contents>`+
+		`<Contents><Key>cluster/etcd-snapshot-b-200.enc</Key><LastModified>2023-09-01T11:00:00.000Z</LastModified></Contents>`+
+		`<Contents><Key>cluster/etcd-snapshot-b-150</Key><LastModified>2023-09-01T10:30:00.000Z</LastModified></Contents>`+
+		`</ListBucketResult>`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "state", "etcd-snapshot-a-100"), []byte("v1 10 2023-09-01T10:00:00Z"), 0600))
+	// the snapshot was deleted from the bucket by the retention of another node
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "state", "etcd-snapshot-a-50"), []byte("v1 10 2023-09-01T09:00:00Z"), 0600))
+
+	cmd := exec.Command("sh", "snapshot.sh", "upload")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"PATH="+filepath.Join(dir, "bin")+":"+os.Getenv("PATH"),
+		"FAKE_DIR="+dir,
+		"S3_ENDPOINT=https://s3.example.com",
+		"S3_BUCKET=bucket",
+		"S3_FOLDER=cluster",
+		"SNAPSHOT_DIR="+filepath.Join(dir, "snapshots"),
+		"STATE_DIR="+filepath.Join(dir, "state"),
+		"RETENTION=5",
+		"LIST_BUCKET=true",
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	assert.Equal(t, []string{
+		"etcd-snapshot-a-100 v1 10 2023-09-01T10:00:00Z",
+		"etcd-snapshot-b-200 ? 0 2023-09-01T11:00:00.000Z",
+	}, strings.Split(strings.TrimSpace(string(out)), "\n"), "the encrypted snapshots of other nodes are listed")
+	assert.NoFileExists(t, filepath.Join(dir, "state", "etcd-snapshot-a-50"))
+	assert.NoFileExists(t, filepath.Join(dir, "requests"))
+}
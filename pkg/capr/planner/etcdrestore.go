@@ -222,7 +222,7 @@ func (p *Planner) runEtcdSnapshotRestorePlan(controlPlane *rkev1.RKEControlPlane
 	return assignAndCheckPlan(p.store, ETCDRestoreMessage, servers[0], restorePlan, joinedServer, 1, 1)
 }
 
-func (p *Planner) runEtcdSnapshotPostRestorePodCleanupPlan(controlPlane *rkev1.RKEControlPlane, tokensSecret plan.Secret, clusterPlan *plan.Plan) error {
+func (p *Planner) runEtcdSnapshotPostRestorePodCleanupPlan(controlPlane *rkev1.RKEControlPlane, snapshot *rkev1.ETCDSnapshot, tokensSecret plan.Secret, clusterPlan *plan.Plan) error {
 	initNodes := collect(clusterPlan, isInitNode)
 	if len(initNodes) != 1 {
 		return fmt.Errorf("multiple init nodes found")
@@ -239,6 +239,7 @@ func (p *Planner) runEtcdSnapshotPostRestorePodCleanupPlan(controlPlane *rkev1.R
 		cleanupScriptFiles, cleanupInstructions := p.generateEtcdRestorePodCleanupFilesAndInstruction(controlPlane, []string{string(initNode.Machine.UID)})
 		initNodePlan.Files = append(initNodePlan.Files, cleanupScriptFiles...)
 		initNodePlan.Instructions = append(initNodePlan.Instructions, cleanupInstructions...)
+		initNodePlan.Instructions = append(initNodePlan.Instructions, generateEtcdSnapshotCloneCleanupInstructions(controlPlane, snapshot)...)
 		return assignAndCheckPlan(p.store, ETCDRestoreMessage, initNode, initNodePlan, "", 5, 5)
 	}
 
@@ -269,6 +270,7 @@ func (p *Planner) runEtcdSnapshotPostRestorePodCleanupPlan(controlPlane *rkev1.R
 	cleanupScriptFiles, cleanupInstructions := p.generateEtcdRestorePodCleanupFilesAndInstruction(controlPlane, []string{string(initNode.Machine.UID), string(controlPlaneEntry.Machine.UID)})
 	firstControlPlanePlan.Files = append(firstControlPlanePlan.Files, cleanupScriptFiles...)
 	firstControlPlanePlan.Instructions = append(firstControlPlanePlan.Instructions, cleanupInstructions...)
+	firstControlPlanePlan.Instructions = append(firstControlPlanePlan.Instructions, generateEtcdSnapshotCloneCleanupInstructions(controlPlane, snapshot)...)
 	return assignAndCheckPlan(p.store, ETCDRestoreMessage, controlPlaneEntry, firstControlPlanePlan, joinedServer, 5, 5)
 }
 
@@ -319,13 +321,35 @@ func (p *Planner) generateEtcdSnapshotRestorePlan(controlPlane *rkev1.RKEControl
 		"--etcd-disable-snapshots=false",                          // this is a workaround for https://github.com/k3s-io/k3s/issues/8031
 	}
 
-	var env []string
+	var (
+		env      []string
+		download []plan.OneTimeInstruction
+	)
 
-	if snapshot == nil {
+	if target := controlPlane.Spec.ETCDSnapshotRestore.S3Target; target != "" {
+		// Snapshots in S3 targets are downloaded into the local snapshot directory, then restored like local snapshots.
+		files, instruction, err := p.generateEtcdSnapshotS3TargetDownloadInstruction(controlPlane, snapshot, target)
+		if err != nil {
+			return plan.NodePlan{}, "", err
+		}
+		nodePlan.Files = append(nodePlan.Files, files...)
+		download = append(download, convertToIdempotentInstruction("etcd-restore/download-snapshot", fmt.Sprintf("%v", controlPlane.Status.ETCDSnapshotRestore), instruction))
+		args = append(args, fmt.Sprintf("--cluster-reset-restore-path=db/snapshots/%s", snapshot.SnapshotFile.Name), "--etcd-s3=false")
+	} else if snapshot == nil {
 		// If the snapshot is nil, then we will assume the passed in snapshot name is a local snapshot.
 		args = append(args, fmt.Sprintf("--cluster-reset-restore-path=db/snapshots/%s", snapshotName), "--etcd-s3=false")
 	} else if snapshot.SnapshotFile.S3 == nil {
 		args = append(args, fmt.Sprintf("--cluster-reset-restore-path=db/snapshots/%s", snapshot.SnapshotFile.Name), "--etcd-s3=false")
+	} else if S3EncryptionEnabled(snapshot.SnapshotFile.S3) {
+		// Encrypted snapshots are downloaded and decrypted into the local snapshot directory, then restored like local
+		// snapshots.
+		files, instruction, err := p.generateEtcdSnapshotDecryptInstruction(controlPlane, snapshot)
+		if err != nil {
+			return plan.NodePlan{}, "", err
+		}
+		nodePlan.Files = append(nodePlan.Files, files...)
+		download = append(download, convertToIdempotentInstruction("etcd-restore/download-snapshot", fmt.Sprintf("%v", controlPlane.Status.ETCDSnapshotRestore), instruction))
+		args = append(args, fmt.Sprintf("--cluster-reset-restore-path=db/snapshots/%s", snapshot.SnapshotFile.Name), "--etcd-s3=false")
 	} else {
 		args = append(args, fmt.Sprintf("--cluster-reset-restore-path=%s", snapshot.SnapshotFile.Name))
 		s3, s3Env, s3Files, err := p.etcdS3Args.ToArgs(snapshot.SnapshotFile.S3, controlPlane, "etcd-", true)
@@ -356,7 +380,9 @@ func (p *Planner) generateEtcdSnapshotRestorePlan(controlPlane *rkev1.RKEControl
 			Args: []string{
 				"-rf",
 				fmt.Sprintf("/var/lib/rancher/%s/server/db/etcd", capr.GetRuntimeCommand(controlPlane.Spec.KubernetesVersion)),
-			}}),
+			}}))
+	nodePlan.Instructions = append(nodePlan.Instructions, download...)
+	nodePlan.Instructions = append(nodePlan.Instructions,
 		idempotentInstruction("etcd-restore/restore", fmt.Sprintf("%v", controlPlane.Status.ETCDSnapshotRestore), capr.GetRuntimeCommand(controlPlane.Spec.KubernetesVersion), args, env),
 	)
 
@@ -593,7 +619,7 @@ func generateRemoveTLSAndCredDirInstructions(controlPlane *rkev1.RKEControlPlane
 // runEtcdRestoreInitNodeElection runs an election for an init node. Notably, it accepts a nil snapshot, and will
 func (p *Planner) runEtcdRestoreInitNodeElection(controlPlane *rkev1.RKEControlPlane, snapshot *rkev1.ETCDSnapshot, clusterPlan *plan.Plan) (string, error) {
 	if snapshot != nil { // If the snapshot CR is not nil, then find an init node.
-		if snapshot.SnapshotFile.S3 == nil {
+		if snapshot.SnapshotFile.S3 == nil && (controlPlane.Spec.ETCDSnapshotRestore == nil || controlPlane.Spec.ETCDSnapshotRestore.S3Target == "") {
 			// If the snapshot is not an S3 snapshot, then designate the init node by machine ID defined.
 			if id, ok := snapshot.Labels[capr.MachineIDLabel]; ok {
 				logrus.Infof("[planner] rkecluster %s/%s: designating init node with machine ID: %s for local snapshot %s/%s restoration", controlPlane.Namespace, controlPlane.Name, id, snapshot.Namespace, snapshot.Name)
@@ -769,6 +795,16 @@ func (p *Planner) restoreEtcdSnapshot(cp *rkev1.RKEControlPlane, status rkev1.RK
 		return status, err
 	}
 
+	// The server token of the cluster that produced a cloned snapshot is only needed until it is rotated after the
+	// restore.
+	switch cp.Status.ETCDSnapshotRestorePhase {
+	case rkev1.ETCDSnapshotPhasePostRestoreRotateServerToken, rkev1.ETCDSnapshotPhaseRestartCluster, rkev1.ETCDSnapshotPhaseFinished:
+	default:
+		if err := p.validateEtcdSnapshotClone(cp, snapshot, tokensSecret); err != nil {
+			return status, err
+		}
+	}
+
 	// validate the snapshot can be restored by checking to see if the snapshot version is < 1.25.x and the current version is 1.25 or newer.
 	if snapshot != nil {
 		clusterSpec, err := capr.ParseSnapshotClusterSpecOrError(snapshot)
@@ -810,7 +846,7 @@ func (p *Planner) restoreEtcdSnapshot(cp *rkev1.RKEControlPlane, status rkev1.RK
 		status.ConfigGeneration++ // Increment config generation to cause the restart_stamp to change
 		return p.setEtcdSnapshotRestoreState(status, cp.Spec.ETCDSnapshotRestore, rkev1.ETCDSnapshotPhasePostRestorePodCleanup)
 	case rkev1.ETCDSnapshotPhasePostRestorePodCleanup:
-		if err = p.runEtcdSnapshotPostRestorePodCleanupPlan(cp, tokensSecret, clusterPlan); err != nil {
+		if err = p.runEtcdSnapshotPostRestorePodCleanupPlan(cp, snapshot, tokensSecret, clusterPlan); err != nil {
 			return status, err
 		}
 		return p.setEtcdSnapshotRestoreState(status, cp.Spec.ETCDSnapshotRestore, rkev1.ETCDSnapshotPhaseInitialRestartCluster)
@@ -828,6 +864,20 @@ func (p *Planner) restoreEtcdSnapshot(cp *rkev1.RKEControlPlane, status rkev1.RK
 		if err = p.runEtcdSnapshotPostRestoreNodeCleanupPlan(cp, tokensSecret, clusterPlan); err != nil {
 			return status, err
 		}
+		if isEtcdSnapshotClone(cp, snapshot) {
+			return p.setEtcdSnapshotRestoreState(status, cp.Spec.ETCDSnapshotRestore, rkev1.ETCDSnapshotPhasePostRestoreRotateCA)
+		}
+		return p.setEtcdSnapshotRestoreState(status, cp.Spec.ETCDSnapshotRestore, rkev1.ETCDSnapshotPhaseRestartCluster)
+	case rkev1.ETCDSnapshotPhasePostRestoreRotateCA:
+		if err = p.runEtcdSnapshotCloneRotateCAPlan(cp, tokensSecret, clusterPlan); err != nil {
+			return status, err
+		}
+		return p.setEtcdSnapshotRestoreState(status, cp.Spec.ETCDSnapshotRestore, rkev1.ETCDSnapshotPhasePostRestoreRotateServerToken)
+	case rkev1.ETCDSnapshotPhasePostRestoreRotateServerToken:
+		if err = p.rotateEtcdSnapshotCloneServerToken(cp, tokensSecret, clusterPlan); err != nil {
+			return status, err
+		}
+		status.ConfigGeneration++ // Increment config generation to restart the nodes with the new certificates and token
 		return p.setEtcdSnapshotRestoreState(status, cp.Spec.ETCDSnapshotRestore, rkev1.ETCDSnapshotPhaseRestartCluster)
 	case rkev1.ETCDSnapshotPhaseRestartCluster:
 		if err := p.pauseCAPICluster(cp, false); err != nil {
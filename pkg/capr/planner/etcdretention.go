@@ -0,0 +1,162 @@
+package planner
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+)
+
+// etcdSnapshotRetainFunction is the shell function applying the retention policy of the cluster, set in the HOURLY,
+// DAILY, WEEKLY and MAX_AGE_SECONDS variables, to a list of snapshots.
+const etcdSnapshotRetainFunction = `# retain reads snapshots as "created name", newest first, and prints them as "name tiers". The tiers are the comma
+# separated tiers the snapshot is kept by, - if it is eligible for deletion. Weeks start on monday.
+retain() {
+	awk -v now="$(date +%s)" -v hourly="${HOURLY:-0}" -v daily="${DAILY:-0}" -v weekly="${WEEKLY:-0}" -v maxage="${MAX_AGE_SECONDS:-0}" '
+	function pin(tier, bucket, limit) {
+		if (limit > 0 && !((tier, bucket) in seen) && count[tier] < limit) {
+			seen[tier, bucket] = 1
+			count[tier]++
+			tiers = tiers "," tier
+		}
+	}
+	{
+		tiers = ""
+		pin("hourly", int($1 / 3600), hourly)
+		pin("daily", int($1 / 86400), daily)
+		pin("weekly", int((int($1 / 86400) + 3) / 7), weekly)
+		if (hourly + daily + weekly == 0) {
+			tiers = ",age"
+		}
+		if (maxage > 0 && now - $1 > maxage) {
+			tiers = ""
+		}
+		print $2, (tiers == "" ? "-" : substr(tiers, 2))
+	}'
+}
+`
+
+// etcdSnapshotRetentionScript applies the retention policy of the cluster to the local etcd snapshots of the node and,
+// if S3 is set, to the S3 snapshots. The newest snapshot of each of the most recent hours, days and weeks of a tier is
+// kept, the other snapshots and the snapshots older than the age limit are deleted with the distribution.
+const etcdSnapshotRetentionScript = `#!/bin/sh
+set -e
+
+` + etcdSnapshotRetainFunction + `
+local_snapshots() {
+	for snapshot in "${SNAPSHOT_DIR}"/*; do
+		name=$(basename "${snapshot}")
+		case "${name}" in *.enc) continue ;; esac
+		if [ -f "${snapshot}" ]; then
+			echo "$(date -u -r "${snapshot}" +%s) ${name}"
+		fi
+	done | sort -rn
+}
+
+# s3_snapshots lists the S3 snapshots of the distribution. Older versions list them as "Name Size Created", newer
+# versions list the local and S3 snapshots as "Name Location Size Created", the S3 ones being located at s3://.
+s3_snapshots() {
+	"${RUNTIME}" etcd-snapshot list --etcd-s3 2> /dev/null | awk 'tolower($1) != "name" && (NF == 3 || (NF == 4 && $2 ~ /^s3:\/\//)) { print $1, $NF }' | while read -r name created; do
+		echo "$(date -u -d "${created}" +%s) ${name}"
+	done | sort -rn
+}
+
+# prune prints the snapshots as "storage name tiers" and deletes the snapshots eligible for deletion
+prune() {
+	retain | while read -r name tiers; do
+		echo "$1 ${name} ${tiers}"
+		if [ "${tiers}" = "-" ]; then
+			"${RUNTIME}" etcd-snapshot delete "--etcd-s3=$2" "${name}" > /dev/null 2>&1 || echo "failed to delete etcd snapshot ${name}" >&2
+		fi
+	done
+}
+
+local_snapshots | prune local false
+if [ "${S3}" = "true" ]; then
+	s3_snapshots | prune s3 true
+fi
+`
+
+const (
+	// ETCDSnapshotRetentionInstructionName is the name of the periodic instruction that applies the retention policy of
+	// the cluster to the etcd snapshots of a node. Its output lists the snapshots, one per line, as: storage name tiers.
+	// The storage is local or s3, the tiers are the comma separated tiers the snapshot is kept by, - if it is eligible
+	// for deletion.
+	ETCDSnapshotRetentionInstructionName = "etcd-snapshot-retention"
+
+	etcdSnapshotRetentionScriptPath = "/var/lib/rancher/capr/etcd-snapshot-retention/retention.sh"
+
+	// policySnapshotRetention is the snapshot retention of the distribution when the cluster has a retention policy,
+	// so that the local and S3 snapshots are only pruned by the policy, the S3 snapshots by the init node.
+	policySnapshotRetention = 1024
+)
+
+// validateETCDSnapshotRetentionPolicy validates that the retention policy keeps snapshots.
+func validateETCDSnapshotRetentionPolicy(policy *rkev1.ETCDSnapshotRetentionPolicy) error {
+	if policy.Hourly < 0 || policy.Daily < 0 || policy.Weekly < 0 || policy.MaxAgeHours < 0 {
+		return fmt.Errorf("etcd snapshot retention policy must not be negative")
+	}
+	if policy.Hourly+policy.Daily+policy.Weekly+policy.MaxAgeHours == 0 {
+		return fmt.Errorf("etcd snapshot retention policy must set a tier or an age limit")
+	}
+	return nil
+}
+
+// etcdSnapshotRetentionPolicyEnv returns the environment variables passing the retention policy to the scripts applying
+// it.
+func etcdSnapshotRetentionPolicyEnv(policy *rkev1.ETCDSnapshotRetentionPolicy) []string {
+	return []string{
+		fmt.Sprintf("HOURLY=%d", policy.Hourly),
+		fmt.Sprintf("DAILY=%d", policy.Daily),
+		fmt.Sprintf("WEEKLY=%d", policy.Weekly),
+		fmt.Sprintf("MAX_AGE_SECONDS=%d", policy.MaxAgeHours*3600),
+	}
+}
+
+// etcdSnapshotS3RetentionEnv returns the environment variables setting the retention of the snapshots uploaded to an
+// S3 bucket folder by the system-agent: the retention policy of the cluster if set, which applies to every S3
+// destination, otherwise the number of snapshots kept in the destination.
+func etcdSnapshotS3RetentionEnv(controlPlane *rkev1.RKEControlPlane, retention int) ([]string, error) {
+	policy := controlPlane.Spec.ETCD.SnapshotRetentionPolicy
+	if policy == nil {
+		return []string{fmt.Sprintf("RETENTION=%d", etcdSnapshotS3Retention(controlPlane, retention))}, nil
+	}
+	if err := validateETCDSnapshotRetentionPolicy(policy); err != nil {
+		return nil, err
+	}
+	return append([]string{"POLICY=true"}, etcdSnapshotRetentionPolicyEnv(policy)...), nil
+}
+
+// addEtcdSnapshotRetentionPeriodicInstruction adds the periodic instruction that applies the retention policy of the
+// cluster to the local etcd snapshots of the node. The S3 snapshots uploaded by the distribution are pruned by the init
+// node, as the distribution lists them, the encrypted S3 snapshots and the snapshots in S3 targets are pruned by their
+// uploads.
+func (p *Planner) addEtcdSnapshotRetentionPeriodicInstruction(nodePlan plan.NodePlan, controlPlane *rkev1.RKEControlPlane, entry *planEntry) (plan.NodePlan, error) {
+	policy := controlPlane.Spec.ETCD.SnapshotRetentionPolicy
+	if err := validateETCDSnapshotRetentionPolicy(policy); err != nil {
+		return nodePlan, err
+	}
+	runtime := capr.GetRuntime(controlPlane.Spec.KubernetesVersion)
+	s3 := S3Enabled(controlPlane.Spec.ETCD.S3) && !S3EncryptionEnabled(controlPlane.Spec.ETCD.S3) && isInitNode(entry)
+
+	nodePlan.Files = append(nodePlan.Files, plan.File{
+		Content: base64.StdEncoding.EncodeToString([]byte(etcdSnapshotRetentionScript)),
+		Path:    etcdSnapshotRetentionScriptPath,
+		Dynamic: true,
+		Minor:   true,
+	})
+	nodePlan.PeriodicInstructions = append(nodePlan.PeriodicInstructions, plan.PeriodicInstruction{
+		Name:    ETCDSnapshotRetentionInstructionName,
+		Command: "sh",
+		Args:    []string{etcdSnapshotRetentionScriptPath},
+		Env: append([]string{
+			fmt.Sprintf("RUNTIME=%s", runtime),
+			fmt.Sprintf("SNAPSHOT_DIR=/var/lib/rancher/%s/server/db/snapshots", runtime),
+			fmt.Sprintf("S3=%t", s3),
+		}, etcdSnapshotRetentionPolicyEnv(policy)...),
+		PeriodSeconds: 600,
+	})
+	return nodePlan, nil
+}
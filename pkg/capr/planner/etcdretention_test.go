@@ -0,0 +1,145 @@
+package planner
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateETCDSnapshotRetentionPolicy(t *testing.T) {
+	assert.NoError(t, validateETCDSnapshotRetentionPolicy(&rkev1.ETCDSnapshotRetentionPolicy{Hourly: 24, Daily: 7, Weekly: 4}))
+	assert.NoError(t, validateETCDSnapshotRetentionPolicy(&rkev1.ETCDSnapshotRetentionPolicy{MaxAgeHours: 72}))
+	assert.Error(t, validateETCDSnapshotRetentionPolicy(&rkev1.ETCDSnapshotRetentionPolicy{}))
+	assert.Error(t, validateETCDSnapshotRetentionPolicy(&rkev1.ETCDSnapshotRetentionPolicy{Hourly: -1, Daily: 7}))
+}
+
+func TestAddEtcdSnapshotRetentionPeriodicInstruction(t *testing.T) {
+	mp := newMockPlanner(t, InfoFunctions{})
+	cp := &rkev1.RKEControlPlane{
+		Spec: rkev1.RKEControlPlaneSpec{
+			KubernetesVersion: "v1.27.5+rke2r1",
+			RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
+				ETCD: &rkev1.ETCD{
+					S3: &rkev1.ETCDSnapshotS3{Bucket: "bucket"},
+					SnapshotRetentionPolicy: &rkev1.ETCDSnapshotRetentionPolicy{
+						Hourly:      24,
+						Daily:       7,
+						Weekly:      4,
+						MaxAgeHours: 720,
+					},
+				},
+			},
+		},
+	}
+	initNode := &planEntry{Metadata: &plan.Metadata{Labels: map[string]string{capr.InitNodeLabel: "true"}}}
+
+	nodePlan, err := mp.planner.addEtcdSnapshotRetentionPeriodicInstruction(plan.NodePlan{}, cp, initNode)
+	assert.NoError(t, err)
+	if assert.Len(t, nodePlan.PeriodicInstructions, 1) && assert.Len(t, nodePlan.Files, 1) {
+		instruction := nodePlan.PeriodicInstructions[0]
+		assert.Equal(t, ETCDSnapshotRetentionInstructionName, instruction.Name)
+		assert.Equal(t, []string{nodePlan.Files[0].Path}, instruction.Args)
+		assert.Subset(t, instruction.Env, []string{
+			"RUNTIME=rke2",
+			"SNAPSHOT_DIR=/var/lib/rancher/rke2/server/db/snapshots",
+			"HOURLY=24",
+			"DAILY=7",
+			"WEEKLY=4",
+			"MAX_AGE_SECONDS=2592000",
+			"S3=true",
+		})
+	}
+
+	nodePlan, err = mp.planner.addEtcdSnapshotRetentionPeriodicInstruction(plan.NodePlan{}, cp, &planEntry{})
+	assert.NoError(t, err)
+	assert.Contains(t, nodePlan.PeriodicInstructions[0].Env, "S3=false", "S3 snapshots are pruned by the init node")
+
+	cp.Spec.ETCD.S3.Encryption = &rkev1.ETCDSnapshotEncryption{KeySecretName: "keys", KeyVersion: "v1"}
+	nodePlan, err = mp.planner.addEtcdSnapshotRetentionPeriodicInstruction(plan.NodePlan{}, cp, initNode)
+	assert.NoError(t, err)
+	assert.Contains(t, nodePlan.PeriodicInstructions[0].Env, "S3=false", "encrypted S3 snapshots are not listed by the distribution")
+
+	cp.Spec.ETCD.SnapshotRetentionPolicy = &rkev1.ETCDSnapshotRetentionPolicy{}
+	_, err = mp.planner.addEtcdSnapshotRetentionPeriodicInstruction(plan.NodePlan{}, cp, initNode)
+	assert.Error(t, err)
+}
+
+func TestAddETCDSnapshotRetentionPolicy(t *testing.T) {
+	mp := newMockPlanner(t, InfoFunctions{})
+	cp := &rkev1.RKEControlPlane{
+		Spec: rkev1.RKEControlPlaneSpec{
+			RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
+				ETCD: &rkev1.ETCD{SnapshotRetention: 10},
+			},
+		},
+	}
+	entry := &planEntry{Metadata: &plan.Metadata{Labels: map[string]string{capr.EtcdRoleLabel: "true"}}}
+
+	config := map[string]interface{}{}
+	_, err := mp.planner.addETCD(config, cp, entry, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, config["etcd-snapshot-retention"])
+
+	cp.Spec.ETCD.SnapshotRetentionPolicy = &rkev1.ETCDSnapshotRetentionPolicy{Daily: 7}
+	config = map[string]interface{}{}
+	_, err = mp.planner.addETCD(config, cp, entry, false)
+	assert.NoError(t, err)
+	assert.Equal(t, policySnapshotRetention, config["etcd-snapshot-retention"], "snapshots are only pruned by the policy")
+}
+
+func TestEtcdSnapshotRetentionScriptS3(t *testing.T) {
+	now := time.Now().UTC()
+	for name, list := range map[string]string{
+		"name size created": `Name                      Size    Created
+etcd-snapshot-node-200    8192000 ` + now.Add(-time.Hour).Format(time.RFC3339) + `
+etcd-snapshot-node-100    8192000 ` + now.Add(-2*time.Hour).Format(time.RFC3339) + `
+`,
+		"name location size created": `Name                      Location                                                                Size    Created
+etcd-snapshot-node-200    s3://bucket/cluster/etcd-snapshot-node-200                              8192000 ` + now.Add(-time.Hour).Format(time.RFC3339) + `
+etcd-snapshot-node-100    s3://bucket/cluster/etcd-snapshot-node-100                              8192000 ` + now.Add(-2*time.Hour).Format(time.RFC3339) + `
+etcd-snapshot-node-50     file:///var/lib/rancher/rke2/server/db/snapshots/etcd-snapshot-node-50  8192000 ` + now.Add(-3*time.Hour).Format(time.RFC3339) + `
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.Mkdir(filepath.Join(dir, "snapshots"), 0700))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "retention.sh"), []byte(etcdSnapshotRetentionScript), 0600))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "list"), []byte(list), 0600))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "rke2"), []byte(`#!/bin/sh
+dir=$(dirname "$0")
+case "$2" in
+list) cat "${dir}/list" ;;
+delete) echo "$3 $4" >> "${dir}/deleted" ;;
+esac
+`), 0700))
+
+			cmd := exec.Command("sh", "retention.sh")
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(),
+				"RUNTIME="+filepath.Join(dir, "rke2"),
+				"SNAPSHOT_DIR="+filepath.Join(dir, "snapshots"),
+				"MAX_AGE_SECONDS=5400",
+				"S3=true",
+			)
+			out, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(out))
+
+			assert.Equal(t, []string{
+				"s3 etcd-snapshot-node-200 age",
+				"s3 etcd-snapshot-node-100 -",
+			}, strings.Split(strings.TrimSpace(string(out)), "\n"), "local snapshots listed by the distribution are not pruned as S3 snapshots")
+			deleted, err := os.ReadFile(filepath.Join(dir, "deleted"))
+			require.NoError(t, err)
+			assert.Equal(t, "--etcd-s3=true etcd-snapshot-node-100\n", string(deleted))
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package planner
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// ETCDSnapshotS3TargetInstructionPrefix is the prefix of the names of the periodic instructions that upload etcd
+	// snapshots to the S3 targets of a cluster, it is followed by the name of the target. Their output lists the
+	// snapshots in the target, one per line, as: name key-version size created. The key version is - if the target
+	// is not encrypted.
+	ETCDSnapshotS3TargetInstructionPrefix = "etcd-snapshot-upload-s3-target-"
+
+	etcdSnapshotS3TargetStateDir = etcdSnapshotEncryptionDir + "/targets"
+
+	// defaultSnapshotRetention is the snapshot retention of the distributions.
+	defaultSnapshotRetention = 5
+)
+
+// ETCDSnapshotS3TargetFromInstruction returns the name of the S3 target of the periodic instruction with the given name.
+func ETCDSnapshotS3TargetFromInstruction(instructionName string) (string, bool) {
+	return strings.CutPrefix(instructionName, ETCDSnapshotS3TargetInstructionPrefix)
+}
+
+// ETCDSnapshotS3Location returns the location of the snapshot with the given name uploaded to s3 by the system-agent,
+// encrypted with the given key version.
+func ETCDSnapshotS3Location(s3 *rkev1.ETCDSnapshotS3, snapshotName, keyVersion string) string {
+	if keyVersion != "" {
+		snapshotName += ".enc"
+	}
+	return fmt.Sprintf("s3://%s/%s", s3.Bucket, strings.TrimPrefix(path.Join(s3.Folder, snapshotName), "/"))
+}
+
+// FindETCDSnapshotS3Target returns the S3 target of controlPlane with the given name.
+func FindETCDSnapshotS3Target(controlPlane *rkev1.RKEControlPlane, name string) *rkev1.ETCDSnapshotS3Target {
+	if controlPlane.Spec.ETCD == nil {
+		return nil
+	}
+	for i := range controlPlane.Spec.ETCD.S3Targets {
+		if controlPlane.Spec.ETCD.S3Targets[i].Name == name {
+			return &controlPlane.Spec.ETCD.S3Targets[i]
+		}
+	}
+	return nil
+}
+
+// validateETCDSnapshotS3Targets validates that the S3 targets of controlPlane have unique names which can be used in
+// file paths and instruction names.
+func validateETCDSnapshotS3Targets(targets []rkev1.ETCDSnapshotS3Target) error {
+	names := map[string]bool{}
+	for _, target := range targets {
+		if errs := validation.IsDNS1123Label(target.Name); len(errs) > 0 {
+			return fmt.Errorf("invalid etcd snapshot S3 target name %q: %s", target.Name, strings.Join(errs, ", "))
+		}
+		if names[target.Name] {
+			return fmt.Errorf("duplicate etcd snapshot S3 target name %q", target.Name)
+		}
+		if !S3Enabled(&target.ETCDSnapshotS3) {
+			return fmt.Errorf("etcd snapshot S3 target %q is not configured", target.Name)
+		}
+		names[target.Name] = true
+	}
+	return nil
+}
+
+// addEtcdSnapshotS3TargetPeriodicInstructions adds a periodic instruction per S3 target that uploads the local etcd
+// snapshots of the node to the target, encrypting them if the target is encrypted, and deletes the snapshots beyond the
+// retention of the target, or not kept by the retention policy of the cluster if set.
+func (p *Planner) addEtcdSnapshotS3TargetPeriodicInstructions(nodePlan plan.NodePlan, controlPlane *rkev1.RKEControlPlane) (plan.NodePlan, error) {
+	if err := validateETCDSnapshotS3Targets(controlPlane.Spec.ETCD.S3Targets); err != nil {
+		return nodePlan, err
+	}
+	for i := range controlPlane.Spec.ETCD.S3Targets {
+		target := &controlPlane.Spec.ETCD.S3Targets[i]
+		env, files, err := p.etcdS3Args.etcdSnapshotUploadEnv(controlPlane, &target.ETCDSnapshotS3, path.Join(etcdSnapshotS3TargetStateDir, target.Name))
+		if err != nil {
+			return nodePlan, fmt.Errorf("etcd snapshot S3 target %s: %w", target.Name, err)
+		}
+		retentionEnv, err := etcdSnapshotS3RetentionEnv(controlPlane, target.SnapshotRetention)
+		if err != nil {
+			return nodePlan, err
+		}
+		nodePlan.Files = appendMissingFiles(nodePlan.Files, files...)
+		nodePlan.PeriodicInstructions = append(nodePlan.PeriodicInstructions, plan.PeriodicInstruction{
+			Name:          ETCDSnapshotS3TargetInstructionPrefix + target.Name,
+			Command:       "sh",
+			Args:          []string{etcdSnapshotEncryptionScriptPath, "upload"},
+			Env:           append(env, retentionEnv...),
+			PeriodSeconds: 300,
+		})
+	}
+	return nodePlan, nil
+}
+
+// etcdSnapshotS3Retention returns the number of snapshots kept in an S3 bucket folder by the system-agent uploads, the
+// retention of the destination if set, otherwise the snapshot retention of the cluster.
+func etcdSnapshotS3Retention(controlPlane *rkev1.RKEControlPlane, retention int) int {
+	if retention <= 0 {
+		retention = controlPlane.Spec.ETCD.SnapshotRetention
+	}
+	if retention <= 0 {
+		retention = defaultSnapshotRetention
+	}
+	return retention
+}
+
+// appendMissingFiles appends the files whose path is not in files yet, the script and keys are shared by the uploads.
+func appendMissingFiles(files []plan.File, add ...plan.File) []plan.File {
+	for _, file := range add {
+		found := false
+		for _, existing := range files {
+			if existing.Path == file.Path {
+				found = true
+				break
+			}
+		}
+		if !found {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// generateEtcdSnapshotS3TargetDownloadInstruction returns the files and the instruction that download snapshot from the
+// S3 target with the given name into the local snapshot directory, decrypting it with the key version it was encrypted
+// with if the target is encrypted.
+func (p *Planner) generateEtcdSnapshotS3TargetDownloadInstruction(controlPlane *rkev1.RKEControlPlane, snapshot *rkev1.ETCDSnapshot, targetName string) ([]plan.File, plan.OneTimeInstruction, error) {
+	if snapshot == nil {
+		return nil, plan.OneTimeInstruction{}, fmt.Errorf("etcd snapshot %s/%s was not found, it is required to restore from S3 target %s", controlPlane.Namespace, controlPlane.Spec.ETCDSnapshotRestore.Name, targetName)
+	}
+	target := FindETCDSnapshotS3Target(controlPlane, targetName)
+	if target == nil {
+		return nil, plan.OneTimeInstruction{}, fmt.Errorf("etcd snapshot S3 target %s is not defined", targetName)
+	}
+	var status *rkev1.ETCDSnapshotS3TargetStatus
+	for i := range snapshot.Status.S3Targets {
+		if snapshot.Status.S3Targets[i].Name == targetName {
+			status = &snapshot.Status.S3Targets[i]
+		}
+	}
+	if status == nil {
+		return nil, plan.OneTimeInstruction{}, fmt.Errorf("etcd snapshot %s/%s was not uploaded to S3 target %s", snapshot.Namespace, snapshot.Name, targetName)
+	}
+
+	s3 := target.ETCDSnapshotS3.DeepCopy()
+	if status.KeyVersion == "" {
+		s3.Encryption = nil
+	} else if s3.Encryption != nil {
+		s3.Encryption.KeyVersion = status.KeyVersion
+	} else {
+		return nil, plan.OneTimeInstruction{}, fmt.Errorf("etcd snapshot %s/%s is encrypted in S3 target %s but the target has no encryption key secret", snapshot.Namespace, snapshot.Name, targetName)
+	}
+	return p.generateEtcdSnapshotDownloadInstruction(controlPlane, s3, snapshot.SnapshotFile.Name)
+}
@@ -0,0 +1,271 @@
+package planner
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func createTestS3TargetsControlPlane() *rkev1.RKEControlPlane {
+	return &rkev1.RKEControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fleet-default", Name: "test"},
+		Spec: rkev1.RKEControlPlaneSpec{
+			KubernetesVersion: "v1.27.5+rke2r1",
+			RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
+				ETCD: &rkev1.ETCD{
+					SnapshotRetention: 10,
+					S3Targets: []rkev1.ETCDSnapshotS3Target{
+						{
+							Name: "dr",
+							ETCDSnapshotS3: rkev1.ETCDSnapshotS3{
+								Bucket:              "dr",
+								Region:              "eu-west-1",
+								CloudCredentialName: "cattle-global-data:cc-dr",
+							},
+						},
+						{
+							Name:              "archive",
+							SnapshotRetention: 30,
+							ETCDSnapshotS3: rkev1.ETCDSnapshotS3{
+								Bucket:              "archive",
+								Folder:              "etcd",
+								Endpoint:            "minio.example.com",
+								CloudCredentialName: "cattle-global-data:cc-archive",
+								Encryption:          &rkev1.ETCDSnapshotEncryption{KeySecretName: "snapshot-keys", KeyVersion: "v2"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func expectS3TargetSecrets(mp *mockPlanner) {
+	for _, cc := range []string{"cc-dr", "cc-archive"} {
+		mp.secretCache.EXPECT().Get("cattle-global-data", cc).Return(&v1.Secret{
+			Data: map[string][]byte{
+				"s3credentialConfig-accessKey": []byte(cc + "-access"),
+				"s3credentialConfig-secretKey": []byte(cc + "-secret"),
+			},
+		}, nil).AnyTimes()
+	}
+	mp.secretCache.EXPECT().Get("fleet-default", "snapshot-keys").Return(&v1.Secret{
+		Data: map[string][]byte{"v1": []byte("old"), "v2": []byte("new")},
+	}, nil).AnyTimes()
+}
+
+func TestValidateETCDSnapshotS3Targets(t *testing.T) {
+	assert.NoError(t, validateETCDSnapshotS3Targets(createTestS3TargetsControlPlane().Spec.ETCD.S3Targets))
+	assert.Error(t, validateETCDSnapshotS3Targets([]rkev1.ETCDSnapshotS3Target{{Name: "DR", ETCDSnapshotS3: rkev1.ETCDSnapshotS3{Bucket: "b"}}}))
+	assert.Error(t, validateETCDSnapshotS3Targets([]rkev1.ETCDSnapshotS3Target{{Name: "dr"}}), "the target must be configured")
+	assert.Error(t, validateETCDSnapshotS3Targets([]rkev1.ETCDSnapshotS3Target{
+		{Name: "dr", ETCDSnapshotS3: rkev1.ETCDSnapshotS3{Bucket: "a"}},
+		{Name: "dr", ETCDSnapshotS3: rkev1.ETCDSnapshotS3{Bucket: "b"}},
+	}))
+}
+
+func TestAddEtcdSnapshotS3TargetPeriodicInstructions(t *testing.T) {
+	mp := newMockPlanner(t, InfoFunctions{})
+	expectS3TargetSecrets(mp)
+	cp := createTestS3TargetsControlPlane()
+
+	nodePlan, err := mp.planner.addEtcdSnapshotS3TargetPeriodicInstructions(plan.NodePlan{}, cp)
+	assert.NoError(t, err)
+	if assert.Len(t, nodePlan.PeriodicInstructions, 2) {
+		dr := nodePlan.PeriodicInstructions[0]
+		assert.Equal(t, ETCDSnapshotS3TargetInstructionPrefix+"dr", dr.Name)
+		assert.Contains(t, dr.Env, "S3_BUCKET=dr")
+		assert.Contains(t, dr.Env, "S3_REGION=eu-west-1")
+		assert.Contains(t, dr.Env, "AWS_ACCESS_KEY_ID=cc-dr-access")
+		assert.Contains(t, dr.Env, "STATE_DIR="+etcdSnapshotS3TargetStateDir+"/dr")
+		assert.Contains(t, dr.Env, "RETENTION=10", "the retention defaults to the snapshot retention of the cluster")
+		for _, env := range dr.Env {
+			assert.NotContains(t, env, "KEY_FILE=", "the target is not encrypted")
+		}
+
+		archive := nodePlan.PeriodicInstructions[1]
+		assert.Equal(t, ETCDSnapshotS3TargetInstructionPrefix+"archive", archive.Name)
+		assert.Contains(t, archive.Env, "S3_ENDPOINT=https://minio.example.com")
+		assert.Contains(t, archive.Env, "AWS_ACCESS_KEY_ID=cc-archive-access")
+		assert.Contains(t, archive.Env, "RETENTION=30")
+		assert.Contains(t, archive.Env, "KEY_FILE="+etcdSnapshotEncryptionKeyDir+"/snapshot-keys/v2")
+	}
+
+	cp.Spec.ETCD.SnapshotRetentionPolicy = &rkev1.ETCDSnapshotRetentionPolicy{Daily: 7}
+	policyPlan, err := mp.planner.addEtcdSnapshotS3TargetPeriodicInstructions(plan.NodePlan{}, cp)
+	assert.NoError(t, err)
+	for _, instruction := range policyPlan.PeriodicInstructions {
+		assert.Subset(t, instruction.Env, []string{"POLICY=true", "DAILY=7"}, "the retention policy applies to every target")
+		assert.NotContains(t, strings.Join(instruction.Env, " "), "RETENTION=")
+	}
+	cp.Spec.ETCD.SnapshotRetentionPolicy = &rkev1.ETCDSnapshotRetentionPolicy{}
+	_, err = mp.planner.addEtcdSnapshotS3TargetPeriodicInstructions(plan.NodePlan{}, cp)
+	assert.Error(t, err)
+
+	var scripts int
+	for _, file := range nodePlan.Files {
+		if file.Path == etcdSnapshotEncryptionScriptPath {
+			scripts++
+		}
+	}
+	assert.Equal(t, 1, scripts, "the script is shared by the targets")
+
+	cp.Spec.ETCD.S3Targets[1].Name = "dr"
+	_, err = mp.planner.addEtcdSnapshotS3TargetPeriodicInstructions(plan.NodePlan{}, cp)
+	assert.Error(t, err)
+}
+
+func TestGenerateEtcdSnapshotS3TargetDownloadInstruction(t *testing.T) {
+	mp := newMockPlanner(t, InfoFunctions{})
+	expectS3TargetSecrets(mp)
+	cp := createTestS3TargetsControlPlane()
+	cp.Spec.ETCDSnapshotRestore = &rkev1.ETCDSnapshotRestore{Name: "test-etcd-snapshot-a-1-local", S3Target: "archive"}
+	snapshot := &rkev1.ETCDSnapshot{
+		ObjectMeta:   metav1.ObjectMeta{Namespace: "fleet-default", Name: "test-etcd-snapshot-a-1-local"},
+		SnapshotFile: rkev1.ETCDSnapshotFile{Name: "etcd-snapshot-a-1"},
+	}
+
+	_, _, err := mp.planner.generateEtcdSnapshotS3TargetDownloadInstruction(cp, snapshot, "archive")
+	assert.Error(t, err, "the snapshot was not uploaded to the target")
+	_, _, err = mp.planner.generateEtcdSnapshotS3TargetDownloadInstruction(cp, snapshot, "missing")
+	assert.Error(t, err, "the target is not defined")
+
+	snapshot.Status.S3Targets = []rkev1.ETCDSnapshotS3TargetStatus{
+		{Name: "dr", Location: "s3://dr/etcd-snapshot-a-1"},
+		{Name: "archive", Location: "s3://archive/etcd/etcd-snapshot-a-1.enc", KeyVersion: "v1"},
+	}
+	_, instruction, err := mp.planner.generateEtcdSnapshotS3TargetDownloadInstruction(cp, snapshot, "archive")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{etcdSnapshotEncryptionScriptPath, "download", "etcd-snapshot-a-1"}, instruction.Args)
+	assert.Contains(t, instruction.Env, "KEY_VERSION=v1", "the snapshot is decrypted with the key version it was encrypted with")
+
+	_, instruction, err = mp.planner.generateEtcdSnapshotS3TargetDownloadInstruction(cp, snapshot, "dr")
+	assert.NoError(t, err)
+	assert.Contains(t, instruction.Env, "S3_BUCKET=dr")
+	for _, env := range instruction.Env {
+		assert.NotContains(t, env, "KEY_FILE=")
+	}
+}
+
+func TestETCDSnapshotS3Location(t *testing.T) {
+	assert.Equal(t, "s3://bucket/etcd-snapshot-a-1", ETCDSnapshotS3Location(&rkev1.ETCDSnapshotS3{Bucket: "bucket"}, "etcd-snapshot-a-1", ""))
+	assert.Equal(t, "s3://bucket/folder/etcd-snapshot-a-1.enc", ETCDSnapshotS3Location(&rkev1.ETCDSnapshotS3{Bucket: "bucket", Folder: "/folder"}, "etcd-snapshot-a-1", "v1"))
+}
+
+// fakeCurl stands in for curl in the snapshot upload script. It prints the listing pages of the bucket and logs the
+// uploads and deletes.
+const fakeCurl = `#!/bin/sh
+cat > /dev/null
+for arg; do
+	case "${arg}" in
+	--get) request=list ;;
+	DELETE) request=delete ;;
+	--upload-file) request=upload ;;
+	continuation-token=*) page=2 ;;
+	esac
+	url="${arg}"
+done
+case "${request}" in
+list) cat "${FAKE_DIR}/page${page:-1}.xml" ;;
+*) echo "${request} ${url}" >> "${FAKE_DIR}/requests" ;;
+esac
+`
+
+func TestEtcdSnapshotS3TargetRetention(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"bin", "snapshots", "state"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, d), 0700))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bin", "curl"), []byte(fakeCurl), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "snapshot.sh"), []byte(etcdSnapshotEncryptionScript), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "page1.xml"), []byte(`<ListBucketResult>`+
+		`<Contents><Key>cluster/etcd-snapshot-old-node-100</Key><LastModified>2023-09-01T10:00:00.000Z</LastModified></Contents>`+
+		`<Contents><Key>cluster/etcd-snapshot-node-200</Key><LastModified>2023-09-01T11:00:00.000Z</LastModified></Contents>`+
+		`<NextContinuationToken>next</NextContinuationToken></ListBucketResult>`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "page2.xml"), []byte(`<ListBucketResult>`+
+		`<Contents><Key>cluster/etcd-snapshot-node-300</Key><LastModified>2023-09-01T12:00:00.000Z</LastModified></Contents>`+
+		`<Contents><Key>cluster/other/etcd-snapshot-node-50</Key><LastModified>2023-09-01T09:00:00.000Z</LastModified></Contents>`+
+		`</ListBucketResult>`), 0600))
+
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"etcd-snapshot-node-300", "etcd-snapshot-node-400.part", "etcd-snapshot-node-500"} {
+		path := filepath.Join(dir, "snapshots", name)
+		require.NoError(t, os.WriteFile(path, []byte("snapshot"), 0600))
+		if name != "etcd-snapshot-node-500" {
+			require.NoError(t, os.Chtimes(path, old, old))
+		}
+	}
+	// the state of the snapshot uploaded by the replaced node is on another node
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "state", "etcd-snapshot-node-200"), []byte("- 8 2023-09-01T11:00:00Z"), 0600))
+
+	cmd := exec.Command("sh", "snapshot.sh", "upload")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"PATH="+filepath.Join(dir, "bin")+":"+os.Getenv("PATH"),
+		"FAKE_DIR="+dir,
+		"S3_ENDPOINT=https://s3.example.com",
+		"S3_BUCKET=bucket",
+		"S3_FOLDER=cluster",
+		"SNAPSHOT_DIR="+filepath.Join(dir, "snapshots"),
+		"STATE_DIR="+filepath.Join(dir, "state"),
+		"RETENTION=2",
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	requests, err := os.ReadFile(filepath.Join(dir, "requests"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"upload https://s3.example.com/bucket/cluster/etcd-snapshot-node-300",
+		"delete https://s3.example.com/bucket/cluster/etcd-snapshot-old-node-100",
+	}, strings.Split(strings.TrimSpace(string(requests)), "\n"), "partial and recent snapshots are not uploaded, the oldest snapshot in the bucket is deleted")
+	assert.FileExists(t, filepath.Join(dir, "state", "etcd-snapshot-node-300"))
+	assert.Contains(t, string(out), "etcd-snapshot-node-300 - 8 ")
+}
+
+func TestEtcdSnapshotS3TargetRetentionPolicy(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"bin", "snapshots", "state"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, d), 0700))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bin", "curl"), []byte(fakeCurl), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "snapshot.sh"), []byte(etcdSnapshotEncryptionScript), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "page1.xml"), []byte(`<ListBucketResult>`+
+		`<Contents><Key>cluster/etcd-snapshot-node-100.enc</Key><LastModified>2023-09-01T10:00:00.000Z</LastModified></Contents>`+
+		`<Contents><Key>cluster/etcd-snapshot-node-200.enc</Key><LastModified>2023-09-01T11:00:00.000Z</LastModified></Contents>`+
+		`<Contents><Key>cluster/etcd-snapshot-node-300.enc</Key><LastModified>2023-09-02T10:00:00.000Z</LastModified></Contents>`+
+		`</ListBucketResult>`), 0600))
+
+	cmd := exec.Command("sh", "snapshot.sh", "upload")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"PATH="+filepath.Join(dir, "bin")+":"+os.Getenv("PATH"),
+		"FAKE_DIR="+dir,
+		"S3_ENDPOINT=https://s3.example.com",
+		"S3_BUCKET=bucket",
+		"S3_FOLDER=cluster",
+		"SNAPSHOT_DIR="+filepath.Join(dir, "snapshots"),
+		"STATE_DIR="+filepath.Join(dir, "state"),
+		"POLICY=true",
+		"DAILY=2",
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	requests, err := os.ReadFile(filepath.Join(dir, "requests"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"delete https://s3.example.com/bucket/cluster/etcd-snapshot-node-100.enc",
+	}, strings.Split(strings.TrimSpace(string(requests)), "\n"), "the newest snapshot of each of the two most recent days is kept")
+}
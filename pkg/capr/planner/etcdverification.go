@@ -0,0 +1,194 @@
+package planner
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+)
+
+// etcdSnapshotVerificationScript checksums the local etcd snapshots of the node. If test restores are enabled, each
+// snapshot is restored once into a throwaway etcd process listening on free loopback ports, and the result is recorded
+// in the state directory along with the checksum it was restored with, so that a snapshot is restored again if it
+// changes. RKE2 nodes restore with the etcd image of their etcd static pod through the containerd of RKE2, other nodes
+// with the etcd and etcdutl binaries of the host. If neither is available, as on K3s which embeds etcd, the test
+// restore is reported as unsupported and attempted again on the next run. Snapshots that are still being written, i.e.
+// partial files or files modified in the last two minutes, are verified on a later run.
+const etcdSnapshotVerificationScript = `#!/bin/sh
+set -e
+
+# etcd_tools finds how etcdutl and etcd are run on the node and fails if they are not available
+etcd_tools() {
+	manifest="/var/lib/rancher/${RUNTIME}/agent/pod-manifests/etcd.yaml"
+	if [ -x "/var/lib/rancher/${RUNTIME}/bin/ctr" ] && [ -f "${manifest}" ]; then
+		image=$(sed -n 's/^ *image: *"\{0,1\}\([^" ]*\)"\{0,1\} *$/\1/p' "${manifest}" | head -n 1)
+		if [ -n "${image}" ]; then
+			tools="image"
+			return 0
+		fi
+	fi
+	if command -v etcdutl > /dev/null 2>&1 && command -v etcd > /dev/null 2>&1; then
+		tools="host"
+		return 0
+	fi
+	return 1
+}
+
+# ctr runs the containerd client of the node
+ctr() {
+	"/var/lib/rancher/${RUNTIME}/bin/ctr" --address "/run/k3s/containerd/containerd.sock" --namespace k8s.io "$@"
+}
+
+# run_etcdutl runs etcdutl with the given arguments
+run_etcdutl() {
+	if [ "${tools}" = "image" ]; then
+		ctr run --rm --net-host --mount "type=bind,src=${dir},dst=${dir},options=rbind:rw" "${image}" "etcd-verify-restore-$$" etcdutl "$@"
+	else
+		etcdutl "$@"
+	fi
+}
+
+# start_etcd starts an etcd process with the given arguments in the background
+start_etcd() {
+	if [ "${tools}" = "image" ]; then
+		ctr run --detach --net-host --mount "type=bind,src=${dir},dst=${dir},options=rbind:rw" "${image}" "etcd-verify-$$" etcd "$@"
+	else
+		etcd "$@" &
+		pid=$!
+	fi
+}
+
+# stop_etcd stops the etcd process started by start_etcd
+stop_etcd() {
+	if [ "${tools}" = "image" ]; then
+		ctr task rm --force "etcd-verify-$$" || true
+		ctr container rm "etcd-verify-$$" || true
+	else
+		kill "${pid}" || true
+		wait "${pid}" || true
+	fi
+}
+
+# port_free succeeds if no socket of the node uses the given port
+port_free() {
+	! grep -qi ":$(printf '%04X' "$1") " /proc/net/tcp /proc/net/tcp6 2> /dev/null
+}
+
+# free_port prints a port that is free along with the next one
+free_port() {
+	port=$(($$ % 20000 + 20000))
+	while ! port_free "${port}" || ! port_free "$((port + 1))"; do
+		port=$((port + 2))
+		if [ "${port}" -gt 65000 ]; then
+			return 1
+		fi
+	done
+	echo "${port}"
+}
+
+# test_restore restores a snapshot into a temporary data directory and checks that an etcd process can serve it
+test_restore() {
+	dir=$(mktemp -d)
+	case "$1" in
+	*.zip) unzip -p "$1" > "${dir}/snapshot" ;;
+	*) cp "$1" "${dir}/snapshot" ;;
+	esac || { rm -rf "${dir}"; return 1; }
+	if ! port=$(free_port); then
+		rm -rf "${dir}"
+		return 1
+	fi
+	client="http://127.0.0.1:${port}"
+	peer="http://127.0.0.1:$((port + 1))"
+	result=1
+	if run_etcdutl snapshot restore "${dir}/snapshot" --data-dir "${dir}/data" --name verify --initial-cluster "verify=${peer}" --initial-advertise-peer-urls "${peer}" > /dev/null 2>&1; then
+		start_etcd --name verify --data-dir "${dir}/data" --listen-client-urls "${client}" --advertise-client-urls "${client}" --listen-peer-urls "${peer}" --initial-advertise-peer-urls "${peer}" --initial-cluster "verify=${peer}" > /dev/null 2>&1 || true
+		for i in $(seq 30); do
+			if curl --silent --max-time 1 "${client}/health" | grep -q '"health":"true"'; then
+				result=0
+				break
+			fi
+			sleep 1
+		done
+		stop_etcd > /dev/null 2>&1
+	fi
+	rm -rf "${dir}"
+	return "${result}"
+}
+
+mkdir -p "${STATE_DIR}"
+for snapshot in "${SNAPSHOT_DIR}"/*; do
+	name=$(basename "${snapshot}")
+	case "${name}" in *.enc | *.part | *.tmp) continue ;; esac
+	if [ ! -f "${snapshot}" ] || [ -n "$(find "${snapshot}" -mmin -2)" ]; then
+		continue
+	fi
+	sum=$(sha256sum "${snapshot}" | cut -d ' ' -f 1)
+	restore="-"
+	if [ "${TEST_RESTORE}" = "true" ]; then
+		if [ -f "${STATE_DIR}/${name}" ] && [ "$(cut -d ' ' -f 1 "${STATE_DIR}/${name}")" = "${sum}" ]; then
+			restore=$(cut -d ' ' -f 2 "${STATE_DIR}/${name}")
+		elif ! etcd_tools; then
+			restore="unsupported"
+		else
+			restore="failed"
+			if test_restore "${snapshot}"; then
+				restore="ok"
+			fi
+			echo "${sum} ${restore}" > "${STATE_DIR}/${name}"
+		fi
+	fi
+	echo "${name} ${sum} ${restore}"
+done
+for state in "${STATE_DIR}"/*; do
+	if [ -f "${state}" ] && [ ! -f "${SNAPSHOT_DIR}/$(basename "${state}")" ]; then
+		rm -f "${state}"
+	fi
+done
+`
+
+const (
+	// ETCDSnapshotVerificationInstructionName is the name of the periodic instruction that verifies the local etcd
+	// snapshots of a node. Its output lists the snapshots, one per line, as: name sha256 restore. The restore is ok or
+	// failed if the snapshot was test restored, unsupported if the node cannot test restore snapshots, - otherwise.
+	ETCDSnapshotVerificationInstructionName = "etcd-snapshot-verify"
+
+	etcdSnapshotVerificationDir        = "/var/lib/rancher/capr/etcd-snapshot-verification"
+	etcdSnapshotVerificationScriptPath = etcdSnapshotVerificationDir + "/verify.sh"
+	etcdSnapshotVerificationStateDir   = etcdSnapshotVerificationDir + "/restored"
+
+	defaultSnapshotVerificationIntervalSeconds = 3600
+)
+
+// addEtcdSnapshotVerificationPeriodicInstruction adds the periodic instruction that verifies the local etcd snapshots
+// of the node, test restoring them if the node is the test restore machine of the cluster.
+func (p *Planner) addEtcdSnapshotVerificationPeriodicInstruction(nodePlan plan.NodePlan, controlPlane *rkev1.RKEControlPlane, entry *planEntry) (plan.NodePlan, error) {
+	verification := controlPlane.Spec.ETCD.SnapshotVerification
+	runtime := capr.GetRuntime(controlPlane.Spec.KubernetesVersion)
+	interval := verification.IntervalSeconds
+	if interval <= 0 {
+		interval = defaultSnapshotVerificationIntervalSeconds
+	}
+	testRestore := verification.TestRestoreMachineName != "" && entry.Machine != nil && entry.Machine.Name == verification.TestRestoreMachineName
+
+	nodePlan.Files = append(nodePlan.Files, plan.File{
+		Content: base64.StdEncoding.EncodeToString([]byte(etcdSnapshotVerificationScript)),
+		Path:    etcdSnapshotVerificationScriptPath,
+		Dynamic: true,
+		Minor:   true,
+	})
+	nodePlan.PeriodicInstructions = append(nodePlan.PeriodicInstructions, plan.PeriodicInstruction{
+		Name:    ETCDSnapshotVerificationInstructionName,
+		Command: "sh",
+		Args:    []string{etcdSnapshotVerificationScriptPath},
+		Env: []string{
+			fmt.Sprintf("RUNTIME=%s", runtime),
+			fmt.Sprintf("SNAPSHOT_DIR=/var/lib/rancher/%s/server/db/snapshots", runtime),
+			fmt.Sprintf("STATE_DIR=%s", etcdSnapshotVerificationStateDir),
+			fmt.Sprintf("TEST_RESTORE=%t", testRestore),
+		},
+		PeriodSeconds: interval,
+	})
+	return nodePlan, nil
+}
@@ -0,0 +1,110 @@
+package planner
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+func TestAddEtcdSnapshotVerificationPeriodicInstruction(t *testing.T) {
+	mp := newMockPlanner(t, InfoFunctions{})
+	cp := &rkev1.RKEControlPlane{
+		Spec: rkev1.RKEControlPlaneSpec{
+			KubernetesVersion: "v1.27.5+k3s1",
+			RKEClusterSpecCommon: rkev1.RKEClusterSpecCommon{
+				ETCD: &rkev1.ETCD{
+					SnapshotVerification: &rkev1.ETCDSnapshotVerification{TestRestoreMachineName: "etcd-0"},
+				},
+			},
+		},
+	}
+
+	for _, machineName := range []string{"etcd-0", "etcd-1"} {
+		t.Run(machineName, func(t *testing.T) {
+			entry := &planEntry{Machine: &capi.Machine{ObjectMeta: metav1.ObjectMeta{Name: machineName}}}
+			nodePlan, err := mp.planner.addEtcdSnapshotVerificationPeriodicInstruction(plan.NodePlan{}, cp, entry)
+			assert.NoError(t, err)
+			if assert.Len(t, nodePlan.PeriodicInstructions, 1) && assert.Len(t, nodePlan.Files, 1) {
+				instruction := nodePlan.PeriodicInstructions[0]
+				assert.Equal(t, ETCDSnapshotVerificationInstructionName, instruction.Name)
+				assert.Equal(t, []string{nodePlan.Files[0].Path}, instruction.Args)
+				assert.Equal(t, defaultSnapshotVerificationIntervalSeconds, instruction.PeriodSeconds)
+				assert.Contains(t, instruction.Env, "SNAPSHOT_DIR=/var/lib/rancher/k3s/server/db/snapshots")
+				assert.Contains(t, instruction.Env, "RUNTIME=k3s")
+				if machineName == "etcd-0" {
+					assert.Contains(t, instruction.Env, "TEST_RESTORE=true")
+				} else {
+					assert.Contains(t, instruction.Env, "TEST_RESTORE=false", "snapshots are only test restored on the test restore machine")
+				}
+			}
+		})
+	}
+
+	cp.Spec.ETCD.SnapshotVerification.IntervalSeconds = 600
+	nodePlan, err := mp.planner.addEtcdSnapshotVerificationPeriodicInstruction(plan.NodePlan{}, cp, &planEntry{})
+	assert.NoError(t, err)
+	assert.Equal(t, 600, nodePlan.PeriodicInstructions[0].PeriodSeconds)
+	assert.Contains(t, nodePlan.PeriodicInstructions[0].Env, "TEST_RESTORE=false")
+}
+
+func TestEtcdSnapshotVerificationScript(t *testing.T) {
+	if _, err := exec.LookPath("etcdutl"); err == nil {
+		t.Skip("etcdutl is installed on the host")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "snapshots"), 0700))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bin"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "verify.sh"), []byte(etcdSnapshotVerificationScript), 0600))
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"etcd-snapshot-node-100", "etcd-snapshot-node-200.part", "etcd-snapshot-node-300.tmp", "etcd-snapshot-node-400"} {
+		path := filepath.Join(dir, "snapshots", name)
+		require.NoError(t, os.WriteFile(path, []byte("snapshot"), 0600))
+		if name != "etcd-snapshot-node-400" {
+			require.NoError(t, os.Chtimes(path, old, old))
+		}
+	}
+
+	verify := func() string {
+		cmd := exec.Command("sh", "verify.sh")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"PATH="+filepath.Join(dir, "bin")+":"+os.Getenv("PATH"),
+			"RUNTIME=k3s-test",
+			"SNAPSHOT_DIR="+filepath.Join(dir, "snapshots"),
+			"STATE_DIR="+filepath.Join(dir, "state"),
+			"TEST_RESTORE=true",
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	sum := "16a0eeb0791b6c92451fd284dd9f599e0a7dbe7f6ebea6e2d2d06c7f74aec112"
+
+	out := verify()
+	assert.Equal(t, []string{"etcd-snapshot-node-100", sum, "unsupported"}, strings.Fields(out), "a node without etcd tools cannot test restore, partial and recent snapshots are verified later")
+	assert.NoFileExists(t, filepath.Join(dir, "state", "etcd-snapshot-node-100"), "unsupported test restores are attempted again")
+
+	for name, content := range map[string]string{
+		"etcdutl": "#!/bin/sh\nexit 0\n",
+		"etcd":    "#!/bin/sh\nexec sleep 60\n",
+		"curl":    "#!/bin/sh\nfor arg; do url=\"$arg\"; done\necho \"$url\" >> \"$(dirname \"$0\")/urls\"\necho '{\"health\":\"true\"}'\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "bin", name), []byte(content), 0700))
+	}
+	out = verify()
+	assert.Equal(t, []string{"etcd-snapshot-node-100", sum, "ok"}, strings.Fields(out))
+	assert.FileExists(t, filepath.Join(dir, "state", "etcd-snapshot-node-100"))
+	urls, err := os.ReadFile(filepath.Join(dir, "bin", "urls"))
+	require.NoError(t, err)
+	assert.Regexp(t, `^http://127\.0\.0\.1:[23][0-9]{4}/health$`, strings.TrimSpace(string(urls)), "the throwaway etcd process listens on a free port")
+}
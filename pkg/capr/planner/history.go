@@ -0,0 +1,261 @@
+package planner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/rancher/wrangler/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// PlanHistoryKey is the key of the plan history secret holding the encoded history.
+	PlanHistoryKey = "history"
+
+	// PlanHistoryMachineNameLabel is the label holding the machine name of a plan history secret. The secret must not
+	// carry the capr.MachineNameLabel, the plan secrets of a machine are selected by it.
+	PlanHistoryMachineNameLabel = "rke.cattle.io/plan-history-machine-name"
+
+	// maxPlanHistorySize is the maximum size of the encoded history, it keeps the history secret well below the size
+	// limit of secrets.
+	maxPlanHistorySize = 768 * 1024
+)
+
+// PlanRevision is a plan that was applied, or failed to be applied, to a machine.
+type PlanRevision struct {
+	Revision  int         `json:"revision"`
+	Timestamp metav1.Time `json:"timestamp"`
+	// Checksum is the checksum of the plan reported by the system-agent.
+	Checksum string `json:"checksum"`
+	Failed   bool   `json:"failed,omitempty"`
+	// Output is the output of the instructions of the plan that save their output.
+	Output map[string][]byte `json:"output,omitempty"`
+	Plan   PlanDigest        `json:"plan"`
+}
+
+// PlanDigest is what the plan history keeps of a plan. File contents and instruction environments and arguments hold
+// join tokens, credentials and encryption keys, so only their hashes are kept.
+type PlanDigest struct {
+	Files        []FileDigest        `json:"files,omitempty"`
+	Instructions []InstructionDigest `json:"instructions,omitempty"`
+}
+
+// FileDigest is a file of a plan without its content.
+type FileDigest struct {
+	Path  string `json:"path"`
+	Hash  string `json:"hash,omitempty"`
+	Minor bool   `json:"minor,omitempty"`
+	// ConfigKeys holds the hash of the value of each key of a JSON config file, so the changed keys can be told.
+	ConfigKeys map[string]string `json:"configKeys,omitempty"`
+}
+
+// InstructionDigest is a one time instruction of a plan without its environment and arguments.
+type InstructionDigest struct {
+	Name    string `json:"name"`
+	Image   string `json:"image,omitempty"`
+	Command string `json:"command,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+}
+
+// PlanDiff is the difference between two revisions of the plan of a machine.
+type PlanDiff struct {
+	From         int                 `json:"from"`
+	To           int                 `json:"to"`
+	Files        []FileChange        `json:"files,omitempty"`
+	Instructions []InstructionChange `json:"instructions,omitempty"`
+}
+
+// PlanHistorySecretName returns the name of the secret holding the plan history of the machine with the given plan
+// secret.
+func PlanHistorySecretName(planSecretName string) string {
+	return name.SafeConcatName(planSecretName, "history")
+}
+
+// DecodePlanHistory returns the revisions stored in a plan history secret, oldest first.
+func DecodePlanHistory(secret *corev1.Secret) ([]PlanRevision, error) {
+	if secret.Type != capr.SecretTypeMachinePlanHistory {
+		return nil, fmt.Errorf("secret %s/%s type %s did not match expected type %s", secret.Namespace, secret.Name, secret.Type, capr.SecretTypeMachinePlanHistory)
+	}
+	data := secret.Data[PlanHistoryKey]
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var history []PlanRevision
+	if err := capr.DecompressInterface(string(data), &history); err != nil {
+		return nil, fmt.Errorf("failed to decode plan history of secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return history, nil
+}
+
+// EncodePlanHistory encodes history for a plan history secret. The oldest revisions are dropped until the encoded
+// history fits the maximum size, the latest revision is always kept.
+func EncodePlanHistory(history []PlanRevision) ([]byte, error) {
+	for {
+		data, err := capr.CompressInterface(history)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) <= maxPlanHistorySize || len(history) <= 1 {
+			return []byte(data), nil
+		}
+		history = history[1:]
+	}
+}
+
+// AppendPlanRevision appends revision to history and returns true, unless the latest revision has the same checksum
+// and outcome. The oldest revisions are dropped to keep at most limit revisions.
+func AppendPlanRevision(history []PlanRevision, revision PlanRevision, limit int) ([]PlanRevision, bool) {
+	if len(history) > 0 {
+		latest := history[len(history)-1]
+		if latest.Checksum == revision.Checksum && latest.Failed == revision.Failed {
+			return history, false
+		}
+		revision.Revision = latest.Revision + 1
+	} else {
+		revision.Revision = 1
+	}
+
+	history = append(history, revision)
+	if limit > 0 && len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	return history, true
+}
+
+// FindPlanRevision returns the revision with the given number from history.
+func FindPlanRevision(history []PlanRevision, revision int) (PlanRevision, bool) {
+	for _, r := range history {
+		if r.Revision == revision {
+			return r, true
+		}
+	}
+	return PlanRevision{}, false
+}
+
+// DigestPlan returns the digest of nodePlan the plan history keeps.
+func DigestPlan(nodePlan plan.NodePlan) PlanDigest {
+	var digest PlanDigest
+	for _, file := range nodePlan.Files {
+		fileDigest := FileDigest{
+			Path:  file.Path,
+			Hash:  hashOf(file.Content + file.Permissions),
+			Minor: file.Minor,
+		}
+		if config, ok := decodeConfig(file.Content); ok {
+			fileDigest.ConfigKeys = map[string]string{}
+			for k, v := range config {
+				value, _ := json.Marshal(v)
+				fileDigest.ConfigKeys[k] = hashOf(string(value))
+			}
+		}
+		digest.Files = append(digest.Files, fileDigest)
+	}
+	for _, instruction := range nodePlan.Instructions {
+		data, _ := json.Marshal(instruction)
+		digest.Instructions = append(digest.Instructions, InstructionDigest{
+			Name:    instruction.Name,
+			Image:   instruction.Image,
+			Command: instruction.Command,
+			Hash:    hashOf(string(data)),
+		})
+	}
+	return digest
+}
+
+func hashOf(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// DiffPlanRevisions returns how the plan of revision to differs from the plan of revision from.
+func DiffPlanRevisions(from, to PlanRevision) PlanDiff {
+	return PlanDiff{
+		From:         from.Revision,
+		To:           to.Revision,
+		Files:        diffFileDigests(from.Plan.Files, to.Plan.Files),
+		Instructions: diffInstructionDigests(from.Plan.Instructions, to.Plan.Instructions),
+	}
+}
+
+// diffFileDigests is diffFiles for the digests of files.
+func diffFileDigests(from, to []FileDigest) []FileChange {
+	fromFiles := map[string]FileDigest{}
+	for _, file := range from {
+		fromFiles[file.Path] = file
+	}
+
+	var changes []FileChange
+	for _, file := range to {
+		fromFile, ok := fromFiles[file.Path]
+		delete(fromFiles, file.Path)
+		if !ok {
+			changes = append(changes, FileChange{Path: file.Path, Change: changeAdded, Minor: file.Minor})
+		} else if fromFile.Hash != file.Hash || fromFile.Minor != file.Minor {
+			changes = append(changes, FileChange{
+				Path:   file.Path,
+				Change: changeModified,
+				Minor:  file.Minor && fromFile.Minor,
+				Keys:   changedDigestKeys(fromFile.ConfigKeys, file.ConfigKeys),
+			})
+		}
+	}
+	for _, file := range fromFiles {
+		changes = append(changes, FileChange{Path: file.Path, Change: changeRemoved, Minor: file.Minor})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// changedDigestKeys returns the sorted keys whose value hashes differ, nil if either file is not a JSON config file.
+func changedDigestKeys(from, to map[string]string) []string {
+	if from == nil || to == nil {
+		return nil
+	}
+	var keys []string
+	for k, v := range to {
+		if fromValue, ok := from[k]; !ok || fromValue != v {
+			keys = append(keys, k)
+		}
+	}
+	for k := range from {
+		if _, ok := to[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diffInstructionDigests is diffInstructions for the digests of instructions.
+func diffInstructionDigests(from, to []InstructionDigest) []InstructionChange {
+	fromInstructions := map[string]InstructionDigest{}
+	for _, instruction := range from {
+		fromInstructions[instruction.Name] = instruction
+	}
+
+	var changes []InstructionChange
+	for _, instruction := range to {
+		fromInstruction, ok := fromInstructions[instruction.Name]
+		delete(fromInstructions, instruction.Name)
+		if !ok {
+			changes = append(changes, InstructionChange{Name: instruction.Name, Change: changeAdded})
+		} else if fromInstruction != instruction {
+			changes = append(changes, InstructionChange{Name: instruction.Name, Change: changeModified})
+		}
+	}
+	for _, instruction := range from {
+		if _, ok := fromInstructions[instruction.Name]; ok {
+			changes = append(changes, InstructionChange{Name: instruction.Name, Change: changeRemoved})
+		}
+	}
+	return changes
+}
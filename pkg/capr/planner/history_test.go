@@ -0,0 +1,120 @@
+package planner
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestAppendPlanRevision(t *testing.T) {
+	history, appended := AppendPlanRevision(nil, PlanRevision{Checksum: "a"}, 2)
+	assert.True(t, appended)
+	assert.Equal(t, 1, history[0].Revision)
+
+	history, appended = AppendPlanRevision(history, PlanRevision{Checksum: "a"}, 2)
+	assert.False(t, appended, "the latest revision is not recorded twice")
+	assert.Len(t, history, 1)
+
+	history, appended = AppendPlanRevision(history, PlanRevision{Checksum: "b", Failed: true}, 2)
+	assert.True(t, appended)
+	history, appended = AppendPlanRevision(history, PlanRevision{Checksum: "b"}, 2)
+	assert.True(t, appended, "a plan that failed and then succeeded is recorded twice")
+
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, 2, history[0].Revision)
+		assert.True(t, history[0].Failed)
+		assert.Equal(t, 3, history[1].Revision)
+		assert.False(t, history[1].Failed)
+	}
+}
+
+func TestEncodeDecodePlanHistory(t *testing.T) {
+	history := []PlanRevision{
+		{Revision: 1, Checksum: "a", Plan: PlanDigest{Files: []FileDigest{{Path: "/etc/a", Hash: "abc"}}}},
+		{Revision: 2, Checksum: "b", Failed: true, Output: map[string][]byte{"install": []byte("error")}},
+	}
+	data, err := EncodePlanHistory(history)
+	assert.NoError(t, err)
+
+	secret := &corev1.Secret{
+		Type: capr.SecretTypeMachinePlanHistory,
+		Data: map[string][]byte{PlanHistoryKey: data},
+	}
+	decoded, err := DecodePlanHistory(secret)
+	assert.NoError(t, err)
+	assert.Equal(t, history, decoded)
+
+	secret.Type = capr.SecretTypeMachinePlan
+	_, err = DecodePlanHistory(secret)
+	assert.Error(t, err, "only plan history secrets are decoded")
+}
+
+func TestDigestPlan(t *testing.T) {
+	digest := DigestPlan(plan.NodePlan{
+		Files: []plan.File{
+			// {"token":"secret"}
+			{Path: "/etc/rancher/rke2/config.yaml.d/50-rancher.yaml", Content: "eyJ0b2tlbiI6InNlY3JldCJ9"},
+			{Path: "/etc/a", Content: "c2VjcmV0", Minor: true},
+		},
+		Instructions: []plan.OneTimeInstruction{{
+			Name:    "etcd-snapshot",
+			Image:   "rancher/system-agent-installer-rke2:v1.27.1-rke2r1",
+			Command: "sh",
+			Env:     []string{"S3_SECRET_KEY=secret"},
+			Args:    []string{"--token", "secret"},
+		}},
+	})
+
+	data, err := json.Marshal(digest)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+	assert.NotContains(t, string(data), "c2VjcmV0")
+
+	require.Len(t, digest.Files, 2)
+	assert.Contains(t, digest.Files[0].ConfigKeys, "token")
+	assert.Nil(t, digest.Files[1].ConfigKeys)
+	assert.True(t, digest.Files[1].Minor)
+	assert.Equal(t, InstructionDigest{
+		Name:    "etcd-snapshot",
+		Image:   "rancher/system-agent-installer-rke2:v1.27.1-rke2r1",
+		Command: "sh",
+		Hash:    digest.Instructions[0].Hash,
+	}, digest.Instructions[0])
+	assert.NotEmpty(t, digest.Instructions[0].Hash)
+}
+
+func TestDiffPlanRevisions(t *testing.T) {
+	from := PlanRevision{Revision: 1, Plan: DigestPlan(plan.NodePlan{
+		Files: []plan.File{
+			{Path: "/etc/a", Content: "YQ=="},
+			// {"token":"a","server":"a"}
+			{Path: "/etc/config", Content: "eyJ0b2tlbiI6ImEiLCJzZXJ2ZXIiOiJhIn0="},
+		},
+		Instructions: []plan.OneTimeInstruction{{Name: "install"}},
+	})}
+	to := PlanRevision{Revision: 3, Plan: DigestPlan(plan.NodePlan{
+		Files: []plan.File{
+			{Path: "/etc/a", Content: "Yg=="},
+			{Path: "/etc/b"},
+			// {"token":"b","server":"a"}
+			{Path: "/etc/config", Content: "eyJ0b2tlbiI6ImIiLCJzZXJ2ZXIiOiJhIn0="},
+		},
+		Instructions: []plan.OneTimeInstruction{{Name: "install", Args: []string{"--force"}}},
+	})}
+
+	assert.Equal(t, PlanDiff{
+		From: 1,
+		To:   3,
+		Files: []FileChange{
+			{Path: "/etc/a", Change: changeModified},
+			{Path: "/etc/b", Change: changeAdded},
+			{Path: "/etc/config", Change: changeModified, Keys: []string{"token"}},
+		},
+		Instructions: []InstructionChange{{Name: "install", Change: changeModified}},
+	}, DiffPlanRevisions(from, to))
+}
@@ -0,0 +1,63 @@
+package planner
+
+import (
+	"fmt"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/robfig/cron"
+)
+
+const waitingMaintenanceWindowMessage = "waiting for maintenance window"
+
+// maintenanceWindowOpen returns true if window is unset or one of its windows is open at now. Otherwise, it returns the
+// time the next window opens.
+func maintenanceWindowOpen(window *rkev1.MaintenanceWindow, now time.Time) (bool, time.Time, error) {
+	if window == nil || len(window.Schedules) == 0 {
+		return true, time.Time{}, nil
+	}
+
+	duration, err := time.ParseDuration(window.Duration)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("invalid maintenance window duration %q: %w", window.Duration, err)
+	} else if duration <= 0 {
+		return false, time.Time{}, fmt.Errorf("invalid maintenance window duration %q: must be positive", window.Duration)
+	}
+
+	location := time.UTC
+	if window.TimeZone != "" {
+		location, err = time.LoadLocation(window.TimeZone)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid maintenance window time zone %q: %w", window.TimeZone, err)
+		}
+	}
+
+	var next time.Time
+	for _, spec := range window.Schedules {
+		schedule, err := cron.ParseStandard(spec)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid maintenance window schedule %q: %w", spec, err)
+		}
+		// The first window opening after now-duration is either open at now or the next one of this schedule.
+		start := schedule.Next(now.In(location).Add(-duration))
+		if start.IsZero() {
+			// The schedule never fires, e.g. on February 30th.
+			continue
+		}
+		if !start.After(now) {
+			return true, time.Time{}, nil
+		}
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return false, next, nil
+}
+
+// maintenanceWindowMessage renders the status message for machines whose plan changes are held until next.
+func maintenanceWindowMessage(next time.Time) string {
+	if next.IsZero() {
+		return waitingMaintenanceWindowMessage
+	}
+	return fmt.Sprintf("%s opening at %s", waitingMaintenanceWindowMessage, next.Format(time.RFC3339))
+}
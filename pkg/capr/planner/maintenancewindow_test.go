@@ -0,0 +1,124 @@
+package planner
+
+import (
+	"testing"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceWindowOpen(t *testing.T) {
+	// Saturday
+	saturday := time.Date(2023, 9, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		window     *rkev1.MaintenanceWindow
+		now        time.Time
+		expectOpen bool
+		expectNext time.Time
+		expectErr  bool
+	}{
+		{
+			name:       "no window",
+			now:        saturday,
+			expectOpen: true,
+		},
+		{
+			name: "within window",
+			window: &rkev1.MaintenanceWindow{
+				Schedules: []string{"0 2 * * 6"},
+				Duration:  "4h",
+			},
+			now:        saturday.Add(3 * time.Hour),
+			expectOpen: true,
+		},
+		{
+			name: "window opens exactly now",
+			window: &rkev1.MaintenanceWindow{
+				Schedules: []string{"0 2 * * 6"},
+				Duration:  "4h",
+			},
+			now:        saturday.Add(2 * time.Hour),
+			expectOpen: true,
+		},
+		{
+			name: "before window",
+			window: &rkev1.MaintenanceWindow{
+				Schedules: []string{"0 2 * * 6"},
+				Duration:  "4h",
+			},
+			now:        saturday.Add(time.Hour),
+			expectNext: saturday.Add(2 * time.Hour),
+		},
+		{
+			name: "after window closed",
+			window: &rkev1.MaintenanceWindow{
+				Schedules: []string{"0 2 * * 6"},
+				Duration:  "4h",
+			},
+			now:        saturday.Add(6 * time.Hour),
+			expectNext: saturday.Add(7*24*time.Hour + 2*time.Hour),
+		},
+		{
+			name: "earliest of multiple schedules",
+			window: &rkev1.MaintenanceWindow{
+				Schedules: []string{"0 2 * * 6", "0 22 * * 3"},
+				Duration:  "1h",
+			},
+			now:        saturday.Add(6 * time.Hour),
+			expectNext: saturday.Add(4*24*time.Hour + 22*time.Hour),
+		},
+		{
+			name: "time zone",
+			window: &rkev1.MaintenanceWindow{
+				Schedules: []string{"0 2 * * 6"},
+				Duration:  "4h",
+				TimeZone:  "America/New_York",
+			},
+			// 03:00 UTC is 23:00 on Friday in New York
+			now:        saturday.Add(3 * time.Hour),
+			expectNext: saturday.Add(6 * time.Hour),
+		},
+		{
+			name: "invalid schedule",
+			window: &rkev1.MaintenanceWindow{
+				Schedules: []string{"not a schedule"},
+				Duration:  "4h",
+			},
+			now:       saturday,
+			expectErr: true,
+		},
+		{
+			name: "missing duration",
+			window: &rkev1.MaintenanceWindow{
+				Schedules: []string{"0 2 * * 6"},
+			},
+			now:       saturday,
+			expectErr: true,
+		},
+		{
+			name: "invalid time zone",
+			window: &rkev1.MaintenanceWindow{
+				Schedules: []string{"0 2 * * 6"},
+				Duration:  "4h",
+				TimeZone:  "Nowhere/Special",
+			},
+			now:       saturday,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			open, next, err := maintenanceWindowOpen(tt.window, tt.now)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectOpen, open)
+			assert.True(t, tt.expectNext.Equal(next), "expected next window at %s, got %s", tt.expectNext, next)
+		})
+	}
+}
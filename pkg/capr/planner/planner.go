@@ -11,6 +11,7 @@
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/moby/locker"
@@ -35,6 +36,7 @@
 	apierror "k8s.io/apimachinery/pkg/api/errors"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	authorizationv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
 	"k8s.io/client-go/util/retry"
 	capi "sigs.k8s.io/cluster-api/api/v1beta1"
 	capiannotations "sigs.k8s.io/cluster-api/util/annotations"
@@ -122,8 +124,10 @@ type Planner struct {
 	capiClusters                  capicontrollers.ClusterCache
 	managementClusters            mgmtcontrollers.ClusterCache
 	rancherClusterCache           ranchercontrollers.ClusterCache
+	subjectAccessReviews          authorizationv1.SubjectAccessReviewInterface
 	locker                        locker.Locker
 	etcdS3Args                    s3Args
+	downstreamClients             *downstreamClients
 	retrievalFunctions            InfoFunctions
 }
 
@@ -136,10 +140,14 @@ type InfoFunctions struct {
 	SystemPodLabelSelectors func(plane *rkev1.RKEControlPlane) []string
 }
 
-func New(ctx context.Context, clients *wrangler.Context, functions InfoFunctions) *Planner {
+// RegisterIndexers registers the indexers used by the planner. It must be called once before planners are created.
+func RegisterIndexers(clients *wrangler.Context) {
 	clients.Mgmt.ClusterRegistrationToken().Cache().AddIndexer(clusterRegToken, func(obj *v3.ClusterRegistrationToken) ([]string, error) {
 		return []string{obj.Spec.ClusterName}, nil
 	})
+}
+
+func New(ctx context.Context, clients *wrangler.Context, functions InfoFunctions) *Planner {
 	store := NewStore(clients.Core.Secret(),
 		clients.CAPI.Machine().Cache())
 	return &Planner{
@@ -155,6 +163,7 @@ func New(ctx context.Context, clients *wrangler.Context, functions InfoFunctions
 		capiClusters:                  clients.CAPI.Cluster().Cache(),
 		managementClusters:            clients.Mgmt.Cluster().Cache(),
 		rancherClusterCache:           clients.Provisioning.Cluster().Cache(),
+		subjectAccessReviews:          clients.K8s.AuthorizationV1().SubjectAccessReviews(),
 		rkeControlPlanes:              clients.RKE.RKEControlPlane(),
 		rkeBootstrap:                  clients.RKE.RKEBootstrap(),
 		rkeBootstrapCache:             clients.RKE.RKEBootstrap().Cache(),
@@ -162,6 +171,7 @@ func New(ctx context.Context, clients *wrangler.Context, functions InfoFunctions
 		etcdS3Args: s3Args{
 			secretCache: clients.Core.Secret().Cache(),
 		},
+		downstreamClients:  &downstreamClients{},
 		retrievalFunctions: functions,
 	}
 }
@@ -319,10 +329,18 @@ func (p *Planner) Process(cp *rkev1.RKEControlPlane, status rkev1.RKEControlPlan
 		}
 	}
 
+	if status, err = p.autoRotateCertificates(cp, status, plan, time.Now()); err != nil {
+		return status, err
+	}
+
 	if status, err = p.rotateCertificates(cp, status, clusterSecretTokens, plan); err != nil {
 		return status, err
 	}
 
+	if status, err = p.scheduleEncryptionKeyRotation(cp, status, plan, releaseData, time.Now()); err != nil {
+		return status, err
+	}
+
 	if status, err = p.rotateEncryptionKeys(cp, status, clusterSecretTokens, plan, releaseData); err != nil {
 		return status, err
 	}
@@ -356,6 +374,7 @@ func (p *Planner) fullReconcile(cp *rkev1.RKEControlPlane, status rkev1.RKEContr
 		firstIgnoreError                             error
 		controlPlaneDrainOptions, workerDrainOptions rkev1.DrainOptions
 		controlPlaneConcurrency, workerConcurrency   string
+		maintenanceWindow                            *rkev1.MaintenanceWindow
 	)
 
 	if !ignoreDrainAndConcurrency {
@@ -363,12 +382,13 @@ func (p *Planner) fullReconcile(cp *rkev1.RKEControlPlane, status rkev1.RKEContr
 		workerDrainOptions = cp.Spec.UpgradeStrategy.WorkerDrainOptions
 		controlPlaneConcurrency = cp.Spec.UpgradeStrategy.ControlPlaneConcurrency
 		workerConcurrency = cp.Spec.UpgradeStrategy.WorkerConcurrency
+		maintenanceWindow = cp.Spec.UpgradeStrategy.MaintenanceWindow
 	}
 
 	// select all etcd and then filter to just initNodes so that unavailable count is correct
 	err = p.reconcile(cp, clusterSecretTokens, plan, true, bootstrapTier, isEtcd, isNotInitNodeOrIsDeleting,
 		"1", "",
-		controlPlaneDrainOptions)
+		controlPlaneDrainOptions, maintenanceWindow, "")
 	capr.Bootstrapped.True(&status)
 	firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
 	if err != nil {
@@ -389,7 +409,7 @@ func (p *Planner) fullReconcile(cp *rkev1.RKEControlPlane, status rkev1.RKEContr
 	// Process all nodes that have the etcd role and are NOT an init node or deleting. Only process 1 node at a time.
 	err = p.reconcile(cp, clusterSecretTokens, plan, true, etcdTier, isEtcd, isInitNodeOrDeleting,
 		"1", joinServer,
-		controlPlaneDrainOptions)
+		controlPlaneDrainOptions, maintenanceWindow, "")
 	firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
 	if err != nil {
 		return status, err
@@ -398,7 +418,7 @@ func (p *Planner) fullReconcile(cp *rkev1.RKEControlPlane, status rkev1.RKEContr
 	// Process all nodes that have the controlplane role and are NOT an init node or deleting.
 	err = p.reconcile(cp, clusterSecretTokens, plan, true, controlPlaneTier, isControlPlane, isInitNodeOrDeleting,
 		controlPlaneConcurrency, joinServer,
-		controlPlaneDrainOptions)
+		controlPlaneDrainOptions, maintenanceWindow, "")
 	firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
 	if err != nil {
 		return status, err
@@ -415,15 +435,49 @@ func (p *Planner) fullReconcile(cp *rkev1.RKEControlPlane, status rkev1.RKEContr
 		return status, errWaiting("marking control plane as initialized and ready")
 	}
 
+	workers := roleFilter(isOnlyWorker)
+	var canaryErr error
+	var canaryHoldMessage string
+	if canary := cp.Spec.UpgradeStrategy.WorkerCanary; canary != nil && !ignoreDrainAndConcurrency {
+		isCanary, err := canaryFilter(canary)
+		if err != nil {
+			return status, err
+		}
+
+		// Process the canary worker nodes first. The other worker nodes are processed while the canary nodes are
+		// upgraded, but their major plan changes are held until the canary health gates pass.
+		err = p.reconcile(cp, clusterSecretTokens, plan, false, workerCanaryTier, isCanary, isInitNodeOrDeleting,
+			workerConcurrency, "",
+			workerDrainOptions, maintenanceWindow, "")
+		firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
+		if err != nil && !IsErrWaiting(err) {
+			return status, err
+		}
+		canaryErr = err
+
+		status, canaryHoldMessage, err = p.workerCanaryGates(cp, status, plan, canary, isCanary, canaryErr != nil, time.Now())
+		if err != nil {
+			return status, err
+		}
+		workers = roleAnd(isOnlyWorker, roleNot(isCanary))
+	} else {
+		status.WorkerCanary = nil
+		capr.WorkerCanaryHealthy.SetStatus(&status, "")
+	}
+
 	// Process all nodes that are ONLY worker nodes.
-	err = p.reconcile(cp, clusterSecretTokens, plan, false, workerTier, isOnlyWorker, isInitNodeOrDeleting,
+	err = p.reconcile(cp, clusterSecretTokens, plan, false, workerTier, workers, isInitNodeOrDeleting,
 		workerConcurrency, "",
-		workerDrainOptions)
+		workerDrainOptions, maintenanceWindow, canaryHoldMessage)
 	firstIgnoreError, err = ignoreErrors(firstIgnoreError, err)
 	if err != nil {
 		return status, err
 	}
 
+	if canaryErr != nil {
+		return status, canaryErr
+	}
+
 	if firstIgnoreError != nil {
 		return status, errWaiting(firstIgnoreError.Error())
 	}
@@ -880,10 +934,11 @@ type reconcilable struct {
 }
 
 func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, tokensSecret plan.Secret, clusterPlan *plan.Plan, required bool,
-	tierName string, include, exclude roleFilter, maxUnavailable string, forcedJoinURL string, drainOptions rkev1.DrainOptions) error {
+	tierName string, include, exclude roleFilter, maxUnavailable string, forcedJoinURL string, drainOptions rkev1.DrainOptions,
+	maintenanceWindow *rkev1.MaintenanceWindow, holdMessage string) error {
 	var (
-		ready, outOfSync, nonReady, errMachines, draining, uncordoned []string
-		messages                                                      = map[string][]string{}
+		ready, outOfSync, nonReady, errMachines, draining, uncordoned, held []string
+		messages                                                            = map[string][]string{}
 	)
 
 	entries := collect(clusterPlan, include)
@@ -919,6 +974,12 @@ func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, tokensSecret pl
 		return err
 	}
 
+	now := time.Now()
+	windowOpen, nextWindow, err := maintenanceWindowOpen(maintenanceWindow, now)
+	if err != nil {
+		return err
+	}
+
 	for _, r := range reconcilables {
 		logrus.Tracef("[planner] rkecluster %s/%s reconcile tier %s - processing machine entry: %s/%s", controlPlane.Namespace, controlPlane.Name, tierName, r.entry.Machine.Namespace, r.entry.Machine.Name)
 		// we exclude here and not in collect to ensure that include matched at least one node
@@ -967,7 +1028,17 @@ func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, tokensSecret pl
 			// 4. unavailable < concurrency meaning we have capacity to make something unavailable
 			// 5. If the plan was successful in application but the probes never went healthy
 			logrus.Debugf("[planner] rkecluster %s/%s reconcile tier %s - concurrency: %d, unavailable: %d", controlPlane.Namespace, controlPlane.Name, tierName, concurrency, unavailable)
-			if isInDrain(r.entry) || r.entry.Plan.Failed || concurrency == 0 || unavailable < concurrency || planAppliedButProbesNeverHealthy(r.entry) {
+			if !windowOpen && !isInDrain(r.entry) {
+				// Disruptive changes are held until a maintenance window opens. Nodes that are already draining are
+				// finished so that they are not left cordoned while the window is closed.
+				logrus.Debugf("[planner] rkecluster %s/%s reconcile tier %s - holding major plan change for machine %s/%s until maintenance window opens at %s", controlPlane.Namespace, controlPlane.Name, tierName, r.entry.Machine.Namespace, r.entry.Machine.Name, nextWindow)
+				held = append(held, r.entry.Machine.Name)
+				messages[r.entry.Machine.Name] = append(messages[r.entry.Machine.Name], maintenanceWindowMessage(nextWindow))
+			} else if holdMessage != "" && !isInDrain(r.entry) {
+				// Disruptive changes are held while the canary health gates have not passed.
+				logrus.Debugf("[planner] rkecluster %s/%s reconcile tier %s - holding major plan change for machine %s/%s: %s", controlPlane.Namespace, controlPlane.Name, tierName, r.entry.Machine.Namespace, r.entry.Machine.Name, holdMessage)
+				messages[r.entry.Machine.Name] = append(messages[r.entry.Machine.Name], holdMessage)
+			} else if isInDrain(r.entry) || r.entry.Plan.Failed || concurrency == 0 || unavailable < concurrency || planAppliedButProbesNeverHealthy(r.entry) {
 				if !isUnavailable(r) {
 					unavailable++
 				}
@@ -1026,6 +1097,11 @@ func (p *Planner) reconcile(controlPlane *rkev1.RKEControlPlane, tokensSecret pl
 		return errWaiting("waiting for at least one " + tierName + " node")
 	}
 
+	if len(held) > 0 && !nextWindow.IsZero() {
+		// The planner is not re-enqueued while waiting, so it is enqueued for when the next window opens.
+		p.rkeControlPlanes.EnqueueAfter(controlPlane.Namespace, controlPlane.Name, nextWindow.Sub(now))
+	}
+
 	// If multiple machines are changing status, then all of their statuses should be updated to avoid having stale conditions.
 	// However, only the first one will be returned so that status goes on the control plane and cluster objects.
 	var firstError error
@@ -1115,7 +1191,10 @@ func (p *Planner) desiredPlan(controlPlane *rkev1.RKEControlPlane, tokensSecret
 	if err != nil {
 		return nodePlan, joinedTo, err
 	}
-	nodePlan.Probes = probes
+	nodePlan.Probes, err = addCanaryProbes(controlPlane, entry, probes)
+	if err != nil {
+		return nodePlan, joinedTo, err
+	}
 
 	// Add instruction last because it hashes config content
 	nodePlan, err = p.addInstallInstructionWithRestartStamp(nodePlan, controlPlane, entry)
@@ -1123,6 +1202,13 @@ func (p *Planner) desiredPlan(controlPlane *rkev1.RKEControlPlane, tokensSecret
 		return nodePlan, joinedTo, err
 	}
 
+	if controlPlane.Spec.CertificateAutoRotation != nil {
+		nodePlan, err = p.addCertificateExpirationPeriodicInstruction(nodePlan, controlPlane)
+		if err != nil {
+			return nodePlan, joinedTo, err
+		}
+	}
+
 	if isInitNode(entry) && IsOnlyEtcd(entry) {
 		// If the annotation to disable autosetting the join URL is enabled, don't deliver a plan to add the periodic instruction to scrape init node.
 		if _, autosetDisabled := entry.Metadata.Annotations[capr.JoinURLAutosetDisabled]; !autosetDisabled {
@@ -1138,12 +1224,35 @@ func (p *Planner) desiredPlan(controlPlane *rkev1.RKEControlPlane, tokensSecret
 		if err != nil {
 			return nodePlan, joinedTo, err
 		}
-		if controlPlane != nil && controlPlane.Spec.ETCD != nil && S3Enabled(controlPlane.Spec.ETCD.S3) && isInitNode(entry) {
+		if controlPlane != nil && controlPlane.Spec.ETCD != nil && S3EncryptionEnabled(controlPlane.Spec.ETCD.S3) {
+			nodePlan, err = p.addEtcdSnapshotUploadEncryptedPeriodicInstruction(nodePlan, controlPlane)
+			if err != nil {
+				return nodePlan, joinedTo, err
+			}
+		} else if controlPlane != nil && controlPlane.Spec.ETCD != nil && S3Enabled(controlPlane.Spec.ETCD.S3) && isInitNode(entry) {
 			nodePlan, err = p.addEtcdSnapshotListS3PeriodicInstruction(nodePlan, controlPlane)
 			if err != nil {
 				return nodePlan, joinedTo, err
 			}
 		}
+		if controlPlane != nil && controlPlane.Spec.ETCD != nil && len(controlPlane.Spec.ETCD.S3Targets) > 0 {
+			nodePlan, err = p.addEtcdSnapshotS3TargetPeriodicInstructions(nodePlan, controlPlane)
+			if err != nil {
+				return nodePlan, joinedTo, err
+			}
+		}
+		if controlPlane != nil && controlPlane.Spec.ETCD != nil && controlPlane.Spec.ETCD.SnapshotVerification != nil {
+			nodePlan, err = p.addEtcdSnapshotVerificationPeriodicInstruction(nodePlan, controlPlane, entry)
+			if err != nil {
+				return nodePlan, joinedTo, err
+			}
+		}
+		if controlPlane != nil && controlPlane.Spec.ETCD != nil && controlPlane.Spec.ETCD.SnapshotRetentionPolicy != nil {
+			nodePlan, err = p.addEtcdSnapshotRetentionPeriodicInstruction(nodePlan, controlPlane, entry)
+			if err != nil {
+				return nodePlan, joinedTo, err
+			}
+		}
 	}
 	return nodePlan, joinedTo, nil
 }
@@ -1168,10 +1277,17 @@ func (p *Planner) ensureRKEStateSecret(controlPlane *rkev1.RKEControlPlane, newC
 		if !newCluster {
 			return "", plan.Secret{}, fmt.Errorf("newCluster was false and secret does not exist: %w", err)
 		}
-		serverToken, err := randomtoken.Generate()
+		// A new cluster restoring the etcd snapshot of another cluster must use the server token of that cluster.
+		serverToken, err := p.etcdSnapshotCloneServerToken(controlPlane)
 		if err != nil {
 			return "", plan.Secret{}, err
 		}
+		if serverToken == "" {
+			serverToken, err = randomtoken.Generate()
+			if err != nil {
+				return "", plan.Secret{}, err
+			}
+		}
 
 		agentToken, err := randomtoken.Generate()
 		if err != nil {
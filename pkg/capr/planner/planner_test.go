@@ -20,6 +20,7 @@
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
 	capi "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
@@ -39,6 +40,7 @@ type mockPlanner struct {
 	capiClusters                  *fake.MockCacheInterface[*capi.Cluster]
 	managementClusters            *fake.MockNonNamespacedCacheInterface[*apisv3.Cluster]
 	rancherClusterCache           *fake.MockCacheInterface[*apisv1.Cluster]
+	clientset                     *k8sfake.Clientset
 }
 
 // newMockPlanner creates a new mockPlanner that can be used for simulating a functional Planner.
@@ -59,6 +61,7 @@ func newMockPlanner(t *testing.T, functions InfoFunctions) *mockPlanner {
 		capiClusters:                  fake.NewMockCacheInterface[*capi.Cluster](ctrl),
 		managementClusters:            fake.NewMockNonNamespacedCacheInterface[*apisv3.Cluster](ctrl),
 		rancherClusterCache:           fake.NewMockCacheInterface[*apisv1.Cluster](ctrl),
+		clientset:                     k8sfake.NewSimpleClientset(),
 	}
 	store := PlanStore{
 		secrets:      mp.secretClient,
@@ -78,6 +81,7 @@ func newMockPlanner(t *testing.T, functions InfoFunctions) *mockPlanner {
 		capiClusters:                  mp.capiClusters,
 		managementClusters:            mp.managementClusters,
 		rancherClusterCache:           mp.rancherClusterCache,
+		subjectAccessReviews:          mp.clientset.AuthorizationV1().SubjectAccessReviews(),
 		rkeControlPlanes:              mp.rkeControlPlanes,
 		rkeBootstrap:                  mp.rkeBootstrap,
 		rkeBootstrapCache:             mp.rkeBootstrapCache,
@@ -85,6 +89,7 @@ func newMockPlanner(t *testing.T, functions InfoFunctions) *mockPlanner {
 		etcdS3Args: s3Args{
 			secretCache: mp.secretCache,
 		},
+		downstreamClients:  &downstreamClients{},
 		retrievalFunctions: functions,
 	}
 	mp.planner = &p
@@ -0,0 +1,253 @@
+package planner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/rancher/rancher/pkg/capr"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// PlanChange is the kind of change the planner would make to the plan of a machine.
+type PlanChange string
+
+const (
+	// PlanChangeNone means the plan of the machine would not change.
+	PlanChangeNone PlanChange = "none"
+	// PlanChangeInitial means the machine has no plan yet and would receive its first one.
+	PlanChangeInitial PlanChange = "initial"
+	// PlanChangeMinor means only files that can be changed without restarting or draining the node would change.
+	PlanChangeMinor PlanChange = "minor"
+	// PlanChangeMajor means the plan would change in a way that is subject to concurrency, drain options and
+	// maintenance windows.
+	PlanChangeMajor PlanChange = "major"
+)
+
+const (
+	changeAdded    = "added"
+	changeRemoved  = "removed"
+	changeModified = "modified"
+)
+
+// MachinePlanPreview describes how the plan of a machine would change.
+type MachinePlanPreview struct {
+	Machine string     `json:"machine"`
+	Node    string     `json:"node,omitempty"`
+	Change  PlanChange `json:"change"`
+	// Restart is true if the engine would be restarted on the node.
+	Restart bool `json:"restart,omitempty"`
+	// Drain is true if the node would be drained before the plan is applied.
+	Drain        bool                `json:"drain,omitempty"`
+	Files        []FileChange        `json:"files,omitempty"`
+	Instructions []InstructionChange `json:"instructions,omitempty"`
+	// Error is the error rendering the plan of the machine failed with.
+	Error string `json:"error,omitempty"`
+}
+
+// FileChange describes a file that would be added, removed or modified on a machine.
+type FileChange struct {
+	Path   string `json:"path"`
+	Change string `json:"change"`
+	Minor  bool   `json:"minor,omitempty"`
+	// Keys are the keys that would change in a JSON config file. Values are left out as they may hold secrets.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// InstructionChange describes a one time instruction that would be added, removed or modified on a machine.
+type InstructionChange struct {
+	Name   string `json:"name"`
+	Change string `json:"change"`
+}
+
+// Preview renders the plans the planner would deliver to the machines of the cluster if its controlplane had the spec
+// of the given controlplane and returns how they differ from the current plans. Nothing is written, notably no plan
+// secrets, so the controlplane does not have to exist with the given spec.
+func (p *Planner) Preview(cp *rkev1.RKEControlPlane) ([]MachinePlanPreview, error) {
+	if cp.Spec.UnmanagedConfig {
+		return nil, fmt.Errorf("rkecluster %s/%s: plans of clusters with unmanaged config are not rendered", cp.Namespace, cp.Name)
+	}
+
+	if releaseData := p.retrievalFunctions.ReleaseData(p.ctx, cp); releaseData == nil {
+		return nil, fmt.Errorf("rkecluster %s/%s: release data not found for version %s", cp.Namespace, cp.Name, cp.Spec.KubernetesVersion)
+	}
+
+	capiCluster, err := capr.GetOwnerCAPICluster(cp, p.capiClusters)
+	if err != nil {
+		return nil, err
+	} else if capiCluster == nil {
+		return nil, fmt.Errorf("rkecluster %s/%s: CAPI cluster does not exist", cp.Namespace, cp.Name)
+	}
+
+	clusterPlan, _, err := p.store.load(capiCluster, cp, false)
+	if err != nil {
+		return nil, err
+	}
+
+	_, tokensSecret, err := p.ensureRKEStateSecret(cp, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// The join server of the etcd and control plane nodes is the join URL of the current init node.
+	var joinServer string
+	for _, entry := range collect(clusterPlan, isInitNode) {
+		joinServer = entry.Metadata.Annotations[capr.JoinURLAnnotation]
+	}
+
+	var previews []MachinePlanPreview
+	for _, entry := range collect(clusterPlan, isNotDeleting) {
+		drainOptions := cp.Spec.UpgradeStrategy.ControlPlaneDrainOptions
+		joinURL := joinServer
+		if isInitNode(entry) {
+			joinURL = ""
+		} else if isOnlyWorker(entry) {
+			drainOptions = cp.Spec.UpgradeStrategy.WorkerDrainOptions
+			if joinURL, err = determineJoinURL(cp, entry, clusterPlan, ""); err != nil {
+				previews = append(previews, MachinePlanPreview{Machine: entry.Machine.Name, Error: err.Error()})
+				continue
+			}
+		}
+
+		desiredPlan, _, err := p.desiredPlan(cp, tokensSecret, entry, joinURL)
+		if err != nil {
+			previews = append(previews, MachinePlanPreview{Machine: entry.Machine.Name, Error: err.Error()})
+			continue
+		}
+		previews = append(previews, previewPlan(entry, desiredPlan, drainOptions, len(clusterPlan.Machines) == 1))
+	}
+	return previews, nil
+}
+
+// previewPlan compares the current plan of entry with the desired plan. The drain decision mirrors the one of drain,
+// single node clusters are never drained.
+func previewPlan(entry *planEntry, desiredPlan plan.NodePlan, drainOptions rkev1.DrainOptions, singleNode bool) MachinePlanPreview {
+	preview := MachinePlanPreview{
+		Machine: entry.Machine.Name,
+	}
+	if entry.Machine.Status.NodeRef != nil {
+		preview.Node = entry.Machine.Status.NodeRef.Name
+	}
+
+	var currentPlan plan.NodePlan
+	switch {
+	case entry.Plan == nil:
+		preview.Change = PlanChangeInitial
+	case equality.Semantic.DeepEqual(entry.Plan.Plan, desiredPlan):
+		preview.Change = PlanChangeNone
+	case minorPlanChangeDetected(entry.Plan.Plan, desiredPlan):
+		preview.Change = PlanChangeMinor
+	default:
+		preview.Change = PlanChangeMajor
+	}
+	if entry.Plan != nil {
+		currentPlan = entry.Plan.Plan
+	}
+
+	if preview.Change == PlanChangeMajor {
+		preview.Restart = shouldDrain(entry.Plan.AppliedPlan, desiredPlan)
+		preview.Drain = preview.Restart && drainOptions.Enabled && !singleNode && entry.Machine.Status.NodeRef != nil
+	}
+	preview.Files = diffFiles(currentPlan.Files, desiredPlan.Files)
+	preview.Instructions = diffInstructions(currentPlan.Instructions, desiredPlan.Instructions)
+	return preview
+}
+
+// diffFiles returns the changes between the current and desired files, sorted by path.
+func diffFiles(current, desired []plan.File) []FileChange {
+	currentFiles := map[string]plan.File{}
+	for _, file := range current {
+		currentFiles[file.Path] = file
+	}
+
+	var changes []FileChange
+	for _, file := range desired {
+		currentFile, ok := currentFiles[file.Path]
+		delete(currentFiles, file.Path)
+		if !ok {
+			changes = append(changes, FileChange{Path: file.Path, Change: changeAdded, Minor: file.Minor})
+		} else if currentFile != file {
+			changes = append(changes, FileChange{
+				Path:   file.Path,
+				Change: changeModified,
+				Minor:  file.Minor && currentFile.Minor,
+				Keys:   changedConfigKeys(currentFile.Content, file.Content),
+			})
+		}
+	}
+	for _, file := range currentFiles {
+		changes = append(changes, FileChange{Path: file.Path, Change: changeRemoved, Minor: file.Minor})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// changedConfigKeys returns the sorted keys that differ between two base64 encoded JSON objects. Nil is returned if
+// either of them is not a JSON object.
+func changedConfigKeys(current, desired string) []string {
+	currentConfig, ok := decodeConfig(current)
+	if !ok {
+		return nil
+	}
+	desiredConfig, ok := decodeConfig(desired)
+	if !ok {
+		return nil
+	}
+
+	var keys []string
+	for k, v := range desiredConfig {
+		if currentValue, ok := currentConfig[k]; !ok || !equality.Semantic.DeepEqual(currentValue, v) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range currentConfig {
+		if _, ok := desiredConfig[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func decodeConfig(content string) (map[string]interface{}, bool) {
+	data, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, false
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, false
+	}
+	return config, true
+}
+
+// diffInstructions returns the changes between the current and desired one time instructions, in the order they run.
+func diffInstructions(current, desired []plan.OneTimeInstruction) []InstructionChange {
+	currentInstructions := map[string]plan.OneTimeInstruction{}
+	for _, instruction := range current {
+		currentInstructions[instruction.Name] = instruction
+	}
+
+	var changes []InstructionChange
+	for _, instruction := range desired {
+		currentInstruction, ok := currentInstructions[instruction.Name]
+		delete(currentInstructions, instruction.Name)
+		if !ok {
+			changes = append(changes, InstructionChange{Name: instruction.Name, Change: changeAdded})
+		} else if !equality.Semantic.DeepEqual(currentInstruction, instruction) {
+			changes = append(changes, InstructionChange{Name: instruction.Name, Change: changeModified})
+		}
+	}
+	for _, instruction := range current {
+		if _, ok := currentInstructions[instruction.Name]; ok {
+			changes = append(changes, InstructionChange{Name: instruction.Name, Change: changeRemoved})
+		}
+	}
+	return changes
+}
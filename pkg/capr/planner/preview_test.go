@@ -0,0 +1,99 @@
+package planner
+
+import (
+	"encoding/base64"
+	"testing"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1/plan"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capi "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+func TestPreviewPlan(t *testing.T) {
+	config := func(data string) string {
+		return base64.StdEncoding.EncodeToString([]byte(data))
+	}
+	install := func(stamp string) plan.OneTimeInstruction {
+		return plan.OneTimeInstruction{Name: "install", Env: []string{"RESTART_STAMP=" + stamp}}
+	}
+	currentPlan := plan.NodePlan{
+		Files: []plan.File{
+			{Path: "/etc/rancher/rke2/config.yaml.d/50-rancher.yaml", Content: config(`{"token":"abc","cni":"calico","node-label":["a=b"]}`)},
+			{Path: "/var/lib/rancher/rke2/server/manifests/rancher/addons.yaml", Content: config("addons"), Minor: true},
+			{Path: "/etc/old", Content: config("old")},
+		},
+		Instructions: []plan.OneTimeInstruction{install("1")},
+	}
+	entry := func(p *plan.NodePlan) *planEntry {
+		e := &planEntry{
+			Machine: &capi.Machine{
+				ObjectMeta: metav1.ObjectMeta{Name: "machine-1"},
+				Status:     capi.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "node-1"}},
+			},
+		}
+		if p != nil {
+			e.Plan = &plan.Node{Plan: *p, AppliedPlan: p}
+		}
+		return e
+	}
+	drainEnabled := rkev1.DrainOptions{Enabled: true}
+
+	preview := previewPlan(entry(nil), currentPlan, drainEnabled, false)
+	assert.Equal(t, PlanChangeInitial, preview.Change)
+	assert.Equal(t, "node-1", preview.Node)
+	assert.False(t, preview.Drain, "machines without a plan are not drained")
+	assert.Len(t, preview.Files, 3)
+
+	preview = previewPlan(entry(&currentPlan), currentPlan, drainEnabled, false)
+	assert.Equal(t, PlanChangeNone, preview.Change)
+	assert.Empty(t, preview.Files)
+	assert.Empty(t, preview.Instructions)
+
+	minorPlan := currentPlan
+	minorPlan.Files = append([]plan.File{}, currentPlan.Files...)
+	minorPlan.Files[1] = plan.File{Path: minorPlan.Files[1].Path, Content: config("new addons"), Minor: true}
+	preview = previewPlan(entry(&currentPlan), minorPlan, drainEnabled, false)
+	assert.Equal(t, PlanChangeMinor, preview.Change)
+	assert.Equal(t, []FileChange{{Path: minorPlan.Files[1].Path, Change: changeModified, Minor: true}}, preview.Files)
+	assert.False(t, preview.Restart)
+
+	majorPlan := plan.NodePlan{
+		Files: []plan.File{
+			{Path: "/etc/rancher/rke2/config.yaml.d/50-rancher.yaml", Content: config(`{"token":"abc","cni":"cilium","node-label":["a=b"],"profile":"cis"}`)},
+			currentPlan.Files[1],
+			{Path: "/etc/new", Content: config("new")},
+		},
+		Instructions: []plan.OneTimeInstruction{install("2")},
+	}
+	preview = previewPlan(entry(&currentPlan), majorPlan, drainEnabled, false)
+	assert.Equal(t, PlanChangeMajor, preview.Change)
+	assert.True(t, preview.Restart)
+	assert.True(t, preview.Drain)
+	assert.Equal(t, []FileChange{
+		{Path: "/etc/new", Change: changeAdded},
+		{Path: "/etc/old", Change: changeRemoved},
+		{Path: "/etc/rancher/rke2/config.yaml.d/50-rancher.yaml", Change: changeModified, Keys: []string{"cni", "profile"}},
+	}, preview.Files)
+	assert.Equal(t, []InstructionChange{{Name: "install", Change: changeModified}}, preview.Instructions)
+
+	preview = previewPlan(entry(&currentPlan), majorPlan, rkev1.DrainOptions{}, false)
+	assert.True(t, preview.Restart)
+	assert.False(t, preview.Drain, "drain is disabled")
+
+	preview = previewPlan(entry(&currentPlan), majorPlan, drainEnabled, true)
+	assert.False(t, preview.Drain, "single node clusters are not drained")
+}
+
+func TestDiffInstructions(t *testing.T) {
+	current := []plan.OneTimeInstruction{{Name: "a"}, {Name: "b"}, {Name: "c", Args: []string{"1"}}}
+	desired := []plan.OneTimeInstruction{{Name: "c", Args: []string{"2"}}, {Name: "a"}, {Name: "d"}}
+
+	assert.Equal(t, []InstructionChange{
+		{Name: "c", Change: changeModified},
+		{Name: "d", Change: changeAdded},
+		{Name: "b", Change: changeRemoved},
+	}, diffInstructions(current, desired))
+}
@@ -108,17 +108,9 @@ func (s *s3Args) ToArgs(s3 *rkev1.ETCDSnapshotS3, controlPlane *rkev1.RKEControl
 				}
 			}
 		} else {
-			if _, err := base64.StdEncoding.DecodeString(v); err != nil {
-				// There was an error decoding the endpointCA, indicating that it needs to be encoded.
-				v = base64.StdEncoding.EncodeToString([]byte(v))
-			}
-			s3CAName := fmt.Sprintf("s3-endpoint-ca-%s.crt", name.Hex(v, 5))
-			filePath := configFile(controlPlane, s3CAName)
-			files = append(files, plan.File{
-				Content: v,
-				Path:    filePath,
-			})
-			args = append(args, fmt.Sprintf("--%ss3-endpoint-ca=%s", prefix, filePath))
+			caFile := endpointCAFile(controlPlane, v)
+			files = append(files, caFile)
+			args = append(args, fmt.Sprintf("--%ss3-endpoint-ca=%s", prefix, caFile.Path))
 		}
 	}
 
@@ -130,6 +122,19 @@ func (s *s3Args) ToArgs(s3 *rkev1.ETCDSnapshotS3, controlPlane *rkev1.RKEControl
 	return
 }
 
+// endpointCAFile renders the file holding the given S3 endpoint CA, which may or may not be base64 encoded.
+func endpointCAFile(controlPlane *rkev1.RKEControlPlane, endpointCA string) plan.File {
+	if _, err := base64.StdEncoding.DecodeString(endpointCA); err != nil {
+		// There was an error decoding the endpointCA, indicating that it needs to be encoded.
+		endpointCA = base64.StdEncoding.EncodeToString([]byte(endpointCA))
+	}
+	s3CAName := fmt.Sprintf("s3-endpoint-ca-%s.crt", name.Hex(endpointCA, 5))
+	return plan.File{
+		Content: endpointCA,
+		Path:    configFile(controlPlane, s3CAName),
+	}
+}
+
 func generateEndpointCAFileIfPathMatches(controlPlane *rkev1.RKEControlPlane, existingEndpointCAPath, endpointCA string) *plan.File {
 	s3CAName := fmt.Sprintf("s3-endpoint-ca-%s.crt", name.Hex(endpointCA, 5))
 	filePath := configFile(controlPlane, s3CAName)
@@ -66,6 +66,12 @@ func onlyRKE(machines []*capi.Machine) (result []*capi.Machine) {
 // generates a new plan.Plan, a bool that indicates whether any plan has been delivered to any of the machines,
 // and an error
 func (p *PlanStore) Load(cluster *capi.Cluster, rkeControlPlane *rkev1.RKEControlPlane) (*plan.Plan, bool, error) {
+	return p.load(cluster, rkeControlPlane, true)
+}
+
+// load generates the plan.Plan like Load does. If setJoinURLs is false, the join URLs of the machines are not updated
+// on their plan secrets and nothing is written.
+func (p *PlanStore) load(cluster *capi.Cluster, rkeControlPlane *rkev1.RKEControlPlane, setJoinURLs bool) (*plan.Plan, bool, error) {
 	result := &plan.Plan{
 		Nodes:    map[string]*plan.Node{},
 		Machines: map[string]*capi.Machine{},
@@ -114,8 +120,10 @@ func (p *PlanStore) Load(cluster *capi.Cluster, rkeControlPlane *rkev1.RKEContro
 		if node.PlanDataExists {
 			anyPlanDelivered = true
 		}
-		if err := p.setMachineJoinURL(&planEntry{Machine: result.Machines[machineName], Metadata: result.Metadata[machineName], Plan: node}, cluster, rkeControlPlane); err != nil {
-			return nil, anyPlanDelivered, err
+		if setJoinURLs {
+			if err := p.setMachineJoinURL(&planEntry{Machine: result.Machines[machineName], Metadata: result.Metadata[machineName], Plan: node}, cluster, rkeControlPlane); err != nil {
+				return nil, anyPlanDelivered, err
+			}
 		}
 		result.Nodes[machineName] = node
 	}
@@ -0,0 +1,54 @@
+package chart
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+// Verify checks that the provenance file of a chart archive is signed by a key of the keyring and that it matches the
+// archive. The filename is the name of the archive the provenance file was created for. It returns the identity of the
+// key the chart is signed with.
+func Verify(keyring []byte, filename string, archive, prov []byte) (string, error) {
+	dir, err := os.MkdirTemp("", "chart-verify-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		keyringPath = filepath.Join(dir, "keyring")
+		chartPath   = filepath.Join(dir, filepath.Base(filename))
+		provPath    = chartPath + ".prov"
+	)
+	for path, data := range map[string][]byte{
+		keyringPath: keyring,
+		chartPath:   archive,
+		provPath:    prov,
+	} {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return "", err
+		}
+	}
+
+	signatory, err := provenance.NewFromKeyring(keyringPath, "")
+	if err != nil {
+		return "", err
+	}
+	verification, err := signatory.Verify(chartPath, provPath)
+	if err != nil {
+		return "", err
+	}
+
+	var identities []string
+	for identity := range verification.SignedBy.Identities {
+		identities = append(identities, identity)
+	}
+	sort.Strings(identities)
+	if len(identities) == 0 {
+		return verification.SignedBy.PrimaryKey.KeyIdString(), nil
+	}
+	return identities[0], nil
+}
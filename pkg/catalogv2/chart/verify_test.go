@@ -0,0 +1,34 @@
+package chart
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	keyring, err := os.ReadFile("testdata/helm-test-key.pub")
+	require.NoError(t, err)
+	archive, err := os.ReadFile("testdata/hashtest-1.2.3.tgz")
+	require.NoError(t, err)
+	prov, err := os.ReadFile("testdata/hashtest-1.2.3.tgz.prov")
+	require.NoError(t, err)
+
+	signer, err := Verify(keyring, "hashtest-1.2.3.tgz", archive, prov)
+	require.NoError(t, err)
+	assert.Equal(t, "Helm Testing (This key should only be used for testing. DO NOT TRUST.) <helm-testing@helm.sh>", signer)
+
+	// the provenance file is only valid for the archive it was created for
+	_, err = Verify(keyring, "hashtest-1.2.4.tgz", archive, prov)
+	assert.Error(t, err)
+
+	tampered := append([]byte{}, archive...)
+	tampered[len(tampered)-1]++
+	_, err = Verify(keyring, "hashtest-1.2.3.tgz", tampered, prov)
+	assert.Error(t, err)
+
+	_, err = Verify(nil, "hashtest-1.2.3.tgz", archive, prov)
+	assert.Error(t, err)
+}
@@ -23,16 +23,20 @@
 	"io"
 	"io/ioutil"
 	"net/url"
+	"path"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/rancher/rancher/pkg/api/steve/catalog/types"
 	v1 "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
 	"github.com/rancher/rancher/pkg/catalogv2"
+	catalogchart "github.com/rancher/rancher/pkg/catalogv2/chart"
 	"github.com/rancher/rancher/pkg/catalogv2/git"
 	"github.com/rancher/rancher/pkg/catalogv2/helm"
 	helmhttp "github.com/rancher/rancher/pkg/catalogv2/http"
+	"github.com/rancher/rancher/pkg/catalogv2/oci"
 	catalogcontrollers "github.com/rancher/rancher/pkg/generated/controllers/catalog.cattle.io/v1"
 	"github.com/rancher/rancher/pkg/settings"
 	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
@@ -41,6 +45,7 @@
 	"helm.sh/helm/v3/pkg/repo"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
 	"k8s.io/client-go/discovery"
 )
 
@@ -57,8 +62,29 @@ type Manager struct {
 	discovery    discovery.DiscoveryInterface        // An interface to the Kubernetes Discovery API. Provides information about the Kubernetes API server.
 	IndexCache   map[string]indexCache               // cache for Helm repository index files. Used to store and retrieve index files for faster access.
 	lock         sync.RWMutex                        // read-write mutex used to ensure that some Manager's operations are thread-safe.
+
+	verifications *cache.LRUExpireCache // results of the provenance verification of chart versions, keyed by verificationKey.
 }
 
+const (
+	// VerificationAnnotation is set on the chart versions of the index of repos that verify the provenance of their
+	// charts. Chart versions are verified when they are installed or upgraded to.
+	VerificationAnnotation = "catalog.cattle.io/verification"
+	// VerificationVerified is the verification status of a chart version signed by a key of the keyring of its repo.
+	VerificationVerified = "verified"
+	// VerificationFailed is the verification status of a chart version without a valid provenance file.
+	VerificationFailed = "failed"
+	// VerificationUnverified is the verification status of a chart version that was not verified yet.
+	VerificationUnverified = "unverified"
+
+	// verificationCacheSize is the number of verification results kept by a Manager, the least recently used results
+	// are evicted first.
+	verificationCacheSize = 10000
+	// verificationCacheTTL is the duration a verification result is kept for, the chart version is unverified again
+	// until it is installed or upgraded to afterwards.
+	verificationCacheTTL = 24 * time.Hour
+)
+
 // indexCache - used to cache helm chart indexes
 type indexCache struct {
 	index    *repo.IndexFile // Pointer to the helm chart index
@@ -85,6 +111,8 @@ func NewManager(
 		secrets:      secrets,
 		clusterRepos: clusterRepos,
 		IndexCache:   map[string]indexCache{},
+
+		verifications: cache.NewLRUExpireCache(verificationCacheSize),
 	}
 }
 
@@ -114,7 +142,7 @@ func (c *Manager) Index(namespace, name string, skipFilter bool) (*repo.IndexFil
 	if cache, ok := c.IndexCache[fmt.Sprintf("%s/%s", r.status.IndexConfigMapNamespace, r.status.IndexConfigMapName)]; ok {
 		if cm.ResourceVersion == cache.revision {
 			c.lock.RUnlock()
-			return c.filterReleases(deepCopyIndex(cache.index), k8sVersion, skipFilter), nil
+			return c.setVerification(r, c.filterReleases(deepCopyIndex(cache.index), k8sVersion, skipFilter)), nil
 		}
 	}
 	c.lock.RUnlock()
@@ -152,13 +180,13 @@ func (c *Manager) Index(namespace, name string, skipFilter bool) (*repo.IndexFil
 	}
 	c.lock.Unlock()
 
-	return c.filterReleases(deepCopyIndex(index), k8sVersion, skipFilter), nil
+	return c.setVerification(r, c.filterReleases(deepCopyIndex(index), k8sVersion, skipFilter)), nil
 }
 
 // Icon Returns an io.ReadCloser and the icon's MIME type for the chart.
 //
-// If the chart's icon is not an HTTP or HTTPS URL, retrieves the icon from the repo's Git repository.
-// Otherwise, retrieves the icon via HTTP from the chart's URL and returns it as an io.ReadCloser with the proper Secret.
+// If the chart's icon is not an HTTP or HTTPS URL, retrieves the icon from the repo's Git repository, or from the chart
+// archive if the repo is in an OCI registry. Otherwise, retrieves the icon via HTTP from the chart's URL and returns it as an io.ReadCloser with the proper Secret.
 func (c *Manager) Icon(namespace, name, chartName, version string) (io.ReadCloser, string, error) {
 	index, err := c.Index(namespace, name, true)
 	if err != nil {
@@ -184,6 +212,14 @@ func (c *Manager) Icon(namespace, name, chartName, version string) (io.ReadClose
 		return nil, "", err
 	}
 
+	if oci.IsOCI(repo.status.URL) {
+		if !isHTTP(chart.Icon) {
+			return oci.Icon(secret, repo.status.URL, repo.spec.CABundle, repo.spec.InsecureSkipTLSverify, chart)
+		}
+		// icons hosted outside of the registry are downloaded without the credentials of the repo
+		return helmhttp.Icon(nil, chart.Icon, repo.spec.CABundle, repo.spec.InsecureSkipTLSverify, false, chart)
+	}
+
 	return helmhttp.Icon(secret, repo.status.URL, repo.spec.CABundle, repo.spec.InsecureSkipTLSverify, repo.spec.DisableSameOriginCheck, chart)
 }
 
@@ -197,6 +233,7 @@ func (c *Manager) Icon(namespace, name, chartName, version string) (io.ReadClose
 //
 // If the commit status of the repository is an empty string,
 // it retrieves the secret associated with the repository
+// and pulls the chart from the OCI registry or downloads it via HTTP
 //
 // The function returns an io.ReadCloser which represents the chart content.
 func (c *Manager) Chart(namespace, name, chartName, version string, skipFilter bool) (io.ReadCloser, error) {
@@ -227,6 +264,10 @@ func (c *Manager) Chart(namespace, name, chartName, version string, skipFilter b
 		return nil, err
 	}
 
+	if oci.IsOCI(repo.status.URL) {
+		return oci.Chart(secret, repo.status.URL, repo.spec.CABundle, repo.spec.InsecureSkipTLSverify, chart)
+	}
+
 	return helmhttp.Chart(secret, repo.status.URL, repo.spec.CABundle, repo.spec.InsecureSkipTLSverify, repo.spec.DisableSameOriginCheck, chart)
 }
 
@@ -250,6 +291,114 @@ func (c *Manager) Info(namespace, name, chartName, version string) (*types.Chart
 	return helm.InfoFromTarball(chart)
 }
 
+// Verify verifies the provenance file of a chart archive of a repository, if the repository verifies the provenance of
+// its charts, and records the result for the index.
+//
+// An error is returned if the verification failed and the repository requires signed charts.
+func (c *Manager) Verify(namespace, name, chartName, version string, archive []byte) error {
+	r, err := c.getRepo(namespace, name)
+	if err != nil {
+		return err
+	}
+	if r.spec.Verification == nil {
+		return nil
+	}
+
+	index, err := c.Index(namespace, name, true)
+	if err != nil {
+		return err
+	}
+	chart, err := index.Get(chartName, version)
+	if err != nil {
+		return err
+	}
+
+	signer, err := c.verify(r, chart, archive)
+	result := VerificationVerified
+	if err != nil {
+		result = VerificationFailed
+	}
+	c.verifications.Add(verificationKey(r, chart), result, verificationCacheTTL)
+
+	if err != nil {
+		if r.spec.Verification.Required {
+			return fmt.Errorf("chartName %s version %s failed provenance verification: %v: %w", chartName, version, err, validation.PermissionDenied)
+		}
+		logrus.Warnf("chartName %s version %s of repo %s failed provenance verification: %v", chartName, version, name, err)
+		return nil
+	}
+	logrus.Infof("chartName %s version %s of repo %s is signed by %s", chartName, version, name, signer)
+	return nil
+}
+
+// verify checks the provenance file of the chart against the keyring of the repository and returns the signer.
+func (c *Manager) verify(r repoDef, chart *repo.ChartVersion, archive []byte) (string, error) {
+	keyring, err := catalogv2.GetKeyring(c.secrets, r.spec, r.metadata.Namespace)
+	if err != nil {
+		return "", err
+	}
+	prov, err := c.provenance(r, chart)
+	if err != nil {
+		return "", err
+	}
+
+	// the provenance file is created for the archive named after the chart, as packaged by helm
+	filename := fmt.Sprintf("%s-%s.tgz", chart.Name, chart.Version)
+	if len(chart.URLs) > 0 {
+		if u, err := url.Parse(chart.URLs[0]); err == nil && strings.HasSuffix(u.Path, ".tgz") {
+			filename = path.Base(u.Path)
+		}
+	}
+	return catalogchart.Verify(keyring, filename, archive, prov)
+}
+
+// provenance retrieves the provenance file of the chart from the Git repository, the OCI registry or via HTTP.
+func (c *Manager) provenance(r repoDef, chart *repo.ChartVersion) ([]byte, error) {
+	if r.status.Commit != "" {
+		return git.Provenance(r.metadata.Namespace, r.metadata.Name, r.status.URL, chart)
+	}
+
+	secret, err := catalogv2.GetSecret(c.secrets, r.spec, r.metadata.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if oci.IsOCI(r.status.URL) {
+		return oci.Provenance(secret, r.status.URL, r.spec.CABundle, r.spec.InsecureSkipTLSverify, chart)
+	}
+	return helmhttp.Provenance(secret, r.status.URL, r.spec.CABundle, r.spec.InsecureSkipTLSverify, r.spec.DisableSameOriginCheck, chart)
+}
+
+// setVerification sets the VerificationAnnotation on the chart versions of the index if the repository verifies the
+// provenance of its charts.
+func (c *Manager) setVerification(r repoDef, index *repo.IndexFile) *repo.IndexFile {
+	if r.spec.Verification == nil {
+		return index
+	}
+
+	for _, versions := range index.Entries {
+		for _, version := range versions {
+			result := VerificationUnverified
+			if cached, ok := c.verifications.Get(verificationKey(r, version)); ok {
+				result = cached.(string)
+			}
+			// the annotations are shared with the cached index
+			annotations := make(map[string]string, len(version.Annotations)+1)
+			for k, v := range version.Annotations {
+				annotations[k] = v
+			}
+			annotations[VerificationAnnotation] = result
+			version.Annotations = annotations
+		}
+	}
+	return index
+}
+
+// verificationKey identifies a chart version of a repository, the digest changes if the chart is replaced.
+func verificationKey(r repoDef, chart *repo.ChartVersion) string {
+	return fmt.Sprintf("%s/%s/%s/%s", r.metadata.UID, chart.Name, chart.Version, chart.Digest)
+}
+
 // getRepo returns a cluster repository based on the name
 //
 // namespace should never be empty
@@ -6,10 +6,13 @@
 	"time"
 
 	"github.com/Masterminds/semver/v3"
+	v1 "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
 	"github.com/rancher/rancher/pkg/settings"
 	"github.com/stretchr/testify/assert"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/repo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
 )
 
 func TestFilterReleasesSemver(t *testing.T) {
@@ -520,3 +523,42 @@ func TestFilteringReleaseKubeVersionAnnotation(t *testing.T) {
 		})
 	}
 }
+
+func TestSetVerification(t *testing.T) {
+	newIndex := func() *repo.IndexFile {
+		return &repo.IndexFile{
+			Entries: map[string]repo.ChartVersions{
+				"mychart": {
+					{Metadata: &chart.Metadata{Name: "mychart", Version: "1.0.0", Annotations: map[string]string{"foo": "bar"}}, Digest: "a"},
+					{Metadata: &chart.Metadata{Name: "mychart", Version: "1.1.0"}, Digest: "b"},
+					{Metadata: &chart.Metadata{Name: "mychart", Version: "1.2.0"}, Digest: "c"},
+				},
+			},
+		}
+	}
+	r := repoDef{
+		metadata: &metav1.ObjectMeta{UID: "uid"},
+		spec:     &v1.RepoSpec{},
+	}
+	m := &Manager{verifications: cache.NewLRUExpireCache(verificationCacheSize)}
+
+	index := newIndex()
+	assert.Equal(t, newIndex(), m.setVerification(r, index))
+
+	r.spec.Verification = &v1.ChartVerification{}
+	m.verifications.Add(verificationKey(r, index.Entries["mychart"][0]), VerificationVerified, verificationCacheTTL)
+	m.verifications.Add(verificationKey(r, index.Entries["mychart"][1]), VerificationFailed, verificationCacheTTL)
+	annotations := index.Entries["mychart"][0].Annotations
+	index = m.setVerification(r, index)
+	assert.Equal(t, map[string]string{"foo": "bar", VerificationAnnotation: VerificationVerified}, index.Entries["mychart"][0].Annotations)
+	assert.Equal(t, map[string]string{VerificationAnnotation: VerificationFailed}, index.Entries["mychart"][1].Annotations)
+	assert.Equal(t, map[string]string{VerificationAnnotation: VerificationUnverified}, index.Entries["mychart"][2].Annotations)
+	// the annotations of the cached index are not modified
+	assert.Equal(t, map[string]string{"foo": "bar"}, annotations)
+
+	// a chart replaced with the same version is verified again
+	index = newIndex()
+	index.Entries["mychart"][0].Digest = "d"
+	index = m.setVerification(r, index)
+	assert.Equal(t, VerificationUnverified, index.Entries["mychart"][0].Annotations[VerificationAnnotation])
+}
@@ -54,6 +54,26 @@ func Chart(namespace, name, gitURL string, chartVersion *repo.ChartVersion) (io.
 	return archive.Open()
 }
 
+// Provenance returns the provenance file of the chart, which is stored next to the chart archive in the repo.
+func Provenance(namespace, name, gitURL string, chartVersion *repo.ChartVersion) ([]byte, error) {
+	dir := gitDir(namespace, name, gitURL)
+
+	if len(chartVersion.URLs) == 0 {
+		return nil, fmt.Errorf("failed to find chartName %s version %s: %w", chartVersion.Name, chartVersion.Version, validation.NotFound)
+	}
+
+	file, err := relative(dir, gitURL, chartVersion.URLs[0]+".prov")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to find provenance file of chartName %s version %s: %w", chartVersion.Name, chartVersion.Version, validation.NotFound)
+	}
+	return data, err
+}
+
 func relative(base, publicURL, path string) (string, error) {
 	if strings.HasPrefix(path, publicURL) {
 		path = path[len(publicURL):]
@@ -17,6 +17,8 @@
 	v1 "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
 
 	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // isHelm3 checks if the value of the owner key of the received map is equal to helm.
@@ -123,6 +125,25 @@ func fromHelm3ReleaseToRelease(release *release.Release, isNamespaced IsNamespac
 	return hr, err
 }
 
+// ToHelm3Release returns the helm3 release stored in the received runtime.Object, which can be an
+// unstructured.Unstructured or a corev1.Secret of the helm3 release storage.
+func ToHelm3Release(obj runtime.Object) (*release.Release, error) {
+	releaseData, err := getReleaseDataAndKind(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	if !isHelm3(meta.GetLabels()) {
+		return nil, ErrNotHelmRelease
+	}
+
+	return decodeHelm3(releaseData)
+}
+
 // decodeHelm3 receives a helm3 release data string, decodes the string data using the standard base64 library
 // and unmarshals the data into release.Release struct to return it.
 func decodeHelm3(data string) (*release.Release, error) {
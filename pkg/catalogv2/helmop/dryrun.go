@@ -0,0 +1,460 @@
+package helmop
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/rancher/apiserver/pkg/apierror"
+	"github.com/rancher/apiserver/pkg/types"
+	types2 "github.com/rancher/rancher/pkg/api/steve/catalog/types"
+	catalog "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/catalogv2/helm"
+	"github.com/rancher/wrangler/pkg/data/convert"
+	"github.com/rancher/wrangler/pkg/schemas/validation"
+	wyaml "github.com/rancher/wrangler/pkg/yaml"
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ResourceAdded is the change of a resource rendered by a dry-run that is not in the current release.
+	ResourceAdded = "added"
+	// ResourceRemoved is the change of a resource of the current release that is not rendered by a dry-run.
+	ResourceRemoved = "removed"
+	// ResourceChanged is the change of a resource of the current release that is rendered differently by a dry-run.
+	ResourceChanged = "changed"
+
+	// dryRunTimeout bounds the time a dry-run request waits for its charts to be rendered.
+	dryRunTimeout = 30 * time.Second
+	// maxDryRunRenders is the maximum number of charts rendered by dry-runs at once, including the renderings of
+	// requests that timed out.
+	maxDryRunRenders = 4
+	// maxDryRunChartSize is the maximum decompressed size of a chart archive rendered by a dry-run.
+	maxDryRunChartSize = 100 << 20
+	// maxDryRunManifestSize is the maximum size of the manifest of a chart returned by a dry-run.
+	maxDryRunManifestSize = 20 << 20
+)
+
+// dryRunRenders holds a token per chart being rendered by a dry-run.
+var dryRunRenders = make(chan struct{}, maxDryRunRenders)
+
+// DryRun renders the charts of an install or upgrade action with the submitted values, without creating an operation.
+// The manifests of releases that are upgraded are compared to the ones of their current release.
+//
+// The user must have access to the charts of the repo and to the namespace of the releases, and the user the operation
+// would run as must be allowed to manage the releases of the namespace.
+//
+// Templates can not be interrupted once rendering, so a request stops waiting for a chart after dryRunTimeout and the
+// rendering is abandoned to finish in the background. At most maxDryRunRenders charts are rendered at once, which
+// bounds the resources held by abandoned renderings. Chart archives are limited to maxDryRunChartSize before they are
+// loaded, while manifests are only checked against maxDryRunManifestSize once rendered, so that limit bounds the
+// response rather than the memory used while rendering.
+//
+// The charts are rendered in client only mode against the version and the API versions of the cluster, so lookup
+// functions return empty results. The kustomize post-renderer of migrated apps is not applied.
+func (s *Operations) DryRun(ctx context.Context, user user.Info, action, namespace, name string, options io.Reader) (*types2.ChartDryRunOutput, error) {
+	var (
+		status catalog.OperationStatus
+		cmds   Commands
+		err    error
+	)
+	if err := s.authorize(ctx, user, authzv1.ResourceAttributes{
+		Verb:     "get",
+		Group:    catalog.SchemeGroupVersion.Group,
+		Resource: "clusterrepos",
+		Name:     name,
+	}); err != nil {
+		return nil, err
+	}
+
+	switch action {
+	case "install":
+		status, cmds, err = s.getInstallCommand(namespace, name, options)
+	case "upgrade":
+		status, cmds, err = s.getUpgradeCommand(namespace, name, options)
+	default:
+		return nil, fmt.Errorf("dry-run of action %s is not supported: %w", action, validation.InvalidAction)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the namespace of the releases is read by the user and the releases are stored in it by the operation
+	if err := s.authorize(ctx, user, authzv1.ResourceAttributes{
+		Verb:     "get",
+		Resource: "namespaces",
+		Name:     status.Namespace,
+	}); err != nil {
+		return nil, err
+	}
+	operationUser, err := s.getUser(user, namespace, name, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, operationUser, authzv1.ResourceAttributes{
+		Verb:      "create",
+		Resource:  "secrets",
+		Namespace: status.Namespace,
+	}); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dryRunTimeout)
+	defer cancel()
+
+	// the current releases are read with the permissions of the user who requested the dry-run
+	client, err := s.cg.K8sInterface(types.GetAPIContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	kubeVersion, apiVersions, err := capabilities(client)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &types2.ChartDryRunOutput{}
+	for _, cmd := range cmds {
+		var current *release.Release
+		if cmd.Operation == "upgrade" && cmd.ReleaseName != "" {
+			current, err = currentRelease(ctx, client, status.Namespace, cmd.ReleaseName)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		chartDryRun, err := dryRunCommand(ctx, cmd, status.Namespace, current, kubeVersion, apiVersions)
+		if err != nil {
+			return nil, err
+		}
+		output.Charts = append(output.Charts, chartDryRun)
+	}
+	return output, nil
+}
+
+// authorize returns a permission denied error if the user is not allowed the verb on the resource.
+func (s *Operations) authorize(ctx context.Context, user user.Info, attributes authzv1.ResourceAttributes) error {
+	client, err := s.cg.AdminK8sInterface()
+	if err != nil {
+		return err
+	}
+	extra := map[string]authzv1.ExtraValue{}
+	for k, v := range user.GetExtra() {
+		extra[k] = v
+	}
+	review, err := client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attributes,
+			User:               user.GetName(),
+			Groups:             user.GetGroups(),
+			Extra:              extra,
+			UID:                user.GetUID(),
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create a SubjectAccessReview: %w", err)
+	}
+	if !review.Status.Allowed {
+		resource := attributes.Resource
+		if attributes.Name != "" {
+			resource += " " + attributes.Name
+		}
+		if attributes.Namespace != "" {
+			resource += " in namespace " + attributes.Namespace
+		}
+		return apierror.NewAPIError(validation.PermissionDenied, fmt.Sprintf("user %s can not %s %s", user.GetName(), attributes.Verb, resource))
+	}
+	return nil
+}
+
+// capabilities returns the Kubernetes version and the API versions of the cluster the charts are rendered for.
+func capabilities(client kubernetes.Interface) (*chartutil.KubeVersion, chartutil.VersionSet, error) {
+	info, err := client.Discovery().ServerVersion()
+	if err != nil {
+		return nil, nil, err
+	}
+	apiVersions, err := action.GetVersionSet(client.Discovery())
+	if err != nil {
+		return nil, nil, err
+	}
+	return &chartutil.KubeVersion{
+		Version: info.GitVersion,
+		Major:   info.Major,
+		Minor:   info.Minor,
+	}, apiVersions, nil
+}
+
+// currentRelease returns the release helm upgrades, which is the last deployed release or the last release if none
+// is deployed. It returns nil if the release does not exist.
+func currentRelease(ctx context.Context, client kubernetes.Interface, namespace, name string) (*release.Release, error) {
+	secrets, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			"owner": "helm",
+			"name":  name,
+		}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var current *release.Release
+	for i := range secrets.Items {
+		rel, err := helm.ToHelm3Release(&secrets.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		if current == nil ||
+			deployed(rel) && !deployed(current) ||
+			deployed(rel) == deployed(current) && rel.Version > current.Version {
+			current = rel
+		}
+	}
+	return current, nil
+}
+
+func deployed(rel *release.Release) bool {
+	return rel.Info != nil && rel.Info.Status == release.StatusDeployed
+}
+
+// dryRunCommand renders the chart of an install or upgrade command and compares its manifest to the one of the
+// current release, if any.
+func dryRunCommand(ctx context.Context, cmd Command, releaseNamespace string, current *release.Release, kubeVersion *chartutil.KubeVersion, apiVersions chartutil.VersionSet) (types2.ChartDryRun, error) {
+	args, err := cmd.argMap()
+	if err != nil {
+		return types2.ChartDryRun{}, err
+	}
+
+	if err := checkChartSize(cmd.Chart); err != nil {
+		return types2.ChartDryRun{}, err
+	}
+	chrt, err := loader.LoadArchive(bytes.NewReader(cmd.Chart))
+	if err != nil {
+		return types2.ChartDryRun{}, err
+	}
+
+	values := map[string]interface{}{}
+	if len(cmd.Values) > 0 {
+		if err := json.Unmarshal(cmd.Values, &values); err != nil {
+			return types2.ChartDryRun{}, err
+		}
+	}
+	// helm upgrades reuse the values of the current release if none are submitted
+	if current != nil && len(values) == 0 && !convert.ToBool(args["resetValues"]) {
+		values = current.Config
+	}
+
+	install := action.NewInstall(&action.Configuration{Log: logrus.Debugf})
+	install.DryRun = true
+	install.ClientOnly = true
+	install.IsUpgrade = current != nil
+	install.Namespace = releaseNamespace
+	install.DisableHooks = convert.ToBool(args["noHooks"])
+	install.KubeVersion = kubeVersion
+	install.APIVersions = apiVersions
+	install.ReleaseName = cmd.ReleaseName
+	if install.ReleaseName == "" {
+		install.GenerateName = true
+		install.ReleaseName, _, err = install.NameAndChart([]string{chrt.Name()})
+		if err != nil {
+			return types2.ChartDryRun{}, err
+		}
+	}
+
+	rel, err := render(ctx, install, chrt, values)
+	if err != nil {
+		return types2.ChartDryRun{}, fmt.Errorf("failed to render chart %s version %s: %w", chrt.Name(), chrt.Metadata.Version, err)
+	}
+
+	result := types2.ChartDryRun{
+		ChartName:        chrt.Name(),
+		Version:          chrt.Metadata.Version,
+		ReleaseName:      rel.Name,
+		ReleaseNamespace: rel.Namespace,
+		Manifest:         rel.Manifest,
+	}
+	if rel.Info != nil {
+		result.Notes = rel.Info.Notes
+	}
+	if !install.DisableHooks {
+		// the hooks are not part of the manifest of a release, they are shown for review but not compared
+		for _, hook := range rel.Hooks {
+			result.Manifest += fmt.Sprintf("---\n# Source: %s\n%s\n", hook.Path, hook.Manifest)
+		}
+	}
+
+	if len(result.Manifest) > maxDryRunManifestSize {
+		return types2.ChartDryRun{}, fmt.Errorf("manifest of chart %s version %s exceeds %d bytes", chrt.Name(), chrt.Metadata.Version, maxDryRunManifestSize)
+	}
+
+	var currentManifest string
+	if current != nil {
+		currentManifest = current.Manifest
+	}
+	result.Changes, err = diffManifests(currentManifest, rel.Manifest)
+	return result, err
+}
+
+// render runs the client only install in the background, as it does not stop when ctx is done, and returns its release
+// or the error of ctx if ctx is done first.
+func render(ctx context.Context, install *action.Install, chrt *chart.Chart, values map[string]interface{}) (*release.Release, error) {
+	select {
+	case dryRunRenders <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	type result struct {
+		rel *release.Release
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() { <-dryRunRenders }()
+		rel, err := install.RunWithContext(ctx, chrt, values)
+		done <- result{rel: rel, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.rel, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// checkChartSize returns an error if the chart archive decompresses to more than maxDryRunChartSize bytes.
+func checkChartSize(archive []byte) error {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	n, err := io.Copy(io.Discard, io.LimitReader(gz, maxDryRunChartSize+1))
+	if err != nil {
+		return err
+	}
+	if n > maxDryRunChartSize {
+		return fmt.Errorf("chart archive exceeds %d bytes decompressed", maxDryRunChartSize)
+	}
+	return nil
+}
+
+// resourceKey identifies a resource of a manifest.
+type resourceKey struct {
+	apiVersion string
+	kind       string
+	namespace  string
+	name       string
+}
+
+// manifestResources returns the resources of the manifest by key, as YAML with sorted fields.
+func manifestResources(manifest string) (map[resourceKey]string, error) {
+	objs, err := wyaml.ToObjects(strings.NewReader(manifest))
+	if err != nil {
+		return nil, err
+	}
+
+	resources := map[resourceKey]string{}
+	for _, obj := range objs {
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		apiVersion, kind := obj.GetObjectKind().GroupVersionKind().ToAPIVersionAndKind()
+		resources[resourceKey{
+			apiVersion: apiVersion,
+			kind:       kind,
+			namespace:  m.GetNamespace(),
+			name:       m.GetName(),
+		}] = string(data)
+	}
+	return resources, nil
+}
+
+// diffManifests returns the resources that are added, removed or changed from the current to the new manifest,
+// sorted by kind, namespace and name. Changed resources come with a unified diff of their YAML.
+func diffManifests(current, new string) ([]types2.ResourceChange, error) {
+	currentResources, err := manifestResources(current)
+	if err != nil {
+		return nil, err
+	}
+	newResources, err := manifestResources(new)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []types2.ResourceChange
+	for key, data := range newResources {
+		currentData, ok := currentResources[key]
+		if !ok {
+			changes = append(changes, resourceChange(key, ResourceAdded, ""))
+			continue
+		}
+		if currentData == data {
+			continue
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(currentData),
+			B:        difflib.SplitLines(data),
+			FromFile: "current",
+			ToFile:   "dry-run",
+			Context:  3,
+		})
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, resourceChange(key, ResourceChanged, diff))
+	}
+	for key := range currentResources {
+		if _, ok := newResources[key]; !ok {
+			changes = append(changes, resourceChange(key, ResourceRemoved, ""))
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind < changes[j].Kind
+		}
+		if changes[i].Namespace != changes[j].Namespace {
+			return changes[i].Namespace < changes[j].Namespace
+		}
+		if changes[i].Name != changes[j].Name {
+			return changes[i].Name < changes[j].Name
+		}
+		return changes[i].APIVersion < changes[j].APIVersion
+	})
+	return changes, nil
+}
+
+func resourceChange(key resourceKey, change, diff string) types2.ResourceChange {
+	return types2.ResourceChange{
+		APIVersion: key.apiVersion,
+		Kind:       key.kind,
+		Namespace:  key.namespace,
+		Name:       key.name,
+		Change:     change,
+		Diff:       diff,
+	}
+}
@@ -0,0 +1,240 @@
+package helmop
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancher/apiserver/pkg/apierror"
+	types2 "github.com/rancher/rancher/pkg/api/steve/catalog/types"
+	"github.com/rancher/steve/pkg/stores/proxy"
+	"github.com/rancher/wrangler/pkg/schemas/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	authzv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const configMapTemplate = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-config
+data:
+  replicas: {{ .Values.replicas | quote }}
+`
+
+const serviceTemplate = `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  ports:
+  - port: 80
+`
+
+func testChart(t *testing.T, templates ...string) []byte {
+	files := []struct{ name, content string }{
+		{"Chart.yaml", "apiVersion: v2\nname: mychart\nversion: 1.0.0\n"},
+		{"values.yaml", "replicas: 1\n"},
+		{"templates/configmap.yaml", configMapTemplate},
+		{"templates/service.yaml", serviceTemplate},
+		{"templates/NOTES.txt", "Installed {{ .Release.Name }}"},
+	}
+	for i, template := range templates {
+		files = append(files, struct{ name, content string }{fmt.Sprintf("templates/extra-%d.yaml", i), template})
+	}
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "mychart/" + file.name, Mode: 0644, Size: int64(len(file.content))}))
+		_, err := tw.Write([]byte(file.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func releaseSecret(t *testing.T, rel *release.Release) *corev1.Secret {
+	data, err := json.Marshal(rel)
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err = gz.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("sh.helm.release.v1.%s.v%d", rel.Name, rel.Version),
+			Namespace: rel.Namespace,
+			Labels: map[string]string{
+				"owner":   "helm",
+				"name":    rel.Name,
+				"version": fmt.Sprint(rel.Version),
+			},
+		},
+		Type: "helm.sh/release.v1",
+		Data: map[string][]byte{
+			"release": []byte(base64.StdEncoding.EncodeToString(buf.Bytes())),
+		},
+	}
+}
+
+func TestCurrentRelease(t *testing.T) {
+	newRelease := func(version int, status release.Status) *release.Release {
+		return &release.Release{
+			Name:      "myapp",
+			Namespace: "apps",
+			Version:   version,
+			Info:      &release.Info{Status: status},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		releaseSecret(t, newRelease(1, release.StatusSuperseded)),
+		releaseSecret(t, newRelease(2, release.StatusDeployed)),
+		releaseSecret(t, newRelease(3, release.StatusFailed)),
+	)
+
+	current, err := currentRelease(context.Background(), client, "apps", "myapp")
+	require.NoError(t, err)
+	assert.Equal(t, 2, current.Version)
+
+	current, err = currentRelease(context.Background(), client, "apps", "other")
+	require.NoError(t, err)
+	assert.Nil(t, current)
+}
+
+func TestDryRunCommand(t *testing.T) {
+	kubeVersion := &chartutil.KubeVersion{Version: "v1.27.0", Major: "1", Minor: "27"}
+	cmd := Command{
+		Operation:   "install",
+		Chart:       testChart(t),
+		Values:      []byte(`{"replicas":2}`),
+		ReleaseName: "myapp",
+	}
+
+	result, err := dryRunCommand(context.Background(), cmd, "apps", nil, kubeVersion, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "mychart", result.ChartName)
+	assert.Equal(t, "1.0.0", result.Version)
+	assert.Equal(t, "apps", result.ReleaseNamespace)
+	assert.Equal(t, "Installed myapp", result.Notes)
+	assert.Contains(t, result.Manifest, `replicas: "2"`)
+	assert.Equal(t, []types2.ResourceChange{
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "myapp-config", Change: ResourceAdded},
+		{APIVersion: "v1", Kind: "Service", Name: "myapp", Change: ResourceAdded},
+	}, result.Changes)
+
+	current := &release.Release{
+		Name:      "myapp",
+		Namespace: "apps",
+		Version:   1,
+		Config:    map[string]interface{}{"replicas": 3},
+		Manifest:  result.Manifest + "---\napiVersion: v1\nkind: Secret\nmetadata:\n  name: myapp-old\n",
+	}
+	cmd.Operation = "upgrade"
+	cmd.Values = nil
+	result, err = dryRunCommand(context.Background(), cmd, "apps", current, kubeVersion, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Changes, 2)
+	assert.Equal(t, types2.ResourceChange{APIVersion: "v1", Kind: "Secret", Name: "myapp-old", Change: ResourceRemoved}, result.Changes[1])
+	// the values of the current release are reused if none are submitted
+	assert.Equal(t, ResourceChanged, result.Changes[0].Change)
+	assert.Equal(t, "ConfigMap", result.Changes[0].Kind)
+	assert.Contains(t, result.Changes[0].Diff, `-  replicas: "2"`)
+	assert.Contains(t, result.Changes[0].Diff, `+  replicas: "3"`)
+}
+
+func TestDryRunCommandTimeout(t *testing.T) {
+	kubeVersion := &chartutil.KubeVersion{Version: "v1.27.0", Major: "1", Minor: "27"}
+	cmd := Command{
+		Operation:   "install",
+		Chart:       testChart(t, "{{ range until 3000 }}{{ range until 3000 }}{{ end }}{{ end }}"),
+		ReleaseName: "myapp",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := dryRunCommand(ctx, cmd, "apps", nil, kubeVersion, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second, "the request does not wait for the rendering")
+}
+
+func TestDiffManifests(t *testing.T) {
+	changes, err := diffManifests("", "")
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	manifest := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n  namespace: apps\ndata:\n  a: b\n"
+	// the order of the fields does not matter
+	changes, err = diffManifests(manifest, "kind: ConfigMap\napiVersion: v1\nmetadata:\n  namespace: apps\n  name: foo\ndata:\n  a: b\n")
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+// adminClientGetter returns the same admin client for all requests.
+type adminClientGetter struct {
+	proxy.ClientGetter
+	client kubernetes.Interface
+}
+
+func (a adminClientGetter) AdminK8sInterface() (kubernetes.Interface, error) {
+	return a.client, nil
+}
+
+func TestDryRunUnprivilegedUser(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var reviews []authzv1.SubjectAccessReview
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		reviews = append(reviews, *review)
+		review.Status.Allowed = review.Spec.User == "admin"
+		return true, review, nil
+	})
+	s := &Operations{cg: adminClientGetter{client: client}}
+
+	output, err := s.DryRun(context.Background(), &user.DefaultInfo{Name: "user", Groups: []string{"system:authenticated"}}, "install", "", "rancher-charts", strings.NewReader(`{"dryRun":true}`))
+	assert.Nil(t, output)
+	var apiError *apierror.APIError
+	require.ErrorAs(t, err, &apiError)
+	assert.Equal(t, validation.PermissionDenied, apiError.Code)
+	require.Len(t, reviews, 1, "the chart is not read for a user without access to the repo")
+	assert.Equal(t, "user", reviews[0].Spec.User)
+	assert.Equal(t, []string{"system:authenticated"}, reviews[0].Spec.Groups)
+	assert.Equal(t, &authzv1.ResourceAttributes{
+		Verb:     "get",
+		Group:    "catalog.cattle.io",
+		Resource: "clusterrepos",
+		Name:     "rancher-charts",
+	}, reviews[0].Spec.ResourceAttributes)
+}
+
+func TestCheckChartSize(t *testing.T) {
+	assert.NoError(t, checkChartSize(testChart(t)))
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write(make([]byte, maxDryRunChartSize+1))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	assert.Error(t, checkChartSize(buf.Bytes()), "charts that decompress beyond the limit are not rendered")
+}
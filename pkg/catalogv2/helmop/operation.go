@@ -528,15 +528,9 @@ func (c Command) renderArgs() ([]string, error) {
 		args []string
 	)
 
-	dataMap := map[string]interface{}{}
-	for _, argObject := range c.ArgObjects {
-		data, err := convert.EncodeToMap(argObject)
-		if err != nil {
-			return nil, err
-		}
-		for k, v := range data {
-			dataMap[k] = v
-		}
+	dataMap, err := c.argMap()
+	if err != nil {
+		return nil, err
 	}
 
 	delete(dataMap, "annotations")
@@ -589,6 +583,21 @@ func (c Command) renderArgs() ([]string, error) {
 	return append([]string{c.Operation}, args...), nil
 }
 
+// argMap merges the ArgObjects of the command into a single map, the fields of later objects take precedence.
+func (c Command) argMap() (map[string]interface{}, error) {
+	dataMap := map[string]interface{}{}
+	for _, argObject := range c.ArgObjects {
+		data, err := convert.EncodeToMap(argObject)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range data {
+			dataMap[k] = v
+		}
+	}
+	return dataMap, nil
+}
+
 func sanitizeVersion(chartVersion string) string {
 	return badChars.ReplaceAllString(chartVersion, "-")
 }
@@ -705,6 +714,11 @@ func (s *Operations) getChartCommand(namespace, name, chartName, chartVersion st
 		return Command{}, err
 	}
 
+	// verify the chart as it was downloaded, before the annotations are injected and the operation pod is created
+	if err := s.contentManager.Verify(namespace, name, chartName, chartVersion, chartData); err != nil {
+		return Command{}, err
+	}
+
 	chartData, err = injectAnnotation(chartData, annotations)
 	if err != nil {
 		return Command{}, err
@@ -76,7 +76,58 @@ func Chart(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipT
 	}
 	defer client.CloseIdleConnections()
 
-	u, err := url.Parse(chart.URLs[0])
+	u, err := chartURL(repoURL, chart.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	return ioutil.NopCloser(bytes.NewBuffer(data)), err
+}
+
+// Provenance downloads the provenance file of the chart, which is served next to the chart archive.
+func Provenance(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipTLSVerify bool, disableSameOriginCheck bool, chart *repo.ChartVersion) ([]byte, error) {
+	if len(chart.URLs) == 0 {
+		return nil, fmt.Errorf("failed to find chartName %s version %s: %w", chart.Name, chart.Version, validation.NotFound)
+	}
+
+	client, err := HelmClient(secret, caBundle, insecureSkipTLSVerify, disableSameOriginCheck, repoURL)
+	if err != nil {
+		return nil, err
+	}
+	defer client.CloseIdleConnections()
+
+	u, err := chartURL(repoURL, chart.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+	u.Path += ".prov"
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		defer ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to find provenance file of chartName %s version %s: %w", chart.Name, chart.Version, validation.ErrorCode{
+			Status: resp.StatusCode,
+		})
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// chartURL resolves the URL of a chart archive of the index against the URL of the repository.
+func chartURL(repoURL, chartURL string) (*url.URL, error) {
+	u, err := url.Parse(chartURL)
 	if err != nil {
 		return nil, err
 	}
@@ -93,15 +144,7 @@ func Chart(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipT
 		// contain an access credential.
 		u.RawQuery = base.RawQuery
 	}
-
-	resp, err := client.Get(u.String())
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	data, err := ioutil.ReadAll(resp.Body)
-	return ioutil.NopCloser(bytes.NewBuffer(data)), err
+	return u, nil
 }
 
 func DownloadIndex(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipTLSVerify bool, disableSameOriginCheck bool) (*repo.IndexFile, error) {
@@ -0,0 +1,106 @@
+package oci
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/remotes"
+	helmhttp "github.com/rancher/rancher/pkg/catalogv2/http"
+	"helm.sh/helm/v3/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	"oras.land/oras-go/pkg/auth"
+	dockerauth "oras.land/oras-go/pkg/auth/docker"
+)
+
+// IsOCI returns true if the URL references a chart repository in an OCI registry.
+func IsOCI(repoURL string) bool {
+	return registry.IsOCI(repoURL)
+}
+
+// reference returns the reference of the chart repository of an oci:// URL, as expected by the registry client.
+func reference(repoURL string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(repoURL, registry.OCIScheme+"://"), "/")
+}
+
+// repository returns the reference of the chart repository of a reference to a tag of the repository.
+func repository(ref string) string {
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i]
+	}
+	return ref
+}
+
+// host returns the registry host of a reference.
+func host(ref string) string {
+	return strings.SplitN(ref, "/", 2)[0]
+}
+
+// dockerConfig is the subset of the docker config file the registry client reads credentials from.
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+type dockerAuth struct {
+	Auth string `json:"auth,omitempty"`
+}
+
+// RegistryClient returns a registry client for the registry of the chart repository. The credentials of a basic auth
+// secret are used to log in to the registry, the certificate of a TLS secret is presented to it.
+func RegistryClient(secret *corev1.Secret, caBundle []byte, insecureSkipTLSVerify bool, repoURL string) (*registry.Client, error) {
+	client, _, err := registryClientAndResolver(secret, caBundle, insecureSkipTLSVerify, repoURL)
+	return client, err
+}
+
+// registryClientAndResolver returns a registry client for the registry of the chart repository and a resolver with
+// the same credentials, which resolves tags to the digests of their manifests without pulling them.
+func registryClientAndResolver(secret *corev1.Secret, caBundle []byte, insecureSkipTLSVerify bool, repoURL string) (*registry.Client, remotes.Resolver, error) {
+	config := dockerConfig{Auths: map[string]dockerAuth{}}
+	httpSecret := secret
+	if secret != nil && secret.Type == corev1.SecretTypeBasicAuth {
+		// the registry client authorizes the requests itself, the http client must not set basic auth headers
+		httpSecret = nil
+		credentials := string(secret.Data[corev1.BasicAuthUsernameKey]) + ":" + string(secret.Data[corev1.BasicAuthPasswordKey])
+		config.Auths[host(reference(repoURL))] = dockerAuth{Auth: base64.StdEncoding.EncodeToString([]byte(credentials))}
+	}
+
+	httpClient, err := helmhttp.HelmClient(httpSecret, caBundle, insecureSkipTLSVerify, false, repoURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the credentials are read when the clients are created, the file does not need to outlive them
+	dir, err := os.MkdirTemp("", "oci-registry-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	credentialsFile := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(credentialsFile, data, 0600); err != nil {
+		return nil, nil, err
+	}
+
+	client, err := registry.NewClient(
+		registry.ClientOptCredentialsFile(credentialsFile),
+		registry.ClientOptHTTPClient(httpClient),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	authClient, err := dockerauth.NewClient(credentialsFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	resolver, err := authClient.ResolverWithOpts(auth.WithResolverClient(httpClient))
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, resolver, nil
+}
@@ -0,0 +1,182 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rancher/wrangler/pkg/schemas/validation"
+	"github.com/sirupsen/logrus"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+const (
+	// manifestCacheSize is the number of pulled manifests kept, the least recently used manifests are pulled again.
+	manifestCacheSize = 10000
+	// manifestCacheTTL is the duration a pulled manifest is kept for.
+	manifestCacheTTL = 24 * time.Hour
+)
+
+// manifests caches the chart metadata and provenance files of the manifests pulled for the indexes, keyed by
+// manifestKey, so that only the tags whose digest changed are pulled when an index is downloaded again.
+var manifests = cache.NewLRUExpireCache(manifestCacheSize)
+
+// cachedManifest is the content of a manifest that is read for the index of its chart repository.
+type cachedManifest struct {
+	metadata *helmchart.Metadata
+	// prov is the provenance file of the chart version, nil if the manifest has no provenance layer.
+	prov []byte
+}
+
+// manifestKey identifies the manifest with the digest in a chart repository.
+func manifestKey(ref, digest string) string {
+	return ref + "@" + digest
+}
+
+// DownloadIndex synthesizes the index of a chart repository in an OCI registry. Each semver tag of the repository is a
+// version of the chart, its metadata is read from the config of the manifest so that the charts are not downloaded.
+// The tags are resolved to the digests of their manifests first, the manifests pulled before are not pulled again.
+func DownloadIndex(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipTLSVerify bool) (*repo.IndexFile, error) {
+	client, resolver, err := registryClientAndResolver(secret, caBundle, insecureSkipTLSVerify, repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := reference(repoURL)
+	logrus.Infof("Listing tags of OCI repository %s", ref)
+	tags, err := client.Tags(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	index := repo.NewIndexFile()
+	for _, tag := range tags {
+		// the registry client lists the tags with the plus signs of the chart versions, which are underscores in the registry
+		_, desc, err := resolver.Resolve(context.Background(), ref+":"+strings.ReplaceAll(tag, "+", "_"))
+		if err != nil {
+			logrus.Warnf("Skipping tag %s of OCI repository %s: %v", tag, ref, err)
+			continue
+		}
+		manifest, digest, err := pullManifest(client, ref, tag, desc.Digest.String())
+		if err != nil {
+			logrus.Warnf("Skipping tag %s of OCI repository %s: %v", tag, ref, err)
+			continue
+		}
+		metadata := manifest.metadata
+		if metadata == nil || metadata.Name == "" || metadata.Version == "" {
+			logrus.Warnf("Skipping tag %s of OCI repository %s: manifest config is not a chart", tag, ref)
+			continue
+		}
+		index.Entries[metadata.Name] = append(index.Entries[metadata.Name], &repo.ChartVersion{
+			Metadata: metadata,
+			URLs:     []string{registry.OCIScheme + "://" + ref + ":" + tag},
+			Digest:   digest,
+		})
+	}
+
+	if len(tags) > 0 && len(index.Entries) == 0 {
+		return nil, fmt.Errorf("failed to find charts in OCI repository %s", ref)
+	}
+	return index, nil
+}
+
+// pullManifest returns the content and the digest of the manifest of the tag of the chart repository, which resolved
+// to the digest. The manifest is only pulled if it is not cached.
+func pullManifest(client *registry.Client, ref, tag, digest string) (*cachedManifest, string, error) {
+	if cached, ok := manifests.Get(manifestKey(ref, digest)); ok {
+		return cached.(*cachedManifest), digest, nil
+	}
+
+	// the provenance layer is optional, pulling it instead of the chart only fetches the manifest and its config
+	result, err := client.Pull(ref+":"+tag,
+		registry.PullOptWithChart(false),
+		registry.PullOptWithProv(true),
+		registry.PullOptIgnoreMissingProv(true))
+	if err != nil {
+		return nil, "", err
+	}
+	manifest := &cachedManifest{metadata: result.Chart.Meta}
+	if result.Prov != nil {
+		manifest.prov = result.Prov.Data
+	}
+	// the tag may have moved since it was resolved, the manifest is cached under the digest that was pulled
+	manifests.Add(manifestKey(ref, result.Manifest.Digest), manifest, manifestCacheTTL)
+	return manifest, result.Manifest.Digest, nil
+}
+
+// Chart pulls a chart version of the index from its OCI registry.
+func Chart(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipTLSVerify bool, chart *repo.ChartVersion) (io.ReadCloser, error) {
+	result, err := pull(secret, repoURL, caBundle, insecureSkipTLSVerify, chart)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewBuffer(result.Chart.Data)), nil
+}
+
+// Icon returns the icon of a chart version of the index that is packaged in the chart, as referenced by a file:// URL.
+func Icon(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipTLSVerify bool, chart *repo.ChartVersion) (io.ReadCloser, string, error) {
+	if !strings.HasPrefix(chart.Icon, "file://") {
+		return nil, "", fmt.Errorf("failed to find icon of chartName %s version %s: %w", chart.Name, chart.Version, validation.NotFound)
+	}
+
+	result, err := pull(secret, repoURL, caBundle, insecureSkipTLSVerify, chart)
+	if err != nil {
+		return nil, "", err
+	}
+	files, err := loader.LoadArchiveFiles(bytes.NewBuffer(result.Chart.Data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	icon := path.Clean(strings.TrimPrefix(chart.Icon, "file://"))
+	for _, file := range files {
+		if file.Name == icon {
+			return ioutil.NopCloser(bytes.NewBuffer(file.Data)), path.Ext(icon), nil
+		}
+	}
+	return nil, "", fmt.Errorf("failed to find icon %s of chartName %s version %s: %w", icon, chart.Name, chart.Version, validation.NotFound)
+}
+
+// Provenance pulls the provenance file of a chart version of the index, which is a layer of its manifest. The
+// provenance file read when the index was downloaded is returned if the manifest is still cached.
+func Provenance(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipTLSVerify bool, chart *repo.ChartVersion) ([]byte, error) {
+	if len(chart.URLs) > 0 && chart.Digest != "" {
+		if cached, ok := manifests.Get(manifestKey(repository(reference(chart.URLs[0])), chart.Digest)); ok && cached.(*cachedManifest).prov != nil {
+			return cached.(*cachedManifest).prov, nil
+		}
+	}
+	result, err := pull(secret, repoURL, caBundle, insecureSkipTLSVerify, chart, registry.PullOptWithChart(false), registry.PullOptWithProv(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull provenance file of chartName %s version %s: %w", chart.Name, chart.Version, err)
+	}
+	return result.Prov.Data, nil
+}
+
+// pull pulls a chart version of the index, by default only its archive is pulled.
+func pull(secret *corev1.Secret, repoURL string, caBundle []byte, insecureSkipTLSVerify bool, chart *repo.ChartVersion, options ...registry.PullOption) (*registry.PullResult, error) {
+	if len(chart.URLs) == 0 || !IsOCI(chart.URLs[0]) {
+		return nil, fmt.Errorf("failed to find chartName %s version %s: %w", chart.Name, chart.Version, validation.NotFound)
+	}
+
+	client, err := RegistryClient(secret, caBundle, insecureSkipTLSVerify, repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := reference(chart.URLs[0])
+	if host(ref) != host(reference(repoURL)) {
+		// the credentials of the repository are only valid for its registry
+		return nil, fmt.Errorf("chartName %s version %s is not in the registry of the repository %s", chart.Name, chart.Version, repoURL)
+	}
+	return client.Pull(ref, options...)
+}
@@ -0,0 +1,223 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	helmchart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// fakeRegistry serves the charts of a single repository, requiring basic auth.
+type fakeRegistry struct {
+	repository string
+	manifests  map[string][]byte
+	blobs      map[string][]byte
+	// pulls counts the manifests fetched by reference, resolving a tag with a HEAD request is not counted
+	pulls map[string]int
+}
+
+func digest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func chartArchive(t *testing.T, name, version string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for _, file := range []struct{ name, content string }{
+		{"Chart.yaml", fmt.Sprintf("apiVersion: v2\nname: %s\nversion: %s\nicon: file://assets/icon.svg\n", name, version)},
+		{"assets/icon.svg", "<svg/>"},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name + "/" + file.name, Mode: 0644, Size: int64(len(file.content))}))
+		_, err := tw.Write([]byte(file.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func (f *fakeRegistry) add(t *testing.T, tag, name, version string) {
+	config := []byte(fmt.Sprintf(`{"apiVersion":"v2","name":%q,"version":%q,"icon":"file://assets/icon.svg"}`, name, version))
+	chart := chartArchive(t, name, version)
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config":        map[string]interface{}{"mediaType": registry.ConfigMediaType, "digest": digest(config), "size": len(config)},
+		"layers": []map[string]interface{}{
+			{"mediaType": registry.ChartLayerMediaType, "digest": digest(chart), "size": len(chart)},
+		},
+	})
+	require.NoError(t, err)
+	f.blobs[digest(config)] = config
+	f.blobs[digest(chart)] = chart
+	f.manifests[tag] = manifest
+	f.manifests[digest(manifest)] = manifest
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	prefix := "/v2/" + f.repository + "/"
+	switch {
+	case r.URL.Path == "/v2/":
+		w.WriteHeader(http.StatusOK)
+	case r.URL.Path == prefix+"tags/list":
+		var tags []string
+		for tag := range f.manifests {
+			if !strings.HasPrefix(tag, "sha256:") {
+				tags = append(tags, tag)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": f.repository, "tags": tags})
+	case strings.HasPrefix(r.URL.Path, prefix+"manifests/"):
+		manifest, ok := f.manifests[strings.TrimPrefix(r.URL.Path, prefix+"manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", digest(manifest))
+		w.Header().Set("Content-Length", fmt.Sprint(len(manifest)))
+		if r.Method != http.MethodHead {
+			f.pulls[strings.TrimPrefix(r.URL.Path, prefix+"manifests/")]++
+			w.Write(manifest)
+		}
+	case strings.HasPrefix(r.URL.Path, prefix+"blobs/"):
+		blob, ok := f.blobs[strings.TrimPrefix(r.URL.Path, prefix+"blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+		if r.Method != http.MethodHead {
+			w.Write(blob)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestDownloadIndexAndChart(t *testing.T) {
+	fake := &fakeRegistry{
+		repository: "charts/mychart",
+		manifests:  map[string][]byte{},
+		blobs:      map[string][]byte{},
+		pulls:      map[string]int{},
+	}
+	fake.add(t, "1.0.0", "mychart", "1.0.0")
+	fake.add(t, "1.1.0_build.1", "mychart", "1.1.0+build.1")
+	fake.manifests["latest"] = fake.manifests["1.0.0"]
+	// registries on localhost are accessed over plain HTTP
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	repoURL := "oci://" + strings.TrimPrefix(server.URL, "http://") + "/charts/mychart"
+	secret := &corev1.Secret{
+		Type: corev1.SecretTypeBasicAuth,
+		Data: map[string][]byte{
+			corev1.BasicAuthUsernameKey: []byte("user"),
+			corev1.BasicAuthPasswordKey: []byte("pass"),
+		},
+	}
+
+	index, err := DownloadIndex(secret, repoURL, nil, true)
+	require.NoError(t, err)
+	index.SortEntries()
+	require.Len(t, index.Entries["mychart"], 2)
+	latest := index.Entries["mychart"][0]
+	assert.Equal(t, "1.1.0+build.1", latest.Version)
+	assert.Equal(t, []string{repoURL + ":1.1.0+build.1"}, latest.URLs)
+	assert.Equal(t, digest(fake.manifests["1.1.0_build.1"]), latest.Digest)
+
+	chart, err := Chart(secret, repoURL, nil, true, latest)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(chart)
+	require.NoError(t, err)
+	assert.Equal(t, chartArchive(t, "mychart", "1.1.0+build.1"), data)
+
+	icon, ext, err := Icon(secret, repoURL, nil, true, latest)
+	require.NoError(t, err)
+	data, err = ioutil.ReadAll(icon)
+	require.NoError(t, err)
+	assert.Equal(t, "<svg/>", string(data))
+	assert.Equal(t, ".svg", ext)
+
+	_, err = DownloadIndex(nil, repoURL, nil, true)
+	assert.Error(t, err)
+}
+
+func TestDownloadIndexCachedManifests(t *testing.T) {
+	fake := &fakeRegistry{
+		repository: "charts/mychart",
+		manifests:  map[string][]byte{},
+		blobs:      map[string][]byte{},
+		pulls:      map[string]int{},
+	}
+	fake.add(t, "1.0.0", "mychart", "1.0.0")
+	fake.add(t, "1.1.0", "mychart", "1.1.0")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	repoURL := "oci://" + strings.TrimPrefix(server.URL, "http://") + "/charts/mychart"
+	secret := &corev1.Secret{
+		Type: corev1.SecretTypeBasicAuth,
+		Data: map[string][]byte{
+			corev1.BasicAuthUsernameKey: []byte("user"),
+			corev1.BasicAuthPasswordKey: []byte("pass"),
+		},
+	}
+
+	pulls := func() int {
+		n := 0
+		for _, count := range fake.pulls {
+			n += count
+		}
+		return n
+	}
+
+	index, err := DownloadIndex(secret, repoURL, nil, true)
+	require.NoError(t, err)
+	require.Len(t, index.Entries["mychart"], 2)
+	pulled := pulls()
+	assert.NotZero(t, pulled)
+
+	index, err = DownloadIndex(secret, repoURL, nil, true)
+	require.NoError(t, err)
+	require.Len(t, index.Entries["mychart"], 2)
+	assert.Equal(t, pulled, pulls(), "the manifests of unchanged tags are not pulled again")
+
+	// the tag is moved to another manifest
+	fake.add(t, "1.0.0", "otherchart", "1.0.0")
+	index, err = DownloadIndex(secret, repoURL, nil, true)
+	require.NoError(t, err)
+	assert.Greater(t, pulls(), pulled, "the manifest of a changed tag is pulled")
+	require.Len(t, index.Entries["mychart"], 1)
+	require.Len(t, index.Entries["otherchart"], 1)
+	assert.Equal(t, digest(fake.manifests["1.0.0"]), index.Entries["otherchart"][0].Digest)
+}
+
+func TestPullOtherRegistry(t *testing.T) {
+	chart := &repo.ChartVersion{
+		Metadata: &helmchart.Metadata{Name: "mychart", Version: "1.0.0"},
+		URLs:     []string{"oci://other.example.com/charts/mychart:1.0.0"},
+	}
+	_, err := Chart(nil, "oci://registry.example.com/charts/mychart", nil, false, chart)
+	assert.ErrorContains(t, err, "is not in the registry of the repository")
+}
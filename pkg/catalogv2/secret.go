@@ -1,6 +1,8 @@
 package catalogv2
 
 import (
+	"fmt"
+
 	v1 "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
 	corev1controllers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -18,3 +20,27 @@ func GetSecret(secrets corev1controllers.SecretCache, repoSpec *v1.RepoSpec, rep
 
 	return secrets.Get(ns, repoSpec.ClientSecret.Name)
 }
+
+// KeyringKey is the key of the public keyring in the keyring secret of a repo
+const KeyringKey = "keyring"
+
+// GetKeyring returns the public keyring from the cluster repo's verification spec field
+func GetKeyring(secrets corev1controllers.SecretCache, repoSpec *v1.RepoSpec, repoNamespace string) ([]byte, error) {
+	if repoSpec.Verification == nil || repoSpec.Verification.KeyringSecret == nil {
+		return nil, fmt.Errorf("repo verification does not reference a keyring secret")
+	}
+	ns := repoSpec.Verification.KeyringSecret.Namespace
+	if repoNamespace != "" {
+		ns = repoNamespace
+	}
+
+	secret, err := secrets.Get(ns, repoSpec.Verification.KeyringSecret.Name)
+	if err != nil {
+		return nil, err
+	}
+	keyring, ok := secret.Data[KeyringKey]
+	if !ok || len(keyring) == 0 {
+		return nil, fmt.Errorf("secret %s/%s does not contain a %s", secret.Namespace, secret.Name, KeyringKey)
+	}
+	return keyring, nil
+}
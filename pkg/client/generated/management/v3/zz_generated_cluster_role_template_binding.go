@@ -10,6 +10,7 @@
 	ClusterRoleTemplateBindingFieldClusterID        = "clusterId"
 	ClusterRoleTemplateBindingFieldCreated          = "created"
 	ClusterRoleTemplateBindingFieldCreatorID        = "creatorId"
+	ClusterRoleTemplateBindingFieldExpiresAt        = "expiresAt"
 	ClusterRoleTemplateBindingFieldGroupID          = "groupId"
 	ClusterRoleTemplateBindingFieldGroupPrincipalID = "groupPrincipalId"
 	ClusterRoleTemplateBindingFieldLabels           = "labels"
@@ -29,6 +30,7 @@ type ClusterRoleTemplateBinding struct {
 	ClusterID        string            `json:"clusterId,omitempty" yaml:"clusterId,omitempty"`
 	Created          string            `json:"created,omitempty" yaml:"created,omitempty"`
 	CreatorID        string            `json:"creatorId,omitempty" yaml:"creatorId,omitempty"`
+	ExpiresAt        string            `json:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
 	GroupID          string            `json:"groupId,omitempty" yaml:"groupId,omitempty"`
 	GroupPrincipalID string            `json:"groupPrincipalId,omitempty" yaml:"groupPrincipalId,omitempty"`
 	Labels           map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
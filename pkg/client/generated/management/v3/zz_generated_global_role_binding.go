@@ -9,6 +9,7 @@
 	GlobalRoleBindingFieldAnnotations      = "annotations"
 	GlobalRoleBindingFieldCreated          = "created"
 	GlobalRoleBindingFieldCreatorID        = "creatorId"
+	GlobalRoleBindingFieldExpiresAt        = "expiresAt"
 	GlobalRoleBindingFieldGlobalRoleID     = "globalRoleId"
 	GlobalRoleBindingFieldGroupPrincipalID = "groupPrincipalId"
 	GlobalRoleBindingFieldLabels           = "labels"
@@ -24,6 +25,7 @@ type GlobalRoleBinding struct {
 	Annotations      map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
 	Created          string            `json:"created,omitempty" yaml:"created,omitempty"`
 	CreatorID        string            `json:"creatorId,omitempty" yaml:"creatorId,omitempty"`
+	ExpiresAt        string            `json:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
 	GlobalRoleID     string            `json:"globalRoleId,omitempty" yaml:"globalRoleId,omitempty"`
 	GroupPrincipalID string            `json:"groupPrincipalId,omitempty" yaml:"groupPrincipalId,omitempty"`
 	Labels           map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
@@ -0,0 +1,14 @@
+package client
+
+const (
+	MFAEnrollmentType                 = "mfaEnrollment"
+	MFAEnrollmentFieldProvisioningURI = "provisioningUri"
+	MFAEnrollmentFieldRecoveryCodes   = "recoveryCodes"
+	MFAEnrollmentFieldSecret          = "secret"
+)
+
+type MFAEnrollment struct {
+	ProvisioningURI string   `json:"provisioningUri,omitempty" yaml:"provisioningUri,omitempty"`
+	RecoveryCodes   []string `json:"recoveryCodes,omitempty" yaml:"recoveryCodes,omitempty"`
+	Secret          string   `json:"secret,omitempty" yaml:"secret,omitempty"`
+}
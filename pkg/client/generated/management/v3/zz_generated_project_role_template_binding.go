@@ -9,6 +9,7 @@
 	ProjectRoleTemplateBindingFieldAnnotations      = "annotations"
 	ProjectRoleTemplateBindingFieldCreated          = "created"
 	ProjectRoleTemplateBindingFieldCreatorID        = "creatorId"
+	ProjectRoleTemplateBindingFieldExpiresAt        = "expiresAt"
 	ProjectRoleTemplateBindingFieldGroupID          = "groupId"
 	ProjectRoleTemplateBindingFieldGroupPrincipalID = "groupPrincipalId"
 	ProjectRoleTemplateBindingFieldLabels           = "labels"
@@ -29,6 +30,7 @@ type ProjectRoleTemplateBinding struct {
 	Annotations      map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
 	Created          string            `json:"created,omitempty" yaml:"created,omitempty"`
 	CreatorID        string            `json:"creatorId,omitempty" yaml:"creatorId,omitempty"`
+	ExpiresAt        string            `json:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
 	GroupID          string            `json:"groupId,omitempty" yaml:"groupId,omitempty"`
 	GroupPrincipalID string            `json:"groupPrincipalId,omitempty" yaml:"groupPrincipalId,omitempty"`
 	Labels           map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
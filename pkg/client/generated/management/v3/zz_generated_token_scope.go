@@ -0,0 +1,16 @@
+package client
+
+const (
+	TokenScopeType           = "tokenScope"
+	TokenScopeFieldAPIGroups = "apiGroups"
+	TokenScopeFieldClusters  = "clusters"
+	TokenScopeFieldResources = "resources"
+	TokenScopeFieldVerbs     = "verbs"
+)
+
+type TokenScope struct {
+	APIGroups []string `json:"apiGroups,omitempty" yaml:"apiGroups,omitempty"`
+	Clusters  []string `json:"clusters,omitempty" yaml:"clusters,omitempty"`
+	Resources []string `json:"resources,omitempty" yaml:"resources,omitempty"`
+	Verbs     []string `json:"verbs,omitempty" yaml:"verbs,omitempty"`
+}
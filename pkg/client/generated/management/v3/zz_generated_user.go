@@ -18,6 +18,8 @@
 	UserFieldName                 = "name"
 	UserFieldOwnerReferences      = "ownerReferences"
 	UserFieldPassword             = "password"
+	UserFieldPasswordChangedAt    = "passwordChangedAt"
+	UserFieldPasswordHistory      = "passwordHistory"
 	UserFieldPrincipalIDs         = "principalIds"
 	UserFieldRemoved              = "removed"
 	UserFieldState                = "state"
@@ -41,6 +43,8 @@ type User struct {
 	Name                 string            `json:"name,omitempty" yaml:"name,omitempty"`
 	OwnerReferences      []OwnerReference  `json:"ownerReferences,omitempty" yaml:"ownerReferences,omitempty"`
 	Password             string            `json:"password,omitempty" yaml:"password,omitempty"`
+	PasswordChangedAt    string            `json:"passwordChangedAt,omitempty" yaml:"passwordChangedAt,omitempty"`
+	PasswordHistory      []string          `json:"passwordHistory,omitempty" yaml:"passwordHistory,omitempty"`
 	PrincipalIDs         []string          `json:"principalIds,omitempty" yaml:"principalIds,omitempty"`
 	Removed              string            `json:"removed,omitempty" yaml:"removed,omitempty"`
 	State                string            `json:"state,omitempty" yaml:"state,omitempty"`
@@ -71,10 +75,20 @@ type UserOperations interface {
 
 	ActionRefreshauthprovideraccess(resource *User) error
 
+	ActionResetmfa(resource *User) error
+
 	ActionSetpassword(resource *User, input *SetPasswordInput) (*User, error)
 
+	ActionUnlock(resource *User) error
+
 	CollectionActionChangepassword(resource *UserCollection, input *ChangePasswordInput) error
 
+	CollectionActionConfirmmfa(resource *UserCollection, input *MFACodeInput) error
+
+	CollectionActionDisablemfa(resource *UserCollection, input *MFACodeInput) error
+
+	CollectionActionEnrollmfa(resource *UserCollection) (*MFAEnrollment, error)
+
 	CollectionActionRefreshauthprovideraccess(resource *UserCollection) error
 }
 
@@ -152,17 +166,43 @@ func (c *UserClient) ActionRefreshauthprovideraccess(resource *User) error {
 	return err
 }
 
+func (c *UserClient) ActionResetmfa(resource *User) error {
+	err := c.apiClient.Ops.DoAction(UserType, "resetmfa", &resource.Resource, nil, nil)
+	return err
+}
+
 func (c *UserClient) ActionSetpassword(resource *User, input *SetPasswordInput) (*User, error) {
 	resp := &User{}
 	err := c.apiClient.Ops.DoAction(UserType, "setpassword", &resource.Resource, input, resp)
 	return resp, err
 }
 
+func (c *UserClient) ActionUnlock(resource *User) error {
+	err := c.apiClient.Ops.DoAction(UserType, "unlock", &resource.Resource, nil, nil)
+	return err
+}
+
 func (c *UserClient) CollectionActionChangepassword(resource *UserCollection, input *ChangePasswordInput) error {
 	err := c.apiClient.Ops.DoCollectionAction(UserType, "changepassword", &resource.Collection, input, nil)
 	return err
 }
 
+func (c *UserClient) CollectionActionConfirmmfa(resource *UserCollection, input *MFACodeInput) error {
+	err := c.apiClient.Ops.DoCollectionAction(UserType, "confirmmfa", &resource.Collection, input, nil)
+	return err
+}
+
+func (c *UserClient) CollectionActionDisablemfa(resource *UserCollection, input *MFACodeInput) error {
+	err := c.apiClient.Ops.DoCollectionAction(UserType, "disablemfa", &resource.Collection, input, nil)
+	return err
+}
+
+func (c *UserClient) CollectionActionEnrollmfa(resource *UserCollection) (*MFAEnrollment, error) {
+	resp := &MFAEnrollment{}
+	err := c.apiClient.Ops.DoCollectionAction(UserType, "enrollmfa", &resource.Collection, nil, resp)
+	return resp, err
+}
+
 func (c *UserClient) CollectionActionRefreshauthprovideraccess(resource *UserCollection) error {
 	err := c.apiClient.Ops.DoCollectionAction(UserType, "refreshauthprovideraccess", &resource.Collection, nil, nil)
 	return err
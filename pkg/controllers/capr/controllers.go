@@ -24,13 +24,18 @@
 	"github.com/rancher/rancher/pkg/wrangler"
 )
 
-func Register(ctx context.Context, clients *wrangler.Context, kubeconfigManager *kubeconfig.Manager) {
-	rkePlanner := planner.New(ctx, clients, planner.InfoFunctions{
+// PlannerInfoFunctions returns the functions the planner uses to retrieve Rancher specific information.
+func PlannerInfoFunctions(clients *wrangler.Context) planner.InfoFunctions {
+	return planner.InfoFunctions{
 		ImageResolver:           image.ResolveWithControlPlane,
 		ReleaseData:             capr.GetKDMReleaseData,
 		SystemAgentImage:        settings.SystemAgentInstallerImage.Get,
 		SystemPodLabelSelectors: systeminfo.NewRetriever(clients).GetSystemPodLabelSelectors,
-	})
+	}
+}
+
+func Register(ctx context.Context, clients *wrangler.Context, kubeconfigManager *kubeconfig.Manager) {
+	rkePlanner := planner.New(ctx, clients, PlannerInfoFunctions(clients))
 	if features.MCM.Enabled() {
 		dynamicschema.Register(ctx, clients)
 		machineprovision.Register(ctx, clients, kubeconfigManager)
@@ -0,0 +1,61 @@
+package etcdmgmt
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// RetainedSnapshot is an etcd snapshot the retention policy of the cluster was applied to by the system-agent.
+type RetainedSnapshot struct {
+	Name string
+	// Tiers are the tiers of the retention policy the snapshot is kept by, it is empty if the snapshot is eligible for
+	// deletion.
+	Tiers []string
+}
+
+// ParseRetainedSnapshots parses the output of the periodic instruction applying the retention policy of the cluster to
+// the etcd snapshots of a node, which lists the snapshots as: storage name tiers. It returns the local and S3
+// snapshots.
+func ParseRetainedSnapshots(output []byte) (local, s3 map[string]RetainedSnapshot) {
+	local = map[string]RetainedSnapshot{}
+	s3 = map[string]RetainedSnapshot{}
+	scanner := bufio.NewScanner(bytes.NewBuffer(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		s := RetainedSnapshot{Name: fields[1]}
+		if fields[2] != "-" {
+			s.Tiers = strings.Split(fields[2], ",")
+		}
+		switch fields[0] {
+		case "local":
+			local[s.Name] = s
+		case "s3":
+			s3[s.Name] = s
+		}
+	}
+	return local, s3
+}
+
+// SetRetentionStatus sets the retention of a snapshot on status, it returns true if the status changed. The retention
+// is removed if retained is nil.
+func SetRetentionStatus(status *rkev1.ETCDSnapshotStatus, retained *RetainedSnapshot) bool {
+	var retention *rkev1.ETCDSnapshotRetentionStatus
+	if retained != nil {
+		retention = &rkev1.ETCDSnapshotRetentionStatus{
+			Pinned: len(retained.Tiers) > 0,
+			Tiers:  retained.Tiers,
+		}
+	}
+	if equality.Semantic.DeepEqual(status.Retention, retention) {
+		return false
+	}
+	status.Retention = retention
+	return true
+}
@@ -0,0 +1,40 @@
+package etcdmgmt
+
+import (
+	"testing"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetainedSnapshots(t *testing.T) {
+	output := []byte(`local etcd-snapshot-a-3 hourly,daily,weekly
+local etcd-snapshot-a-2 -
+s3 etcd-snapshot-a-3 age
+invalid line
+other etcd-snapshot-a-1 hourly
+`)
+	local, s3 := ParseRetainedSnapshots(output)
+	assert.Equal(t, map[string]RetainedSnapshot{
+		"etcd-snapshot-a-3": {Name: "etcd-snapshot-a-3", Tiers: []string{"hourly", "daily", "weekly"}},
+		"etcd-snapshot-a-2": {Name: "etcd-snapshot-a-2"},
+	}, local)
+	assert.Equal(t, map[string]RetainedSnapshot{
+		"etcd-snapshot-a-3": {Name: "etcd-snapshot-a-3", Tiers: []string{"age"}},
+	}, s3)
+}
+
+func TestSetRetentionStatus(t *testing.T) {
+	status := rkev1.ETCDSnapshotStatus{}
+
+	assert.True(t, SetRetentionStatus(&status, &RetainedSnapshot{Name: "etcd-snapshot-a-1", Tiers: []string{"daily"}}))
+	assert.Equal(t, &rkev1.ETCDSnapshotRetentionStatus{Pinned: true, Tiers: []string{"daily"}}, status.Retention)
+	assert.False(t, SetRetentionStatus(&status, &RetainedSnapshot{Name: "etcd-snapshot-a-1", Tiers: []string{"daily"}}))
+
+	assert.True(t, SetRetentionStatus(&status, &RetainedSnapshot{Name: "etcd-snapshot-a-1"}))
+	assert.Equal(t, &rkev1.ETCDSnapshotRetentionStatus{}, status.Retention, "the snapshot is eligible for deletion")
+
+	assert.True(t, SetRetentionStatus(&status, nil))
+	assert.Nil(t, status.Retention)
+	assert.False(t, SetRetentionStatus(&status, nil))
+}
@@ -0,0 +1,90 @@
+package etcdmgmt
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UnknownKeyVersion is the key version of the encrypted snapshots in S3 uploaded by another node.
+const UnknownKeyVersion = "?"
+
+// UploadedSnapshot is an etcd snapshot uploaded to S3 by the system-agent.
+type UploadedSnapshot struct {
+	Name string
+	// KeyVersion is the version of the key the snapshot was encrypted with, it is empty if the snapshot is not
+	// encrypted and UnknownKeyVersion if it was uploaded by another node.
+	KeyVersion string
+	Size       int64
+	CreatedAt  *metav1.Time
+}
+
+// ParseUploadedSnapshots parses the output of the periodic instructions uploading etcd snapshots to S3, which list the
+// uploaded snapshots as: name key-version size created. The key version is - if the snapshot is not encrypted.
+func ParseUploadedSnapshots(output []byte) map[string]UploadedSnapshot {
+	snapshots := map[string]UploadedSnapshot{}
+	scanner := bufio.NewScanner(bytes.NewBuffer(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			logrus.Errorf("error parsing uploaded etcd snapshot output (%s): %v", scanner.Text(), err)
+			continue
+		}
+		s := UploadedSnapshot{
+			Name:       fields[0],
+			KeyVersion: strings.TrimPrefix(fields[1], "-"),
+			Size:       size,
+		}
+		if createdAt, err := time.Parse(time.RFC3339, fields[3]); err == nil {
+			s.CreatedAt = &metav1.Time{Time: createdAt}
+		}
+		snapshots[s.Name] = s
+	}
+	return snapshots
+}
+
+// SetS3TargetStatus sets the status of the S3 target targetStatus.Name on status, it returns true if the status changed.
+func SetS3TargetStatus(status *rkev1.ETCDSnapshotStatus, targetStatus rkev1.ETCDSnapshotS3TargetStatus) bool {
+	for i, existing := range status.S3Targets {
+		if existing.Name == targetStatus.Name {
+			if existing == targetStatus {
+				return false
+			}
+			status.S3Targets[i] = targetStatus
+			return true
+		}
+	}
+	status.S3Targets = append(status.S3Targets, targetStatus)
+	return true
+}
+
+// RemoveS3TargetStatus removes the status of the S3 targets that keep returns false for from status, it returns true
+// if the status changed.
+func RemoveS3TargetStatus(status *rkev1.ETCDSnapshotStatus, keep func(name string) bool) bool {
+	var targets []rkev1.ETCDSnapshotS3TargetStatus
+	for _, target := range status.S3Targets {
+		if keep(target.Name) {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == len(status.S3Targets) {
+		return false
+	}
+	status.S3Targets = targets
+	return true
+}
+
+// InS3Targets returns true if the etcd snapshot was uploaded to any S3 target.
+func InS3Targets(snapshot *rkev1.ETCDSnapshot) bool {
+	return len(snapshot.Status.S3Targets) > 0
+}
@@ -0,0 +1,54 @@
+package etcdmgmt
+
+import (
+	"testing"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseUploadedSnapshots(t *testing.T) {
+	output := []byte(`etcd-snapshot-a-1 v1 1024 2023-09-01T00:00:00Z
+etcd-snapshot-a-2 - 2048 2023-09-02T00:00:00Z
+invalid line
+etcd-snapshot-a-3 v1 notanumber 2023-09-03T00:00:00Z
+etcd-snapshot-b-4 ? 0 2023-09-04T00:00:00.000Z
+`)
+	assert.Equal(t, map[string]UploadedSnapshot{
+		"etcd-snapshot-a-1": {
+			Name:       "etcd-snapshot-a-1",
+			KeyVersion: "v1",
+			Size:       1024,
+			CreatedAt:  &metav1.Time{Time: time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		"etcd-snapshot-a-2": {
+			Name:      "etcd-snapshot-a-2",
+			Size:      2048,
+			CreatedAt: &metav1.Time{Time: time.Date(2023, 9, 2, 0, 0, 0, 0, time.UTC)},
+		},
+		"etcd-snapshot-b-4": {
+			Name:       "etcd-snapshot-b-4",
+			KeyVersion: UnknownKeyVersion,
+			CreatedAt:  &metav1.Time{Time: time.Date(2023, 9, 4, 0, 0, 0, 0, time.UTC)},
+		},
+	}, ParseUploadedSnapshots(output))
+}
+
+func TestS3TargetStatus(t *testing.T) {
+	status := rkev1.ETCDSnapshotStatus{}
+	dr := rkev1.ETCDSnapshotS3TargetStatus{Name: "dr", Location: "s3://dr/etcd-snapshot-a-1", Size: 1024}
+
+	assert.True(t, SetS3TargetStatus(&status, dr))
+	assert.False(t, SetS3TargetStatus(&status, dr), "the status did not change")
+	assert.True(t, SetS3TargetStatus(&status, rkev1.ETCDSnapshotS3TargetStatus{Name: "archive", Location: "s3://archive/etcd-snapshot-a-1.enc", KeyVersion: "v1"}))
+	assert.Len(t, status.S3Targets, 2)
+	assert.True(t, InS3Targets(&rkev1.ETCDSnapshot{Status: status}))
+
+	assert.False(t, RemoveS3TargetStatus(&status, func(string) bool { return true }))
+	assert.True(t, RemoveS3TargetStatus(&status, func(name string) bool { return name != "archive" }))
+	assert.Equal(t, []rkev1.ETCDSnapshotS3TargetStatus{dr}, status.S3Targets)
+	assert.True(t, RemoveS3TargetStatus(&status, func(string) bool { return false }))
+	assert.False(t, InS3Targets(&rkev1.ETCDSnapshot{Status: status}))
+}
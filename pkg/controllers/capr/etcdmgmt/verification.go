@@ -0,0 +1,80 @@
+package etcdmgmt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VerifiedSnapshot is a local etcd snapshot verified by the system-agent.
+type VerifiedSnapshot struct {
+	Name   string
+	SHA256 string
+	// TestRestore is ok or failed if the snapshot was test restored, unsupported if the node cannot test restore
+	// snapshots, it is empty otherwise.
+	TestRestore string
+}
+
+// ParseVerifiedSnapshots parses the output of the periodic instruction verifying the local etcd snapshots of a node,
+// which lists the snapshots as: name sha256 restore. The restore is - if the snapshot was not test restored.
+func ParseVerifiedSnapshots(output []byte) map[string]VerifiedSnapshot {
+	snapshots := map[string]VerifiedSnapshot{}
+	scanner := bufio.NewScanner(bytes.NewBuffer(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		snapshots[fields[0]] = VerifiedSnapshot{
+			Name:        fields[0],
+			SHA256:      fields[1],
+			TestRestore: strings.TrimPrefix(fields[2], "-"),
+		}
+	}
+	return snapshots
+}
+
+// SetVerificationStatus sets the result of the verification of a snapshot at the given time on status, it returns true
+// if the status changed. The checksum is recorded by the first verification that does not fail, so that the checksum of
+// a snapshot that was not completely written is never recorded, later verifications fail if the snapshot does not match
+// it anymore. A failed verification is cleared by a later one that succeeds.
+func SetVerificationStatus(status *rkev1.ETCDSnapshotStatus, verified VerifiedSnapshot, verifiedAt metav1.Time) bool {
+	if status.Verification != nil && status.Verification.LastVerified != nil && status.Verification.LastVerified.Equal(&verifiedAt) {
+		return false
+	}
+
+	verification := &rkev1.ETCDSnapshotVerificationStatus{
+		Result:       rkev1.ETCDSnapshotVerified,
+		SHA256:       verified.SHA256,
+		TestRestored: verified.TestRestore == "ok",
+		LastVerified: &verifiedAt,
+	}
+	if status.Verification != nil && status.Verification.SHA256 != "" {
+		verification.SHA256 = status.Verification.SHA256
+	}
+	switch {
+	case verification.SHA256 != verified.SHA256:
+		verification.Result = rkev1.ETCDSnapshotVerificationFailed
+		verification.Message = fmt.Sprintf("checksum %s does not match the recorded checksum %s", verified.SHA256, verification.SHA256)
+	case verified.TestRestore == "failed":
+		verification.Result = rkev1.ETCDSnapshotVerificationFailed
+		verification.Message = "test restore failed"
+		if status.Verification == nil || status.Verification.SHA256 == "" {
+			// the checksum is recorded once the snapshot passes a verification
+			verification.SHA256 = ""
+		}
+	case verified.TestRestore == "unsupported":
+		verification.Result = rkev1.ETCDSnapshotVerificationUnsupported
+		verification.Message = "test restore is not supported on the node, it requires the etcd image of RKE2 or the etcd and etcdutl binaries"
+	case verified.TestRestore == "" && status.Verification != nil:
+		// the snapshot is only test restored on the test restore machine, keep its result when it is checksummed
+		verification.TestRestored = status.Verification.TestRestored
+	}
+
+	status.Verification = verification
+	return true
+}
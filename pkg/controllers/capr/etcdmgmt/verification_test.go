@@ -0,0 +1,76 @@
+package etcdmgmt
+
+import (
+	"testing"
+	"time"
+
+	rkev1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseVerifiedSnapshots(t *testing.T) {
+	output := []byte(`etcd-snapshot-a-1 aaaa ok
+etcd-snapshot-a-2 bbbb -
+etcd-snapshot-a-3 cccc unsupported
+invalid line
+`)
+	assert.Equal(t, map[string]VerifiedSnapshot{
+		"etcd-snapshot-a-1": {Name: "etcd-snapshot-a-1", SHA256: "aaaa", TestRestore: "ok"},
+		"etcd-snapshot-a-2": {Name: "etcd-snapshot-a-2", SHA256: "bbbb"},
+		"etcd-snapshot-a-3": {Name: "etcd-snapshot-a-3", SHA256: "cccc", TestRestore: "unsupported"},
+	}, ParseVerifiedSnapshots(output))
+}
+
+func TestSetVerificationStatus(t *testing.T) {
+	first := metav1.NewTime(time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC))
+	second := metav1.NewTime(first.Add(time.Hour))
+	third := metav1.NewTime(second.Add(time.Hour))
+	status := rkev1.ETCDSnapshotStatus{}
+
+	assert.True(t, SetVerificationStatus(&status, VerifiedSnapshot{SHA256: "aaaa", TestRestore: "ok"}, first))
+	assert.Equal(t, &rkev1.ETCDSnapshotVerificationStatus{
+		Result:       rkev1.ETCDSnapshotVerified,
+		SHA256:       "aaaa",
+		TestRestored: true,
+		LastVerified: &first,
+	}, status.Verification)
+	assert.False(t, SetVerificationStatus(&status, VerifiedSnapshot{SHA256: "aaaa", TestRestore: "ok"}, first), "the verification did not run again")
+
+	assert.True(t, SetVerificationStatus(&status, VerifiedSnapshot{SHA256: "aaaa"}, second))
+	assert.Equal(t, rkev1.ETCDSnapshotVerified, status.Verification.Result)
+	assert.True(t, status.Verification.TestRestored, "the result of the test restore is kept when the snapshot is only checksummed")
+	assert.Equal(t, &second, status.Verification.LastVerified)
+
+	assert.True(t, SetVerificationStatus(&status, VerifiedSnapshot{SHA256: "bbbb", TestRestore: "ok"}, third))
+	assert.Equal(t, rkev1.ETCDSnapshotVerificationFailed, status.Verification.Result)
+	assert.Equal(t, "aaaa", status.Verification.SHA256, "the recorded checksum is kept")
+	assert.Contains(t, status.Verification.Message, "does not match")
+
+	assert.True(t, SetVerificationStatus(&status, VerifiedSnapshot{SHA256: "aaaa"}, metav1.NewTime(third.Add(time.Hour))))
+	assert.Equal(t, rkev1.ETCDSnapshotVerified, status.Verification.Result, "a later verification clears the failure")
+	assert.Empty(t, status.Verification.Message)
+
+	status = rkev1.ETCDSnapshotStatus{}
+	assert.True(t, SetVerificationStatus(&status, VerifiedSnapshot{SHA256: "aaaa", TestRestore: "failed"}, first))
+	assert.Equal(t, rkev1.ETCDSnapshotVerificationFailed, status.Verification.Result)
+	assert.False(t, status.Verification.TestRestored)
+	assert.Equal(t, "test restore failed", status.Verification.Message)
+	assert.Empty(t, status.Verification.SHA256, "the checksum of a snapshot that failed its first verification is not recorded")
+
+	assert.True(t, SetVerificationStatus(&status, VerifiedSnapshot{SHA256: "bbbb", TestRestore: "ok"}, second))
+	assert.Equal(t, rkev1.ETCDSnapshotVerified, status.Verification.Result, "a later verification clears the failure")
+	assert.Equal(t, "bbbb", status.Verification.SHA256)
+	assert.True(t, status.Verification.TestRestored)
+
+	assert.True(t, SetVerificationStatus(&status, VerifiedSnapshot{SHA256: "bbbb", TestRestore: "failed"}, third))
+	assert.Equal(t, "bbbb", status.Verification.SHA256, "the recorded checksum is kept when a later test restore fails")
+
+	status = rkev1.ETCDSnapshotStatus{}
+	assert.True(t, SetVerificationStatus(&status, VerifiedSnapshot{SHA256: "aaaa", TestRestore: "unsupported"}, first))
+	assert.Equal(t, rkev1.ETCDSnapshotVerificationUnsupported, status.Verification.Result, "a node without the tools to test restore does not fail the verification")
+	assert.False(t, status.Verification.TestRestored)
+
+	assert.True(t, SetVerificationStatus(&status, VerifiedSnapshot{SHA256: "bbbb", TestRestore: "unsupported"}, second))
+	assert.Equal(t, rkev1.ETCDSnapshotVerificationFailed, status.Verification.Result, "a checksum mismatch still fails the verification")
+}
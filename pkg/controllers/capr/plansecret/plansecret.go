@@ -11,9 +11,12 @@
 	v1 "github.com/rancher/rancher/pkg/apis/rke.cattle.io/v1"
 	"github.com/rancher/rancher/pkg/capr"
 	"github.com/rancher/rancher/pkg/capr/planner"
+	"github.com/rancher/rancher/pkg/controllers/capr/etcdmgmt"
 	sb "github.com/rancher/rancher/pkg/controllers/managementuser/snapshotbackpopulate"
 	capicontrollers "github.com/rancher/rancher/pkg/generated/controllers/cluster.x-k8s.io/v1beta1"
+	provcontrollers "github.com/rancher/rancher/pkg/generated/controllers/provisioning.cattle.io/v1"
 	rkev1controllers "github.com/rancher/rancher/pkg/generated/controllers/rke.cattle.io/v1"
+	"github.com/rancher/rancher/pkg/settings"
 	"github.com/rancher/rancher/pkg/wrangler"
 	corecontrollers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
 	"github.com/rancher/wrangler/pkg/name"
@@ -28,19 +31,25 @@
 
 type handler struct {
 	secrets             corecontrollers.SecretClient
+	secretsCache        corecontrollers.SecretCache
 	machinesCache       capicontrollers.MachineCache
 	machinesClient      capicontrollers.MachineClient
 	etcdSnapshotsClient rkev1controllers.ETCDSnapshotClient
 	etcdSnapshotsCache  rkev1controllers.ETCDSnapshotCache
+	controlPlanesCache  rkev1controllers.RKEControlPlaneCache
+	clustersCache       provcontrollers.ClusterCache
 }
 
 func Register(ctx context.Context, clients *wrangler.Context) {
 	h := handler{
 		secrets:             clients.Core.Secret(),
+		secretsCache:        clients.Core.Secret().Cache(),
 		machinesCache:       clients.CAPI.Machine().Cache(),
 		machinesClient:      clients.CAPI.Machine(),
 		etcdSnapshotsClient: clients.RKE.ETCDSnapshot(),
 		etcdSnapshotsCache:  clients.RKE.ETCDSnapshot().Cache(),
+		controlPlanesCache:  clients.RKE.RKEControlPlane().Cache(),
+		clustersCache:       clients.Provisioning.Cluster().Cache(),
 	}
 	clients.Core.Secret().OnChange(ctx, "plan-secret", h.OnChange)
 }
@@ -69,6 +78,36 @@ func (h *handler) OnChange(key string, secret *corev1.Secret) (*corev1.Secret, e
 		}
 	}
 
+	if v, ok := node.PeriodicOutput[planner.ETCDSnapshotUploadEncryptedInstructionName]; ok && v.ExitCode == 0 && v.LastSuccessfulRunTime != "" {
+		if err := h.reconcileEncryptedEtcdSnapshotList(secret, v.Stdout, v.LastSuccessfulRunTime); err != nil {
+			logrus.Errorf("[plansecret] error reconciling encrypted S3 snapshot list for secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		}
+	}
+
+	s3TargetUploads := map[string][]byte{}
+	for instructionName, v := range node.PeriodicOutput {
+		if target, ok := planner.ETCDSnapshotS3TargetFromInstruction(instructionName); ok && v.ExitCode == 0 {
+			s3TargetUploads[target] = v.Stdout
+		}
+	}
+	if _, ok := node.PeriodicOutput["etcd-snapshot-list-local"]; ok || len(s3TargetUploads) > 0 {
+		if err := h.reconcileEtcdSnapshotS3Targets(secret, s3TargetUploads); err != nil {
+			logrus.Errorf("[plansecret] error reconciling S3 targets of snapshots for secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		}
+	}
+
+	if v, ok := node.PeriodicOutput[planner.ETCDSnapshotRetentionInstructionName]; ok && v.ExitCode == 0 {
+		if err := h.reconcileEtcdSnapshotRetention(secret, v.Stdout); err != nil {
+			logrus.Errorf("[plansecret] error reconciling retention of snapshots for secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		}
+	}
+
+	if v, ok := node.PeriodicOutput[planner.ETCDSnapshotVerificationInstructionName]; ok && v.ExitCode == 0 && v.LastSuccessfulRunTime != "" {
+		if err := h.reconcileEtcdSnapshotVerification(secret, v.Stdout, v.LastSuccessfulRunTime); err != nil {
+			logrus.Errorf("[plansecret] error reconciling verification of snapshots for secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		}
+	}
+
 	appliedChecksum := string(secret.Data["applied-checksum"])
 	failedChecksum := string(secret.Data["failed-checksum"])
 	plan := secret.Data["plan"]
@@ -101,6 +140,23 @@ func (h *handler) OnChange(key string, secret *corev1.Secret) (*corev1.Secret, e
 		}
 	}
 
+	if node != nil && len(plan) > 0 {
+		var revision *planner.PlanRevision
+		if appliedChecksum == planner.PlanHash(plan) {
+			revision = &planner.PlanRevision{Checksum: appliedChecksum}
+		} else if failedChecksum == planner.PlanHash(plan) {
+			revision = &planner.PlanRevision{Checksum: failedChecksum, Failed: true}
+		}
+		if revision != nil {
+			revision.Timestamp = metav1.NewTime(time.Now().UTC())
+			revision.Output = node.Output
+			revision.Plan = planner.DigestPlan(node.Plan)
+			if err := h.recordPlanHistory(secret, *revision); err != nil {
+				return secret, fmt.Errorf("failed to record plan history for secret %s/%s: %w", secret.Namespace, secret.Name, err)
+			}
+		}
+	}
+
 	if failedChecksum == planner.PlanHash(plan) {
 		logrus.Debugf("[plansecret] %s/%s: rv: %s: Detected failed plan application, reconciling machine PlanApplied condition to error", secret.Namespace, secret.Name, secret.ResourceVersion)
 		err = h.reconcileMachinePlanAppliedCondition(secret, fmt.Errorf("error applying plan -- check rancher-system-agent.service logs on node for more information"))
@@ -112,6 +168,65 @@ func (h *handler) OnChange(key string, secret *corev1.Secret) (*corev1.Secret, e
 	return secret, err
 }
 
+// recordPlanHistory appends revision to the plan history of the machine of the plan secret, unless it is the latest
+// revision already. The history secret is owned by the plan secret so that it is removed along with it.
+func (h *handler) recordPlanHistory(secret *corev1.Secret, revision planner.PlanRevision) error {
+	limit := settings.MachinePlanHistoryLimit.GetInt()
+	if limit <= 0 {
+		return nil
+	}
+
+	historySecret, err := h.secretsCache.Get(secret.Namespace, planner.PlanHistorySecretName(secret.Name))
+	if apierrors.IsNotFound(err) {
+		historySecret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      planner.PlanHistorySecretName(secret.Name),
+				Namespace: secret.Namespace,
+				Labels: map[string]string{
+					planner.PlanHistoryMachineNameLabel: secret.Labels[capr.MachineNameLabel],
+				},
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion: "v1",
+						Kind:       "Secret",
+						Name:       secret.Name,
+						UID:        secret.UID,
+					},
+				},
+			},
+			Type: capr.SecretTypeMachinePlanHistory,
+		}
+	} else if err != nil {
+		return err
+	}
+
+	history, err := planner.DecodePlanHistory(historySecret)
+	if err != nil {
+		return err
+	}
+	history, appended := planner.AppendPlanRevision(history, revision, limit)
+	if !appended {
+		return nil
+	}
+	data, err := planner.EncodePlanHistory(history)
+	if err != nil {
+		return err
+	}
+
+	historySecret = historySecret.DeepCopy()
+	if historySecret.Data == nil {
+		historySecret.Data = map[string][]byte{}
+	}
+	historySecret.Data[planner.PlanHistoryKey] = data
+	logrus.Debugf("[plansecret] %s/%s: recording plan revision %d with checksum %s", secret.Namespace, secret.Name, history[len(history)-1].Revision, revision.Checksum)
+	if historySecret.ResourceVersion == "" {
+		_, err = h.secrets.Create(historySecret)
+	} else {
+		_, err = h.secrets.Update(historySecret)
+	}
+	return err
+}
+
 func (h *handler) reconcileMachinePlanAppliedCondition(secret *corev1.Secret, planAppliedErr error) error {
 	if secret == nil {
 		logrus.Debug("[plansecret] secret was nil when reconciling machine status")
@@ -213,7 +328,7 @@ func (h *handler) reconcileEtcdSnapshotList(secret *corev1.Secret, s3 bool, list
 	indexedEtcdSnapshots := map[string]*v1.ETCDSnapshot{}
 
 	for _, v := range etcdSnapshots {
-		if _, ok := etcdSnapshotsOnNode[v.Name]; !ok && v.Status.Missing {
+		if _, ok := etcdSnapshotsOnNode[v.Name]; !ok && v.Status.Missing && !etcdmgmt.InS3Targets(v) {
 			// delete the etcd snapshot as it is missing
 			logrus.Infof("[plansecret] Deleting etcd snapshot %s/%s", v.Namespace, v.Name)
 			if err := h.etcdSnapshotsClient.Delete(v.Namespace, v.Name, &metav1.DeleteOptions{}); err != nil {
@@ -264,6 +379,328 @@ func (h *handler) reconcileEtcdSnapshotList(secret *corev1.Secret, s3 bool, list
 	return nil
 }
 
+// reconcileEncryptedEtcdSnapshotList creates the etcd snapshot objects of the snapshots the node encrypted and uploaded
+// to S3. Encrypted snapshots are uploaded by the system-agent, so they are not known to the distribution and not
+// reconciled by the snapshotbackpopulate controller. As the output lists every encrypted snapshot in the bucket, the
+// output of the init node is used to delete the objects of the snapshots that are no longer in the bucket, e.g. as they
+// were pruned by the retention, unless they were created shortly before the last upload of the init node, which may not
+// have listed them yet.
+func (h *handler) reconcileEncryptedEtcdSnapshotList(secret *corev1.Secret, uploadStdout []byte, lastRunTime string) error {
+	cnl := secret.Labels[capr.ClusterNameLabel]
+	if len(cnl) == 0 {
+		return fmt.Errorf("node secret did not have label %s", capr.ClusterNameLabel)
+	}
+
+	controlPlane, err := h.controlPlanesCache.Get(secret.Namespace, cnl)
+	if err != nil {
+		return err
+	}
+	if controlPlane.Spec.ETCD == nil || !planner.S3EncryptionEnabled(controlPlane.Spec.ETCD.S3) {
+		return nil
+	}
+	cluster, err := h.clustersCache.Get(secret.Namespace, cnl)
+	if err != nil {
+		return err
+	}
+
+	uploadedSnapshots := etcdmgmt.ParseUploadedSnapshots(uploadStdout)
+	if secret.Labels[capr.InitNodeLabel] == "true" {
+		if err := h.deleteRemovedEncryptedEtcdSnapshots(secret.Namespace, cnl, uploadedSnapshots, lastRunTime); err != nil {
+			return err
+		}
+	}
+
+	for _, uploaded := range uploadedSnapshots {
+		if uploaded.KeyVersion == etcdmgmt.UnknownKeyVersion {
+			// the snapshot was uploaded by another node, which creates its object
+			continue
+		}
+		snapshotName := name.SafeConcatName(cnl, strings.ToLower(sb.InvalidKeyChars.ReplaceAllString(uploaded.Name, "-")), sb.StorageS3)
+		if _, err := h.etcdSnapshotsCache.Get(secret.Namespace, snapshotName); err == nil || !apierrors.IsNotFound(err) {
+			continue
+		}
+
+		s3 := controlPlane.Spec.ETCD.S3.DeepCopy()
+		s3.Encryption.KeyVersion = uploaded.KeyVersion
+		snapshot := &v1.ETCDSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      snapshotName,
+				Namespace: secret.Namespace,
+				Labels: map[string]string{
+					capr.ClusterNameLabel: cnl,
+					capr.NodeNameLabel:    sb.StorageS3,
+				},
+				Annotations: map[string]string{
+					sb.SnapshotNameKey:      uploaded.Name,
+					sb.StorageAnnotationKey: sb.StorageS3,
+				},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion:         "provisioning.cattle.io/v1",
+					Kind:               "Cluster",
+					Name:               cluster.Name,
+					UID:                cluster.UID,
+					Controller:         &[]bool{true}[0],
+					BlockOwnerDeletion: &[]bool{true}[0],
+				}},
+			},
+			Spec: v1.ETCDSnapshotSpec{
+				ClusterName: cnl,
+			},
+			SnapshotFile: v1.ETCDSnapshotFile{
+				Name:      uploaded.Name,
+				NodeName:  sb.StorageS3,
+				Location:  planner.ETCDSnapshotS3Location(s3, uploaded.Name, uploaded.KeyVersion),
+				CreatedAt: uploaded.CreatedAt,
+				Size:      uploaded.Size,
+				S3:        s3,
+				Status:    "successful",
+			},
+		}
+		logrus.Debugf("[plansecret] secret %s/%s: creating encrypted etcd snapshot %s for cluster %s", secret.Namespace, secret.Name, snapshot.Name, cnl)
+		if _, err := h.etcdSnapshotsClient.Create(snapshot); err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("error while creating etcd snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// encryptedSnapshotListMargin is how long before the last upload of the init node an encrypted etcd snapshot object
+// must have been created to be deleted if the upload did not list it.
+const encryptedSnapshotListMargin = 5 * time.Minute
+
+// deleteRemovedEncryptedEtcdSnapshots deletes the encrypted S3 etcd snapshot objects of the cluster whose snapshot is
+// not in the bucket, the upload that listed the bucket having run at lastRunTime.
+func (h *handler) deleteRemovedEncryptedEtcdSnapshots(namespace, clusterName string, uploaded map[string]etcdmgmt.UploadedSnapshot, lastRunTime string) error {
+	listedAt, err := time.Parse(time.UnixDate, lastRunTime)
+	if err != nil {
+		return fmt.Errorf("error parsing last run time of etcd snapshot upload: %w", err)
+	}
+	etcdSnapshots, err := h.etcdSnapshotsCache.List(namespace, labels.SelectorFromSet(map[string]string{
+		capr.ClusterNameLabel: clusterName,
+		capr.NodeNameLabel:    sb.StorageS3,
+	}))
+	if err != nil {
+		return err
+	}
+	for _, v := range etcdSnapshots {
+		if v.SnapshotFile.S3 == nil || v.SnapshotFile.S3.Encryption == nil || !v.CreationTimestamp.Add(encryptedSnapshotListMargin).Before(listedAt) {
+			continue
+		}
+		if _, ok := uploaded[v.SnapshotFile.Name]; ok {
+			continue
+		}
+		logrus.Infof("[plansecret] Deleting encrypted etcd snapshot %s/%s as it is no longer in S3", v.Namespace, v.Name)
+		if err := h.etcdSnapshotsClient.Delete(v.Namespace, v.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileEtcdSnapshotS3Targets reconciles the S3 targets in the status of the local etcd snapshots of the machine of
+// the plan secret with the output of the instructions uploading them to the S3 targets of the cluster. Targets which
+// are no longer defined are removed from the status.
+func (h *handler) reconcileEtcdSnapshotS3Targets(secret *corev1.Secret, uploads map[string][]byte) error {
+	cnl := secret.Labels[capr.ClusterNameLabel]
+	if len(cnl) == 0 {
+		return fmt.Errorf("node secret did not have label %s", capr.ClusterNameLabel)
+	}
+	machineName, ok := secret.Labels[capr.MachineNameLabel]
+	if !ok {
+		return fmt.Errorf("did not find machine label on secret %s/%s", secret.Namespace, secret.Name)
+	}
+
+	controlPlane, err := h.controlPlanesCache.Get(secret.Namespace, cnl)
+	if err != nil {
+		return err
+	}
+	machine, err := h.machinesCache.Get(secret.Namespace, machineName)
+	if err != nil {
+		return err
+	}
+	if machine.Labels[capr.MachineIDLabel] == "" {
+		return fmt.Errorf("error finding machine ID for machine %s/%s", machine.Namespace, machine.Name)
+	}
+
+	etcdSnapshots, err := h.etcdSnapshotsCache.List(secret.Namespace, labels.SelectorFromSet(map[string]string{
+		capr.ClusterNameLabel: cnl,
+		capr.MachineIDLabel:   machine.Labels[capr.MachineIDLabel],
+	}))
+	if err != nil {
+		return err
+	}
+
+	uploaded := map[string]map[string]etcdmgmt.UploadedSnapshot{}
+	for targetName, stdout := range uploads {
+		if planner.FindETCDSnapshotS3Target(controlPlane, targetName) != nil {
+			uploaded[targetName] = etcdmgmt.ParseUploadedSnapshots(stdout)
+		}
+	}
+
+	for _, etcdSnapshot := range etcdSnapshots {
+		status := etcdSnapshot.Status.DeepCopy()
+		changed := etcdmgmt.RemoveS3TargetStatus(status, func(name string) bool {
+			return planner.FindETCDSnapshotS3Target(controlPlane, name) != nil
+		})
+		for targetName, snapshots := range uploaded {
+			if s, ok := snapshots[etcdSnapshot.SnapshotFile.Name]; ok {
+				target := planner.FindETCDSnapshotS3Target(controlPlane, targetName)
+				changed = etcdmgmt.SetS3TargetStatus(status, v1.ETCDSnapshotS3TargetStatus{
+					Name:       targetName,
+					Location:   planner.ETCDSnapshotS3Location(&target.ETCDSnapshotS3, s.Name, s.KeyVersion),
+					Size:       s.Size,
+					KeyVersion: s.KeyVersion,
+				}) || changed
+			} else {
+				// the snapshot was not uploaded yet or was removed from the target by its retention
+				changed = etcdmgmt.RemoveS3TargetStatus(status, func(name string) bool { return name != targetName }) || changed
+			}
+		}
+		if !changed {
+			continue
+		}
+		etcdSnapshot = etcdSnapshot.DeepCopy()
+		etcdSnapshot.Status = *status
+		logrus.Debugf("[plansecret] secret %s/%s: updating S3 targets of etcd snapshot %s", secret.Namespace, secret.Name, etcdSnapshot.Name)
+		if _, err := h.etcdSnapshotsClient.UpdateStatus(etcdSnapshot); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileEtcdSnapshotVerification sets the result of the last verification of the local etcd snapshots of the machine
+// of the plan secret on their status.
+func (h *handler) reconcileEtcdSnapshotVerification(secret *corev1.Secret, verifyStdout []byte, lastRunTime string) error {
+	cnl := secret.Labels[capr.ClusterNameLabel]
+	if len(cnl) == 0 {
+		return fmt.Errorf("node secret did not have label %s", capr.ClusterNameLabel)
+	}
+	machineName, ok := secret.Labels[capr.MachineNameLabel]
+	if !ok {
+		return fmt.Errorf("did not find machine label on secret %s/%s", secret.Namespace, secret.Name)
+	}
+	verifiedAt, err := time.Parse(time.UnixDate, lastRunTime)
+	if err != nil {
+		return fmt.Errorf("error parsing last run time of etcd snapshot verification: %w", err)
+	}
+
+	machine, err := h.machinesCache.Get(secret.Namespace, machineName)
+	if err != nil {
+		return err
+	}
+	if machine.Labels[capr.MachineIDLabel] == "" {
+		return fmt.Errorf("error finding machine ID for machine %s/%s", machine.Namespace, machine.Name)
+	}
+
+	etcdSnapshots, err := h.etcdSnapshotsCache.List(secret.Namespace, labels.SelectorFromSet(map[string]string{
+		capr.ClusterNameLabel: cnl,
+		capr.MachineIDLabel:   machine.Labels[capr.MachineIDLabel],
+	}))
+	if err != nil {
+		return err
+	}
+
+	verified := map[string]etcdmgmt.VerifiedSnapshot{}
+	for _, v := range etcdmgmt.ParseVerifiedSnapshots(verifyStdout) {
+		verified[snapshotFileKey(v.Name)] = v
+	}
+
+	for _, etcdSnapshot := range etcdSnapshots {
+		v, ok := verified[snapshotFileKey(etcdSnapshot.SnapshotFile.Name)]
+		if !ok {
+			continue
+		}
+		status := etcdSnapshot.Status.DeepCopy()
+		if !etcdmgmt.SetVerificationStatus(status, v, metav1.NewTime(verifiedAt.UTC())) {
+			continue
+		}
+		etcdSnapshot = etcdSnapshot.DeepCopy()
+		etcdSnapshot.Status = *status
+		logrus.Debugf("[plansecret] secret %s/%s: updating verification of etcd snapshot %s: %s", secret.Namespace, secret.Name, etcdSnapshot.Name, status.Verification.Result)
+		if _, err := h.etcdSnapshotsClient.UpdateStatus(etcdSnapshot); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileEtcdSnapshotRetention sets the retention of the etcd snapshots the retention policy of the cluster was
+// applied to by the machine of the plan secret on their status, the local snapshots of the machine and, if it is the
+// init node, the S3 snapshots. The retention is removed if the cluster no longer has a retention policy.
+func (h *handler) reconcileEtcdSnapshotRetention(secret *corev1.Secret, retentionStdout []byte) error {
+	cnl := secret.Labels[capr.ClusterNameLabel]
+	if len(cnl) == 0 {
+		return fmt.Errorf("node secret did not have label %s", capr.ClusterNameLabel)
+	}
+	machineName, ok := secret.Labels[capr.MachineNameLabel]
+	if !ok {
+		return fmt.Errorf("did not find machine label on secret %s/%s", secret.Namespace, secret.Name)
+	}
+
+	controlPlane, err := h.controlPlanesCache.Get(secret.Namespace, cnl)
+	if err != nil {
+		return err
+	}
+	machine, err := h.machinesCache.Get(secret.Namespace, machineName)
+	if err != nil {
+		return err
+	}
+	if machine.Labels[capr.MachineIDLabel] == "" {
+		return fmt.Errorf("error finding machine ID for machine %s/%s", machine.Namespace, machine.Name)
+	}
+	hasPolicy := controlPlane.Spec.ETCD != nil && controlPlane.Spec.ETCD.SnapshotRetentionPolicy != nil
+
+	local, s3 := etcdmgmt.ParseRetainedSnapshots(retentionStdout)
+	type snapshotSet struct {
+		selector labels.Set
+		retained map[string]etcdmgmt.RetainedSnapshot
+	}
+	sets := []snapshotSet{
+		{labels.Set{capr.ClusterNameLabel: cnl, capr.MachineIDLabel: machine.Labels[capr.MachineIDLabel]}, local},
+	}
+	if secret.Labels[capr.InitNodeLabel] == "true" {
+		sets = append(sets, snapshotSet{labels.Set{capr.ClusterNameLabel: cnl, capr.NodeNameLabel: sb.StorageS3}, s3})
+	}
+	for _, set := range sets {
+		etcdSnapshots, err := h.etcdSnapshotsCache.List(secret.Namespace, labels.SelectorFromSet(set.selector))
+		if err != nil {
+			return err
+		}
+
+		byKey := map[string]etcdmgmt.RetainedSnapshot{}
+		for _, r := range set.retained {
+			byKey[snapshotFileKey(r.Name)] = r
+		}
+		for _, etcdSnapshot := range etcdSnapshots {
+			var r *etcdmgmt.RetainedSnapshot
+			if v, ok := byKey[snapshotFileKey(etcdSnapshot.SnapshotFile.Name)]; ok && hasPolicy {
+				r = &v
+			} else if hasPolicy {
+				// the snapshot was not listed by the last run, it is updated by the next one
+				continue
+			}
+			status := etcdSnapshot.Status.DeepCopy()
+			if !etcdmgmt.SetRetentionStatus(status, r) {
+				continue
+			}
+			etcdSnapshot = etcdSnapshot.DeepCopy()
+			etcdSnapshot.Status = *status
+			logrus.Debugf("[plansecret] secret %s/%s: updating retention of etcd snapshot %s", secret.Namespace, secret.Name, etcdSnapshot.Name)
+			if _, err := h.etcdSnapshotsClient.UpdateStatus(etcdSnapshot); err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// snapshotFileKey returns the name of a snapshot file sanitized the same way as in the snapshot list, so that the
+// snapshot files listed by the system-agent can be matched with the snapshot objects.
+func snapshotFileKey(name string) string {
+	return strings.ToLower(sb.InvalidKeyChars.ReplaceAllString(name, "-"))
+}
+
 type snapshot struct {
 	Name     string
 	Location string
@@ -0,0 +1,160 @@
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"sort"
+
+	catalog "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/repo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// indexHistoryLimit is the number of index revisions kept in the status of a repo.
+	indexHistoryLimit = 10
+	// indexRevisionLimit is the number of chart versions listed as added, removed or changed by a revision, so that
+	// the history of repos that are reorganized does not exceed the size of an object.
+	indexRevisionLimit = 100
+)
+
+// readIndex reads the index stored in the ConfigMap and the ConfigMaps linked to it by the "catalog.cattle.io/next"
+// annotation.
+func (r *repoHandler) readIndex(namespace, name string) (*repo.IndexFile, error) {
+	cm, err := r.configMapCache.Get(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	data := append([]byte{}, cm.BinaryData["content"]...)
+	for next := cm.Annotations["catalog.cattle.io/next"]; next != ""; next = cm.Annotations["catalog.cattle.io/next"] {
+		cm, err = r.configMapCache.Get(namespace, next)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, cm.BinaryData["content"]...)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	index := &repo.IndexFile{}
+	return index, json.NewDecoder(gz).Decode(index)
+}
+
+// diffIndex returns the revision of the chart versions added, removed or changed from the old to the new index.
+func diffIndex(old, new *repo.IndexFile) catalog.IndexRevision {
+	var revision catalog.IndexRevision
+
+	oldVersions := indexVersions(old)
+	newVersions := indexVersions(new)
+	for key, chart := range newVersions {
+		oldChart, ok := oldVersions[key]
+		if !ok {
+			revision.Added = append(revision.Added, key)
+		} else if chartVersionChanged(oldChart, chart) {
+			revision.Changed = append(revision.Changed, key)
+		}
+	}
+	for key := range oldVersions {
+		if _, ok := newVersions[key]; !ok {
+			revision.Removed = append(revision.Removed, key)
+		}
+	}
+
+	revision.Added = sortChartVersions(revision.Added, &revision.Truncated)
+	revision.Removed = sortChartVersions(revision.Removed, &revision.Truncated)
+	revision.Changed = sortChartVersions(revision.Changed, &revision.Truncated)
+	return revision
+}
+
+// indexVersions returns the chart versions of the index by name and version.
+func indexVersions(index *repo.IndexFile) map[catalog.IndexChartVersion]*repo.ChartVersion {
+	versions := map[catalog.IndexChartVersion]*repo.ChartVersion{}
+	for name, entries := range index.Entries {
+		for _, chart := range entries {
+			if chart == nil || chart.Metadata == nil {
+				continue
+			}
+			versions[catalog.IndexChartVersion{Name: name, Version: chart.Version}] = chart
+		}
+	}
+	return versions
+}
+
+// chartVersionChanged returns true if the chart version was republished with another archive.
+func chartVersionChanged(old, new *repo.ChartVersion) bool {
+	if old.Digest != new.Digest {
+		return true
+	}
+	if len(old.URLs) != len(new.URLs) {
+		return true
+	}
+	for i := range old.URLs {
+		if old.URLs[i] != new.URLs[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// sortChartVersions sorts the chart versions by name and version and truncates them to the indexRevisionLimit.
+func sortChartVersions(versions []catalog.IndexChartVersion, truncated *bool) []catalog.IndexChartVersion {
+	sort.Slice(versions, func(i, j int) bool {
+		if versions[i].Name != versions[j].Name {
+			return versions[i].Name < versions[j].Name
+		}
+		return versions[i].Version < versions[j].Version
+	})
+	if len(versions) > indexRevisionLimit {
+		*truncated = true
+		return versions[:indexRevisionLimit]
+	}
+	return versions
+}
+
+// recordIndexRevision appends the revision of the changes from the previously stored index to the index history of
+// the status. Nothing is recorded for the first download of a repo or if the chart versions did not change.
+func (r *repoHandler) recordIndexRevision(status catalog.RepoStatus, index *repo.IndexFile, downloadTime metav1.Time, commit string) catalog.RepoStatus {
+	if status.IndexConfigMapName == "" {
+		return status
+	}
+
+	old, err := r.readIndex(status.IndexConfigMapNamespace, status.IndexConfigMapName)
+	if err != nil {
+		// the history is informational, a previous index that can not be read must not block the refresh
+		logrus.Warnf("failed to read the previous index of repo %s to record its changes: %v", status.URL, err)
+		return status
+	}
+
+	revision := diffIndex(old, index)
+	if len(revision.Added) == 0 && len(revision.Removed) == 0 && len(revision.Changed) == 0 {
+		return status
+	}
+	revision.Time = downloadTime
+	revision.Commit = commit
+	for _, removed := range revision.Removed {
+		logrus.Infof("chart %s version %s was removed from the index of repo %s", removed.Name, removed.Version, status.URL)
+	}
+
+	return appendIndexRevision(status, revision)
+}
+
+// appendIndexRevision appends the revision to the index history of the status, dropping the oldest revisions beyond
+// the indexHistoryLimit.
+func appendIndexRevision(status catalog.RepoStatus, revision catalog.IndexRevision) catalog.RepoStatus {
+	// the history is copied, the status may share it with the cached repo
+	history := make([]catalog.IndexRevision, 0, len(status.IndexHistory)+1)
+	history = append(history, status.IndexHistory...)
+	history = append(history, revision)
+	if len(history) > indexHistoryLimit {
+		history = history[len(history)-indexHistoryLimit:]
+	}
+	status.IndexHistory = history
+	return status
+}
@@ -0,0 +1,71 @@
+package helm
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	catalog "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func chartVersion(name, version, digest string) *repo.ChartVersion {
+	return &repo.ChartVersion{
+		Metadata: &chart.Metadata{Name: name, Version: version},
+		URLs:     []string{fmt.Sprintf("https://example.com/%s-%s.tgz", name, version)},
+		Digest:   digest,
+	}
+}
+
+func TestDiffIndex(t *testing.T) {
+	old := &repo.IndexFile{
+		Entries: map[string]repo.ChartVersions{
+			"foo": {chartVersion("foo", "1.0.0", "a"), chartVersion("foo", "1.1.0", "b")},
+			"bar": {chartVersion("bar", "2.0.0", "c")},
+		},
+	}
+	new := &repo.IndexFile{
+		Entries: map[string]repo.ChartVersions{
+			"foo": {chartVersion("foo", "1.0.0", "a"), chartVersion("foo", "1.1.0", "d"), chartVersion("foo", "1.2.0", "e")},
+			"baz": {chartVersion("baz", "0.1.0", "f")},
+		},
+	}
+
+	assert.Equal(t, catalog.IndexRevision{
+		Added:   []catalog.IndexChartVersion{{Name: "baz", Version: "0.1.0"}, {Name: "foo", Version: "1.2.0"}},
+		Removed: []catalog.IndexChartVersion{{Name: "bar", Version: "2.0.0"}},
+		Changed: []catalog.IndexChartVersion{{Name: "foo", Version: "1.1.0"}},
+	}, diffIndex(old, new))
+	assert.Equal(t, catalog.IndexRevision{}, diffIndex(old, old))
+}
+
+func TestDiffIndexTruncated(t *testing.T) {
+	new := &repo.IndexFile{Entries: map[string]repo.ChartVersions{}}
+	for i := 0; i < indexRevisionLimit+1; i++ {
+		new.Entries["foo"] = append(new.Entries["foo"], chartVersion("foo", fmt.Sprintf("1.0.%03d", i), ""))
+	}
+
+	revision := diffIndex(&repo.IndexFile{}, new)
+	assert.True(t, revision.Truncated)
+	assert.Len(t, revision.Added, indexRevisionLimit)
+	assert.Equal(t, "1.0.000", revision.Added[0].Version)
+}
+
+func TestAppendIndexRevision(t *testing.T) {
+	start := time.Date(2024, 7, 15, 12, 0, 0, 0, time.UTC)
+	status := catalog.RepoStatus{}
+	for i := 0; i < indexHistoryLimit+2; i++ {
+		status = appendIndexRevision(status, catalog.IndexRevision{Time: metav1.NewTime(start.Add(time.Duration(i) * time.Hour))})
+	}
+	assert.Len(t, status.IndexHistory, indexHistoryLimit)
+	assert.Equal(t, start.Add(2*time.Hour), status.IndexHistory[0].Time.Time)
+	assert.Equal(t, start.Add((indexHistoryLimit+1)*time.Hour), status.IndexHistory[indexHistoryLimit-1].Time.Time)
+
+	// the history of the previous status is not modified
+	previous := status
+	status = appendIndexRevision(status, catalog.IndexRevision{})
+	assert.Equal(t, start.Add(2*time.Hour), previous.IndexHistory[0].Time.Time)
+}
@@ -12,12 +12,14 @@
 	"github.com/rancher/rancher/pkg/catalogv2"
 	"github.com/rancher/rancher/pkg/catalogv2/git"
 	helmhttp "github.com/rancher/rancher/pkg/catalogv2/http"
+	"github.com/rancher/rancher/pkg/catalogv2/oci"
 	catalogcontrollers "github.com/rancher/rancher/pkg/generated/controllers/catalog.cattle.io/v1"
 	namespaces "github.com/rancher/rancher/pkg/namespace"
 	"github.com/rancher/wrangler/pkg/apply"
 	"github.com/rancher/wrangler/pkg/condition"
 	corev1controllers "github.com/rancher/wrangler/pkg/generated/controllers/core/v1"
 	name2 "github.com/rancher/wrangler/pkg/name"
+	"github.com/robfig/cron"
 	"helm.sh/helm/v3/pkg/repo"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -31,6 +33,9 @@
 
 var (
 	interval = 1 * time.Hour
+	// minRefreshInterval is the shortest refresh interval of a repo, shorter intervals are raised to it so that repos
+	// are not downloaded on every reconcile.
+	minRefreshInterval = 5 * time.Minute
 )
 
 type repoHandler struct {
@@ -83,8 +88,17 @@ func (r *repoHandler) ClusterRepoDownloadStatusHandler(repo *catalog.ClusterRepo
 	if err != nil {
 		return status, err
 	}
+	// an invalid refresh schedule or interval must not block the downloads of the repo, the index is refreshed after
+	// the default interval instead
+	next, msg, err := nextRefresh(&repo.Spec, status.DownloadTime.Time)
+	condition.Cond(catalog.RepoRefreshScheduled).SetError(&status, "", err)
+	if err != nil {
+		next = status.DownloadTime.Add(interval)
+	} else {
+		condition.Cond(catalog.RepoRefreshScheduled).Message(&status, msg)
+	}
 	if !shouldRefresh(&repo.Spec, &status) {
-		r.clusterRepos.EnqueueAfter(repo.Name, interval)
+		r.clusterRepos.EnqueueAfter(repo.Name, time.Until(next))
 		return status, nil
 	}
 
@@ -224,6 +238,10 @@ func (r *repoHandler) download(repoSpec *catalog.RepoSpec, status catalog.RepoSt
 			return status, nil
 		}
 		index, err = git.BuildOrGetIndex(metadata.Namespace, metadata.Name, repoSpec.GitRepo)
+	} else if oci.IsOCI(repoSpec.URL) {
+		status.URL = repoSpec.URL
+		status.Branch = ""
+		index, err = oci.DownloadIndex(secret, repoSpec.URL, repoSpec.CABundle, repoSpec.InsecureSkipTLSverify)
 	} else if repoSpec.URL != "" {
 		status.URL = repoSpec.URL
 		status.Branch = ""
@@ -242,6 +260,8 @@ func (r *repoHandler) download(repoSpec *catalog.RepoSpec, status catalog.RepoSt
 		name = owner.Name
 	}
 
+	status = r.recordIndexRevision(status, index, downloadTime, commit)
+
 	cm, err := r.createOrUpdateMap(metadata.Namespace, name, index, owner)
 	if err != nil {
 		return status, err
@@ -290,6 +310,41 @@ func shouldRefresh(spec *catalog.RepoSpec, status *catalog.RepoStatus) bool {
 	if spec.ForceUpdate != nil && spec.ForceUpdate.After(status.DownloadTime.Time) && spec.ForceUpdate.Time.Before(time.Now()) {
 		return true
 	}
-	refreshTime := time.Now().Add(-interval)
-	return refreshTime.After(status.DownloadTime.Time)
+	next, _, err := nextRefresh(spec, status.DownloadTime.Time)
+	if err != nil {
+		next = status.DownloadTime.Add(interval)
+	}
+	return time.Now().After(next)
+}
+
+// nextRefresh returns the time the index downloaded at downloadTime is downloaded again, on the refresh schedule of
+// the repo, after its refresh interval or by default after an hour. Refresh intervals shorter than minRefreshInterval
+// are raised to it, the returned message then reports the interval used.
+func nextRefresh(spec *catalog.RepoSpec, downloadTime time.Time) (time.Time, string, error) {
+	if spec.RefreshSchedule != "" {
+		schedule, err := cron.ParseStandard(spec.RefreshSchedule)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid refresh schedule %q: %w", spec.RefreshSchedule, err)
+		}
+		next := schedule.Next(downloadTime)
+		if next.IsZero() {
+			return time.Time{}, "", fmt.Errorf("invalid refresh schedule %q: never runs", spec.RefreshSchedule)
+		}
+		return next, "", nil
+	}
+
+	if spec.RefreshInterval != "" {
+		refreshInterval, err := time.ParseDuration(spec.RefreshInterval)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid refresh interval %q: %w", spec.RefreshInterval, err)
+		} else if refreshInterval <= 0 {
+			return time.Time{}, "", fmt.Errorf("invalid refresh interval %q: must be positive", spec.RefreshInterval)
+		}
+		if refreshInterval < minRefreshInterval {
+			return downloadTime.Add(minRefreshInterval), fmt.Sprintf("refresh interval %q is below the minimum, using %v", spec.RefreshInterval, minRefreshInterval), nil
+		}
+		return downloadTime.Add(refreshInterval), "", nil
+	}
+
+	return downloadTime.Add(interval), "", nil
 }
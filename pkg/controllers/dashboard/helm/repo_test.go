@@ -4,7 +4,10 @@
 	"testing"
 	"time"
 
+	"github.com/golang/mock/gomock"
 	catalog "github.com/rancher/rancher/pkg/apis/catalog.cattle.io/v1"
+	"github.com/rancher/wrangler/pkg/condition"
+	"github.com/rancher/wrangler/pkg/generic/fake"
 	"github.com/stretchr/testify/assert"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -200,6 +203,36 @@ func TestShouldRefresh(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"http repo - refresh interval elapsed",
+			&catalog.RepoSpec{
+				URL:             "https://example.com",
+				RefreshInterval: "10m",
+			},
+			&catalog.RepoStatus{
+				URL:                "https://example.com",
+				IndexConfigMapName: "configmap",
+				DownloadTime: metav1.Time{
+					Time: time.Now().Add(-15 * time.Minute),
+				},
+			},
+			true,
+		},
+		{
+			"http repo - invalid refresh interval falls back to the default interval",
+			&catalog.RepoSpec{
+				URL:             "https://example.com",
+				RefreshInterval: "10",
+			},
+			&catalog.RepoStatus{
+				URL:                "https://example.com",
+				IndexConfigMapName: "configmap",
+				DownloadTime: metav1.Time{
+					Time: time.Now().Add(-15 * time.Minute),
+				},
+			},
+			false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -209,3 +242,111 @@ func TestShouldRefresh(t *testing.T) {
 		})
 	}
 }
+
+func TestNextRefresh(t *testing.T) {
+	downloadTime := time.Date(2024, 7, 15, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		spec          *catalog.RepoSpec
+		expectedNext  time.Time
+		expectedMsg   string
+		expectedError bool
+	}{
+		{
+			"default interval",
+			&catalog.RepoSpec{},
+			downloadTime.Add(time.Hour),
+			"",
+			false,
+		},
+		{
+			"refresh interval",
+			&catalog.RepoSpec{RefreshInterval: "15m"},
+			downloadTime.Add(15 * time.Minute),
+			"",
+			false,
+		},
+		{
+			"refresh interval below the minimum",
+			&catalog.RepoSpec{RefreshInterval: "10s"},
+			downloadTime.Add(5 * time.Minute),
+			`refresh interval "10s" is below the minimum, using 5m0s`,
+			false,
+		},
+		{
+			"refresh schedule takes precedence over the refresh interval",
+			&catalog.RepoSpec{RefreshInterval: "15m", RefreshSchedule: "0 */6 * * *"},
+			time.Date(2024, 7, 15, 18, 0, 0, 0, time.UTC),
+			"",
+			false,
+		},
+		{
+			"invalid refresh interval",
+			&catalog.RepoSpec{RefreshInterval: "-15m"},
+			time.Time{},
+			"",
+			true,
+		},
+		{
+			"invalid refresh schedule",
+			&catalog.RepoSpec{RefreshSchedule: "every hour"},
+			time.Time{},
+			"",
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, msg, err := nextRefresh(tt.spec, downloadTime)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedNext, next)
+			assert.Equal(t, tt.expectedMsg, msg)
+		})
+	}
+}
+
+func TestClusterRepoDownloadStatusHandlerInvalidRefresh(t *testing.T) {
+	clusterRepos := fake.NewMockNonNamespacedControllerInterface[*catalog.ClusterRepo, *catalog.ClusterRepoList](gomock.NewController(t))
+	h := &repoHandler{clusterRepos: clusterRepos}
+	repo := &catalog.ClusterRepo{
+		ObjectMeta: metav1.ObjectMeta{Name: "repo"},
+		Spec:       catalog.RepoSpec{URL: "https://example.com", RefreshInterval: "-15m"},
+	}
+	status := catalog.RepoStatus{
+		URL:                "https://example.com",
+		IndexConfigMapName: "repo",
+		DownloadTime:       metav1.NewTime(time.Now().Add(-time.Minute)),
+	}
+
+	var after time.Duration
+	clusterRepos.EXPECT().EnqueueAfter("repo", gomock.Any()).Do(func(_ string, duration time.Duration) {
+		after = duration
+	})
+	status, err := h.ClusterRepoDownloadStatusHandler(repo, status)
+	assert.NoError(t, err, "an invalid refresh interval does not fail the handler")
+	assert.InDelta(t, float64(59*time.Minute), float64(after), float64(time.Minute), "the repo is refreshed after the default interval")
+	assert.True(t, condition.Cond(catalog.RepoRefreshScheduled).IsFalse(&status))
+	assert.Contains(t, condition.Cond(catalog.RepoRefreshScheduled).GetMessage(&status), "invalid refresh interval")
+
+	repo.Spec.RefreshInterval = "15m"
+	clusterRepos.EXPECT().EnqueueAfter("repo", gomock.Any())
+	status, err = h.ClusterRepoDownloadStatusHandler(repo, status)
+	assert.NoError(t, err)
+	assert.True(t, condition.Cond(catalog.RepoRefreshScheduled).IsTrue(&status))
+	assert.Empty(t, condition.Cond(catalog.RepoRefreshScheduled).GetMessage(&status))
+
+	repo.Spec.RefreshInterval = "30s"
+	clusterRepos.EXPECT().EnqueueAfter("repo", gomock.Any()).Do(func(_ string, duration time.Duration) {
+		after = duration
+	})
+	status, err = h.ClusterRepoDownloadStatusHandler(repo, status)
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(4*time.Minute), float64(after), float64(time.Minute), "the repo is refreshed after the minimum interval")
+	assert.True(t, condition.Cond(catalog.RepoRefreshScheduled).IsTrue(&status))
+	assert.Contains(t, condition.Cond(catalog.RepoRefreshScheduled).GetMessage(&status), "using 5m0s")
+}
@@ -0,0 +1,311 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/metrics"
+	namespaces "github.com/rancher/rancher/pkg/namespace"
+	"github.com/rancher/rancher/pkg/settings"
+	"github.com/rancher/rancher/pkg/types/config"
+	"github.com/rancher/wrangler/pkg/name"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	bindingExpirationController = "mgmt-auth-binding-expiration-controller"
+
+	reasonBindingExpiring = "RoleBindingExpiring"
+	reasonBindingExpired  = "RoleBindingExpired"
+
+	defaultExpirationWarning = 24 * time.Hour
+
+	// expirationPinKey and expirationPinUIDKey are the keys of the ConfigMaps the expiration of a binding is pinned in,
+	// in the system namespace where the subjects of the bindings can't edit them. The expiration can only be shortened
+	// once pinned, an extended or removed expiration is restored from it.
+	expirationPinKey    = "expiresAt"
+	expirationPinUIDKey = "uid"
+)
+
+// bindingExpirer removes ClusterRoleTemplateBindings, ProjectRoleTemplateBindings and GlobalRoleBindings once they
+// reach their expiration. The existing lifecycles then remove the RBAC resources created for the bindings, in the
+// management cluster and downstream. The expiration of a binding is immutable once set, so a subject able to update its
+// own binding can't extend its access.
+type bindingExpirer struct {
+	crtbs      v3.ClusterRoleTemplateBindingInterface
+	prtbs      v3.ProjectRoleTemplateBindingInterface
+	grbs       v3.GlobalRoleBindingInterface
+	events     typedcorev1.EventsGetter
+	configMaps typedcorev1.ConfigMapsGetter
+	now        func() time.Time
+
+	lock sync.Mutex
+	// warned holds the expiration of the bindings a warning event was recorded for.
+	warned map[string]time.Time
+}
+
+func newBindingExpirer(management *config.ManagementContext) *bindingExpirer {
+	return &bindingExpirer{
+		crtbs:      management.Management.ClusterRoleTemplateBindings(""),
+		prtbs:      management.Management.ProjectRoleTemplateBindings(""),
+		grbs:       management.Management.GlobalRoleBindings(""),
+		events:     management.K8sClient.CoreV1(),
+		configMaps: management.K8sClient.CoreV1(),
+		now:        time.Now,
+		warned:     map[string]time.Time{},
+	}
+}
+
+func (e *bindingExpirer) syncCRTB(key string, obj *v3.ClusterRoleTemplateBinding) (runtime.Object, error) {
+	if obj == nil || obj.DeletionTimestamp != nil {
+		return obj, e.forget("ClusterRoleTemplateBinding", key)
+	}
+	expiresAt, err := e.pinExpiration("ClusterRoleTemplateBinding", &obj.ObjectMeta, obj.ExpiresAt)
+	if err != nil {
+		return obj, err
+	}
+	if !expiresAt.Equal(obj.ExpiresAt) {
+		obj = obj.DeepCopy()
+		obj.ExpiresAt = expiresAt
+		updated, err := e.crtbs.Update(obj)
+		if err != nil {
+			return obj, fmt.Errorf("failed to restore expiration of ClusterRoleTemplateBinding %s: %w", key, err)
+		}
+		obj = updated
+	}
+	return obj, e.sync("ClusterRoleTemplateBinding", &obj.ObjectMeta, obj.ExpiresAt,
+		e.crtbs.Controller().EnqueueAfter, func() error {
+			return e.crtbs.DeleteNamespaced(obj.Namespace, obj.Name, &metav1.DeleteOptions{})
+		})
+}
+
+func (e *bindingExpirer) syncPRTB(key string, obj *v3.ProjectRoleTemplateBinding) (runtime.Object, error) {
+	if obj == nil || obj.DeletionTimestamp != nil {
+		return obj, e.forget("ProjectRoleTemplateBinding", key)
+	}
+	expiresAt, err := e.pinExpiration("ProjectRoleTemplateBinding", &obj.ObjectMeta, obj.ExpiresAt)
+	if err != nil {
+		return obj, err
+	}
+	if !expiresAt.Equal(obj.ExpiresAt) {
+		obj = obj.DeepCopy()
+		obj.ExpiresAt = expiresAt
+		updated, err := e.prtbs.Update(obj)
+		if err != nil {
+			return obj, fmt.Errorf("failed to restore expiration of ProjectRoleTemplateBinding %s: %w", key, err)
+		}
+		obj = updated
+	}
+	return obj, e.sync("ProjectRoleTemplateBinding", &obj.ObjectMeta, obj.ExpiresAt,
+		e.prtbs.Controller().EnqueueAfter, func() error {
+			return e.prtbs.DeleteNamespaced(obj.Namespace, obj.Name, &metav1.DeleteOptions{})
+		})
+}
+
+func (e *bindingExpirer) syncGRB(key string, obj *v3.GlobalRoleBinding) (runtime.Object, error) {
+	if obj == nil || obj.DeletionTimestamp != nil {
+		return obj, e.forget("GlobalRoleBinding", key)
+	}
+	expiresAt, err := e.pinExpiration("GlobalRoleBinding", &obj.ObjectMeta, obj.ExpiresAt)
+	if err != nil {
+		return obj, err
+	}
+	if !expiresAt.Equal(obj.ExpiresAt) {
+		obj = obj.DeepCopy()
+		obj.ExpiresAt = expiresAt
+		updated, err := e.grbs.Update(obj)
+		if err != nil {
+			return obj, fmt.Errorf("failed to restore expiration of GlobalRoleBinding %s: %w", key, err)
+		}
+		obj = updated
+	}
+	return obj, e.sync("GlobalRoleBinding", &obj.ObjectMeta, obj.ExpiresAt,
+		e.grbs.Controller().EnqueueAfter, func() error {
+			return e.grbs.Delete(obj.Name, &metav1.DeleteOptions{})
+		})
+}
+
+// pinExpiration returns the expiration a binding must have. The expiration is pinned when it is first set and
+// replaced only by an earlier one, an extended or removed expiration is restored from the pin.
+func (e *bindingExpirer) pinExpiration(kind string, meta *metav1.ObjectMeta, expiresAt *metav1.Time) (*metav1.Time, error) {
+	configMaps := e.configMaps.ConfigMaps(namespaces.System)
+	name := expirationPinName(kind, bindingKey(meta))
+	pin, err := configMaps.Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		pin = nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get expiration of %s %s: %w", kind, bindingKey(meta), err)
+	}
+
+	// a pin left behind by a removed binding of the same name does not apply
+	if pin != nil && pin.Data[expirationPinUIDKey] == string(meta.UID) {
+		pinned, err := time.Parse(time.RFC3339, pin.Data[expirationPinKey])
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiration of %s %s: %w", kind, bindingKey(meta), err)
+		}
+		if expiresAt == nil || expiresAt.After(pinned) {
+			logrus.Warnf("[%s] Restoring expiration of %s %s to %s, it can't be extended or removed",
+				bindingExpirationController, kind, bindingKey(meta), pinned.Format(time.RFC3339))
+			return &metav1.Time{Time: pinned}, nil
+		}
+		if expiresAt.Equal(&metav1.Time{Time: pinned}) {
+			return expiresAt, nil
+		}
+	} else if expiresAt == nil {
+		return nil, nil
+	}
+
+	data := map[string]string{
+		expirationPinKey:    expiresAt.UTC().Format(time.RFC3339),
+		expirationPinUIDKey: string(meta.UID),
+	}
+	if pin == nil {
+		_, err = configMaps.Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespaces.System},
+			Data:       data,
+		}, metav1.CreateOptions{})
+	} else {
+		pin = pin.DeepCopy()
+		pin.Data = data
+		_, err = configMaps.Update(context.TODO(), pin, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to pin expiration of %s %s: %w", kind, bindingKey(meta), err)
+	}
+	// the pin is stored with a precision of seconds
+	return &metav1.Time{Time: expiresAt.Truncate(time.Second)}, nil
+}
+
+// expirationPinName returns the name of the ConfigMap the expiration of a binding is pinned in.
+func expirationPinName(kind, key string) string {
+	return name.SafeConcatName("binding-expiration", strings.ToLower(kind), strings.ReplaceAll(key, "/", "-"))
+}
+
+// sync removes an expired binding, records a warning event for a binding expiring within the warning window, and
+// enqueues the binding again for when it is due.
+func (e *bindingExpirer) sync(kind string, meta *metav1.ObjectMeta, expiresAt *metav1.Time,
+	enqueueAfter func(namespace, name string, after time.Duration), remove func() error) error {
+	if expiresAt == nil {
+		e.forgetWarning(kind, bindingKey(meta))
+		return nil
+	}
+
+	metrics.SetRoleBindingExpiration(kind, meta.Namespace, meta.Name, expiresAt.Time)
+	now := e.now()
+	remaining := expiresAt.Sub(now)
+
+	if remaining <= 0 {
+		logrus.Infof("[%s] Removing %s %s, it expired at %s", bindingExpirationController, kind, bindingKey(meta), expiresAt.UTC().Format(time.RFC3339))
+		if err := remove(); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to remove expired %s %s: %w", kind, bindingKey(meta), err)
+		}
+		metrics.IncRoleBindingsExpired(kind)
+		e.recordEvent(kind, meta, corev1.EventTypeNormal, reasonBindingExpired,
+			fmt.Sprintf("Removed %s, it expired at %s", kind, expiresAt.UTC().Format(time.RFC3339)))
+		return e.forget(kind, bindingKey(meta))
+	}
+
+	warning := expirationWarning()
+	if remaining <= warning {
+		if e.shouldWarn(kind, meta, expiresAt.Time) {
+			e.recordEvent(kind, meta, corev1.EventTypeWarning, reasonBindingExpiring,
+				fmt.Sprintf("%s expires at %s and will be removed", kind, expiresAt.UTC().Format(time.RFC3339)))
+		}
+		enqueueAfter(meta.Namespace, meta.Name, remaining)
+	} else {
+		enqueueAfter(meta.Namespace, meta.Name, remaining-warning)
+	}
+	return nil
+}
+
+// shouldWarn returns true once per expiration of a binding.
+func (e *bindingExpirer) shouldWarn(kind string, meta *metav1.ObjectMeta, expiresAt time.Time) bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	key := kind + "/" + bindingKey(meta)
+	if warned, ok := e.warned[key]; ok && warned.Equal(expiresAt) {
+		return false
+	}
+	e.warned[key] = expiresAt
+	return true
+}
+
+// forget removes the state kept for a removed binding, including its pinned expiration.
+func (e *bindingExpirer) forget(kind, key string) error {
+	e.forgetWarning(kind, key)
+	err := e.configMaps.ConfigMaps(namespaces.System).Delete(context.TODO(), expirationPinName(kind, key), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to remove expiration of %s %s: %w", kind, key, err)
+	}
+	return nil
+}
+
+func (e *bindingExpirer) forgetWarning(kind, key string) {
+	e.lock.Lock()
+	delete(e.warned, kind+"/"+key)
+	e.lock.Unlock()
+
+	namespace, name := "", key
+	if i := strings.Index(key, "/"); i >= 0 {
+		namespace, name = key[:i], key[i+1:]
+	}
+	metrics.UnsetRoleBindingExpiration(kind, namespace, name)
+}
+
+func (e *bindingExpirer) recordEvent(kind string, meta *metav1.ObjectMeta, eventType, reason, message string) {
+	// Events of cluster scoped objects go to the default namespace.
+	namespace := meta.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	now := metav1.NewTime(e.now())
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: meta.Name + ".",
+			Namespace:    namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: v3.SchemeGroupVersion.String(),
+			Kind:       kind,
+			Namespace:  meta.Namespace,
+			Name:       meta.Name,
+			UID:        meta.UID,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: bindingExpirationController},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := e.events.Events(namespace).Create(context.TODO(), event, metav1.CreateOptions{}); err != nil {
+		logrus.Warnf("[%s] Failed to record %s event for %s %s: %v", bindingExpirationController, reason, kind, bindingKey(meta), err)
+	}
+}
+
+func bindingKey(meta *metav1.ObjectMeta) string {
+	if meta.Namespace == "" {
+		return meta.Name
+	}
+	return meta.Namespace + "/" + meta.Name
+}
+
+func expirationWarning() time.Duration {
+	warning, err := time.ParseDuration(settings.RoleBindingExpirationWarning.Get())
+	if err != nil || warning < 0 {
+		logrus.Warnf("Invalid %s setting %q, using %v", settings.RoleBindingExpirationWarning.Name, settings.RoleBindingExpirationWarning.Get(), defaultExpirationWarning)
+		return defaultExpirationWarning
+	}
+	return warning
+}
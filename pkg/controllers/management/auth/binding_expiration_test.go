@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	v3 "github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/generated/norman/management.cattle.io/v3/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestBindingExpirerGRB(t *testing.T) {
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	var deleted []string
+	var enqueued []time.Duration
+	clientset := k8sfake.NewSimpleClientset()
+	// the fake clientset does not generate names
+	var created int
+	clientset.PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		created++
+		event := action.(k8stesting.CreateAction).GetObject().(*corev1.Event)
+		event.Name = event.GenerateName + strconv.Itoa(created)
+		return false, nil, nil
+	})
+	expirer := &bindingExpirer{
+		grbs: &fakes.GlobalRoleBindingInterfaceMock{
+			DeleteFunc: func(name string, options *metav1.DeleteOptions) error {
+				deleted = append(deleted, name)
+				return nil
+			},
+			UpdateFunc: func(obj *v3.GlobalRoleBinding) (*v3.GlobalRoleBinding, error) {
+				return obj, nil
+			},
+			ControllerFunc: func() v3.GlobalRoleBindingController {
+				return &fakes.GlobalRoleBindingControllerMock{
+					EnqueueAfterFunc: func(namespace, name string, after time.Duration) {
+						enqueued = append(enqueued, after)
+					},
+				}
+			},
+		},
+		events:     clientset.CoreV1(),
+		configMaps: clientset.CoreV1(),
+		now:        func() time.Time { return now },
+		warned:     map[string]time.Time{},
+	}
+	grb := &v3.GlobalRoleBinding{
+		ObjectMeta:     metav1.ObjectMeta{Name: "grb-abc"},
+		GlobalRoleName: "admin",
+	}
+
+	// no expiration
+	_, err := expirer.syncGRB(grb.Name, grb)
+	require.NoError(t, err)
+	assert.Empty(t, enqueued)
+
+	// outside of the warning window the binding is enqueued for when the window starts
+	grb.ExpiresAt = &metav1.Time{Time: now.Add(72 * time.Hour)}
+	_, err = expirer.syncGRB(grb.Name, grb)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{48 * time.Hour}, enqueued)
+
+	// within the warning window a warning is recorded once
+	grb.ExpiresAt = &metav1.Time{Time: now.Add(time.Hour)}
+	for i := 0; i < 2; i++ {
+		_, err = expirer.syncGRB(grb.Name, grb)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, time.Hour, enqueued[len(enqueued)-1])
+	events, err := clientset.CoreV1().Events(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, events.Items, 1)
+	assert.Equal(t, reasonBindingExpiring, events.Items[0].Reason)
+	assert.Equal(t, "GlobalRoleBinding", events.Items[0].InvolvedObject.Kind)
+	assert.Empty(t, deleted)
+
+	// expired
+	now = now.Add(time.Hour)
+	_, err = expirer.syncGRB(grb.Name, grb)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"grb-abc"}, deleted)
+	events, err = clientset.CoreV1().Events(metav1.NamespaceDefault).List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, events.Items, 2)
+}
+
+func TestBindingExpirerGRBPinnedExpiration(t *testing.T) {
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	var updated []*v3.GlobalRoleBinding
+	clientset := k8sfake.NewSimpleClientset()
+	expirer := &bindingExpirer{
+		grbs: &fakes.GlobalRoleBindingInterfaceMock{
+			UpdateFunc: func(obj *v3.GlobalRoleBinding) (*v3.GlobalRoleBinding, error) {
+				updated = append(updated, obj)
+				return obj, nil
+			},
+			ControllerFunc: func() v3.GlobalRoleBindingController {
+				return &fakes.GlobalRoleBindingControllerMock{
+					EnqueueAfterFunc: func(namespace, name string, after time.Duration) {},
+				}
+			},
+		},
+		events:     clientset.CoreV1(),
+		configMaps: clientset.CoreV1(),
+		now:        func() time.Time { return now },
+		warned:     map[string]time.Time{},
+	}
+	expiresAt := now.Add(72 * time.Hour)
+	grb := &v3.GlobalRoleBinding{
+		ObjectMeta:     metav1.ObjectMeta{Name: "grb-abc", UID: "uid-abc"},
+		GlobalRoleName: "admin",
+		ExpiresAt:      &metav1.Time{Time: expiresAt},
+	}
+
+	// the expiration is pinned when first seen, outside of the binding
+	_, err := expirer.syncGRB(grb.Name, grb)
+	require.NoError(t, err)
+	assert.Empty(t, updated, "an unchanged expiration is not updated")
+	pin, err := clientset.CoreV1().ConfigMaps("cattle-system").Get(context.Background(), expirationPinName("GlobalRoleBinding", "grb-abc"), metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{expirationPinKey: "2023-09-04T12:00:00Z", expirationPinUIDKey: "uid-abc"}, pin.Data)
+
+	// an extended expiration is restored
+	extended := grb.DeepCopy()
+	extended.ExpiresAt = &metav1.Time{Time: expiresAt.Add(time.Hour)}
+	_, err = expirer.syncGRB(extended.Name, extended)
+	require.NoError(t, err)
+	require.Len(t, updated, 1)
+	assert.True(t, updated[0].ExpiresAt.Time.Equal(expiresAt))
+
+	// a removed expiration is restored, even without any annotation on the binding
+	removed := grb.DeepCopy()
+	removed.Annotations = nil
+	removed.ExpiresAt = nil
+	_, err = expirer.syncGRB(removed.Name, removed)
+	require.NoError(t, err)
+	require.Len(t, updated, 2)
+	require.NotNil(t, updated[1].ExpiresAt)
+	assert.True(t, updated[1].ExpiresAt.Time.Equal(expiresAt))
+
+	// a shortened expiration is pinned
+	shortened := grb.DeepCopy()
+	shortened.ExpiresAt = &metav1.Time{Time: expiresAt.Add(-time.Hour)}
+	_, err = expirer.syncGRB(shortened.Name, shortened)
+	require.NoError(t, err)
+	assert.Len(t, updated, 2)
+	extended.ExpiresAt = &metav1.Time{Time: expiresAt}
+	_, err = expirer.syncGRB(extended.Name, extended)
+	require.NoError(t, err)
+	require.Len(t, updated, 3)
+	assert.True(t, updated[2].ExpiresAt.Time.Equal(expiresAt.Add(-time.Hour)), "the shortened expiration can't be extended back")
+
+	// the pin is removed with the binding, so a binding recreated with the same name is not bound by it
+	_, err = expirer.syncGRB(grb.Name, nil)
+	require.NoError(t, err)
+	_, err = clientset.CoreV1().ConfigMaps("cattle-system").Get(context.Background(), expirationPinName("GlobalRoleBinding", "grb-abc"), metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// a binding that never expires is left alone
+	updated = nil
+	_, err = expirer.syncGRB("grb-def", &v3.GlobalRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "grb-def"}})
+	require.NoError(t, err)
+	assert.Empty(t, updated)
+}
+
+func TestBindingExpirerRoleTemplateBindingPinnedExpiration(t *testing.T) {
+	now := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(72 * time.Hour)
+	var updatedCRTBs []*v3.ClusterRoleTemplateBinding
+	var updatedPRTBs []*v3.ProjectRoleTemplateBinding
+	clientset := k8sfake.NewSimpleClientset()
+	expirer := &bindingExpirer{
+		crtbs: &fakes.ClusterRoleTemplateBindingInterfaceMock{
+			UpdateFunc: func(obj *v3.ClusterRoleTemplateBinding) (*v3.ClusterRoleTemplateBinding, error) {
+				updatedCRTBs = append(updatedCRTBs, obj)
+				return obj, nil
+			},
+			ControllerFunc: func() v3.ClusterRoleTemplateBindingController {
+				return &fakes.ClusterRoleTemplateBindingControllerMock{
+					EnqueueAfterFunc: func(namespace, name string, after time.Duration) {},
+				}
+			},
+		},
+		prtbs: &fakes.ProjectRoleTemplateBindingInterfaceMock{
+			UpdateFunc: func(obj *v3.ProjectRoleTemplateBinding) (*v3.ProjectRoleTemplateBinding, error) {
+				updatedPRTBs = append(updatedPRTBs, obj)
+				return obj, nil
+			},
+			ControllerFunc: func() v3.ProjectRoleTemplateBindingController {
+				return &fakes.ProjectRoleTemplateBindingControllerMock{
+					EnqueueAfterFunc: func(namespace, name string, after time.Duration) {},
+				}
+			},
+		},
+		events:     clientset.CoreV1(),
+		configMaps: clientset.CoreV1(),
+		now:        func() time.Time { return now },
+		warned:     map[string]time.Time{},
+	}
+
+	crtb := &v3.ClusterRoleTemplateBinding{
+		ObjectMeta:       metav1.ObjectMeta{Name: "crtb-abc", Namespace: "c-abc", UID: "uid-crtb"},
+		RoleTemplateName: "cluster-owner",
+		ExpiresAt:        &metav1.Time{Time: expiresAt},
+	}
+	_, err := expirer.syncCRTB("c-abc/crtb-abc", crtb)
+	require.NoError(t, err)
+	crtb.ExpiresAt = &metav1.Time{Time: expiresAt.Add(30 * 24 * time.Hour)}
+	_, err = expirer.syncCRTB("c-abc/crtb-abc", crtb)
+	require.NoError(t, err)
+	require.Len(t, updatedCRTBs, 1, "a cluster owner can't extend its own binding")
+	assert.True(t, updatedCRTBs[0].ExpiresAt.Time.Equal(expiresAt))
+
+	prtb := &v3.ProjectRoleTemplateBinding{
+		ObjectMeta:       metav1.ObjectMeta{Name: "prtb-abc", Namespace: "p-abc", UID: "uid-prtb"},
+		RoleTemplateName: "project-owner",
+		ExpiresAt:        &metav1.Time{Time: expiresAt},
+	}
+	_, err = expirer.syncPRTB("p-abc/prtb-abc", prtb)
+	require.NoError(t, err)
+	prtb.ExpiresAt = nil
+	_, err = expirer.syncPRTB("p-abc/prtb-abc", prtb)
+	require.NoError(t, err)
+	require.Len(t, updatedPRTBs, 1, "a project owner can't remove the expiration of its own binding")
+	require.NotNil(t, updatedPRTBs[0].ExpiresAt)
+	assert.True(t, updatedPRTBs[0].ExpiresAt.Time.Equal(expiresAt))
+}
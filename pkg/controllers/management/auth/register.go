@@ -68,6 +68,7 @@ func RegisterEarly(ctx context.Context, management *config.ManagementContext, cl
 	rt := newRoleTemplateLifecycle(management, clusterManager)
 	grbLegacy := newLegacyGRBCleaner(management)
 	rtLegacy := newLegacyRTCleaner(management)
+	expirer := newBindingExpirer(management)
 
 	management.Management.ClusterRoleTemplateBindings("").AddLifecycle(ctx, ctrbMGMTController, crtb)
 	management.Management.ProjectRoleTemplateBindings("").AddLifecycle(ctx, ptrbMGMTController, prtb)
@@ -84,6 +85,9 @@ func RegisterEarly(ctx context.Context, management *config.ManagementContext, cl
 	management.Management.Settings("").AddHandler(ctx, authSettingController, s.sync)
 	management.Management.GlobalRoleBindings("").AddHandler(ctx, "legacy-grb-cleaner", grbLegacy.sync)
 	management.Management.RoleTemplates("").AddHandler(ctx, "legacy-rt-cleaner", rtLegacy.sync)
+	management.Management.ClusterRoleTemplateBindings("").AddHandler(ctx, bindingExpirationController, expirer.syncCRTB)
+	management.Management.ProjectRoleTemplateBindings("").AddHandler(ctx, bindingExpirationController, expirer.syncPRTB)
+	management.Management.GlobalRoleBindings("").AddHandler(ctx, bindingExpirationController, expirer.syncGRB)
 }
 
 func RegisterLate(ctx context.Context, management *config.ManagementContext) {
@@ -39,6 +39,11 @@ type tokenHandler struct {
 
 // Create is called when a given token is created, and is responsible for creating a ClusterAuthToken in a downstream cluster.
 func (h *tokenHandler) Create(token *managementv3.Token) (runtime.Object, error) {
+	if tokens.IsRestrictedScope(token.Scope) {
+		// the downstream cluster can not enforce the scope, so ACE would bypass it
+		logrus.Warnf("token [%s] will not be synced or useable for ACE because it is scoped", token.Name)
+		return nil, generic.ErrSkip
+	}
 	_, err := h.clusterAuthTokenLister.Get(h.namespace, token.Name)
 	if !errors.IsNotFound(err) {
 		return h.Updated(token)
@@ -106,7 +111,8 @@ func (h *tokenHandler) Updated(token *managementv3.Token) (runtime.Object, error
 		return nil, err
 	}
 
-	tokenEnabled := token.Enabled == nil || *token.Enabled
+	// a token scoped after it was synced is disabled downstream, as ACE would bypass the scope
+	tokenEnabled := (token.Enabled == nil || *token.Enabled) && !tokens.IsRestrictedScope(token.Scope)
 	current := tokenAttributeCompare{
 		enabled:   tokenEnabled,
 		expiresAt: token.ExpiresAt,
@@ -113,6 +113,24 @@ func TestCreate(t *testing.T) {
 			wantClusterAuthToken: true,
 			wantAuthTokenEnabled: true,
 		},
+		{
+			name:               "scoped token, don't create token",
+			token:              setTokenScope(testToken, &v3.TokenScope{Verbs: []string{"get"}}),
+			existingTokenError: authTokenNotFoundError,
+
+			wantClusterAuthToken: false,
+			wantError:            true,
+			wantSkipError:        true,
+		},
+		{
+			name:               "token scoped to clusters only, don't create token",
+			token:              setTokenScope(testToken, &v3.TokenScope{Clusters: []string{"c-abc"}}),
+			existingTokenError: authTokenNotFoundError,
+
+			wantClusterAuthToken: false,
+			wantError:            true,
+			wantSkipError:        true,
+		},
 		{
 			name:                "token hashing enabled, token not hashed yet",
 			token:               testToken,
@@ -262,6 +280,15 @@ func TestUpdate(t *testing.T) {
 			wantAuthTokenEnabled: false,
 			wantAuthTokenUpdate:  true,
 		},
+		{
+			name:                     "token scoped, disable token",
+			token:                    setTokenScope(testToken, &v3.TokenScope{Resources: []string{"pods"}}),
+			existingClusterAuthToken: testAuthToken,
+
+			wantClusterAuthToken: true,
+			wantAuthTokenEnabled: false,
+			wantAuthTokenUpdate:  true,
+		},
 		{
 			name:                     "token enabled missing, no token update",
 			token:                    setTokenEnabled(testToken, nil),
@@ -450,6 +477,12 @@ func setTokenUser(token *managementv3.Token, user string) *managementv3.Token {
 	return newToken
 }
 
+func setTokenScope(token *managementv3.Token, scope *v3.TokenScope) *managementv3.Token {
+	newToken := token.DeepCopy()
+	newToken.Scope = scope
+	return newToken
+}
+
 type testInput struct {
 	Token                    *managementv3.Token
 	ExistingClusterAuthToken *clusterv3.ClusterAuthToken
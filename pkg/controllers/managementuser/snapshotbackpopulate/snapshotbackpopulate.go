@@ -132,6 +132,11 @@ func (h *handler) OnChange(key string, configMap *corev1.ConfigMap) (runtime.Obj
 				storageLocation = StorageS3
 			}
 		}
+		if storageLocation == StorageS3 && existingSnapshotCR.SnapshotFile.S3 != nil && existingSnapshotCR.SnapshotFile.S3.Encryption != nil {
+			// encrypted snapshots are uploaded by the system-agent and are never listed in the configmap, the plansecret
+			// controller deletes their objects once they are no longer in S3
+			continue
+		}
 		snapshotKey := existingSnapshotCR.SnapshotFile.Name + storageLocation
 		// check to see if the snapshot CR we have is found in the etcd-snapshots configmap, and if it is not found in the configmap, mark it as missing
 		if _, ok := actualEtcdSnapshots[snapshotKey]; !ok {
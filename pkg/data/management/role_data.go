@@ -9,6 +9,7 @@
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	v3 "github.com/rancher/rancher/pkg/apis/management.cattle.io/v3"
+	"github.com/rancher/rancher/pkg/auth/providers/local"
 	"github.com/rancher/rancher/pkg/features"
 	"github.com/rancher/rancher/pkg/rbac"
 	"github.com/rancher/rancher/pkg/settings"
@@ -546,6 +547,13 @@ func BootstrapAdmin(management *wrangler.Context) (string, error) {
 
 		bootstrapPasswordHash, _ := bcrypt.GenerateFromPassword([]byte(bootstrapPassword), bcrypt.DefaultCost)
 
+		// A bootstrap password breaking the password policy must be changed on first login.
+		mustChangePassword := bootstrapPasswordIsGenerated || bootstrapPassword == "admin"
+		if err := local.ReadPasswordPolicy().Validate("admin", "", bootstrapPassword, nil); err != nil && !mustChangePassword {
+			logrus.Warnf("The bootstrap password does not satisfy the password policy and must be changed on first login: %v", err)
+			mustChangePassword = true
+		}
+
 		admin, err := management.Mgmt.User().Create(&v3.User{
 			ObjectMeta: v1.ObjectMeta{
 				GenerateName: "user-",
@@ -554,7 +562,7 @@ func BootstrapAdmin(management *wrangler.Context) (string, error) {
 			DisplayName:        "Default Admin",
 			Username:           "admin",
 			Password:           string(bootstrapPasswordHash),
-			MustChangePassword: bootstrapPasswordIsGenerated || bootstrapPassword == "admin",
+			MustChangePassword: mustChangePassword,
 		})
 		if err != nil && !apierrors.IsAlreadyExists(err) {
 			return "", errors.Wrap(err, "can not ensure admin user exists")
@@ -226,6 +226,10 @@ func Register(ctx context.Context, scaledContext *config.ScaledContext) {
 	prometheus.MustRegister(numNodes)
 	prometheus.MustRegister(numCores)
 
+	// role binding expiration metrics
+	prometheus.MustRegister(roleBindingExpiration)
+	prometheus.MustRegister(roleBindingsExpired)
+
 	gc := metricGarbageCollector{
 		clusterLister:  scaledContext.Management.Clusters("").Controller().Lister(),
 		nodeLister:     scaledContext.Management.Nodes("").Controller().Lister(),
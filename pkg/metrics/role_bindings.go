@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	roleBindingExpiration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: "auth",
+			Name:      "role_binding_expiration_timestamp_seconds",
+			Help:      "Time role bindings with an expiration are removed at, in seconds since the epoch",
+		},
+		[]string{"kind", "namespace", "name"},
+	)
+	roleBindingsExpired = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "auth",
+			Name:      "role_bindings_expired_total",
+			Help:      "Number of role bindings removed because they expired",
+		},
+		[]string{"kind"},
+	)
+)
+
+// SetRoleBindingExpiration records the time a role binding expires at.
+func SetRoleBindingExpiration(kind, namespace, name string, expiresAt time.Time) {
+	if prometheusMetrics {
+		roleBindingExpiration.WithLabelValues(kind, namespace, name).Set(float64(expiresAt.Unix()))
+	}
+}
+
+// UnsetRoleBindingExpiration removes the expiration of a role binding that was removed or no longer expires.
+func UnsetRoleBindingExpiration(kind, namespace, name string) {
+	if prometheusMetrics {
+		roleBindingExpiration.DeleteLabelValues(kind, namespace, name)
+	}
+}
+
+// IncRoleBindingsExpired counts a role binding removed because it expired.
+func IncRoleBindingsExpired(kind string) {
+	if prometheusMetrics {
+		roleBindingsExpired.WithLabelValues(kind).Inc()
+	}
+}
@@ -22,6 +22,7 @@
 	"github.com/rancher/rancher/pkg/auth"
 	"github.com/rancher/rancher/pkg/auth/audit"
 	"github.com/rancher/rancher/pkg/auth/requests"
+	"github.com/rancher/rancher/pkg/capr/planner"
 	"github.com/rancher/rancher/pkg/controllers/dashboard"
 	"github.com/rancher/rancher/pkg/controllers/dashboard/apiservice"
 	"github.com/rancher/rancher/pkg/controllers/dashboardapi"
@@ -80,8 +81,18 @@ type Options struct {
 	AuditLogMaxsize   int
 	AuditLogMaxbackup int
 	AuditLevel        int
-	Features          string
-	ClusterRegistry   string
+	// AuditLogSinks selects the audit log destinations: file, stdout, webhook and/or syslog.
+	AuditLogSinks          cli.StringSlice
+	AuditLogWebhookURL     string
+	AuditLogSyslogAddress  string
+	AuditLogSyslogTLS      bool
+	AuditLogSyslogInsecure bool
+	// AuditLogHashChain enables tamper-evident hash chaining of audit records.
+	AuditLogHashChain          bool
+	AuditLogCheckpointKey      string
+	AuditLogCheckpointInterval int
+	Features                   string
+	ClusterRegistry            string
 }
 
 type Rancher struct {
@@ -156,6 +167,9 @@ func New(ctx context.Context, clientConfg clientcmd.ClientConfig, opts *Options)
 	if features.ProvisioningV2.Enabled() {
 		// ensure indexers are registered for all replicas
 		provisioningv2.RegisterIndexers(wranglerContext)
+		if features.RKE2.Enabled() {
+			planner.RegisterIndexers(wranglerContext)
+		}
 	}
 
 	clientSet, err := clientset.NewForConfig(restConfig)
@@ -225,11 +239,32 @@ func New(ctx context.Context, clientConfg clientcmd.ClientConfig, opts *Options)
 		return nil, err
 	}
 
-	auditLogWriter := audit.NewLogWriter(opts.AuditLogPath, audit.Level(opts.AuditLevel), opts.AuditLogMaxage, opts.AuditLogMaxbackup, opts.AuditLogMaxsize)
+	auditLogWriter, err := audit.NewLogWriterFromOptions(audit.WriterOptions{
+		Level:              audit.Level(opts.AuditLevel),
+		Sinks:              opts.AuditLogSinks,
+		Path:               opts.AuditLogPath,
+		MaxAge:             opts.AuditLogMaxage,
+		MaxBackup:          opts.AuditLogMaxbackup,
+		MaxSize:            opts.AuditLogMaxsize,
+		WebhookURL:         opts.AuditLogWebhookURL,
+		SyslogAddress:      opts.AuditLogSyslogAddress,
+		SyslogTLS:          opts.AuditLogSyslogTLS,
+		SyslogInsecure:     opts.AuditLogSyslogInsecure,
+		HashChain:          opts.AuditLogHashChain,
+		CheckpointKeyPath:  opts.AuditLogCheckpointKey,
+		CheckpointInterval: opts.AuditLogCheckpointInterval,
+	})
+	if err != nil {
+		return nil, err
+	}
 	auditFilter, err := audit.NewAuditLogMiddleware(auditLogWriter)
 	if err != nil {
 		return nil, err
 	}
+	auditRedactionPreview, err := audit.NewRedactionPreviewMiddleware(auditLogWriter, wranglerContext.K8s.AuthorizationV1().SubjectAccessReviews(), namespace.System)
+	if err != nil {
+		return nil, err
+	}
 	aggregationMiddleware := aggregation.NewMiddleware(ctx, wranglerContext.Mgmt.APIService(), wranglerContext.TunnelServer)
 
 	return &Rancher{
@@ -239,6 +274,7 @@ func New(ctx context.Context, clientConfg clientcmd.ClientConfig, opts *Options)
 			auth.SetXAPICattleAuthHeader,
 			responsewriter.ContentTypeOptions,
 			responsewriter.NoCache,
+			auditRedactionPreview,
 			websocket.NewWebsocketHandler,
 			proxy.RewriteLocalCluster,
 			clusterProxy,
@@ -293,6 +329,7 @@ func (r *Rancher) Start(ctx context.Context) error {
 
 	r.Wrangler.OnLeader(r.authServer.OnLeader)
 	r.auditLog.Start(ctx)
+	audit.WatchPolicy(ctx, r.Wrangler.Core.ConfigMap(), namespace.System, r.auditLog)
 
 	return r.Wrangler.Start(ctx)
 }
@@ -464,6 +464,8 @@ func authnTypes(schemas *types.Schemas) *types.Schemas {
 		MustImport(&Version, v3.SearchPrincipalsInput{}).
 		MustImport(&Version, v3.ChangePasswordInput{}).
 		MustImport(&Version, v3.SetPasswordInput{}).
+		MustImport(&Version, v3.MFACodeInput{}).
+		MustImport(&Version, v3.MFAEnrollment{}).
 		MustImportAndCustomize(&Version, v3.User{}, func(schema *types.Schema) {
 			schema.ResourceActions = map[string]types.Action{
 				"setpassword": {
@@ -471,12 +473,23 @@ func authnTypes(schemas *types.Schemas) *types.Schemas {
 					Output: "user",
 				},
 				"refreshauthprovideraccess": {},
+				"unlock":                    {},
+				"resetmfa":                  {},
 			}
 			schema.CollectionActions = map[string]types.Action{
 				"changepassword": {
 					Input: "changePasswordInput",
 				},
 				"refreshauthprovideraccess": {},
+				"enrollmfa": {
+					Output: "mfaEnrollment",
+				},
+				"confirmmfa": {
+					Input: "mfaCodeInput",
+				},
+				"disablemfa": {
+					Input: "mfaCodeInput",
+				},
 			}
 		}).
 		MustImportAndCustomize(&Version, v3.AuthConfig{}, func(schema *types.Schema) {
@@ -86,6 +86,10 @@
 	MachineVersion                      = NewSetting("machine-version", "dev")
 	Namespace                           = NewSetting("namespace", os.Getenv("CATTLE_NAMESPACE"))
 	PasswordMinLength                   = NewSetting("password-min-length", "12")
+	PasswordMinCharacterClasses         = NewSetting("password-min-character-classes", "0")
+	PasswordDisallowUsername            = NewSetting("password-disallow-username", "false")
+	PasswordHistorySize                 = NewSetting("password-history-size", "0")
+	PasswordMaxAge                      = NewSetting("password-max-age", "")
 	PeerServices                        = NewSetting("peer-service", os.Getenv("CATTLE_PEER_SERVICE"))
 	RDNSServerBaseURL                   = NewSetting("rdns-base-url", "https://api.lb.rancher.cloud/v1")
 	RkeVersion                          = NewSetting("rke-version", "")
@@ -145,6 +149,48 @@
 	// AuthUserSessionTTLMinutes represents the time to live for tokens used for login sessions in minutes.
 	AuthUserSessionTTLMinutes = NewSetting("auth-user-session-ttl-minutes", "960") // 16 hours
 
+	// AuthLocalLockoutAttempts is the number of failed logins to the local auth provider for a username within
+	// AuthLocalLockoutDuration after which the user is locked out for AuthLocalLockoutDuration.
+	// Failed logins are counted in memory per replica, the lockout applies to all replicas.
+	// A zero value means users are never locked out. It is the default, as anyone can lock out a known username, e.g. admin.
+	AuthLocalLockoutAttempts = NewSetting("auth-local-lockout-attempts", "0")
+
+	// AuthLocalLockoutDuration is both the window failed logins are counted in and the time a user or source IP is locked out for.
+	// The value should be expressed in valid time.Duration units e.g. "15m". See https://pkg.go.dev/time#ParseDuration
+	AuthLocalLockoutDuration = NewSetting("auth-local-lockout-duration", "15m")
+
+	// AuthLocalLockoutAttemptsPerIP is the number of failed logins to the local auth provider from a source IP, for any
+	// username, within AuthLocalLockoutDuration after which logins from that IP are rejected for AuthLocalLockoutDuration.
+	// Failed logins and throttled source IPs are kept in memory per replica.
+	// A zero value means source IPs are never throttled. It is the default, as without AuthLocalLockoutTrustedProxies
+	// the source IP of logins through a proxy or load balancer is the one of the proxy.
+	AuthLocalLockoutAttemptsPerIP = NewSetting("auth-local-lockout-attempts-per-ip", "0")
+
+	// AuthLocalLockoutTrustedProxies is a comma separated list of the IP addresses and CIDRs of the proxies in front of
+	// Rancher, e.g. "10.42.0.0/16". The X-Forwarded-For header is only used to determine the source IP of logins, and
+	// the IP tokens were last used from, for requests coming from these proxies.
+	AuthLocalLockoutTrustedProxies = NewSetting("auth-local-lockout-trusted-proxies", "")
+
+	// AuthLocalMFARequiredForAdmins requires local users bound to an admin GlobalRole to log in with a TOTP code. Admins
+	// who have not enrolled can't log in once it is enabled, so they should enroll first. If all admins are locked out the
+	// setting can be reset with kubectl.
+	AuthLocalMFARequiredForAdmins = NewSetting("auth-local-mfa-required-for-admins", "false")
+
+	// RoleBindingExpirationWarning is how long before a role binding with an expiration is removed a warning event is
+	// recorded for it. The value should be expressed in valid time.Duration units e.g. "24h".
+	RoleBindingExpirationWarning = NewSetting("role-binding-expiration-warning", "24h")
+
+	// MachinePlanHistoryLimit is the number of applied plans kept in the plan history of each machine provisioned with
+	// RKE2/K3s. 0 disables the plan history.
+	MachinePlanHistoryLimit = NewSetting("machine-plan-history-limit", "10")
+
+	// DisableUnusedTokensAfter is the duration a token can go unused after which it's disabled by the token purge daemon.
+	// The value should be expressed in valid time.Duration units e.g. "2160h". See https://pkg.go.dev/time#ParseDuration
+	// Tokens that were never used count as used when they were created. Tokens of clusters with the authorized cluster
+	// endpoint enabled are never disabled, as their uses through the endpoint are not recorded.
+	// An empty string or a zero value means the feature is disabled.
+	DisableUnusedTokensAfter = NewSetting("disable-unused-tokens-after", "")
+
 	// DisableInactiveUserAfter is the duration a user can be inactive after which it's disabled by the user retention process.
 	// The value should be expressed in valid time.Duration units and truncated to a second e.g. "168h". See https://pkg.go.dev/time#ParseDuration
 	// DisableInactiveUserAfter should be greater than AuthUserSessionTTLMinutes.
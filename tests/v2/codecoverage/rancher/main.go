@@ -13,6 +13,7 @@
 	"github.com/ehazlett/simplelog"
 	_ "github.com/rancher/norman/controller"
 	"github.com/rancher/norman/pkg/kwrapper/k8s"
+	"github.com/rancher/rancher/pkg/auth/audit"
 	"github.com/rancher/rancher/pkg/data/management"
 	"github.com/rancher/rancher/pkg/logserver"
 	"github.com/rancher/rancher/pkg/rancher"
@@ -41,6 +42,7 @@ func main() {
 func runRancher(ctx context.Context) error {
 	management.RegisterPasswordResetCommand()
 	management.RegisterEnsureDefaultAdminCommand()
+	audit.RegisterVerifyCommand()
 	if reexec.Init() {
 		return nil
 	}
@@ -158,6 +160,55 @@ func runRancher(ctx context.Context) error {
 			Usage:       "Audit log level: 0 - disable audit log, 1 - log event metadata, 2 - log event metadata and request body, 3 - log event metadata, request body and response body",
 			Destination: &config.AuditLevel,
 		},
+		cli.StringSliceFlag{
+			Name:   "audit-log-sink",
+			EnvVar: "AUDIT_LOG_SINKS",
+			Usage:  "Audit log destinations, may be repeated: file, stdout, webhook, syslog. Defaults to file",
+			Value:  &config.AuditLogSinks,
+		},
+		cli.StringFlag{
+			Name:        "audit-log-webhook-url",
+			EnvVar:      "AUDIT_LOG_WEBHOOK_URL",
+			Usage:       "URL that batches of audit events are POSTed to when the webhook sink is enabled",
+			Destination: &config.AuditLogWebhookURL,
+		},
+		cli.StringFlag{
+			Name:        "audit-log-syslog-address",
+			EnvVar:      "AUDIT_LOG_SYSLOG_ADDRESS",
+			Usage:       "host:port of the RFC5424 syslog receiver used when the syslog sink is enabled",
+			Destination: &config.AuditLogSyslogAddress,
+		},
+		cli.BoolFlag{
+			Name:        "audit-log-syslog-tls",
+			EnvVar:      "AUDIT_LOG_SYSLOG_TLS",
+			Usage:       "Connect to the syslog receiver using TLS",
+			Destination: &config.AuditLogSyslogTLS,
+		},
+		cli.BoolFlag{
+			Name:        "audit-log-syslog-insecure",
+			EnvVar:      "AUDIT_LOG_SYSLOG_INSECURE",
+			Usage:       "Skip verification of the syslog receiver's TLS certificate",
+			Destination: &config.AuditLogSyslogInsecure,
+		},
+		cli.BoolFlag{
+			Name:        "audit-log-hash-chain",
+			EnvVar:      "AUDIT_LOG_HASH_CHAIN",
+			Usage:       "Add a sequence number and the hash of the previous record to every audit record so modifications can be detected with verify-audit-log",
+			Destination: &config.AuditLogHashChain,
+		},
+		cli.StringFlag{
+			Name:        "audit-log-checkpoint-key",
+			EnvVar:      "AUDIT_LOG_CHECKPOINT_KEY",
+			Usage:       "Path to a PEM encoded ed25519 private key used to sign periodic checkpoints in the audit log hash chain",
+			Destination: &config.AuditLogCheckpointKey,
+		},
+		cli.IntFlag{
+			Name:        "audit-log-checkpoint-interval",
+			Value:       1000,
+			EnvVar:      "AUDIT_LOG_CHECKPOINT_INTERVAL",
+			Usage:       "Number of audit records between signed checkpoints",
+			Destination: &config.AuditLogCheckpointInterval,
+		},
 		cli.StringFlag{
 			Name:        "profile-listen-address",
 			Value:       "127.0.0.1:6060",